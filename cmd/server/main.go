@@ -2,11 +2,17 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/mail"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
@@ -16,14 +22,20 @@ import (
 	"github.com/spf13/viper"
 	"github.com/tyemirov/tauth/internal/authkit"
 	"github.com/tyemirov/tauth/internal/web"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
 	webassets "github.com/tyemirov/tauth/web"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 )
 
 var serveHTTP = func(server *http.Server) error {
 	return server.ListenAndServe()
 }
 
+var serveGRPC = func(grpcServer *grpc.Server, listener net.Listener) error {
+	return grpcServer.Serve(listener)
+}
+
 var buildGoogleTokenValidator = func(ctx context.Context) (authkit.GoogleTokenValidator, error) {
 	return authkit.NewGoogleTokenValidator(ctx)
 }
@@ -37,34 +49,112 @@ func main() {
 func newRootCommand() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:     "tauth",
-		Short:   "Auth service with Google Sign-In verification, JWT sessions, and rotating refresh tokens",
+		Short:   "Auth service with Google Sign-In and OpenID Connect verification, JWT sessions, and rotating refresh tokens",
 		PreRunE: prepareServerConfig,
 		RunE:    runServer,
 	}
 
-	rootCmd.Flags().String("listen_addr", ":8080", "HTTP listen address")
-	rootCmd.Flags().String("cookie_domain", "", "Cookie domain; empty for host-only")
-	rootCmd.Flags().String("google_web_client_id", "", "Google Web OAuth Client ID")
-	rootCmd.Flags().String("jwt_signing_key", "", "HS256 signing secret for access JWT")
-	rootCmd.Flags().Duration("session_ttl", 15*time.Minute, "Access token TTL")
-	rootCmd.Flags().Duration("refresh_ttl", 60*24*time.Hour, "Refresh token TTL")
-	rootCmd.Flags().Bool("dev_insecure_http", false, "Allow insecure HTTP for local dev")
-	rootCmd.Flags().String("database_url", "", "Database URL for refresh tokens (postgres:// or sqlite://; leave empty for in-memory store)")
-	rootCmd.Flags().Bool("enable_cors", false, "Enable permissive CORS (only if serving cross-origin UI)")
-	rootCmd.Flags().StringSlice("cors_allowed_origins", []string{}, "Allowed origins when CORS is enabled (required if enable_cors is true)")
-	rootCmd.Flags().Duration("nonce_ttl", 5*time.Minute, "Nonce lifetime for Google Sign-In exchanges")
-
-	_ = viper.BindPFlag("listen_addr", rootCmd.Flags().Lookup("listen_addr"))
-	_ = viper.BindPFlag("cookie_domain", rootCmd.Flags().Lookup("cookie_domain"))
-	_ = viper.BindPFlag("google_web_client_id", rootCmd.Flags().Lookup("google_web_client_id"))
-	_ = viper.BindPFlag("jwt_signing_key", rootCmd.Flags().Lookup("jwt_signing_key"))
-	_ = viper.BindPFlag("session_ttl", rootCmd.Flags().Lookup("session_ttl"))
-	_ = viper.BindPFlag("refresh_ttl", rootCmd.Flags().Lookup("refresh_ttl"))
-	_ = viper.BindPFlag("dev_insecure_http", rootCmd.Flags().Lookup("dev_insecure_http"))
-	_ = viper.BindPFlag("database_url", rootCmd.Flags().Lookup("database_url"))
-	_ = viper.BindPFlag("enable_cors", rootCmd.Flags().Lookup("enable_cors"))
-	_ = viper.BindPFlag("cors_allowed_origins", rootCmd.Flags().Lookup("cors_allowed_origins"))
-	_ = viper.BindPFlag("nonce_ttl", rootCmd.Flags().Lookup("nonce_ttl"))
+	rootCmd.PersistentFlags().String("listen_addr", ":8080", "HTTP listen address")
+	rootCmd.PersistentFlags().String("cookie_domain", "", "Cookie domain; empty for host-only")
+	rootCmd.PersistentFlags().String("google_web_client_id", "", "Google Web OAuth Client ID")
+	rootCmd.PersistentFlags().String("google_web_client_secret", "", "Google Web OAuth client secret; enables the authorization code login at /auth/login/google")
+	rootCmd.PersistentFlags().String("oidc_providers_file", "", "JSON file of additional OpenID Connect providers (issuer, JWKS URL, client IDs, claim mappings) accepted by POST /auth/{provider}")
+	rootCmd.PersistentFlags().String("jwt_signing_key", "", "HS256 signing secret for access JWT")
+	rootCmd.PersistentFlags().String("jwt_private_key_file", "", "PEM-encoded RSA, ECDSA, or Ed25519 private key for asymmetric access JWT signing (overrides jwt_signing_key)")
+	rootCmd.PersistentFlags().String("jwt_signing_key_id", "", "Key ID (kid) advertised for the signing key; derived from the key when empty")
+	rootCmd.PersistentFlags().String("jwt_keyring_file", "", "JSON keyring of active, verify_only, and retired signing keys (overrides jwt_signing_key and jwt_private_key_file)")
+	rootCmd.PersistentFlags().String("jwt_issuer", "mprlab-auth", "Issuer (iss) claim of access JWTs, advertised by the OpenID discovery document")
+	rootCmd.PersistentFlags().StringSlice("jwt_encryption_keys", []string{}, "Base64-encoded 256-bit keys for encrypting session tokens as JWE (dir/A256GCM); the first encrypts, all decrypt")
+	rootCmd.PersistentFlags().StringSlice("jwt_audience", []string{}, "Audience (aud) values embedded in access JWTs so downstream services only accept sessions scoped to them")
+	rootCmd.PersistentFlags().String("public_base_url", "", "Externally visible base URL used in the OpenID discovery document; derived from each request when empty")
+	rootCmd.PersistentFlags().Duration("session_ttl", 15*time.Minute, "Access token TTL")
+	rootCmd.PersistentFlags().Duration("refresh_ttl", 60*24*time.Hour, "Refresh token TTL")
+	rootCmd.PersistentFlags().Bool("dev_insecure_http", false, "Allow insecure HTTP for local dev")
+	rootCmd.PersistentFlags().String("database_url", "", "Database URL for refresh tokens (postgres:// or sqlite://; leave empty for in-memory store)")
+	rootCmd.PersistentFlags().Bool("enable_cors", false, "Enable permissive CORS (only if serving cross-origin UI)")
+	rootCmd.PersistentFlags().StringSlice("cors_allowed_origins", []string{}, "Allowed origins when CORS is enabled (required if enable_cors is true)")
+	rootCmd.PersistentFlags().Duration("nonce_ttl", 5*time.Minute, "Nonce lifetime for Google Sign-In exchanges")
+	rootCmd.PersistentFlags().String("ext_authz_listen_addr", "", "Listen address of the Envoy ext_authz gRPC server; empty disables it")
+	rootCmd.PersistentFlags().String("forward_auth_login_url", "", "Login URL (absolute or path) that /auth/verify redirects unauthenticated browsers to, with return_to set to the original URL")
+	rootCmd.PersistentFlags().StringSlice("return_to_origins", []string{}, "Origins besides TAuth's own that /auth/callback/{provider} may redirect to through return_to")
+	rootCmd.PersistentFlags().String("smtp_addr", "", "SMTP relay (host:port) for sign-in emails; enables POST /auth/email/start")
+	rootCmd.PersistentFlags().String("smtp_username", "", "SMTP username (PLAIN auth over STARTTLS)")
+	rootCmd.PersistentFlags().String("smtp_password", "", "SMTP password")
+	rootCmd.PersistentFlags().String("email_from", "", "Sender address of sign-in emails")
+	rootCmd.PersistentFlags().String("email_outbox_file", "", "Development only: append sign-in emails to this file (\"-\" for standard error) instead of sending them")
+	rootCmd.PersistentFlags().String("email_login_url", "", "Page (absolute URL, or path under public_base_url) that sign-in links open with email_token set")
+	rootCmd.PersistentFlags().Duration("email_login_ttl", 10*time.Minute, "Lifetime of sign-in links and codes")
+	rootCmd.PersistentFlags().String("webauthn_rp_id", "", "WebAuthn relying party ID (the domain passkeys are bound to); enables passkeys under /auth/webauthn/")
+	rootCmd.PersistentFlags().String("webauthn_rp_name", "TAuth", "Relying party name shown by authenticators when registering a passkey")
+	rootCmd.PersistentFlags().StringSlice("webauthn_origins", []string{}, "Origins of the pages that run passkey ceremonies (default https://{webauthn_rp_id})")
+	rootCmd.PersistentFlags().String("totp_issuer", "", "Issuer name shown in authenticator apps; enables TOTP second factors under /auth/mfa/")
+	rootCmd.PersistentFlags().StringSlice("allowed_hosted_domains", []string{}, "Google Workspace domains (hd claim) whose accounts may sign in with Google")
+	rootCmd.PersistentFlags().StringSlice("allowed_email_domains", []string{}, "Email domains whose addresses may sign in")
+	rootCmd.PersistentFlags().StringSlice("denied_email_domains", []string{}, "Email domains whose addresses may not sign in")
+	rootCmd.PersistentFlags().StringSlice("allowed_emails", []string{}, "Email addresses admitted regardless of the domain restrictions")
+	rootCmd.PersistentFlags().String("registration_mode", string(authkit.RegistrationOpen), "Whether signing in may create accounts: open, invite_only, or closed")
+	rootCmd.PersistentFlags().Duration("invitation_ttl", 7*24*time.Hour, "Lifetime of invitations created under invite_only registration")
+	rootCmd.PersistentFlags().StringSlice("device_client_ids", []string{}, "Public client IDs allowed to use the device authorization grant at /auth/device/code and /auth/token")
+	rootCmd.PersistentFlags().Duration("device_code_ttl", 10*time.Minute, "Lifetime of device codes issued by /auth/device/code")
+	rootCmd.PersistentFlags().String("device_login_url", "", "Login page (absolute URL or path) the device verification page redirects to without a session; receives return_to")
+	rootCmd.PersistentFlags().StringSlice("introspection_clients", []string{}, "client_id:secret pairs allowed to call /auth/introspect")
+
+	_ = viper.BindPFlag("listen_addr", rootCmd.PersistentFlags().Lookup("listen_addr"))
+	_ = viper.BindPFlag("cookie_domain", rootCmd.PersistentFlags().Lookup("cookie_domain"))
+	_ = viper.BindPFlag("google_web_client_id", rootCmd.PersistentFlags().Lookup("google_web_client_id"))
+	_ = viper.BindPFlag("google_web_client_secret", rootCmd.PersistentFlags().Lookup("google_web_client_secret"))
+	_ = viper.BindPFlag("oidc_providers_file", rootCmd.PersistentFlags().Lookup("oidc_providers_file"))
+	_ = viper.BindPFlag("jwt_signing_key", rootCmd.PersistentFlags().Lookup("jwt_signing_key"))
+	_ = viper.BindPFlag("jwt_private_key_file", rootCmd.PersistentFlags().Lookup("jwt_private_key_file"))
+	_ = viper.BindPFlag("jwt_signing_key_id", rootCmd.PersistentFlags().Lookup("jwt_signing_key_id"))
+	_ = viper.BindPFlag("jwt_keyring_file", rootCmd.PersistentFlags().Lookup("jwt_keyring_file"))
+	_ = viper.BindPFlag("jwt_issuer", rootCmd.PersistentFlags().Lookup("jwt_issuer"))
+	_ = viper.BindPFlag("jwt_encryption_keys", rootCmd.PersistentFlags().Lookup("jwt_encryption_keys"))
+	_ = viper.BindPFlag("jwt_audience", rootCmd.PersistentFlags().Lookup("jwt_audience"))
+	_ = viper.BindPFlag("public_base_url", rootCmd.PersistentFlags().Lookup("public_base_url"))
+	_ = viper.BindPFlag("session_ttl", rootCmd.PersistentFlags().Lookup("session_ttl"))
+	_ = viper.BindPFlag("refresh_ttl", rootCmd.PersistentFlags().Lookup("refresh_ttl"))
+	_ = viper.BindPFlag("dev_insecure_http", rootCmd.PersistentFlags().Lookup("dev_insecure_http"))
+	_ = viper.BindPFlag("database_url", rootCmd.PersistentFlags().Lookup("database_url"))
+	_ = viper.BindPFlag("enable_cors", rootCmd.PersistentFlags().Lookup("enable_cors"))
+	_ = viper.BindPFlag("cors_allowed_origins", rootCmd.PersistentFlags().Lookup("cors_allowed_origins"))
+	_ = viper.BindPFlag("nonce_ttl", rootCmd.PersistentFlags().Lookup("nonce_ttl"))
+	_ = viper.BindPFlag("ext_authz_listen_addr", rootCmd.PersistentFlags().Lookup("ext_authz_listen_addr"))
+	_ = viper.BindPFlag("forward_auth_login_url", rootCmd.PersistentFlags().Lookup("forward_auth_login_url"))
+	_ = viper.BindPFlag("return_to_origins", rootCmd.PersistentFlags().Lookup("return_to_origins"))
+	_ = viper.BindPFlag("smtp_addr", rootCmd.PersistentFlags().Lookup("smtp_addr"))
+	_ = viper.BindPFlag("smtp_username", rootCmd.PersistentFlags().Lookup("smtp_username"))
+	_ = viper.BindPFlag("smtp_password", rootCmd.PersistentFlags().Lookup("smtp_password"))
+	_ = viper.BindPFlag("email_from", rootCmd.PersistentFlags().Lookup("email_from"))
+	_ = viper.BindPFlag("email_outbox_file", rootCmd.PersistentFlags().Lookup("email_outbox_file"))
+	_ = viper.BindPFlag("email_login_url", rootCmd.PersistentFlags().Lookup("email_login_url"))
+	_ = viper.BindPFlag("email_login_ttl", rootCmd.PersistentFlags().Lookup("email_login_ttl"))
+	_ = viper.BindPFlag("webauthn_rp_id", rootCmd.PersistentFlags().Lookup("webauthn_rp_id"))
+	_ = viper.BindPFlag("webauthn_rp_name", rootCmd.PersistentFlags().Lookup("webauthn_rp_name"))
+	_ = viper.BindPFlag("webauthn_origins", rootCmd.PersistentFlags().Lookup("webauthn_origins"))
+	_ = viper.BindPFlag("totp_issuer", rootCmd.PersistentFlags().Lookup("totp_issuer"))
+	_ = viper.BindPFlag("allowed_hosted_domains", rootCmd.PersistentFlags().Lookup("allowed_hosted_domains"))
+	_ = viper.BindPFlag("allowed_email_domains", rootCmd.PersistentFlags().Lookup("allowed_email_domains"))
+	_ = viper.BindPFlag("denied_email_domains", rootCmd.PersistentFlags().Lookup("denied_email_domains"))
+	_ = viper.BindPFlag("allowed_emails", rootCmd.PersistentFlags().Lookup("allowed_emails"))
+	_ = viper.BindPFlag("registration_mode", rootCmd.PersistentFlags().Lookup("registration_mode"))
+	_ = viper.BindPFlag("invitation_ttl", rootCmd.PersistentFlags().Lookup("invitation_ttl"))
+	_ = viper.BindPFlag("device_client_ids", rootCmd.PersistentFlags().Lookup("device_client_ids"))
+	_ = viper.BindPFlag("device_code_ttl", rootCmd.PersistentFlags().Lookup("device_code_ttl"))
+	_ = viper.BindPFlag("device_login_url", rootCmd.PersistentFlags().Lookup("device_login_url"))
+	_ = viper.BindPFlag("introspection_clients", rootCmd.PersistentFlags().Lookup("introspection_clients"))
+
+	proxyCmd := &cobra.Command{
+		Use:     "proxy",
+		Short:   "Authenticating reverse proxy: serve the auth routes and forward signed-in requests to an upstream with identity headers",
+		PreRunE: prepareServerConfig,
+		RunE:    runProxy,
+	}
+	proxyCmd.Flags().String("upstream_url", "", "Upstream URL that authenticated requests are forwarded to")
+	proxyCmd.Flags().String("proxy_login_url", "", "Login URL (absolute or path) that unauthenticated browsers are redirected to, with return_to set to the original URL")
+	_ = viper.BindPFlag("upstream_url", proxyCmd.Flags().Lookup("upstream_url"))
+	_ = viper.BindPFlag("proxy_login_url", proxyCmd.Flags().Lookup("proxy_login_url"))
+	rootCmd.AddCommand(proxyCmd)
 
 	viper.SetEnvPrefix("APP")
 	viper.AutomaticEnv()
@@ -75,9 +165,26 @@ func newRootCommand() *cobra.Command {
 const (
 	sessionCookieName = "app_session"
 	refreshCookieName = "app_refresh"
+	defaultJWTIssuer  = "mprlab-auth"
 
 	configCodeMissingGoogleClientID   = "config.missing_google_web_client_id"
 	configCodeMissingJWTSigningKey    = "config.missing_jwt_signing_key"
+	configCodeInvalidJWTPrivateKey    = "config.invalid_jwt_private_key"
+	configCodeInvalidJWTKeyring       = "config.invalid_jwt_keyring"
+	configCodeInvalidOIDCProviders    = "config.invalid_oidc_providers"
+	configCodeInvalidPublicBaseURL    = "config.invalid_public_base_url"
+	configCodeInvalidEncryptionKey    = "config.invalid_jwt_encryption_key"
+	configCodeInvalidIntrospection    = "config.invalid_introspection_client"
+	configCodeInvalidForwardAuthLogin = "config.invalid_forward_auth_login_url"
+	configCodeInvalidReturnToOrigin   = "config.invalid_return_to_origin"
+	configCodeInvalidMailer           = "config.invalid_mailer"
+	configCodeInvalidEmailLoginURL    = "config.invalid_email_login_url"
+	configCodeInvalidDeviceLoginURL   = "config.invalid_device_login_url"
+	configCodeInvalidWebAuthn         = "config.invalid_webauthn"
+	configCodeInvalidLoginPolicy      = "config.invalid_login_policy"
+	configCodeInvalidRegistrationMode = "config.invalid_registration_mode"
+	configCodeInvalidUpstreamURL      = "config.invalid_upstream_url"
+	configCodeInvalidProxyLoginURL    = "config.invalid_proxy_login_url"
 	configCodeInvalidSessionTTL       = "config.invalid_session_ttl"
 	configCodeInvalidRefreshTTL       = "config.invalid_refresh_ttl"
 	configCodeUninitializedServerConf = "config.uninitialized_server_config"
@@ -106,14 +213,86 @@ func configError(code, message string) error {
 }
 
 func LoadServerConfig() (authkit.ServerConfig, error) {
+	identityProviders, identityProvidersErr := loadIdentityProviders()
+	if identityProvidersErr != nil {
+		return authkit.ServerConfig{}, identityProvidersErr
+	}
+
+	mailer, mailerErr := loadMailer()
+	if mailerErr != nil {
+		return authkit.ServerConfig{}, mailerErr
+	}
+
 	googleWebClientID := viper.GetString("google_web_client_id")
-	if googleWebClientID == "" {
-		return authkit.ServerConfig{}, configError(configCodeMissingGoogleClientID, "google_web_client_id must be provided")
+	if googleWebClientID == "" && len(identityProviders) == 0 && mailer == nil {
+		return authkit.ServerConfig{}, configError(configCodeMissingGoogleClientID, "google_web_client_id, oidc_providers_file, or a mailer (smtp_addr or email_outbox_file) must be provided")
 	}
 
-	jwtSigningKey := viper.GetString("jwt_signing_key")
-	if jwtSigningKey == "" {
-		return authkit.ServerConfig{}, configError(configCodeMissingJWTSigningKey, "jwt_signing_key must be provided")
+	keyring, keyringErr := loadKeyring()
+	if keyringErr != nil {
+		return authkit.ServerConfig{}, keyringErr
+	}
+
+	jwtIssuer := strings.TrimSpace(viper.GetString("jwt_issuer"))
+	if jwtIssuer == "" {
+		jwtIssuer = defaultJWTIssuer
+	}
+
+	encryptionKeys, encryptionKeysErr := loadEncryptionKeys()
+	if encryptionKeysErr != nil {
+		return authkit.ServerConfig{}, encryptionKeysErr
+	}
+
+	introspectionClients, introspectionClientsErr := loadIntrospectionClients()
+	if introspectionClientsErr != nil {
+		return authkit.ServerConfig{}, introspectionClientsErr
+	}
+
+	forwardAuthLoginURL, forwardAuthLoginURLErr := loadForwardAuthLoginURL()
+	if forwardAuthLoginURLErr != nil {
+		return authkit.ServerConfig{}, forwardAuthLoginURLErr
+	}
+
+	returnToOrigins, returnToOriginsErr := loadReturnToOrigins()
+	if returnToOriginsErr != nil {
+		return authkit.ServerConfig{}, returnToOriginsErr
+	}
+
+	publicBaseURL, publicBaseURLErr := loadPublicBaseURL()
+	if publicBaseURLErr != nil {
+		return authkit.ServerConfig{}, publicBaseURLErr
+	}
+
+	emailLoginURL, emailLoginURLErr := loadLoginURL("email_login_url", configCodeInvalidEmailLoginURL)
+	if emailLoginURLErr != nil {
+		return authkit.ServerConfig{}, emailLoginURLErr
+	}
+	if strings.HasPrefix(emailLoginURL, "/") && publicBaseURL == "" {
+		return authkit.ServerConfig{}, configError(configCodeInvalidEmailLoginURL, "email_login_url must be an absolute URL unless public_base_url is set")
+	}
+
+	deviceLoginURL, deviceLoginURLErr := loadLoginURL("device_login_url", configCodeInvalidDeviceLoginURL)
+	if deviceLoginURLErr != nil {
+		return authkit.ServerConfig{}, deviceLoginURLErr
+	}
+
+	webAuthnRPID, webAuthnOrigins, webAuthnErr := loadWebAuthn()
+	if webAuthnErr != nil {
+		return authkit.ServerConfig{}, webAuthnErr
+	}
+
+	loginPolicy, loginPolicyErr := loadLoginPolicy()
+	if loginPolicyErr != nil {
+		return authkit.ServerConfig{}, loginPolicyErr
+	}
+
+	registrationMode := authkit.RegistrationMode(strings.ToLower(strings.TrimSpace(viper.GetString("registration_mode"))))
+	switch registrationMode {
+	case "":
+		registrationMode = authkit.RegistrationOpen
+	case authkit.RegistrationOpen, authkit.RegistrationInviteOnly, authkit.RegistrationClosed:
+	default:
+		return authkit.ServerConfig{}, configError(configCodeInvalidRegistrationMode, "registration_mode must be open, invite_only, or closed")
 	}
 
 	sessionTTL := viper.GetDuration("session_ttl")
@@ -132,18 +311,390 @@ func LoadServerConfig() (authkit.ServerConfig, error) {
 	}
 
 	return authkit.ServerConfig{
-		GoogleWebClientID: googleWebClientID,
-		AppJWTSigningKey:  []byte(jwtSigningKey),
-		AppJWTIssuer:      "mprlab-auth",
-		CookieDomain:      viper.GetString("cookie_domain"),
-		SessionCookieName: sessionCookieName,
-		RefreshCookieName: refreshCookieName,
-		SessionTTL:        sessionTTL,
-		RefreshTTL:        refreshTTL,
-		NonceTTL:          nonceTTL,
+		GoogleWebClientID:     googleWebClientID,
+		GoogleWebClientSecret: strings.TrimSpace(viper.GetString("google_web_client_secret")),
+		IdentityProviders:     identityProviders,
+		AppJWTKeyring:         keyring,
+		AppJWTIssuer:          jwtIssuer,
+		AppJWTAudience:        configStringSlice("jwt_audience"),
+		AppJWTEncryptionKeys:  encryptionKeys,
+		PublicBaseURL:         publicBaseURL,
+		CookieDomain:          viper.GetString("cookie_domain"),
+		SessionCookieName:     sessionCookieName,
+		RefreshCookieName:     refreshCookieName,
+		SessionTTL:            sessionTTL,
+		RefreshTTL:            refreshTTL,
+		NonceTTL:              nonceTTL,
+		IntrospectionClients:  introspectionClients,
+		ForwardAuthLoginURL:   forwardAuthLoginURL,
+		ReturnToOrigins:       returnToOrigins,
+		Mailer:                mailer,
+		EmailLoginURL:         emailLoginURL,
+		EmailLoginTTL:         viper.GetDuration("email_login_ttl"),
+		WebAuthnRPID:          webAuthnRPID,
+		WebAuthnRPName:        strings.TrimSpace(viper.GetString("webauthn_rp_name")),
+		WebAuthnOrigins:       webAuthnOrigins,
+		TOTPIssuer:            strings.TrimSpace(viper.GetString("totp_issuer")),
+		LoginPolicy:           loginPolicy,
+		RegistrationMode:      registrationMode,
+		InvitationTTL:         viper.GetDuration("invitation_ttl"),
+		DeviceClientIDs:       configStringSlice("device_client_ids"),
+		DeviceCodeTTL:         viper.GetDuration("device_code_ttl"),
+		DeviceLoginURL:        deviceLoginURL,
 	}, nil
 }
 
+// oidcProvidersDocument is the on-disk format accepted by --oidc_providers_file.
+type oidcProvidersDocument struct {
+	Providers []struct {
+		Name             string                `json:"name"`
+		Issuer           string                `json:"issuer"`
+		JWKSURL          string                `json:"jwks_url"`
+		ClientIDs        []string              `json:"client_ids"`
+		Claims           authkit.ClaimMappings `json:"claims"`
+		TrustEmail       bool                  `json:"trust_email"`
+		AuthorizationURL string                `json:"authorization_url"`
+		TokenURL         string                `json:"token_url"`
+		ClientSecret     string                `json:"client_secret"`
+		Scopes           []string              `json:"scopes"`
+	} `json:"providers"`
+}
+
+func loadIdentityProviders() ([]authkit.IdentityProvider, error) {
+	path := strings.TrimSpace(viper.GetString("oidc_providers_file"))
+	if path == "" {
+		return nil, nil
+	}
+	contents, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return nil, configError(configCodeInvalidOIDCProviders, readErr.Error())
+	}
+	var document oidcProvidersDocument
+	if decodeErr := json.Unmarshal(contents, &document); decodeErr != nil {
+		return nil, configError(configCodeInvalidOIDCProviders, decodeErr.Error())
+	}
+	providers := make([]authkit.IdentityProvider, 0, len(document.Providers))
+	seenNames := make(map[string]bool, len(document.Providers))
+	for _, entry := range document.Providers {
+		if seenNames[entry.Name] {
+			return nil, configError(configCodeInvalidOIDCProviders, fmt.Sprintf("provider %q is listed twice", entry.Name))
+		}
+		seenNames[entry.Name] = true
+		provider, providerErr := authkit.NewOIDCProvider(authkit.OIDCProviderConfig{
+			Name:             entry.Name,
+			Issuer:           entry.Issuer,
+			JWKSURL:          entry.JWKSURL,
+			ClientIDs:        entry.ClientIDs,
+			ClaimMappings:    entry.Claims,
+			TrustEmail:       entry.TrustEmail,
+			AuthorizationURL: entry.AuthorizationURL,
+			TokenURL:         entry.TokenURL,
+			ClientSecret:     entry.ClientSecret,
+			Scopes:           entry.Scopes,
+		})
+		if providerErr != nil {
+			return nil, configError(configCodeInvalidOIDCProviders, providerErr.Error())
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+func loadEncryptionKeys() ([]sessionvalidator.EncryptionKey, error) {
+	encodedKeys := configStringSlice("jwt_encryption_keys")
+	encryptionKeys := make([]sessionvalidator.EncryptionKey, 0, len(encodedKeys))
+	for index, encodedKey := range encodedKeys {
+		rawKey, decodeErr := base64.StdEncoding.DecodeString(encodedKey)
+		if decodeErr != nil {
+			rawKey, decodeErr = base64.RawURLEncoding.DecodeString(encodedKey)
+		}
+		if decodeErr != nil {
+			return nil, configError(configCodeInvalidEncryptionKey, fmt.Sprintf("jwt_encryption_keys[%d] must be base64-encoded", index))
+		}
+		encryptionKey, keyErr := sessionvalidator.NewEncryptionKey(rawKey)
+		if keyErr != nil {
+			return nil, configError(configCodeInvalidEncryptionKey, fmt.Sprintf("jwt_encryption_keys[%d] must decode to %d bytes", index, sessionvalidator.EncryptionKeySize))
+		}
+		encryptionKeys = append(encryptionKeys, encryptionKey)
+	}
+	return encryptionKeys, nil
+}
+
+func loadIntrospectionClients() ([]authkit.ClientCredential, error) {
+	entries := configStringSlice("introspection_clients")
+	clients := make([]authkit.ClientCredential, 0, len(entries))
+	for index, entry := range entries {
+		clientID, secret, _ := strings.Cut(entry, ":")
+		client, clientErr := authkit.NewClientCredential(clientID, secret)
+		if clientErr != nil {
+			return nil, configError(configCodeInvalidIntrospection, fmt.Sprintf("introspection_clients[%d] must be client_id:secret", index))
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+func loadForwardAuthLoginURL() (string, error) {
+	return loadLoginURL("forward_auth_login_url", configCodeInvalidForwardAuthLogin)
+}
+
+// loadLoginURL accepts an absolute http(s) URL or a same-origin path.
+func loadLoginURL(key string, code string) (string, error) {
+	rawURL := strings.TrimSpace(viper.GetString(key))
+	if rawURL == "" {
+		return "", nil
+	}
+	parsedURL, parseErr := url.Parse(rawURL)
+	isPath := parseErr == nil && parsedURL.Scheme == "" && parsedURL.Host == "" && strings.HasPrefix(parsedURL.Path, "/")
+	isAbsolute := parseErr == nil && (parsedURL.Scheme == "https" || parsedURL.Scheme == "http") && parsedURL.Host != ""
+	if (!isPath && !isAbsolute) || parsedURL.Fragment != "" {
+		return "", configError(code, key+" must be an absolute http(s) URL or a path without fragment")
+	}
+	return parsedURL.String(), nil
+}
+
+// loadMailer builds the SMTP mailer, or the development outbox writer, that
+// enables email sign-in. Neither configured leaves email sign-in disabled.
+func loadMailer() (authkit.Mailer, error) {
+	smtpAddress := strings.TrimSpace(viper.GetString("smtp_addr"))
+	outboxPath := strings.TrimSpace(viper.GetString("email_outbox_file"))
+	sender := strings.TrimSpace(viper.GetString("email_from"))
+	switch {
+	case smtpAddress != "" && outboxPath != "":
+		return nil, configError(configCodeInvalidMailer, "smtp_addr and email_outbox_file are mutually exclusive")
+	case outboxPath == "-":
+		return authkit.NewWriterMailer(os.Stderr, sender), nil
+	case outboxPath != "":
+		outbox, openErr := os.OpenFile(outboxPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if openErr != nil {
+			return nil, configError(configCodeInvalidMailer, openErr.Error())
+		}
+		return authkit.NewWriterMailer(outbox, sender), nil
+	case smtpAddress != "":
+		mailer, mailerErr := authkit.NewSMTPMailer(authkit.SMTPConfig{
+			Address:  smtpAddress,
+			Username: viper.GetString("smtp_username"),
+			Password: viper.GetString("smtp_password"),
+			From:     sender,
+		})
+		if mailerErr != nil {
+			return nil, configError(configCodeInvalidMailer, mailerErr.Error())
+		}
+		return mailer, nil
+	}
+	return nil, nil
+}
+
+// loadReturnToOrigins accepts bare http(s) origins and normalizes them to lowercase.
+func loadReturnToOrigins() ([]string, error) {
+	return loadOrigins("return_to_origins", configCodeInvalidReturnToOrigin)
+}
+
+func loadOrigins(key string, code string) ([]string, error) {
+	entries := configStringSlice(key)
+	origins := make([]string, 0, len(entries))
+	for index, entry := range entries {
+		parsedURL, parseErr := url.Parse(strings.TrimRight(entry, "/"))
+		if parseErr != nil || (parsedURL.Scheme != "https" && parsedURL.Scheme != "http") || parsedURL.Host == "" || parsedURL.Path != "" || parsedURL.RawQuery != "" || parsedURL.Fragment != "" || parsedURL.User != nil {
+			return nil, configError(code, fmt.Sprintf("%s[%d] must be an http(s) origin such as https://app.example.com", key, index))
+		}
+		origins = append(origins, parsedURL.Scheme+"://"+strings.ToLower(parsedURL.Host))
+	}
+	return origins, nil
+}
+
+// loadWebAuthn returns the passkey relying party ID and the origins allowed to
+// use it. Every origin must be the relying party ID or one of its subdomains.
+func loadWebAuthn() (string, []string, error) {
+	rpID := strings.ToLower(strings.TrimSpace(viper.GetString("webauthn_rp_id")))
+	origins, originsErr := loadOrigins("webauthn_origins", configCodeInvalidWebAuthn)
+	if originsErr != nil {
+		return "", nil, originsErr
+	}
+	if rpID == "" {
+		if len(origins) > 0 {
+			return "", nil, configError(configCodeInvalidWebAuthn, "webauthn_origins requires webauthn_rp_id")
+		}
+		return "", nil, nil
+	}
+	if strings.ContainsAny(rpID, ":/?#@") {
+		return "", nil, configError(configCodeInvalidWebAuthn, "webauthn_rp_id must be a domain such as example.com, without scheme or port")
+	}
+	for index, origin := range origins {
+		host := strings.TrimPrefix(strings.TrimPrefix(origin, "https://"), "http://")
+		if hostname, _, splitErr := net.SplitHostPort(host); splitErr == nil {
+			host = hostname
+		}
+		if host != rpID && !strings.HasSuffix(host, "."+rpID) {
+			return "", nil, configError(configCodeInvalidWebAuthn, fmt.Sprintf("webauthn_origins[%d] must be %s or one of its subdomains", index, rpID))
+		}
+	}
+	return rpID, origins, nil
+}
+
+// loadLoginPolicy reads the sign-in restrictions, lowercasing every entry.
+// Domains are bare names such as example.com; emails are plain addresses.
+func loadLoginPolicy() (authkit.LoginPolicy, error) {
+	var policy authkit.LoginPolicy
+	for _, key := range []string{"allowed_hosted_domains", "allowed_email_domains", "denied_email_domains"} {
+		domains := configStringSlice(key)
+		for index, domain := range domains {
+			domain = strings.ToLower(domain)
+			if strings.ContainsAny(domain, "@:/?# ") || !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") {
+				return authkit.LoginPolicy{}, configError(configCodeInvalidLoginPolicy, fmt.Sprintf("%s[%d] must be a domain such as example.com", key, index))
+			}
+			domains[index] = domain
+		}
+		switch key {
+		case "allowed_hosted_domains":
+			policy.AllowedHostedDomains = domains
+		case "allowed_email_domains":
+			policy.AllowedEmailDomains = domains
+		default:
+			policy.DeniedEmailDomains = domains
+		}
+	}
+	emails := configStringSlice("allowed_emails")
+	for index, email := range emails {
+		address, parseErr := mail.ParseAddress(email)
+		if parseErr != nil || address.Address != email {
+			return authkit.LoginPolicy{}, configError(configCodeInvalidLoginPolicy, fmt.Sprintf("allowed_emails[%d] must be an email address", index))
+		}
+		emails[index] = strings.ToLower(email)
+	}
+	policy.AllowedEmails = emails
+	return policy, nil
+}
+
+func loadProxyConfig() (authkit.ProxyConfig, error) {
+	upstreamURL, parseErr := url.Parse(strings.TrimSpace(viper.GetString("upstream_url")))
+	if parseErr != nil || (upstreamURL.Scheme != "https" && upstreamURL.Scheme != "http") || upstreamURL.Host == "" {
+		return authkit.ProxyConfig{}, configError(configCodeInvalidUpstreamURL, "upstream_url must be an absolute http(s) URL")
+	}
+	loginURL, loginURLErr := loadLoginURL("proxy_login_url", configCodeInvalidProxyLoginURL)
+	if loginURLErr != nil {
+		return authkit.ProxyConfig{}, loginURLErr
+	}
+	if loginURL == "" {
+		return authkit.ProxyConfig{}, configError(configCodeInvalidProxyLoginURL, "proxy_login_url must be provided")
+	}
+	return authkit.ProxyConfig{UpstreamURL: upstreamURL, LoginURL: loginURL}, nil
+}
+
+func loadPublicBaseURL() (string, error) {
+	rawURL := strings.TrimSpace(viper.GetString("public_base_url"))
+	if rawURL == "" {
+		return "", nil
+	}
+	parsedURL, parseErr := url.Parse(rawURL)
+	if parseErr != nil || (parsedURL.Scheme != "https" && parsedURL.Scheme != "http") || parsedURL.Host == "" || parsedURL.RawQuery != "" || parsedURL.Fragment != "" {
+		return "", configError(configCodeInvalidPublicBaseURL, "public_base_url must be an absolute http(s) URL without query or fragment")
+	}
+	return strings.TrimRight(parsedURL.String(), "/"), nil
+}
+
+func loadKeyring() (*authkit.Keyring, error) {
+	if keyringFile := viper.GetString("jwt_keyring_file"); keyringFile != "" {
+		return loadKeyringFile(keyringFile)
+	}
+	signingKey, signingKeyErr := loadSigningKey()
+	if signingKeyErr != nil {
+		return nil, signingKeyErr
+	}
+	if keyID := viper.GetString("jwt_signing_key_id"); keyID != "" {
+		var keyIDErr error
+		if signingKey, keyIDErr = signingKey.WithKeyID(keyID); keyIDErr != nil {
+			return nil, configError(configCodeInvalidJWTKeyring, keyIDErr.Error())
+		}
+	}
+	keyring, keyringErr := authkit.NewSingleKeyKeyring(signingKey)
+	if keyringErr != nil {
+		return nil, configError(configCodeInvalidJWTKeyring, keyringErr.Error())
+	}
+	return keyring, nil
+}
+
+// keyringDocument is the on-disk format accepted by --jwt_keyring_file. Key
+// file paths are resolved relative to the keyring file.
+type keyringDocument struct {
+	Keys []struct {
+		KeyID          string            `json:"kid"`
+		Status         authkit.KeyStatus `json:"status"`
+		Secret         string            `json:"secret"`
+		PrivateKeyFile string            `json:"private_key_file"`
+		PublicKeyFile  string            `json:"public_key_file"`
+	} `json:"keys"`
+}
+
+func loadKeyringFile(path string) (*authkit.Keyring, error) {
+	contents, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return nil, configError(configCodeInvalidJWTKeyring, readErr.Error())
+	}
+	var document keyringDocument
+	if decodeErr := json.Unmarshal(contents, &document); decodeErr != nil {
+		return nil, configError(configCodeInvalidJWTKeyring, decodeErr.Error())
+	}
+	baseDir := filepath.Dir(path)
+	entries := make([]authkit.KeyringEntry, 0, len(document.Keys))
+	for _, entry := range document.Keys {
+		var signingKey authkit.SigningKey
+		var keyErr error
+		switch {
+		case entry.PrivateKeyFile != "":
+			signingKey, keyErr = parseKeyFile(baseDir, entry.PrivateKeyFile, authkit.ParsePrivateKeyPEM)
+		case entry.PublicKeyFile != "":
+			signingKey, keyErr = parseKeyFile(baseDir, entry.PublicKeyFile, authkit.ParsePublicKeyPEM)
+		case entry.Secret != "":
+			signingKey, keyErr = authkit.NewHMACSigningKey([]byte(entry.Secret))
+		}
+		if keyErr != nil {
+			return nil, configError(configCodeInvalidJWTKeyring, fmt.Sprintf("%s: %v", entry.KeyID, keyErr))
+		}
+		if signingKey, keyErr = signingKey.WithKeyID(entry.KeyID); keyErr != nil {
+			return nil, configError(configCodeInvalidJWTKeyring, keyErr.Error())
+		}
+		entries = append(entries, authkit.KeyringEntry{Status: entry.Status, Key: signingKey})
+	}
+	keyring, keyringErr := authkit.NewKeyring(entries)
+	if keyringErr != nil {
+		return nil, configError(configCodeInvalidJWTKeyring, keyringErr.Error())
+	}
+	return keyring, nil
+}
+
+func parseKeyFile(baseDir string, path string, parse func([]byte) (authkit.SigningKey, error)) (authkit.SigningKey, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	pemBytes, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return authkit.SigningKey{}, readErr
+	}
+	return parse(pemBytes)
+}
+
+func loadSigningKey() (authkit.SigningKey, error) {
+	privateKeyFile := viper.GetString("jwt_private_key_file")
+	if privateKeyFile != "" {
+		pemBytes, readErr := os.ReadFile(privateKeyFile)
+		if readErr != nil {
+			return authkit.SigningKey{}, configError(configCodeInvalidJWTPrivateKey, readErr.Error())
+		}
+		signingKey, parseErr := authkit.ParsePrivateKeyPEM(pemBytes)
+		if parseErr != nil {
+			return authkit.SigningKey{}, configError(configCodeInvalidJWTPrivateKey, parseErr.Error())
+		}
+		return signingKey, nil
+	}
+
+	jwtSigningKey := viper.GetString("jwt_signing_key")
+	if jwtSigningKey == "" {
+		return authkit.SigningKey{}, configError(configCodeMissingJWTSigningKey, "jwt_signing_key must be provided")
+	}
+	return authkit.NewHMACSigningKey([]byte(jwtSigningKey))
+}
+
 func configStringSlice(key string) []string {
 	return expandCommaSeparatedEntries(viper.GetStringSlice(key))
 }
@@ -162,6 +713,20 @@ func expandCommaSeparatedEntries(entries []string) []string {
 }
 
 func runServer(command *cobra.Command, arguments []string) error {
+	return serve(command, nil)
+}
+
+// runProxy serves the auth routes and forwards every other request to the
+// upstream once the session is authenticated.
+func runProxy(command *cobra.Command, arguments []string) error {
+	proxyConfig, proxyConfigErr := loadProxyConfig()
+	if proxyConfigErr != nil {
+		return proxyConfigErr
+	}
+	return serve(command, &proxyConfig)
+}
+
+func serve(command *cobra.Command, proxyConfig *authkit.ProxyConfig) error {
 	logger, loggerErr := zap.NewProduction()
 	if loggerErr != nil {
 		return loggerErr
@@ -205,32 +770,100 @@ func runServer(command *cobra.Command, arguments []string) error {
 		web.ServeEmbeddedStaticJS(contextGin, webassets.FS, "mpr-sites.js")
 	})
 
-	router.GET("/demo/config.js", func(contextGin *gin.Context) {
-		web.ServeDemoConfig(contextGin, web.DemoConfig{
-			GoogleClientID: serverConfig.GoogleWebClientID,
+	if proxyConfig == nil {
+		router.GET("/demo/config.js", func(contextGin *gin.Context) {
+			web.ServeDemoConfig(contextGin, web.DemoConfig{
+				GoogleClientID: serverConfig.GoogleWebClientID,
+			})
 		})
-	})
 
-	router.GET("/demo", func(contextGin *gin.Context) {
-		contextGin.File("web/demo.html")
-	})
+		router.GET("/demo", func(contextGin *gin.Context) {
+			contextGin.File("web/demo.html")
+		})
+	}
 
 	userStore := web.NewInMemoryUsers()
 	var refreshStore authkit.RefreshTokenStore
+	var revocationStore authkit.SessionRevocationStore
 
 	if databaseURL != "" {
-		persistentStore, storeErr := authkit.NewDatabaseRefreshTokenStore(context.Background(), databaseURL)
+		database, databaseErr := authkit.OpenDatabase(databaseURL)
+		if databaseErr != nil {
+			return databaseErr
+		}
+		persistentStore, storeErr := authkit.NewDatabaseRefreshTokenStore(context.Background(), database)
 		if storeErr != nil {
 			return storeErr
 		}
+		persistentRevocations, revocationsErr := authkit.NewDatabaseSessionRevocationStore(context.Background(), database)
+		if revocationsErr != nil {
+			return revocationsErr
+		}
 		refreshStore = persistentStore
+		revocationStore = persistentRevocations
+		if serverConfig.Mailer != nil {
+			emailLogins, emailLoginsErr := authkit.NewDatabaseEmailLoginStore(context.Background(), database)
+			if emailLoginsErr != nil {
+				return emailLoginsErr
+			}
+			authkit.ProvideEmailLoginStore(emailLogins)
+			defer authkit.ProvideEmailLoginStore(nil)
+		}
+		if serverConfig.WebAuthnRPID != "" {
+			credentials, credentialsErr := authkit.NewDatabaseCredentialStore(context.Background(), database)
+			if credentialsErr != nil {
+				return credentialsErr
+			}
+			authkit.ProvideCredentialStore(credentials)
+			defer authkit.ProvideCredentialStore(nil)
+		}
+		if serverConfig.TOTPIssuer != "" {
+			secondFactors, secondFactorsErr := authkit.NewDatabaseSecondFactorStore(context.Background(), database)
+			if secondFactorsErr != nil {
+				return secondFactorsErr
+			}
+			authkit.ProvideSecondFactorStore(secondFactors)
+			defer authkit.ProvideSecondFactorStore(nil)
+			pendingSecondFactors, pendingSecondFactorsErr := authkit.NewDatabasePendingSecondFactorStore(context.Background(), database)
+			if pendingSecondFactorsErr != nil {
+				return pendingSecondFactorsErr
+			}
+			authkit.ProvidePendingSecondFactorStore(pendingSecondFactors)
+			defer authkit.ProvidePendingSecondFactorStore(nil)
+		}
+		if serverConfig.RegistrationMode == authkit.RegistrationInviteOnly {
+			invitations, invitationsErr := authkit.NewDatabaseInvitationStore(context.Background(), database)
+			if invitationsErr != nil {
+				return invitationsErr
+			}
+			authkit.ProvideInvitationStore(invitations)
+			defer authkit.ProvideInvitationStore(nil)
+		}
+		linkedIdentities, linkedIdentitiesErr := authkit.NewDatabaseLinkedIdentityStore(context.Background(), database)
+		if linkedIdentitiesErr != nil {
+			return linkedIdentitiesErr
+		}
+		authkit.ProvideLinkedIdentityStore(linkedIdentities)
+		defer authkit.ProvideLinkedIdentityStore(nil)
+		if len(serverConfig.DeviceClientIDs) > 0 {
+			deviceAuthorizations, deviceAuthorizationsErr := authkit.NewDatabaseDeviceAuthorizationStore(context.Background(), database)
+			if deviceAuthorizationsErr != nil {
+				return deviceAuthorizationsErr
+			}
+			authkit.ProvideDeviceAuthorizationStore(deviceAuthorizations)
+			defer authkit.ProvideDeviceAuthorizationStore(nil)
+		}
 		logger.Info("using persistent refresh token store", zap.String("driver", persistentStore.Driver()))
 	} else {
 		refreshStore = authkit.NewMemoryRefreshTokenStore()
+		revocationStore = authkit.NewMemorySessionRevocationStore()
 		logger.Info("using in-memory refresh token store")
 	}
 
 	serverConfig.AllowInsecureHTTP = devInsecureHTTP
+	if proxyConfig != nil {
+		serverConfig.RefreshCookiePath = "/"
+	}
 	serverConfig.SameSiteMode = http.SameSiteStrictMode
 	if enableCORS {
 		serverConfig.SameSiteMode = http.SameSiteNoneMode
@@ -238,12 +871,14 @@ func runServer(command *cobra.Command, arguments []string) error {
 
 	nonceStore := authkit.NewMemoryNonceStore(serverConfig.NonceTTL)
 
-	validator, validatorErr := buildGoogleTokenValidator(command.Context())
-	if validatorErr != nil {
-		return fmt.Errorf("%s: %w", configCodeGoogleValidatorInit, validatorErr)
+	if serverConfig.GoogleWebClientID != "" {
+		validator, validatorErr := buildGoogleTokenValidator(command.Context())
+		if validatorErr != nil {
+			return fmt.Errorf("%s: %w", configCodeGoogleValidatorInit, validatorErr)
+		}
+		authkit.ProvideGoogleTokenValidator(validator)
+		defer authkit.ProvideGoogleTokenValidator(nil)
 	}
-	authkit.ProvideGoogleTokenValidator(validator)
-	defer authkit.ProvideGoogleTokenValidator(nil)
 
 	clock := authkit.NewSystemClock()
 	authkit.ProvideClock(clock)
@@ -256,11 +891,23 @@ func runServer(command *cobra.Command, arguments []string) error {
 	authkit.ProvideMetrics(metricsRecorder)
 	defer authkit.ProvideMetrics(nil)
 
+	authkit.ProvideSessionRevocationStore(revocationStore)
+	defer authkit.ProvideSessionRevocationStore(nil)
+
 	authkit.MountAuthRoutes(router, serverConfig, userStore, refreshStore, nonceStore)
 
-	protected := router.Group("/api")
-	protected.Use(authkit.RequireSession(serverConfig))
-	protected.GET("/me", web.HandleWhoAmI(userStore, logger))
+	if proxyConfig != nil {
+		proxyHandler, proxyErr := authkit.NewAuthProxy(serverConfig, *proxyConfig, userStore, refreshStore)
+		if proxyErr != nil {
+			return proxyErr
+		}
+		router.NoRoute(proxyHandler)
+		logger.Info("proxying authenticated requests", zap.String("upstream", proxyConfig.UpstreamURL.Redacted()))
+	} else {
+		protected := router.Group("/api")
+		protected.Use(authkit.RequireSession(serverConfig))
+		protected.GET("/me", web.HandleWhoAmI(userStore, logger))
+	}
 
 	server := &http.Server{
 		Addr:              listenAddr,
@@ -268,6 +915,27 @@ func runServer(command *cobra.Command, arguments []string) error {
 		ReadHeaderTimeout: 10 * time.Second,
 	}
 
+	var extAuthzServer *grpc.Server
+	if extAuthzListenAddr := viper.GetString("ext_authz_listen_addr"); extAuthzListenAddr != "" {
+		authorizationServer, authorizationErr := authkit.NewExtAuthzServer(serverConfig)
+		if authorizationErr != nil {
+			return authorizationErr
+		}
+		extAuthzListener, listenErr := net.Listen("tcp", extAuthzListenAddr)
+		if listenErr != nil {
+			return fmt.Errorf("ext_authz listen error: %w", listenErr)
+		}
+		extAuthzServer = grpc.NewServer()
+		authorizationServer.Register(extAuthzServer)
+		go func() {
+			logger.Info("ext_authz listening", zap.String("addr", extAuthzListenAddr))
+			if err := serveGRPC(extAuthzServer, extAuthzListener); err != nil {
+				logger.Error("ext_authz server error", zap.Error(err))
+			}
+		}()
+		defer extAuthzServer.Stop()
+	}
+
 	shutdownCtx, shutdownCancel := context.WithCancel(context.Background())
 	defer shutdownCancel()
 
@@ -277,6 +945,9 @@ func runServer(command *cobra.Command, arguments []string) error {
 		<-stopSignals
 		graceCtx, graceCancel := context.WithTimeout(shutdownCtx, 10*time.Second)
 		defer graceCancel()
+		if extAuthzServer != nil {
+			extAuthzServer.GracefulStop()
+		}
 		if err := server.Shutdown(graceCtx); err != nil {
 			logger.Error("server shutdown error", zap.Error(err))
 		}
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -18,6 +27,7 @@ import (
 	"github.com/tyemirov/tauth/internal/authkit"
 	"go.uber.org/zap"
 	"google.golang.org/api/idtoken"
+	"google.golang.org/grpc"
 )
 
 func TestZapLoggerMiddleware(t *testing.T) {
@@ -75,7 +85,7 @@ func TestLoadServerConfigRequiresGoogleClientID(t *testing.T) {
 	if err == nil {
 		t.Fatalf("expected error when google_web_client_id is missing")
 	}
-	expectedMessage := "config.missing_google_web_client_id: google_web_client_id must be provided"
+	expectedMessage := "config.missing_google_web_client_id: google_web_client_id, oidc_providers_file, or a mailer (smtp_addr or email_outbox_file) must be provided"
 	if err.Error() != expectedMessage {
 		t.Fatalf("expected error %q, got %q", expectedMessage, err.Error())
 	}
@@ -122,6 +132,510 @@ func TestRunServerMissingSigningKeyReportsField(t *testing.T) {
 	}
 }
 
+func TestLoadServerConfigWithPrivateKeyFile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	privateKey, keyErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if keyErr != nil {
+		t.Fatalf("generate ecdsa key: %v", keyErr)
+	}
+	der, marshalErr := x509.MarshalPKCS8PrivateKey(privateKey)
+	if marshalErr != nil {
+		t.Fatalf("marshal private key: %v", marshalErr)
+	}
+	keyPath := filepath.Join(t.TempDir(), "signing.pem")
+	if writeErr := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); writeErr != nil {
+		t.Fatalf("write private key: %v", writeErr)
+	}
+
+	viper.Set("google_web_client_id", "client")
+	viper.Set("jwt_private_key_file", keyPath)
+	viper.Set("session_ttl", time.Minute)
+	viper.Set("refresh_ttl", time.Hour)
+
+	config, err := LoadServerConfig()
+	if err != nil {
+		t.Fatalf("expected configuration load to succeed, got %v", err)
+	}
+	if config.AppJWTKeyring.ActiveKey().Algorithm() != "ES256" {
+		t.Fatalf("expected ES256 signing key, got %q", config.AppJWTKeyring.ActiveKey().Algorithm())
+	}
+}
+
+func TestLoadServerConfigWithKeyringFile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	privateKey, keyErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if keyErr != nil {
+		t.Fatalf("generate ecdsa key: %v", keyErr)
+	}
+	der, marshalErr := x509.MarshalPKCS8PrivateKey(privateKey)
+	if marshalErr != nil {
+		t.Fatalf("marshal private key: %v", marshalErr)
+	}
+	keyDir := t.TempDir()
+	if writeErr := os.WriteFile(filepath.Join(keyDir, "current.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); writeErr != nil {
+		t.Fatalf("write private key: %v", writeErr)
+	}
+	keyringPath := filepath.Join(keyDir, "keyring.json")
+	keyringDocument := `{"keys":[
+		{"kid":"current","status":"active","private_key_file":"current.pem"},
+		{"kid":"previous","status":"verify_only","secret":"previous-secret"},
+		{"kid":"ancient","status":"retired"}
+	]}`
+	if writeErr := os.WriteFile(keyringPath, []byte(keyringDocument), 0o600); writeErr != nil {
+		t.Fatalf("write keyring: %v", writeErr)
+	}
+
+	viper.Set("google_web_client_id", "client")
+	viper.Set("jwt_keyring_file", keyringPath)
+	viper.Set("session_ttl", time.Minute)
+	viper.Set("refresh_ttl", time.Hour)
+
+	config, err := LoadServerConfig()
+	if err != nil {
+		t.Fatalf("expected configuration load to succeed, got %v", err)
+	}
+	activeKey := config.AppJWTKeyring.ActiveKey()
+	if activeKey.KeyID() != "current" || activeKey.Algorithm() != "ES256" {
+		t.Fatalf("unexpected active key %q (%s)", activeKey.KeyID(), activeKey.Algorithm())
+	}
+	if retired := config.AppJWTKeyring.RetiredKeyIDs(); len(retired) != 1 || retired[0] != "ancient" {
+		t.Fatalf("unexpected retired key ids: %v", retired)
+	}
+
+	if writeErr := os.WriteFile(keyringPath, []byte(`{"keys":[{"kid":"previous","status":"verify_only","secret":"previous-secret"}]}`), 0o600); writeErr != nil {
+		t.Fatalf("write keyring: %v", writeErr)
+	}
+	_, err = LoadServerConfig()
+	if err == nil || !strings.HasPrefix(err.Error(), configCodeInvalidJWTKeyring) {
+		t.Fatalf("expected %s error for keyring without active key, got %v", configCodeInvalidJWTKeyring, err)
+	}
+}
+
+func TestLoadServerConfigIssuerAudienceAndPublicBaseURL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("google_web_client_id", "client")
+	viper.Set("jwt_signing_key", "secret")
+	viper.Set("session_ttl", time.Minute)
+	viper.Set("refresh_ttl", time.Hour)
+
+	config, err := LoadServerConfig()
+	if err != nil {
+		t.Fatalf("expected configuration load to succeed, got %v", err)
+	}
+	if config.AppJWTIssuer != defaultJWTIssuer || config.PublicBaseURL != "" {
+		t.Fatalf("unexpected defaults: issuer %q, base url %q", config.AppJWTIssuer, config.PublicBaseURL)
+	}
+
+	viper.Set("jwt_issuer", "https://auth.example.com")
+	viper.Set("jwt_audience", []string{"billing, reports"})
+	viper.Set("public_base_url", "https://auth.example.com/")
+	config, err = LoadServerConfig()
+	if err != nil {
+		t.Fatalf("expected configuration load to succeed, got %v", err)
+	}
+	if config.AppJWTIssuer != "https://auth.example.com" || config.PublicBaseURL != "https://auth.example.com" {
+		t.Fatalf("unexpected issuer %q / base url %q", config.AppJWTIssuer, config.PublicBaseURL)
+	}
+	if len(config.AppJWTAudience) != 2 || config.AppJWTAudience[0] != "billing" || config.AppJWTAudience[1] != "reports" {
+		t.Fatalf("unexpected audience %v", config.AppJWTAudience)
+	}
+
+	viper.Set("public_base_url", "auth.example.com")
+	_, err = LoadServerConfig()
+	if err == nil || !strings.HasPrefix(err.Error(), configCodeInvalidPublicBaseURL) {
+		t.Fatalf("expected %s error, got %v", configCodeInvalidPublicBaseURL, err)
+	}
+}
+
+func TestLoadServerConfigEncryptionKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("google_web_client_id", "client")
+	viper.Set("jwt_signing_key", "secret")
+	viper.Set("session_ttl", time.Minute)
+	viper.Set("refresh_ttl", time.Hour)
+
+	currentKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	previousKey := base64.RawURLEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+	viper.Set("jwt_encryption_keys", []string{currentKey + "," + previousKey})
+	config, err := LoadServerConfig()
+	if err != nil {
+		t.Fatalf("expected configuration load to succeed, got %v", err)
+	}
+	if len(config.AppJWTEncryptionKeys) != 2 {
+		t.Fatalf("expected two encryption keys, got %d", len(config.AppJWTEncryptionKeys))
+	}
+
+	for _, invalid := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		viper.Set("jwt_encryption_keys", []string{invalid})
+		_, err = LoadServerConfig()
+		if err == nil || !strings.HasPrefix(err.Error(), configCodeInvalidEncryptionKey) {
+			t.Fatalf("expected %s error for %q, got %v", configCodeInvalidEncryptionKey, invalid, err)
+		}
+	}
+}
+
+func TestLoadServerConfigIntrospectionClients(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("google_web_client_id", "client")
+	viper.Set("jwt_signing_key", "secret")
+	viper.Set("session_ttl", time.Minute)
+	viper.Set("refresh_ttl", time.Hour)
+
+	viper.Set("introspection_clients", []string{"billing:s3cret:with-colon,reports:other"})
+	config, err := LoadServerConfig()
+	if err != nil {
+		t.Fatalf("expected configuration load to succeed, got %v", err)
+	}
+	if len(config.IntrospectionClients) != 2 || config.IntrospectionClients[0].ClientID != "billing" || config.IntrospectionClients[1].ClientID != "reports" {
+		t.Fatalf("unexpected introspection clients %+v", config.IntrospectionClients)
+	}
+
+	for _, invalid := range []string{"missing-secret", ":secret", "billing:"} {
+		viper.Set("introspection_clients", []string{invalid})
+		_, err = LoadServerConfig()
+		if err == nil || !strings.HasPrefix(err.Error(), configCodeInvalidIntrospection) {
+			t.Fatalf("expected %s error for %q, got %v", configCodeInvalidIntrospection, invalid, err)
+		}
+	}
+}
+
+func TestLoadServerConfigOIDCProviders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("jwt_signing_key", "secret")
+	viper.Set("session_ttl", time.Minute)
+	viper.Set("refresh_ttl", time.Hour)
+
+	providersPath := filepath.Join(t.TempDir(), "providers.json")
+	writeProviders := func(document string) {
+		if writeErr := os.WriteFile(providersPath, []byte(document), 0o600); writeErr != nil {
+			t.Fatalf("write providers: %v", writeErr)
+		}
+	}
+	writeProviders(`{"providers":[{"name":"entra","issuer":"https://login.microsoftonline.com/tenant/v2.0","jwks_url":"https://login.microsoftonline.com/tenant/discovery/v2.0/keys","client_ids":["app-id"],"claims":{"email":"preferred_username"},"trust_email":true}]}`)
+	viper.Set("oidc_providers_file", providersPath)
+
+	config, err := LoadServerConfig()
+	if err != nil {
+		t.Fatalf("expected configuration without google_web_client_id to load, got %v", err)
+	}
+	if len(config.IdentityProviders) != 1 || config.IdentityProviders[0].Name() != "entra" || config.GoogleWebClientID != "" {
+		t.Fatalf("unexpected identity providers %+v", config.IdentityProviders)
+	}
+
+	for _, invalid := range []string{
+		`{"providers":[{"name":"logout","issuer":"https://idp.example.com","jwks_url":"https://idp.example.com/keys","client_ids":["app"]}]}`,
+		`{"providers":[{"name":"okta","issuer":"https://idp.example.com","jwks_url":"https://idp.example.com/keys"}]}`,
+		`{"providers":[{"name":"okta","issuer":"https://idp.example.com","jwks_url":"https://idp.example.com/keys","client_ids":["app"]},{"name":"okta","issuer":"https://idp.example.com","jwks_url":"https://idp.example.com/keys","client_ids":["app"]}]}`,
+		`{"providers":`,
+	} {
+		writeProviders(invalid)
+		_, err = LoadServerConfig()
+		if err == nil || !strings.HasPrefix(err.Error(), configCodeInvalidOIDCProviders) {
+			t.Fatalf("expected %s error for %s, got %v", configCodeInvalidOIDCProviders, invalid, err)
+		}
+	}
+}
+
+func TestLoadServerConfigForwardAuthLoginURL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("google_web_client_id", "client")
+	viper.Set("jwt_signing_key", "secret")
+	viper.Set("session_ttl", time.Minute)
+	viper.Set("refresh_ttl", time.Hour)
+
+	for _, valid := range []string{"https://auth.example.com/login", "/login?app=wiki"} {
+		viper.Set("forward_auth_login_url", valid)
+		config, err := LoadServerConfig()
+		if err != nil || config.ForwardAuthLoginURL != valid {
+			t.Fatalf("expected %q to load, got %q (%v)", valid, config.ForwardAuthLoginURL, err)
+		}
+	}
+
+	for _, invalid := range []string{"login", "//evil.example.com/login", "ftp://auth.example.com", "https://auth.example.com/login#frag"} {
+		viper.Set("forward_auth_login_url", invalid)
+		_, err := LoadServerConfig()
+		if err == nil || !strings.HasPrefix(err.Error(), configCodeInvalidForwardAuthLogin) {
+			t.Fatalf("expected %s error for %q, got %v", configCodeInvalidForwardAuthLogin, invalid, err)
+		}
+	}
+}
+
+func TestLoadServerConfigAuthorizationCodeLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("google_web_client_id", "client")
+	viper.Set("google_web_client_secret", " client-secret ")
+	viper.Set("jwt_signing_key", "secret")
+	viper.Set("session_ttl", time.Minute)
+	viper.Set("refresh_ttl", time.Hour)
+	viper.Set("return_to_origins", []string{"https://App.example.com/", "http://localhost:3000"})
+
+	config, err := LoadServerConfig()
+	if err != nil {
+		t.Fatalf("expected configuration to load, got %v", err)
+	}
+	if config.GoogleWebClientSecret != "client-secret" {
+		t.Fatalf("unexpected google_web_client_secret %q", config.GoogleWebClientSecret)
+	}
+	if len(config.ReturnToOrigins) != 2 || config.ReturnToOrigins[0] != "https://app.example.com" || config.ReturnToOrigins[1] != "http://localhost:3000" {
+		t.Fatalf("unexpected return_to_origins %v", config.ReturnToOrigins)
+	}
+
+	for _, invalid := range []string{"app.example.com", "https://app.example.com/home", "ftp://app.example.com"} {
+		viper.Set("return_to_origins", []string{invalid})
+		_, err := LoadServerConfig()
+		if err == nil || !strings.HasPrefix(err.Error(), configCodeInvalidReturnToOrigin) {
+			t.Fatalf("expected %s error for %q, got %v", configCodeInvalidReturnToOrigin, invalid, err)
+		}
+	}
+
+	viper.Set("return_to_origins", []string{})
+	providersPath := filepath.Join(t.TempDir(), "providers.json")
+	if writeErr := os.WriteFile(providersPath, []byte(`{"providers":[{"name":"okta","issuer":"https://idp.example.com","jwks_url":"https://idp.example.com/keys","client_ids":["app"],"authorization_url":"https://idp.example.com/authorize"}]}`), 0o600); writeErr != nil {
+		t.Fatalf("write providers: %v", writeErr)
+	}
+	viper.Set("oidc_providers_file", providersPath)
+	if _, err := LoadServerConfig(); err == nil || !strings.HasPrefix(err.Error(), configCodeInvalidOIDCProviders) {
+		t.Fatalf("expected an authorization URL without a token URL to be rejected, got %v", err)
+	}
+}
+
+func TestLoadServerConfigEmailLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("jwt_signing_key", "secret")
+	viper.Set("session_ttl", time.Minute)
+	viper.Set("refresh_ttl", time.Hour)
+	viper.Set("email_outbox_file", filepath.Join(t.TempDir(), "outbox.eml"))
+	viper.Set("email_from", "no-reply@example.com")
+	viper.Set("email_login_url", "https://app.example.com/login/email")
+	viper.Set("email_login_ttl", 5*time.Minute)
+
+	config, err := LoadServerConfig()
+	if err != nil {
+		t.Fatalf("expected email sign-in alone to be a valid configuration, got %v", err)
+	}
+	if config.Mailer == nil || config.EmailLoginURL != "https://app.example.com/login/email" || config.EmailLoginTTL != 5*time.Minute {
+		t.Fatalf("unexpected email sign-in configuration %+v", config)
+	}
+
+	viper.Set("email_login_url", "/login/email")
+	if _, err := LoadServerConfig(); err == nil || !strings.HasPrefix(err.Error(), configCodeInvalidEmailLoginURL) {
+		t.Fatalf("expected a relative email_login_url without public_base_url to be rejected, got %v", err)
+	}
+	viper.Set("email_login_url", "")
+
+	viper.Set("smtp_addr", "smtp.example.com:587")
+	if _, err := LoadServerConfig(); err == nil || !strings.HasPrefix(err.Error(), configCodeInvalidMailer) {
+		t.Fatalf("expected smtp_addr with email_outbox_file to be rejected, got %v", err)
+	}
+	viper.Set("email_outbox_file", "")
+	viper.Set("smtp_addr", "smtp.example.com")
+	if _, err := LoadServerConfig(); err == nil || !strings.HasPrefix(err.Error(), configCodeInvalidMailer) {
+		t.Fatalf("expected smtp_addr without a port to be rejected, got %v", err)
+	}
+}
+
+func TestLoadServerConfigLoginPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("google_web_client_id", "client")
+	viper.Set("jwt_signing_key", "secret")
+	viper.Set("session_ttl", time.Minute)
+	viper.Set("refresh_ttl", time.Hour)
+	viper.Set("allowed_hosted_domains", []string{"OurCompany.com"})
+	viper.Set("allowed_email_domains", []string{"ourcompany.com,partner.example"})
+	viper.Set("denied_email_domains", []string{"gmail.com"})
+	viper.Set("allowed_emails", []string{"Contractor@Example.org"})
+
+	config, err := LoadServerConfig()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	expected := authkit.LoginPolicy{
+		AllowedHostedDomains: []string{"ourcompany.com"},
+		AllowedEmailDomains:  []string{"ourcompany.com", "partner.example"},
+		DeniedEmailDomains:   []string{"gmail.com"},
+		AllowedEmails:        []string{"contractor@example.org"},
+	}
+	if !reflect.DeepEqual(config.LoginPolicy, expected) {
+		t.Fatalf("unexpected login policy %+v", config.LoginPolicy)
+	}
+
+	for key, invalid := range map[string]string{
+		"allowed_hosted_domains": "@ourcompany.com",
+		"allowed_email_domains":  "https://ourcompany.com",
+		"denied_email_domains":   "localhost",
+		"allowed_emails":         "Contractor <contractor@example.org>",
+	} {
+		viper.Set(key, []string{invalid})
+		if _, err := LoadServerConfig(); err == nil || !strings.HasPrefix(err.Error(), configCodeInvalidLoginPolicy) {
+			t.Fatalf("expected %s error for %s=%q, got %v", configCodeInvalidLoginPolicy, key, invalid, err)
+		}
+		viper.Set(key, []string{})
+	}
+}
+
+func TestLoadServerConfigRegistrationMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("google_web_client_id", "client")
+	viper.Set("jwt_signing_key", "secret")
+	viper.Set("session_ttl", time.Minute)
+	viper.Set("refresh_ttl", time.Hour)
+
+	config, err := LoadServerConfig()
+	if err != nil || config.RegistrationMode != authkit.RegistrationOpen {
+		t.Fatalf("expected open registration by default, got %q (%v)", config.RegistrationMode, err)
+	}
+
+	viper.Set("registration_mode", " Invite_Only ")
+	viper.Set("invitation_ttl", 48*time.Hour)
+	config, err = LoadServerConfig()
+	if err != nil || config.RegistrationMode != authkit.RegistrationInviteOnly || config.InvitationTTL != 48*time.Hour {
+		t.Fatalf("expected invite-only registration, got %q %s (%v)", config.RegistrationMode, config.InvitationTTL, err)
+	}
+
+	viper.Set("registration_mode", "waitlist")
+	if _, err := LoadServerConfig(); err == nil || !strings.HasPrefix(err.Error(), configCodeInvalidRegistrationMode) {
+		t.Fatalf("expected %s error, got %v", configCodeInvalidRegistrationMode, err)
+	}
+}
+
+func TestLoadServerConfigDeviceAuthorization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("google_web_client_id", "client")
+	viper.Set("jwt_signing_key", "secret")
+	viper.Set("session_ttl", time.Minute)
+	viper.Set("refresh_ttl", time.Hour)
+	viper.Set("device_client_ids", "deploy-cli, ops-cli")
+	viper.Set("device_code_ttl", 5*time.Minute)
+	viper.Set("device_login_url", "/login")
+
+	config, err := LoadServerConfig()
+	if err != nil {
+		t.Fatalf("LoadServerConfig: %v", err)
+	}
+	if !reflect.DeepEqual(config.DeviceClientIDs, []string{"deploy-cli", "ops-cli"}) || config.DeviceCodeTTL != 5*time.Minute || config.DeviceLoginURL != "/login" {
+		t.Fatalf("unexpected device settings %v %s %q", config.DeviceClientIDs, config.DeviceCodeTTL, config.DeviceLoginURL)
+	}
+
+	viper.Set("device_login_url", "login")
+	if _, err := LoadServerConfig(); err == nil || !strings.HasPrefix(err.Error(), configCodeInvalidDeviceLoginURL) {
+		t.Fatalf("expected %s error, got %v", configCodeInvalidDeviceLoginURL, err)
+	}
+}
+
+func TestLoadServerConfigWebAuthn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("google_web_client_id", "client")
+	viper.Set("jwt_signing_key", "secret")
+	viper.Set("session_ttl", time.Minute)
+	viper.Set("refresh_ttl", time.Hour)
+	viper.Set("webauthn_rp_id", "Example.com")
+	viper.Set("webauthn_rp_name", "Example")
+	viper.Set("webauthn_origins", []string{"https://app.example.com/", "http://example.com:8080"})
+
+	config, err := LoadServerConfig()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if config.WebAuthnRPID != "example.com" || config.WebAuthnRPName != "Example" || !reflect.DeepEqual(config.WebAuthnOrigins, []string{"https://app.example.com", "http://example.com:8080"}) {
+		t.Fatalf("unexpected passkey configuration %+v", config)
+	}
+
+	testCases := []struct {
+		name    string
+		rpID    string
+		origins []string
+	}{
+		{name: "origin outside the relying party", rpID: "example.com", origins: []string{"https://example.org"}},
+		{name: "origin with a path", rpID: "example.com", origins: []string{"https://example.com/login"}},
+		{name: "relying party with a scheme", rpID: "https://example.com"},
+		{name: "origins without a relying party", origins: []string{"https://example.com"}},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			viper.Set("webauthn_rp_id", testCase.rpID)
+			viper.Set("webauthn_origins", testCase.origins)
+			if _, err := LoadServerConfig(); err == nil || !strings.HasPrefix(err.Error(), configCodeInvalidWebAuthn) {
+				t.Fatalf("expected %s error, got %v", configCodeInvalidWebAuthn, err)
+			}
+		})
+	}
+}
+
+func TestLoadServerConfigRejectsInvalidPrivateKeyFile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	keyPath := filepath.Join(t.TempDir(), "signing.pem")
+	if writeErr := os.WriteFile(keyPath, []byte("not a key"), 0o600); writeErr != nil {
+		t.Fatalf("write private key: %v", writeErr)
+	}
+
+	viper.Set("google_web_client_id", "client")
+	viper.Set("jwt_private_key_file", keyPath)
+	viper.Set("session_ttl", time.Minute)
+	viper.Set("refresh_ttl", time.Hour)
+
+	_, err := LoadServerConfig()
+	if err == nil || !strings.HasPrefix(err.Error(), configCodeInvalidJWTPrivateKey) {
+		t.Fatalf("expected %s error, got %v", configCodeInvalidJWTPrivateKey, err)
+	}
+}
+
 func TestRunServerValidatorInitFailure(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -200,6 +714,125 @@ func TestRunServerSuccess(t *testing.T) {
 	}
 }
 
+func TestRunServerStartsExtAuthzServer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	extAuthzStarted := make(chan net.Addr, 1)
+	previousServeGRPC := serveGRPC
+	serveGRPC = func(grpcServer *grpc.Server, listener net.Listener) error {
+		extAuthzStarted <- listener.Addr()
+		return nil
+	}
+	defer func() { serveGRPC = previousServeGRPC }()
+
+	restoreServe := withServeHTTPStub(func(server *http.Server) error {
+		select {
+		case <-extAuthzStarted:
+		case <-time.After(5 * time.Second):
+			t.Errorf("expected the ext_authz server to start")
+		}
+		return http.ErrServerClosed
+	})
+	defer restoreServe()
+
+	restoreValidator := withGoogleValidatorBuilderStub(func(ctx context.Context) (authkit.GoogleTokenValidator, error) {
+		return noopGoogleValidator{}, nil
+	})
+	defer restoreValidator()
+
+	viper.Set("listen_addr", ":0")
+	viper.Set("ext_authz_listen_addr", "127.0.0.1:0")
+	viper.Set("google_web_client_id", "client")
+	viper.Set("jwt_signing_key", "signing-secret")
+	viper.Set("session_ttl", time.Minute)
+	viper.Set("refresh_ttl", time.Hour)
+
+	config, err := LoadServerConfig()
+	if err != nil {
+		t.Fatalf("expected configuration load to succeed, got %v", err)
+	}
+
+	command := &cobra.Command{}
+	command.SetContext(context.WithValue(context.Background(), serverConfigContextKey, config))
+
+	if err := runServer(command, nil); err != nil {
+		t.Fatalf("expected runServer to succeed, got %v", err)
+	}
+}
+
+func TestLoadProxyConfig(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("upstream_url", "http://wiki.internal:3000")
+	viper.Set("proxy_login_url", "https://auth.example.com/login")
+	proxyConfig, err := loadProxyConfig()
+	if err != nil {
+		t.Fatalf("expected proxy configuration load to succeed, got %v", err)
+	}
+	if proxyConfig.UpstreamURL.String() != "http://wiki.internal:3000" || proxyConfig.LoginURL != "https://auth.example.com/login" {
+		t.Fatalf("unexpected proxy configuration %+v", proxyConfig)
+	}
+
+	testCases := []struct {
+		name          string
+		upstreamURL   string
+		loginURL      string
+		expectedError string
+	}{
+		{name: "missing upstream", upstreamURL: "", loginURL: "/login", expectedError: configCodeInvalidUpstreamURL},
+		{name: "relative upstream", upstreamURL: "/wiki", loginURL: "/login", expectedError: configCodeInvalidUpstreamURL},
+		{name: "missing login", upstreamURL: "http://wiki.internal", loginURL: "", expectedError: configCodeInvalidProxyLoginURL},
+		{name: "invalid login", upstreamURL: "http://wiki.internal", loginURL: "login", expectedError: configCodeInvalidProxyLoginURL},
+	}
+	for _, testCase := range testCases {
+		viper.Set("upstream_url", testCase.upstreamURL)
+		viper.Set("proxy_login_url", testCase.loginURL)
+		if _, err := loadProxyConfig(); err == nil || !strings.HasPrefix(err.Error(), testCase.expectedError) {
+			t.Fatalf("%s: expected %s error, got %v", testCase.name, testCase.expectedError, err)
+		}
+	}
+}
+
+func TestProxyCommandServesUpstream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	viper.Reset()
+	defer viper.Reset()
+
+	restoreServe := withServeHTTPStub(func(server *http.Server) error {
+		request := httptest.NewRequest(http.MethodGet, "/anything", nil)
+		request.Header.Set("Accept", "text/html")
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+		if response.Code != http.StatusFound || !strings.HasPrefix(response.Header().Get("Location"), "/login?return_to=") {
+			t.Errorf("expected unauthenticated browsers to be redirected to the login URL, got %d %q", response.Code, response.Header().Get("Location"))
+		}
+		return http.ErrServerClosed
+	})
+	defer restoreServe()
+
+	restoreValidator := withGoogleValidatorBuilderStub(func(ctx context.Context) (authkit.GoogleTokenValidator, error) {
+		return noopGoogleValidator{}, nil
+	})
+	defer restoreValidator()
+
+	command := newRootCommand()
+	command.SetArgs([]string{
+		"proxy",
+		"--google_web_client_id", "client",
+		"--jwt_signing_key", "signing-secret",
+		"--upstream_url", "http://wiki.internal:3000",
+		"--proxy_login_url", "/login",
+	})
+	if err := command.Execute(); err != nil {
+		t.Fatalf("expected proxy command to succeed, got %v", err)
+	}
+}
+
 func TestRunServerWithSQLiteFilePath(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -0,0 +1,361 @@
+package authkit
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+const (
+	authorizationLoginPath    = "/auth/login/:provider"
+	authorizationCallbackPath = "/auth/callback/:provider"
+	authorizationCallbackBase = "/auth/callback/"
+
+	// loginStateCookieName carries the state, nonce, PKCE verifier, and
+	// return_to of an authorization code login to the callback.
+	loginStateCookieName = "app_login_state"
+
+	googleAuthorizationURL = "https://accounts.google.com/o/oauth2/v2/auth"
+	googleTokenURL         = "https://oauth2.googleapis.com/token"
+)
+
+var (
+	// ErrAuthorizationCodeUnsupported indicates a provider configured without authorization and token endpoints.
+	ErrAuthorizationCodeUnsupported = errors.New("identity_provider.authorization_code_unsupported")
+	// ErrInvalidAuthorizationCode indicates the token endpoint rejected the code or returned no ID token.
+	ErrInvalidAuthorizationCode = errors.New("identity_provider.invalid_authorization_code")
+)
+
+var defaultAuthorizationScopes = []string{"openid", "email", "profile"}
+
+// AuthorizationCodeProvider is an IdentityProvider that also signs users in
+// through the OAuth 2.0 authorization code flow with PKCE (RFC 7636), driven
+// by GET /auth/login/{provider} and GET /auth/callback/{provider}. Both
+// methods return ErrAuthorizationCodeUnsupported when the provider has no
+// authorization and token endpoints.
+type AuthorizationCodeProvider interface {
+	IdentityProvider
+	AuthorizationURL(redirectURI string, state string, nonce string, codeVerifier string) (string, error)
+	ExchangeCode(ctx context.Context, redirectURI string, code string, codeVerifier string) (idToken string, err error)
+}
+
+// authorizationCodeClient talks to a provider's authorization and token
+// endpoints. A nil client means the provider only accepts posted ID tokens.
+type authorizationCodeClient struct {
+	config     oauth2.Config
+	httpClient *http.Client
+}
+
+func newAuthorizationCodeClient(authorizationURL string, tokenURL string, clientID string, clientSecret string, scopes []string, httpClient *http.Client) *authorizationCodeClient {
+	if len(scopes) == 0 {
+		scopes = defaultAuthorizationScopes
+	}
+	return &authorizationCodeClient{
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     oauth2.Endpoint{AuthURL: authorizationURL, TokenURL: tokenURL},
+			Scopes:       scopes,
+		},
+		httpClient: httpClient,
+	}
+}
+
+func (client *authorizationCodeClient) authorizationURL(redirectURI string, state string, nonce string, codeVerifier string) (string, error) {
+	if client == nil {
+		return "", fmt.Errorf("identity_provider.authorization_url: %w", ErrAuthorizationCodeUnsupported)
+	}
+	config := client.config
+	config.RedirectURL = redirectURI
+	return config.AuthCodeURL(state, oauth2.S256ChallengeOption(codeVerifier), oauth2.SetAuthURLParam("nonce", nonce)), nil
+}
+
+func (client *authorizationCodeClient) exchangeCode(ctx context.Context, redirectURI string, code string, codeVerifier string) (string, error) {
+	if client == nil {
+		return "", fmt.Errorf("identity_provider.exchange_code: %w", ErrAuthorizationCodeUnsupported)
+	}
+	config := client.config
+	config.RedirectURL = redirectURI
+	if client.httpClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, client.httpClient)
+	}
+	token, exchangeErr := config.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if exchangeErr != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(exchangeErr, &retrieveErr) && retrieveErr.Response != nil && retrieveErr.Response.StatusCode < http.StatusInternalServerError {
+			return "", fmt.Errorf("identity_provider.exchange_code: %w: %v", ErrInvalidAuthorizationCode, exchangeErr)
+		}
+		return "", fmt.Errorf("identity_provider.exchange_code: %w: %v", ErrIdentityProviderUnavailable, exchangeErr)
+	}
+	idToken, _ := token.Extra("id_token").(string)
+	if idToken == "" {
+		return "", fmt.Errorf("identity_provider.exchange_code: %w: token response carries no id_token", ErrInvalidAuthorizationCode)
+	}
+	return idToken, nil
+}
+
+// loginState survives the round trip to the provider in an HttpOnly cookie
+// scoped to the callback; matching state binds the callback to this browser.
+type loginState struct {
+	Provider     string `json:"provider"`
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	ReturnTo     string `json:"return_to"`
+}
+
+// handleAuthorizationLogin starts an authorization code login: it records the
+// state, nonce, and PKCE verifier and redirects the browser to the provider.
+func handleAuthorizationLogin(configuration ServerConfig, providers map[string]IdentityProvider, nonces NonceStore) gin.HandlerFunc {
+	return func(contextGin *gin.Context) {
+		provider, supported := providers[contextGin.Param("provider")].(AuthorizationCodeProvider)
+		if !supported {
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.login.unknown_provider", nil, zap.String("provider", contextGin.Param("provider")))
+			contextGin.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_provider"})
+			return
+		}
+		if !configuration.AllowInsecureHTTP && !isHTTPS(contextGin.Request) {
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.login.insecure_http", nil)
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "https_required"})
+			return
+		}
+		returnTo, validReturnTo := validateReturnTo(configuration, contextGin.Request, contextGin.Query(ForwardAuthReturnParameter))
+		if !validReturnTo {
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.login.invalid_return_to", nil, zap.String("return_to", contextGin.Query(ForwardAuthReturnParameter)))
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_return_to"})
+			return
+		}
+
+		state, stateErr := newRandomIdentifier()
+		if stateErr != nil {
+			recordMetric(metricAuthLoginFailure)
+			logAuthError("auth.login.state", stateErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		nonce, nonceErr := nonces.Issue(contextGin)
+		if nonceErr != nil {
+			recordMetric(metricAuthLoginFailure)
+			logAuthError("auth.login.nonce_issue_failed", nonceErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		codeVerifier := oauth2.GenerateVerifier()
+		authorizationURL, urlErr := provider.AuthorizationURL(authorizationRedirectURI(configuration, contextGin.Request, provider.Name()), state, nonce, codeVerifier)
+		if urlErr != nil {
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.login.authorization_code_unsupported", urlErr, zap.String("provider", provider.Name()))
+			contextGin.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_provider"})
+			return
+		}
+
+		writeLoginStateCookie(contextGin, configuration, loginState{
+			Provider:     provider.Name(),
+			State:        state,
+			Nonce:        nonce,
+			CodeVerifier: codeVerifier,
+			ReturnTo:     returnTo,
+		})
+		contextGin.Header("Cache-Control", "no-store")
+		contextGin.Redirect(http.StatusFound, authorizationURL)
+	}
+}
+
+// handleAuthorizationCallback completes an authorization code login: it
+// checks the state, exchanges the code with the PKCE verifier, verifies the ID
+// token, starts a session, and redirects to the validated return_to URL.
+func handleAuthorizationCallback(clock Clock, configuration ServerConfig, providers map[string]IdentityProvider, users UserStore, refreshTokens RefreshTokenStore, nonces NonceStore) gin.HandlerFunc {
+	return func(contextGin *gin.Context) {
+		provider, supported := providers[contextGin.Param("provider")].(AuthorizationCodeProvider)
+		if !supported {
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.login.unknown_provider", nil, zap.String("provider", contextGin.Param("provider")))
+			contextGin.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_provider"})
+			return
+		}
+		contextGin.Header("Cache-Control", "no-store")
+		state, stateFound := readLoginState(contextGin.Request)
+		clearLoginStateCookie(contextGin, configuration)
+		if !stateFound || state.Provider != provider.Name() || subtle.ConstantTimeCompare([]byte(state.State), []byte(contextGin.Query("state"))) != 1 {
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.login.invalid_state", nil, zap.String("provider", provider.Name()))
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_state"})
+			return
+		}
+		if providerError := contextGin.Query("error"); providerError != "" {
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.login.authorization_denied", nil, zap.String("provider", provider.Name()), zap.String("provider_error", providerError))
+			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authorization_denied"})
+			return
+		}
+		if consumeErr := nonces.Consume(contextGin, state.Nonce); consumeErr != nil {
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.login.invalid_nonce_token", consumeErr)
+			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_nonce"})
+			return
+		}
+		code := contextGin.Query("code")
+		if code == "" {
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.login.missing_code", nil, zap.String("provider", provider.Name()))
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+
+		idToken, exchangeErr := provider.ExchangeCode(contextGin, authorizationRedirectURI(configuration, contextGin.Request, provider.Name()), code, state.CodeVerifier)
+		switch {
+		case errors.Is(exchangeErr, ErrInvalidAuthorizationCode):
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.login.invalid_grant", exchangeErr, zap.String("provider", provider.Name()))
+			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_grant"})
+			return
+		case errors.Is(exchangeErr, ErrIdentityProviderUnavailable):
+			recordMetric(metricAuthLoginFailure)
+			logAuthError("auth.login.provider_unavailable", exchangeErr, zap.String("provider", provider.Name()))
+			contextGin.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		case exchangeErr != nil:
+			recordMetric(metricAuthLoginFailure)
+			logAuthError("auth.login.provider_error", exchangeErr, zap.String("provider", provider.Name()))
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		identity, verified := verifyIdentityToken(contextGin, provider, idToken)
+		if !verified {
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(identity.Nonce), []byte(state.Nonce)) != 1 {
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.login.nonce_mismatch", nil, zap.String("id_token_nonce", identity.Nonce))
+			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_nonce"})
+			return
+		}
+
+		profile, started := startSession(contextGin, clock, configuration, users, refreshTokens, identity)
+		if !started {
+			return
+		}
+		returnTo, validReturnTo := validateReturnTo(configuration, contextGin.Request, state.ReturnTo)
+		if !validReturnTo {
+			returnTo = "/"
+		}
+		if profile["mfa_required"] == true {
+			// The browser holds only app_mfa_pending; tell the page to ask for a code.
+			returnTo = withQueryParameter(returnTo, "mfa_required", "1")
+		}
+		contextGin.Redirect(http.StatusFound, returnTo)
+	}
+}
+
+// authorizationRedirectURI is the callback URL registered with the provider.
+func authorizationRedirectURI(configuration ServerConfig, request *http.Request, providerName string) string {
+	return requestBaseURL(configuration, request) + authorizationCallbackBase + providerName
+}
+
+// withQueryParameter adds a query parameter to a URL already accepted by
+// validateReturnTo.
+func withQueryParameter(rawURL string, name string, value string) string {
+	parsedURL, parseErr := url.Parse(rawURL)
+	if parseErr != nil {
+		return rawURL
+	}
+	query := parsedURL.Query()
+	query.Set(name, value)
+	parsedURL.RawQuery = query.Encode()
+	return parsedURL.String()
+}
+
+// validateReturnTo accepts same-origin paths and absolute http(s) URLs on
+// TAuth's own origin or one of ServerConfig.ReturnToOrigins, so login
+// redirects cannot be abused as open redirects. An empty value means "/".
+func validateReturnTo(configuration ServerConfig, request *http.Request, rawReturnTo string) (string, bool) {
+	if rawReturnTo == "" {
+		return "/", true
+	}
+	parsedURL, parseErr := url.Parse(rawReturnTo)
+	if parseErr != nil || parsedURL.User != nil || strings.ContainsAny(rawReturnTo, "\\\r\n\t") {
+		return "", false
+	}
+	if parsedURL.Scheme == "" && parsedURL.Host == "" {
+		if !strings.HasPrefix(rawReturnTo, "/") || strings.HasPrefix(rawReturnTo, "//") {
+			return "", false
+		}
+		return rawReturnTo, true
+	}
+	if (parsedURL.Scheme != "https" && parsedURL.Scheme != "http") || parsedURL.Host == "" {
+		return "", false
+	}
+	origin := parsedURL.Scheme + "://" + strings.ToLower(parsedURL.Host)
+	if origin != urlOrigin(requestBaseURL(configuration, request)) && !slices.Contains(configuration.ReturnToOrigins, origin) {
+		return "", false
+	}
+	return parsedURL.String(), true
+}
+
+// urlOrigin returns the lowercase scheme://host[:port] of rawURL.
+func urlOrigin(rawURL string) string {
+	parsedURL, parseErr := url.Parse(rawURL)
+	if parseErr != nil {
+		return ""
+	}
+	return parsedURL.Scheme + "://" + strings.ToLower(parsedURL.Host)
+}
+
+// writeLoginStateCookie uses SameSite=Lax: the callback is a top-level
+// navigation from the provider's site, which Strict cookies would not follow.
+func writeLoginStateCookie(contextGin *gin.Context, configuration ServerConfig, state loginState) {
+	encoded, _ := json.Marshal(state)
+	http.SetCookie(contextGin.Writer, &http.Cookie{
+		Name:     loginStateCookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(encoded),
+		Path:     authorizationCallbackBase,
+		Domain:   configuration.CookieDomain,
+		MaxAge:   int(configuration.NonceTTL.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func readLoginState(request *http.Request) (loginState, bool) {
+	cookie, cookieErr := request.Cookie(loginStateCookieName)
+	if cookieErr != nil {
+		return loginState{}, false
+	}
+	decoded, decodeErr := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if decodeErr != nil {
+		return loginState{}, false
+	}
+	var state loginState
+	if unmarshalErr := json.Unmarshal(decoded, &state); unmarshalErr != nil || state.State == "" {
+		return loginState{}, false
+	}
+	return state, true
+}
+
+func clearLoginStateCookie(contextGin *gin.Context, configuration ServerConfig) {
+	http.SetCookie(contextGin.Writer, &http.Cookie{
+		Name:     loginStateCookieName,
+		Value:    "",
+		Path:     authorizationCallbackBase,
+		Domain:   configuration.CookieDomain,
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,312 @@
+package authkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeAuthorizationCode struct {
+	codeChallenge string
+	redirectURI   string
+	idToken       string
+}
+
+// issueCode registers an authorization code for the login request TAuth
+// redirected the browser to; the token endpoint redeems it once, given the
+// verifier matching the request's S256 challenge.
+func (issuer *fakeOIDCIssuer) issueCode(code string, authorizationRequest url.Values, idToken string) {
+	issuer.codesMutex.Lock()
+	defer issuer.codesMutex.Unlock()
+	issuer.codes[code] = fakeAuthorizationCode{
+		codeChallenge: authorizationRequest.Get("code_challenge"),
+		redirectURI:   authorizationRequest.Get("redirect_uri"),
+		idToken:       idToken,
+	}
+}
+
+func (issuer *fakeOIDCIssuer) serveToken(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	writeTokenError := func(status int, code string) {
+		writer.WriteHeader(status)
+		_ = json.NewEncoder(writer).Encode(map[string]string{"error": code})
+	}
+	clientID, clientSecret, hasBasicAuth := request.BasicAuth()
+	if !hasBasicAuth {
+		clientID, clientSecret = request.PostFormValue("client_id"), request.PostFormValue("client_secret")
+	}
+	if clientID != "tauth-client" || clientSecret != "tauth-secret" {
+		writeTokenError(http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if request.PostFormValue("grant_type") != "authorization_code" {
+		writeTokenError(http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+	issuer.codesMutex.Lock()
+	registered, found := issuer.codes[request.PostFormValue("code")]
+	delete(issuer.codes, request.PostFormValue("code"))
+	issuer.codesMutex.Unlock()
+	verifierDigest := sha256.Sum256([]byte(request.PostFormValue("code_verifier")))
+	if !found || registered.redirectURI != request.PostFormValue("redirect_uri") || registered.codeChallenge != base64.RawURLEncoding.EncodeToString(verifierDigest[:]) {
+		writeTokenError(http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	_ = json.NewEncoder(writer).Encode(map[string]interface{}{
+		"access_token": "fake-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     registered.idToken,
+	})
+}
+
+func newAuthorizationCodeRouterForTest(t *testing.T, issuer *fakeOIDCIssuer, configure ...func(*ServerConfig)) (*gin.Engine, ServerConfig) {
+	t.Helper()
+	providerConfig := issuer.providerConfig("okta")
+	providerConfig.AuthorizationURL = issuer.server.URL + "/authorize"
+	providerConfig.TokenURL = issuer.server.URL + "/token"
+	providerConfig.ClientSecret = "tauth-secret"
+	provider, providerErr := NewOIDCProvider(providerConfig)
+	if providerErr != nil {
+		t.Fatalf("new oidc provider: %v", providerErr)
+	}
+	idTokenOnlyProvider, providerErr := NewOIDCProvider(issuer.providerConfig("keycloak"))
+	if providerErr != nil {
+		t.Fatalf("new oidc provider: %v", providerErr)
+	}
+	router, config, _ := newAuthRouterForTest(t, func(config *ServerConfig) {
+		config.IdentityProviders = []IdentityProvider{provider, idTokenOnlyProvider}
+		config.ReturnToOrigins = []string{"https://app.example.com"}
+		for _, apply := range configure {
+			apply(config)
+		}
+	})
+	return router, config
+}
+
+// beginAuthorizationLogin follows GET /auth/login/{provider} and returns the
+// authorization request the browser was redirected to and the login-state cookie.
+func beginAuthorizationLogin(t *testing.T, router http.Handler, path string) (url.Values, *http.Cookie) {
+	t.Helper()
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, path, nil))
+	if response.Code != http.StatusFound {
+		t.Fatalf("expected 302 from %s, got %d: %s", path, response.Code, response.Body.String())
+	}
+	location, parseErr := url.Parse(response.Header().Get("Location"))
+	if parseErr != nil {
+		t.Fatalf("parse authorization redirect: %v", parseErr)
+	}
+	loginCookie := collectCookies(response.Result().Cookies())[loginStateCookieName]
+	if loginCookie == nil {
+		t.Fatalf("expected a login state cookie, got %v", response.Result().Cookies())
+	}
+	return location.Query(), loginCookie
+}
+
+func finishAuthorizationLogin(router http.Handler, query url.Values, loginCookie *http.Cookie) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/auth/callback/okta?"+query.Encode(), nil)
+	if loginCookie != nil {
+		request.AddCookie(loginCookie)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	return response
+}
+
+func TestAuthorizationCodeLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	issuer := newFakeOIDCIssuer(t)
+	router, config := newAuthorizationCodeRouterForTest(t, issuer)
+
+	authorizationRequest, loginCookie := beginAuthorizationLogin(t, router, "/auth/login/okta?return_to="+url.QueryEscape("/dashboard?tab=2"))
+	if authorizationRequest.Get("client_id") != "tauth-client" || authorizationRequest.Get("response_type") != "code" || authorizationRequest.Get("scope") != "openid email profile" {
+		t.Fatalf("unexpected authorization request %v", authorizationRequest)
+	}
+	if authorizationRequest.Get("redirect_uri") != "http://example.com/auth/callback/okta" || authorizationRequest.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %v", authorizationRequest)
+	}
+	if authorizationRequest.Get("state") == "" || authorizationRequest.Get("nonce") == "" || authorizationRequest.Get("code_challenge") == "" {
+		t.Fatalf("expected state, nonce, and PKCE challenge, got %v", authorizationRequest)
+	}
+	if loginCookie.Path != "/auth/callback/" || !loginCookie.HttpOnly || loginCookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("unexpected login state cookie %+v", loginCookie)
+	}
+
+	issuer.issueCode("code-1", authorizationRequest, issuer.idToken(t, "okta-user", map[string]interface{}{"nonce": authorizationRequest.Get("nonce")}))
+	callbackQuery := url.Values{"code": {"code-1"}, "state": {authorizationRequest.Get("state")}}
+	response := finishAuthorizationLogin(router, callbackQuery, loginCookie)
+	if response.Code != http.StatusFound {
+		t.Fatalf("expected 302 from the callback, got %d: %s", response.Code, response.Body.String())
+	}
+	if location := response.Header().Get("Location"); location != "/dashboard?tab=2" {
+		t.Fatalf("expected redirect to return_to, got %q", location)
+	}
+	cookies := collectCookies(response.Result().Cookies())
+	if cookies[config.SessionCookieName] == nil || cookies[config.RefreshCookieName] == nil {
+		t.Fatalf("expected session and refresh cookies, got %v", response.Result().Cookies())
+	}
+	if cookies[loginStateCookieName] == nil || cookies[loginStateCookieName].MaxAge >= 0 {
+		t.Fatalf("expected the login state cookie to be cleared")
+	}
+
+	replayed := finishAuthorizationLogin(router, callbackQuery, loginCookie)
+	if replayed.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a replayed callback to be rejected, got %d", replayed.Code)
+	}
+}
+
+func TestAuthorizationCodeLoginWithSecondFactor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	issuer := newFakeOIDCIssuer(t)
+	router, config := newAuthorizationCodeRouterForTest(t, issuer, withTOTPForTest)
+	if saveErr := resolveSecondFactors().Save(context.Background(), TOTPEnrollment{UserID: "okta:okta-user", Secret: "JBSWY3DPEHPK3PXP", Confirmed: true}); saveErr != nil {
+		t.Fatalf("save enrollment: %v", saveErr)
+	}
+
+	authorizationRequest, loginCookie := beginAuthorizationLogin(t, router, "/auth/login/okta?return_to="+url.QueryEscape("/dashboard?tab=2"))
+	issuer.issueCode("code-1", authorizationRequest, issuer.idToken(t, "okta-user", map[string]interface{}{"nonce": authorizationRequest.Get("nonce")}))
+	response := finishAuthorizationLogin(router, url.Values{"code": {"code-1"}, "state": {authorizationRequest.Get("state")}}, loginCookie)
+	if response.Code != http.StatusFound {
+		t.Fatalf("expected 302 from the callback, got %d: %s", response.Code, response.Body.String())
+	}
+	if location := response.Header().Get("Location"); location != "/dashboard?mfa_required=1&tab=2" {
+		t.Fatalf("expected redirect to return_to with mfa_required, got %q", location)
+	}
+	cookies := collectCookies(response.Result().Cookies())
+	if cookies[mfaPendingCookieName] == nil || cookies[config.SessionCookieName] != nil || cookies[config.RefreshCookieName] != nil {
+		t.Fatalf("expected only the pending second factor cookie, got %v", response.Result().Cookies())
+	}
+}
+
+func TestAuthorizationCodeCallbackRejections(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	issuer := newFakeOIDCIssuer(t)
+	router, _ := newAuthorizationCodeRouterForTest(t, issuer)
+
+	testCases := []struct {
+		name           string
+		state          string
+		code           string
+		providerError  string
+		idTokenNonce   string
+		dropCookie     bool
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "forged state", state: "forged", expectedStatus: http.StatusBadRequest, expectedError: "invalid_state"},
+		{name: "missing login state", dropCookie: true, expectedStatus: http.StatusBadRequest, expectedError: "invalid_state"},
+		{name: "provider error", providerError: "access_denied", expectedStatus: http.StatusUnauthorized, expectedError: "authorization_denied"},
+		{name: "unknown code", code: "stolen-code", expectedStatus: http.StatusUnauthorized, expectedError: "invalid_grant"},
+		{name: "nonce mismatch", idTokenNonce: "other-nonce", expectedStatus: http.StatusUnauthorized, expectedError: "invalid_nonce"},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		registeredCode := "code-" + testCase.name
+		t.Run(testCase.name, func(t *testing.T) {
+			authorizationRequest, loginCookie := beginAuthorizationLogin(t, router, "/auth/login/okta")
+			nonce := authorizationRequest.Get("nonce")
+			if testCase.idTokenNonce != "" {
+				nonce = testCase.idTokenNonce
+			}
+			issuer.issueCode(registeredCode, authorizationRequest, issuer.idToken(t, "okta-user", map[string]interface{}{"nonce": nonce}))
+
+			callbackQuery := url.Values{"code": {registeredCode}, "state": {authorizationRequest.Get("state")}}
+			if testCase.state != "" {
+				callbackQuery.Set("state", testCase.state)
+			}
+			if testCase.code != "" {
+				callbackQuery.Set("code", testCase.code)
+			}
+			if testCase.providerError != "" {
+				callbackQuery.Del("code")
+				callbackQuery.Set("error", testCase.providerError)
+			}
+			if testCase.dropCookie {
+				loginCookie = nil
+			}
+			response := finishAuthorizationLogin(router, callbackQuery, loginCookie)
+			if response.Code != testCase.expectedStatus {
+				t.Fatalf("expected %d, got %d", testCase.expectedStatus, response.Code)
+			}
+			var body map[string]string
+			_ = json.Unmarshal(response.Body.Bytes(), &body)
+			if body["error"] != testCase.expectedError {
+				t.Fatalf("expected error %q, got %q", testCase.expectedError, body["error"])
+			}
+		})
+	}
+}
+
+func TestAuthorizationLoginRejections(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	issuer := newFakeOIDCIssuer(t)
+	router, _ := newAuthorizationCodeRouterForTest(t, issuer)
+
+	testCases := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "unknown provider", path: "/auth/login/entra", expectedStatus: http.StatusNotFound, expectedError: "unknown_provider"},
+		{name: "provider without endpoints", path: "/auth/login/keycloak", expectedStatus: http.StatusNotFound, expectedError: "unknown_provider"},
+		{name: "foreign return_to", path: "/auth/login/okta?return_to=" + url.QueryEscape("https://evil.example.com/"), expectedStatus: http.StatusBadRequest, expectedError: "invalid_return_to"},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, testCase.path, nil))
+			if response.Code != testCase.expectedStatus {
+				t.Fatalf("expected %d, got %d", testCase.expectedStatus, response.Code)
+			}
+			var body map[string]string
+			_ = json.Unmarshal(response.Body.Bytes(), &body)
+			if body["error"] != testCase.expectedError {
+				t.Fatalf("expected error %q, got %q", testCase.expectedError, body["error"])
+			}
+		})
+	}
+}
+
+func TestValidateReturnTo(t *testing.T) {
+	config := newTestServerConfig()
+	config.PublicBaseURL = "https://auth.example.com"
+	config.ReturnToOrigins = []string{"https://app.example.com"}
+	request := httptest.NewRequest(http.MethodGet, "/auth/login/google", nil)
+
+	testCases := []struct {
+		returnTo string
+		expected string
+		valid    bool
+	}{
+		{returnTo: "", expected: "/", valid: true},
+		{returnTo: "/notes?id=1", expected: "/notes?id=1", valid: true},
+		{returnTo: "https://auth.example.com/account", expected: "https://auth.example.com/account", valid: true},
+		{returnTo: "https://APP.example.com/home", expected: "https://APP.example.com/home", valid: true},
+		{returnTo: "https://evil.example.com/", valid: false},
+		{returnTo: "//evil.example.com/", valid: false},
+		{returnTo: "/\\evil.example.com", valid: false},
+		{returnTo: "javascript:alert(1)", valid: false},
+		{returnTo: "https://user@app.example.com/", valid: false},
+		{returnTo: "notes", valid: false},
+	}
+	for _, testCase := range testCases {
+		returnTo, valid := validateReturnTo(config, request, testCase.returnTo)
+		if valid != testCase.valid || returnTo != testCase.expected {
+			t.Fatalf("validateReturnTo(%q) = %q, %v; expected %q, %v", testCase.returnTo, returnTo, valid, testCase.expected, testCase.valid)
+		}
+	}
+}
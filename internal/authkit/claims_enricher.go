@@ -0,0 +1,55 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+)
+
+// ErrUnnamespacedClaim indicates a custom claim name lacks a namespace prefix.
+var ErrUnnamespacedClaim = errors.New("claims_enricher.unnamespaced_claim")
+
+// ClaimsEnricher contributes application-specific claims (tenant IDs, plan
+// tiers, feature flags) to every session minted on login and refresh. Claim
+// names must be namespaced as "<namespace>/<name>", e.g. "acme/tenant_id" or
+// "https://acme.example/plan", so they never collide with TAuth claims.
+type ClaimsEnricher interface {
+	EnrichClaims(ctx context.Context, applicationUserID string, userEmail string, userRoles []string) (map[string]interface{}, error)
+}
+
+var configuredClaimsEnricher ClaimsEnricher
+
+// ProvideClaimsEnricher sets the enricher consulted by auth routes before minting sessions.
+func ProvideClaimsEnricher(enricher ClaimsEnricher) {
+	configuredClaimsEnricher = enricher
+}
+
+func enrichSessionClaims(ctx context.Context, applicationUserID string, userEmail string, userRoles []string) (map[string]interface{}, error) {
+	if configuredClaimsEnricher == nil {
+		return nil, nil
+	}
+	customClaims, enrichErr := configuredClaimsEnricher.EnrichClaims(ctx, applicationUserID, userEmail, userRoles)
+	if enrichErr != nil {
+		return nil, fmt.Errorf("claims_enricher.enrich: %w", enrichErr)
+	}
+	for name := range customClaims {
+		if validateErr := validateCustomClaimName(name); validateErr != nil {
+			return nil, validateErr
+		}
+	}
+	return customClaims, nil
+}
+
+func validateCustomClaimName(name string) error {
+	if sessionvalidator.IsReservedClaim(name) {
+		return fmt.Errorf("claims_enricher.%s: %w", name, sessionvalidator.ErrReservedClaim)
+	}
+	namespace, claim, found := strings.Cut(name, "/")
+	if !found || strings.TrimSpace(namespace) == "" || strings.TrimSpace(claim) == "" {
+		return fmt.Errorf("claims_enricher.%s: %w", name, ErrUnnamespacedClaim)
+	}
+	return nil
+}
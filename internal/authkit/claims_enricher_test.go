@@ -0,0 +1,138 @@
+package authkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+	"google.golang.org/api/idtoken"
+)
+
+type planEnricher struct {
+	plans []string
+	calls int
+	extra map[string]interface{}
+}
+
+func (enricher *planEnricher) EnrichClaims(ctx context.Context, applicationUserID string, userEmail string, userRoles []string) (map[string]interface{}, error) {
+	plan := enricher.plans[enricher.calls%len(enricher.plans)]
+	enricher.calls++
+	claims := map[string]interface{}{
+		"acme/tenant_id": "tenant-42",
+		"acme/plan":      plan,
+		"acme/features":  []string{"exports", "sso"},
+	}
+	for name, value := range enricher.extra {
+		claims[name] = value
+	}
+	return claims, nil
+}
+
+type tenantClaims struct {
+	UserID   string   `json:"user_id"`
+	TenantID string   `json:"acme/tenant_id"`
+	Plan     string   `json:"acme/plan"`
+	Features []string `json:"acme/features"`
+}
+
+func TestClaimsEnricherAddsClaimsOnLoginAndRefresh(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	enricher := &planEnricher{plans: []string{"free", "pro"}}
+	ProvideClaimsEnricher(enricher)
+	defer ProvideClaimsEnricher(nil)
+
+	config := newTestServerConfig()
+	payload := &idtoken.Payload{Claims: map[string]interface{}{
+		"iss":            "https://accounts.google.com",
+		"sub":            "sub-enriched",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"name":           "Enriched User",
+	}}
+	restoreValidator := withValidatorFactory(t, func(ctx context.Context) (GoogleTokenValidator, error) {
+		return &fakeGoogleValidator{results: map[string]validatorResult{
+			"valid-token": {payload: payload, expectedAudience: "client-id"},
+		}}, nil
+	})
+	defer restoreValidator()
+
+	router := gin.New()
+	MountAuthRoutes(router, config, newTestUserStore(), NewMemoryRefreshTokenStore(), nil)
+
+	loginRequest := httptest.NewRequest(http.MethodPost, "/auth/google", bytes.NewBuffer(prepareLoginBody(t, router, payload, "valid-token")))
+	loginRequest.Header.Set("Content-Type", "application/json")
+	loginResponse := httptest.NewRecorder()
+	router.ServeHTTP(loginResponse, loginRequest)
+	if loginResponse.Code != http.StatusOK {
+		t.Fatalf("expected 200 from login, got %d", loginResponse.Code)
+	}
+	cookies := collectCookies(loginResponse.Result().Cookies())
+
+	validator, validatorErr := sessionvalidator.New(config.AppJWTKeyring.ValidatorConfig(config.AppJWTIssuer, config.SessionCookieName))
+	if validatorErr != nil {
+		t.Fatalf("validator: %v", validatorErr)
+	}
+	decoded, claims, validateErr := sessionvalidator.ValidateInto[tenantClaims](validator, cookies[config.SessionCookieName].Value)
+	if validateErr != nil {
+		t.Fatalf("validate session: %v", validateErr)
+	}
+	if decoded.UserID != "google:sub-enriched" || decoded.TenantID != "tenant-42" || decoded.Plan != "free" || len(decoded.Features) != 2 {
+		t.Fatalf("unexpected enriched claims after login: %#v", decoded)
+	}
+	if plan, ok := claims.CustomClaim("acme/plan"); !ok || plan != "free" {
+		t.Fatalf("expected custom claim accessor to return plan, got %v", plan)
+	}
+
+	refreshRequest := httptest.NewRequest(http.MethodPost, "/auth/refresh", nil)
+	addCookies(refreshRequest, cookies, config.RefreshCookieName)
+	refreshResponse := httptest.NewRecorder()
+	router.ServeHTTP(refreshResponse, refreshRequest)
+	if refreshResponse.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 from refresh, got %d", refreshResponse.Code)
+	}
+	refreshed := collectCookies(refreshResponse.Result().Cookies())
+	decoded, _, validateErr = sessionvalidator.ValidateInto[tenantClaims](validator, refreshed[config.SessionCookieName].Value)
+	if validateErr != nil {
+		t.Fatalf("validate refreshed session: %v", validateErr)
+	}
+	if decoded.Plan != "pro" {
+		t.Fatalf("expected refresh to re-run the enricher, got plan %q", decoded.Plan)
+	}
+	if enricher.calls != 2 {
+		t.Fatalf("expected enricher to run on login and refresh, got %d calls", enricher.calls)
+	}
+}
+
+func TestClaimsEnricherRejectsUnsafeClaimNames(t *testing.T) {
+	testCases := []struct {
+		name        string
+		claimName   string
+		expectedErr error
+	}{
+		{name: "Reserved", claimName: "user_roles", expectedErr: sessionvalidator.ErrReservedClaim},
+		{name: "RegisteredClaim", claimName: "exp", expectedErr: sessionvalidator.ErrReservedClaim},
+		{name: "MissingNamespace", claimName: "tenant_id", expectedErr: ErrUnnamespacedClaim},
+		{name: "EmptyNamespace", claimName: "/tenant_id", expectedErr: ErrUnnamespacedClaim},
+	}
+	for _, testCase := range testCases {
+		ProvideClaimsEnricher(&planEnricher{plans: []string{"free"}, extra: map[string]interface{}{testCase.claimName: "value"}})
+		_, err := enrichSessionClaims(context.Background(), "user", "user@example.com", nil)
+		if !errors.Is(err, testCase.expectedErr) {
+			t.Fatalf("%s: expected %v, got %v", testCase.name, testCase.expectedErr, err)
+		}
+	}
+	ProvideClaimsEnricher(nil)
+
+	if claims, err := enrichSessionClaims(context.Background(), "user", "user@example.com", nil); err != nil || claims != nil {
+		t.Fatalf("expected no claims without an enricher, got %v / %v", claims, err)
+	}
+	if err := validateCustomClaimName("https://acme.example/plan"); err != nil {
+		t.Fatalf("expected URI-style namespace to be accepted, got %v", err)
+	}
+}
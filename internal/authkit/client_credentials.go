@@ -0,0 +1,64 @@
+package authkit
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrInvalidClientCredential indicates a client credential without an ID or secret.
+var ErrInvalidClientCredential = errors.New("client_credential.invalid")
+
+// ClientCredential authenticates a back-channel client, such as a service
+// calling the introspection endpoint. Only a digest of the secret is kept.
+type ClientCredential struct {
+	ClientID     string
+	secretDigest [sha256.Size]byte
+}
+
+// NewClientCredential validates and constructs a ClientCredential.
+func NewClientCredential(clientID string, secret string) (ClientCredential, error) {
+	clientID = strings.TrimSpace(clientID)
+	if clientID == "" || secret == "" {
+		return ClientCredential{}, fmt.Errorf("client_credential.new: %w", ErrInvalidClientCredential)
+	}
+	return ClientCredential{ClientID: clientID, secretDigest: sha256.Sum256([]byte(secret))}, nil
+}
+
+func (credential ClientCredential) matches(clientID string, secret string) bool {
+	secretDigest := sha256.Sum256([]byte(secret))
+	idMatches := subtle.ConstantTimeCompare([]byte(credential.ClientID), []byte(clientID)) == 1
+	secretMatches := subtle.ConstantTimeCompare(credential.secretDigest[:], secretDigest[:]) == 1
+	return idMatches && secretMatches
+}
+
+// authenticateClient accepts client_secret_basic (RFC 6749 §2.3.1, with
+// form-encoded ID and secret) or client_secret_post credentials and returns
+// the matching client ID.
+func authenticateClient(request *http.Request, clients []ClientCredential) (string, bool) {
+	clientID, secret, hasBasic := request.BasicAuth()
+	if hasBasic {
+		decodedID, idErr := url.QueryUnescape(clientID)
+		decodedSecret, secretErr := url.QueryUnescape(secret)
+		if idErr != nil || secretErr != nil {
+			return "", false
+		}
+		clientID, secret = decodedID, decodedSecret
+	} else {
+		clientID = request.PostFormValue("client_id")
+		secret = request.PostFormValue("client_secret")
+	}
+	if clientID == "" || secret == "" {
+		return "", false
+	}
+	for _, client := range clients {
+		if client.matches(clientID, secret) {
+			return client.ClientID, true
+		}
+	}
+	return "", false
+}
@@ -3,19 +3,83 @@ package authkit
 import (
 	"net/http"
 	"time"
+
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
 )
 
 // ServerConfig configures issuers, cookies, and TTL.
 type ServerConfig struct {
 	GoogleWebClientID string
-	AppJWTSigningKey  []byte
+	// GoogleWebClientSecret enables Google's authorization code flow.
+	GoogleWebClientSecret string
+	// IdentityProviders are the OpenID Connect providers accepted besides Google.
+	IdentityProviders []IdentityProvider
+	AppJWTKeyring     *Keyring
 	AppJWTIssuer      string
-	CookieDomain      string
-	SessionCookieName string
-	RefreshCookieName string
-	SessionTTL        time.Duration
-	RefreshTTL        time.Duration
-	NonceTTL          time.Duration
-	SameSiteMode      http.SameSite
-	AllowInsecureHTTP bool
+	AppJWTAudience    []string
+	// AppJWTEncryptionKeys seal sessions in a JWE with the first key; any key decrypts.
+	AppJWTEncryptionKeys []sessionvalidator.EncryptionKey
+	PublicBaseURL        string
+	CookieDomain         string
+	SessionCookieName    string
+	RefreshCookieName    string
+	SessionTTL           time.Duration
+	RefreshTTL           time.Duration
+	NonceTTL             time.Duration
+	SameSiteMode         http.SameSite
+	AllowInsecureHTTP    bool
+	// IntrospectionClients may call the introspection endpoint.
+	IntrospectionClients []ClientCredential
+	// ForwardAuthLoginURL receives unauthenticated browser navigations to
+	// /auth/verify; without it they get 401.
+	ForwardAuthLoginURL string
+	// RefreshCookiePath scopes the refresh cookie (default "/auth"); the
+	// authenticating proxy needs "/".
+	RefreshCookiePath string
+	// ReturnToOrigins may receive the authorization code callback's redirect
+	// besides TAuth's own origin.
+	ReturnToOrigins []string
+	// Mailer enables email sign-in; links point at EmailLoginURL (absolute,
+	// or a path under PublicBaseURL) and expire after EmailLoginTTL (default
+	// 10 minutes).
+	Mailer        Mailer
+	EmailLoginURL string
+	EmailLoginTTL time.Duration
+	// WebAuthnRPID enables passkeys for that relying party ID. Assertions must
+	// come from WebAuthnOrigins (default https://{WebAuthnRPID}), and
+	// authenticators show WebAuthnRPName (default "TAuth").
+	WebAuthnRPID    string
+	WebAuthnRPName  string
+	WebAuthnOrigins []string
+	// TOTPIssuer enables TOTP second factors and labels them in authenticator apps.
+	TOTPIssuer string
+	// LoginPolicy restricts which accounts may sign in.
+	LoginPolicy LoginPolicy
+	// RegistrationMode decides whether signing in may create an account;
+	// invitations expire after InvitationTTL (default 7 days).
+	RegistrationMode RegistrationMode
+	InvitationTTL    time.Duration
+	// DeviceClientIDs enables the device authorization grant for those public
+	// clients. Device codes expire after DeviceCodeTTL (default 10 minutes),
+	// and the verification page sends browsers without a session to
+	// DeviceLoginURL.
+	DeviceClientIDs []string
+	DeviceCodeTTL   time.Duration
+	DeviceLoginURL  string
+}
+
+func (configuration ServerConfig) refreshCookiePath() string {
+	if configuration.RefreshCookiePath == "" {
+		return "/auth"
+	}
+	return configuration.RefreshCookiePath
+}
+
+// sessionValidatorConfig returns the validator configuration trusting sessions minted by this server
+// and rejecting the ones revoked through logout or an administrator.
+func (configuration ServerConfig) sessionValidatorConfig() sessionvalidator.Config {
+	validatorConfig := configuration.AppJWTKeyring.ValidatorConfig(configuration.AppJWTIssuer, configuration.SessionCookieName)
+	validatorConfig.EncryptionKeys = configuration.AppJWTEncryptionKeys
+	validatorConfig.RevocationChecker = sessionRevocationChecker{}
+	return validatorConfig
 }
@@ -0,0 +1,151 @@
+package authkit
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var (
+	// ErrCredentialNotFound indicates no passkey is registered under the credential ID.
+	ErrCredentialNotFound = errors.New("credential_store.not_found")
+	// ErrCredentialExists indicates a passkey with the same credential ID is already registered.
+	ErrCredentialExists = errors.New("credential_store.exists")
+	// ErrCredentialInvalid indicates a credential without an ID, public key, or owner.
+	ErrCredentialInvalid = errors.New("credential_store.invalid_credential")
+)
+
+// PasskeyCredential is a WebAuthn credential registered to an application
+// user. Credential holds the public key, signature counter, and flags that
+// later assertions are verified against.
+type PasskeyCredential struct {
+	UserID       string
+	Credential   webauthn.Credential
+	CreatedUnix  int64
+	LastUsedUnix int64
+}
+
+// CredentialStore persists passkeys, keyed by their credential ID.
+type CredentialStore interface {
+	// Create registers credential, failing with ErrCredentialExists when its ID is taken.
+	Create(ctx context.Context, credential PasskeyCredential) error
+	// Get returns the passkey registered under credentialID.
+	Get(ctx context.Context, credentialID []byte) (PasskeyCredential, error)
+	// ListByUser returns the passkeys registered to applicationUserID.
+	ListByUser(ctx context.Context, applicationUserID string) ([]PasskeyCredential, error)
+	// Update stores the counter, flags, and last use of an existing passkey.
+	Update(ctx context.Context, credential PasskeyCredential) error
+}
+
+var configuredCredentials CredentialStore
+
+var defaultCredentials struct {
+	sync.Mutex
+	value CredentialStore
+}
+
+// ProvideCredentialStore injects the store holding registered passkeys.
+// Without one, an in-memory store is used.
+func ProvideCredentialStore(store CredentialStore) {
+	configuredCredentials = store
+	defaultCredentials.Lock()
+	defaultCredentials.value = nil
+	defaultCredentials.Unlock()
+}
+
+func resolveCredentials() CredentialStore {
+	if configuredCredentials != nil {
+		return configuredCredentials
+	}
+	defaultCredentials.Lock()
+	defer defaultCredentials.Unlock()
+	if defaultCredentials.value == nil {
+		defaultCredentials.value = NewMemoryCredentialStore()
+	}
+	return defaultCredentials.value
+}
+
+func validatePasskeyCredential(credential PasskeyCredential) error {
+	if strings.TrimSpace(credential.UserID) == "" || len(credential.Credential.ID) == 0 || len(credential.Credential.PublicKey) == 0 {
+		return ErrCredentialInvalid
+	}
+	return nil
+}
+
+// MemoryCredentialStore keeps passkeys in memory; intended for tests and
+// development, since registrations are lost on restart.
+type MemoryCredentialStore struct {
+	mutex       sync.Mutex
+	credentials map[string]PasskeyCredential
+}
+
+// NewMemoryCredentialStore creates an empty in-memory passkey store.
+func NewMemoryCredentialStore() *MemoryCredentialStore {
+	return &MemoryCredentialStore{credentials: make(map[string]PasskeyCredential)}
+}
+
+// Create registers credential, failing with ErrCredentialExists when its ID is taken.
+func (store *MemoryCredentialStore) Create(ctx context.Context, credential PasskeyCredential) error {
+	if err := validatePasskeyCredential(credential); err != nil {
+		return fmt.Errorf("credential_store.create.memory: %w", err)
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	key := string(credential.Credential.ID)
+	if _, exists := store.credentials[key]; exists {
+		return fmt.Errorf("credential_store.create.memory: %w", ErrCredentialExists)
+	}
+	store.credentials[key] = credential
+	return nil
+}
+
+// Get returns the passkey registered under credentialID.
+func (store *MemoryCredentialStore) Get(ctx context.Context, credentialID []byte) (PasskeyCredential, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	credential, found := store.credentials[string(credentialID)]
+	if !found {
+		return PasskeyCredential{}, fmt.Errorf("credential_store.get.memory: %w", ErrCredentialNotFound)
+	}
+	return credential, nil
+}
+
+// ListByUser returns the passkeys registered to applicationUserID, oldest first.
+func (store *MemoryCredentialStore) ListByUser(ctx context.Context, applicationUserID string) ([]PasskeyCredential, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	var credentials []PasskeyCredential
+	for _, credential := range store.credentials {
+		if credential.UserID == applicationUserID {
+			credentials = append(credentials, credential)
+		}
+	}
+	slices.SortFunc(credentials, func(left PasskeyCredential, right PasskeyCredential) int {
+		if left.CreatedUnix != right.CreatedUnix {
+			return cmp.Compare(left.CreatedUnix, right.CreatedUnix)
+		}
+		return bytes.Compare(left.Credential.ID, right.Credential.ID)
+	})
+	return credentials, nil
+}
+
+// Update stores the counter, flags, and last use of an existing passkey.
+func (store *MemoryCredentialStore) Update(ctx context.Context, credential PasskeyCredential) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	key := string(credential.Credential.ID)
+	existing, found := store.credentials[key]
+	if !found || existing.UserID != credential.UserID {
+		return fmt.Errorf("credential_store.update.memory: %w", ErrCredentialNotFound)
+	}
+	credential.CreatedUnix = existing.CreatedUnix
+	store.credentials[key] = credential
+	return nil
+}
@@ -0,0 +1,108 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+)
+
+func forEachCredentialStore(t *testing.T, test func(t *testing.T, store CredentialStore)) {
+	t.Helper()
+	forEachStore(t,
+		func() CredentialStore { return NewMemoryCredentialStore() },
+		func(ctx context.Context, gormDB *gorm.DB) (CredentialStore, error) {
+			return NewDatabaseCredentialStore(ctx, gormDB)
+		},
+		test,
+	)
+}
+
+func newPasskeyCredentialForTest(userID string, credentialID string, createdUnix int64) PasskeyCredential {
+	return PasskeyCredential{
+		UserID:      userID,
+		CreatedUnix: createdUnix,
+		Credential:  webauthn.Credential{ID: []byte(credentialID), PublicKey: []byte("key-" + credentialID), AttestationType: "none"},
+	}
+}
+
+func TestCredentialStoreRejectsCredentialsWithoutPublicKey(t *testing.T) {
+	forEachCredentialStore(t, func(t *testing.T, store CredentialStore) {
+		err := store.Create(context.Background(), PasskeyCredential{UserID: "user-1", Credential: webauthn.Credential{ID: []byte("no-key")}})
+		if !errors.Is(err, ErrCredentialInvalid) {
+			t.Fatalf("expected ErrCredentialInvalid, got %v", err)
+		}
+	})
+}
+
+func TestCredentialStoreCredentialIDsAreUnique(t *testing.T) {
+	forEachCredentialStore(t, func(t *testing.T, store CredentialStore) {
+		ctx := context.Background()
+		if err := store.Create(ctx, newPasskeyCredentialForTest("user-1", "credential-1", 100)); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if err := store.Create(ctx, newPasskeyCredentialForTest("user-2", "credential-1", 200)); !errors.Is(err, ErrCredentialExists) {
+			t.Fatalf("expected ErrCredentialExists, got %v", err)
+		}
+		fetched, getErr := store.Get(ctx, []byte("credential-1"))
+		if getErr != nil || fetched.UserID != "user-1" {
+			t.Fatalf("expected the first owner to keep the passkey, got %+v (%v)", fetched, getErr)
+		}
+		if _, err := store.Get(ctx, []byte("missing")); !errors.Is(err, ErrCredentialNotFound) {
+			t.Fatalf("expected ErrCredentialNotFound, got %v", err)
+		}
+	})
+}
+
+func TestCredentialStoreListsUserPasskeysOldestFirst(t *testing.T) {
+	forEachCredentialStore(t, func(t *testing.T, store CredentialStore) {
+		ctx := context.Background()
+		for _, credential := range []PasskeyCredential{
+			newPasskeyCredentialForTest("user-1", "credential-2", 200),
+			newPasskeyCredentialForTest("user-1", "credential-1", 100),
+			newPasskeyCredentialForTest("user-2", "credential-3", 50),
+		} {
+			if err := store.Create(ctx, credential); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+		}
+		listed, listErr := store.ListByUser(ctx, "user-1")
+		if listErr != nil || len(listed) != 2 || string(listed[0].Credential.ID) != "credential-1" || string(listed[1].Credential.ID) != "credential-2" {
+			t.Fatalf("expected both passkeys oldest first, got %+v (%v)", listed, listErr)
+		}
+		if others, _ := store.ListByUser(ctx, "user-3"); len(others) != 0 {
+			t.Fatalf("expected no passkeys for another user, got %+v", others)
+		}
+	})
+}
+
+func TestCredentialStoreUpdateKeepsOwnerAndCreation(t *testing.T) {
+	forEachCredentialStore(t, func(t *testing.T, store CredentialStore) {
+		ctx := context.Background()
+		registered := newPasskeyCredentialForTest("user-1", "credential-1", 100)
+		if err := store.Create(ctx, registered); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		used := registered
+		used.Credential.Authenticator.SignCount = 7
+		used.LastUsedUnix = 300
+		if err := store.Update(ctx, used); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		fetched, getErr := store.Get(ctx, []byte("credential-1"))
+		if getErr != nil || fetched.Credential.Authenticator.SignCount != 7 || fetched.LastUsedUnix != 300 || fetched.CreatedUnix != 100 || fetched.Credential.AttestationType != "none" {
+			t.Fatalf("expected the updated passkey, got %+v (%v)", fetched, getErr)
+		}
+
+		stolen := used
+		stolen.UserID = "user-2"
+		if err := store.Update(ctx, stolen); !errors.Is(err, ErrCredentialNotFound) {
+			t.Fatalf("expected another user's update to fail, got %v", err)
+		}
+		if err := store.Update(ctx, newPasskeyCredentialForTest("user-1", "missing", 100)); !errors.Is(err, ErrCredentialNotFound) {
+			t.Fatalf("expected an unknown passkey's update to fail, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package authkit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DatabaseCredentialStore persists passkeys using GORM, next to the refresh
+// tokens of the same database.
+type DatabaseCredentialStore struct {
+	db          *gorm.DB
+	driverLabel string
+}
+
+// webAuthnCredentialRecord stores the webauthn.Credential as JSON so new
+// fields from the WebAuthn library survive without a migration.
+type webAuthnCredentialRecord struct {
+	CredentialID   string `gorm:"column:credential_id;primaryKey"`
+	UserID         string `gorm:"column:user_id;index;not null"`
+	CredentialJSON string `gorm:"column:credential_json;not null"`
+	CreatedUnix    int64  `gorm:"column:created_unix;not null"`
+	LastUsedUnix   int64  `gorm:"column:last_used_unix;not null;default:0"`
+}
+
+func (webAuthnCredentialRecord) TableName() string {
+	return "webauthn_credentials"
+}
+
+func (record webAuthnCredentialRecord) passkeyCredential() (PasskeyCredential, error) {
+	var credential webauthn.Credential
+	if err := json.Unmarshal([]byte(record.CredentialJSON), &credential); err != nil {
+		return PasskeyCredential{}, err
+	}
+	return PasskeyCredential{
+		UserID:       record.UserID,
+		Credential:   credential,
+		CreatedUnix:  record.CreatedUnix,
+		LastUsedUnix: record.LastUsedUnix,
+	}, nil
+}
+
+func encodeCredentialID(credentialID []byte) string {
+	return base64.RawURLEncoding.EncodeToString(credentialID)
+}
+
+// NewDatabaseCredentialStore constructs a GORM-backed passkey store on a
+// database opened by OpenDatabase.
+func NewDatabaseCredentialStore(ctx context.Context, gormDB *gorm.DB) (*DatabaseCredentialStore, error) {
+	driverLabel, err := resolveDriverLabel(gormDB)
+	if err != nil {
+		return nil, fmt.Errorf("credential_store.open: %w", err)
+	}
+	if migrateErr := gormDB.WithContext(ctx).AutoMigrate(&webAuthnCredentialRecord{}); migrateErr != nil {
+		return nil, fmt.Errorf("credential_store.migrate.%s: %w", driverLabel, migrateErr)
+	}
+	return &DatabaseCredentialStore{
+		db:          gormDB,
+		driverLabel: driverLabel,
+	}, nil
+}
+
+// Create registers credential, failing with ErrCredentialExists when its ID is taken.
+func (store *DatabaseCredentialStore) Create(ctx context.Context, credential PasskeyCredential) error {
+	if err := validatePasskeyCredential(credential); err != nil {
+		return fmt.Errorf("credential_store.create.%s: %w", store.driverLabel, err)
+	}
+	credentialJSON, encodeErr := json.Marshal(credential.Credential)
+	if encodeErr != nil {
+		return fmt.Errorf("credential_store.create.%s: %w", store.driverLabel, encodeErr)
+	}
+	record := webAuthnCredentialRecord{
+		CredentialID:   encodeCredentialID(credential.Credential.ID),
+		UserID:         credential.UserID,
+		CredentialJSON: string(credentialJSON),
+		CreatedUnix:    credential.CreatedUnix,
+		LastUsedUnix:   credential.LastUsedUnix,
+	}
+	result := store.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if result.Error != nil {
+		return fmt.Errorf("credential_store.create.%s: %w", store.driverLabel, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("credential_store.create.%s: %w", store.driverLabel, ErrCredentialExists)
+	}
+	return nil
+}
+
+// Get returns the passkey registered under credentialID.
+func (store *DatabaseCredentialStore) Get(ctx context.Context, credentialID []byte) (PasskeyCredential, error) {
+	var record webAuthnCredentialRecord
+	findErr := store.db.WithContext(ctx).Where("credential_id = ?", encodeCredentialID(credentialID)).Take(&record).Error
+	if errors.Is(findErr, gorm.ErrRecordNotFound) {
+		return PasskeyCredential{}, fmt.Errorf("credential_store.get.%s: %w", store.driverLabel, ErrCredentialNotFound)
+	}
+	if findErr != nil {
+		return PasskeyCredential{}, fmt.Errorf("credential_store.get.%s: %w", store.driverLabel, findErr)
+	}
+	credential, decodeErr := record.passkeyCredential()
+	if decodeErr != nil {
+		return PasskeyCredential{}, fmt.Errorf("credential_store.get.%s: %w", store.driverLabel, decodeErr)
+	}
+	return credential, nil
+}
+
+// ListByUser returns the passkeys registered to applicationUserID, oldest first.
+func (store *DatabaseCredentialStore) ListByUser(ctx context.Context, applicationUserID string) ([]PasskeyCredential, error) {
+	var records []webAuthnCredentialRecord
+	if err := store.db.WithContext(ctx).Where("user_id = ?", applicationUserID).Order("created_unix, credential_id").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("credential_store.list.%s: %w", store.driverLabel, err)
+	}
+	credentials := make([]PasskeyCredential, 0, len(records))
+	for _, record := range records {
+		credential, decodeErr := record.passkeyCredential()
+		if decodeErr != nil {
+			return nil, fmt.Errorf("credential_store.list.%s: %w", store.driverLabel, decodeErr)
+		}
+		credentials = append(credentials, credential)
+	}
+	return credentials, nil
+}
+
+// Update stores the counter, flags, and last use of an existing passkey.
+func (store *DatabaseCredentialStore) Update(ctx context.Context, credential PasskeyCredential) error {
+	credentialJSON, encodeErr := json.Marshal(credential.Credential)
+	if encodeErr != nil {
+		return fmt.Errorf("credential_store.update.%s: %w", store.driverLabel, encodeErr)
+	}
+	result := store.db.WithContext(ctx).Model(&webAuthnCredentialRecord{}).
+		Where("credential_id = ? AND user_id = ?", encodeCredentialID(credential.Credential.ID), credential.UserID).
+		Updates(map[string]interface{}{
+			"credential_json": string(credentialJSON),
+			"last_used_unix":  credential.LastUsedUnix,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("credential_store.update.%s: %w", store.driverLabel, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("credential_store.update.%s: %w", store.driverLabel, ErrCredentialNotFound)
+	}
+	return nil
+}
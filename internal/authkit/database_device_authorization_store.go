@@ -0,0 +1,153 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DatabaseDeviceAuthorizationStore persists device authorizations using GORM
+// so the device may poll a different TAuth instance than the one the user
+// approves it on.
+type DatabaseDeviceAuthorizationStore struct {
+	db          *gorm.DB
+	driverLabel string
+}
+
+type deviceAuthorizationRecord struct {
+	DeviceCodeHash string `gorm:"column:device_code_hash;primaryKey"`
+	UserCode       string `gorm:"column:user_code;uniqueIndex;not null"`
+	ClientID       string `gorm:"column:client_id;not null"`
+	Status         string `gorm:"column:status;not null"`
+	UserID         string `gorm:"column:user_id;not null;default:''"`
+	AuthMethods    string `gorm:"column:auth_methods;not null;default:''"`
+	ExpiresUnix    int64  `gorm:"column:expires_unix;index;not null"`
+	LastPolledUnix int64  `gorm:"column:last_polled_unix;not null;default:0"`
+}
+
+func (deviceAuthorizationRecord) TableName() string {
+	return "device_authorizations"
+}
+
+func (record deviceAuthorizationRecord) deviceAuthorization() DeviceAuthorization {
+	return DeviceAuthorization{
+		DeviceCodeHash: record.DeviceCodeHash,
+		UserCode:       record.UserCode,
+		ClientID:       record.ClientID,
+		Status:         DeviceAuthorizationStatus(record.Status),
+		UserID:         record.UserID,
+		AuthMethods:    strings.Fields(record.AuthMethods),
+		ExpiresUnix:    record.ExpiresUnix,
+		LastPolledUnix: record.LastPolledUnix,
+	}
+}
+
+// NewDatabaseDeviceAuthorizationStore constructs a GORM-backed device
+// authorization store on a database opened by OpenDatabase.
+func NewDatabaseDeviceAuthorizationStore(ctx context.Context, gormDB *gorm.DB) (*DatabaseDeviceAuthorizationStore, error) {
+	driverLabel, err := resolveDriverLabel(gormDB)
+	if err != nil {
+		return nil, fmt.Errorf("device_authorization_store.open: %w", err)
+	}
+	if migrateErr := gormDB.WithContext(ctx).AutoMigrate(&deviceAuthorizationRecord{}); migrateErr != nil {
+		return nil, fmt.Errorf("device_authorization_store.migrate.%s: %w", driverLabel, migrateErr)
+	}
+	return &DatabaseDeviceAuthorizationStore{
+		db:          gormDB,
+		driverLabel: driverLabel,
+	}, nil
+}
+
+// Create stores a pending authorization and deletes expired ones.
+func (store *DatabaseDeviceAuthorizationStore) Create(ctx context.Context, authorization DeviceAuthorization) error {
+	if err := validateDeviceAuthorization(authorization); err != nil {
+		return fmt.Errorf("device_authorization_store.create.%s: %w", store.driverLabel, err)
+	}
+	if err := store.db.WithContext(ctx).Where("expires_unix < ?", time.Now().UTC().Unix()).Delete(&deviceAuthorizationRecord{}).Error; err != nil {
+		return fmt.Errorf("device_authorization_store.prune.%s: %w", store.driverLabel, err)
+	}
+	record := deviceAuthorizationRecord{
+		DeviceCodeHash: authorization.DeviceCodeHash,
+		UserCode:       authorization.UserCode,
+		ClientID:       authorization.ClientID,
+		Status:         string(DeviceAuthorizationPending),
+		ExpiresUnix:    authorization.ExpiresUnix,
+	}
+	result := store.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if result.Error != nil {
+		return fmt.Errorf("device_authorization_store.create.%s: %w", store.driverLabel, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("device_authorization_store.create.%s: %w", store.driverLabel, ErrDeviceAuthorizationExists)
+	}
+	return nil
+}
+
+// GetByUserCode returns the authorization awaiting the user code.
+func (store *DatabaseDeviceAuthorizationStore) GetByUserCode(ctx context.Context, userCode string) (DeviceAuthorization, error) {
+	var record deviceAuthorizationRecord
+	findErr := store.db.WithContext(ctx).Where("user_code = ? AND status = ?", userCode, string(DeviceAuthorizationPending)).Take(&record).Error
+	if errors.Is(findErr, gorm.ErrRecordNotFound) {
+		return DeviceAuthorization{}, fmt.Errorf("device_authorization_store.get.%s: %w", store.driverLabel, ErrDeviceAuthorizationNotFound)
+	}
+	if findErr != nil {
+		return DeviceAuthorization{}, fmt.Errorf("device_authorization_store.get.%s: %w", store.driverLabel, findErr)
+	}
+	return record.deviceAuthorization(), nil
+}
+
+// Decide records the user's decision on a pending authorization. The update
+// only matches pending rows, so a code is decided once.
+func (store *DatabaseDeviceAuthorizationStore) Decide(ctx context.Context, userCode string, status DeviceAuthorizationStatus, applicationUserID string, authMethods []string) error {
+	result := store.db.WithContext(ctx).Model(&deviceAuthorizationRecord{}).
+		Where("user_code = ? AND status = ?", userCode, string(DeviceAuthorizationPending)).
+		Updates(map[string]interface{}{
+			"status":       string(status),
+			"user_id":      applicationUserID,
+			"auth_methods": strings.Join(authMethods, " "),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("device_authorization_store.decide.%s: %w", store.driverLabel, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("device_authorization_store.decide.%s: %w", store.driverLabel, ErrDeviceAuthorizationNotFound)
+	}
+	return nil
+}
+
+// Poll returns the authorization as it was before this poll and records polledUnix.
+func (store *DatabaseDeviceAuthorizationStore) Poll(ctx context.Context, deviceCodeHash string, polledUnix int64) (DeviceAuthorization, error) {
+	var record deviceAuthorizationRecord
+	findErr := store.db.WithContext(ctx).Where("device_code_hash = ?", deviceCodeHash).Take(&record).Error
+	if errors.Is(findErr, gorm.ErrRecordNotFound) {
+		return DeviceAuthorization{}, fmt.Errorf("device_authorization_store.poll.%s: %w", store.driverLabel, ErrDeviceAuthorizationNotFound)
+	}
+	if findErr != nil {
+		return DeviceAuthorization{}, fmt.Errorf("device_authorization_store.poll.%s: %w", store.driverLabel, findErr)
+	}
+	updateErr := store.db.WithContext(ctx).Model(&deviceAuthorizationRecord{}).
+		Where("device_code_hash = ?", deviceCodeHash).
+		Update("last_polled_unix", polledUnix).Error
+	if updateErr != nil {
+		return DeviceAuthorization{}, fmt.Errorf("device_authorization_store.poll.%s: %w", store.driverLabel, updateErr)
+	}
+	return record.deviceAuthorization(), nil
+}
+
+// Delete removes the authorization. Only the delete that removes the row
+// succeeds, so concurrent polls redeem an approval once.
+func (store *DatabaseDeviceAuthorizationStore) Delete(ctx context.Context, deviceCodeHash string) error {
+	result := store.db.WithContext(ctx).Where("device_code_hash = ?", deviceCodeHash).Delete(&deviceAuthorizationRecord{})
+	if result.Error != nil {
+		return fmt.Errorf("device_authorization_store.delete.%s: %w", store.driverLabel, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("device_authorization_store.delete.%s: %w", store.driverLabel, ErrDeviceAuthorizationNotFound)
+	}
+	return nil
+}
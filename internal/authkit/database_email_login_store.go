@@ -0,0 +1,141 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DatabaseEmailLoginStore persists pending email sign-ins using GORM so any
+// TAuth instance can complete a sign-in another one started.
+type DatabaseEmailLoginStore struct {
+	db          *gorm.DB
+	driverLabel string
+}
+
+type emailChallengeRecord struct {
+	Email         string `gorm:"column:email;primaryKey"`
+	LinkTokenHash string `gorm:"column:link_token_hash;uniqueIndex;not null"`
+	CodeHash      string `gorm:"column:code_hash;not null"`
+	ExpiresUnix   int64  `gorm:"column:expires_unix;index;not null"`
+	Attempts      int    `gorm:"column:attempts;not null;default:0"`
+}
+
+func (emailChallengeRecord) TableName() string {
+	return "email_login_challenges"
+}
+
+func (record emailChallengeRecord) challenge() EmailChallenge {
+	return EmailChallenge{
+		Email:         record.Email,
+		LinkTokenHash: record.LinkTokenHash,
+		CodeHash:      record.CodeHash,
+		ExpiresUnix:   record.ExpiresUnix,
+		Attempts:      record.Attempts,
+	}
+}
+
+// NewDatabaseEmailLoginStore constructs a GORM-backed email sign-in store on a
+// database opened by OpenDatabase.
+func NewDatabaseEmailLoginStore(ctx context.Context, gormDB *gorm.DB) (*DatabaseEmailLoginStore, error) {
+	driverLabel, err := resolveDriverLabel(gormDB)
+	if err != nil {
+		return nil, fmt.Errorf("email_login_store.open: %w", err)
+	}
+	if migrateErr := gormDB.WithContext(ctx).AutoMigrate(&emailChallengeRecord{}); migrateErr != nil {
+		return nil, fmt.Errorf("email_login_store.migrate.%s: %w", driverLabel, migrateErr)
+	}
+	return &DatabaseEmailLoginStore{
+		db:          gormDB,
+		driverLabel: driverLabel,
+	}, nil
+}
+
+// Create stores challenge, replacing any earlier challenge for its email, and
+// deletes expired challenges.
+func (store *DatabaseEmailLoginStore) Create(ctx context.Context, challenge EmailChallenge) error {
+	if err := validateEmailChallenge(challenge); err != nil {
+		return fmt.Errorf("email_login_store.create.%s: %w", store.driverLabel, err)
+	}
+	if err := store.db.WithContext(ctx).Where("expires_unix < ?", time.Now().UTC().Unix()).Delete(&emailChallengeRecord{}).Error; err != nil {
+		return fmt.Errorf("email_login_store.prune.%s: %w", store.driverLabel, err)
+	}
+	record := emailChallengeRecord{
+		Email:         challenge.Email,
+		LinkTokenHash: challenge.LinkTokenHash,
+		CodeHash:      challenge.CodeHash,
+		ExpiresUnix:   challenge.ExpiresUnix,
+	}
+	err := store.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "email"}},
+		DoUpdates: clause.AssignmentColumns([]string{"link_token_hash", "code_hash", "expires_unix", "attempts"}),
+	}).Create(&record).Error
+	if err != nil {
+		return fmt.Errorf("email_login_store.create.%s: %w", store.driverLabel, err)
+	}
+	return nil
+}
+
+// ConsumeLink removes and returns the challenge whose link token hashes to
+// linkTokenHash. The delete decides between concurrent consumers.
+func (store *DatabaseEmailLoginStore) ConsumeLink(ctx context.Context, linkTokenHash string) (EmailChallenge, error) {
+	var record emailChallengeRecord
+	findErr := store.db.WithContext(ctx).Where("link_token_hash = ?", linkTokenHash).First(&record).Error
+	if errors.Is(findErr, gorm.ErrRecordNotFound) {
+		return EmailChallenge{}, fmt.Errorf("email_login_store.consume_link.%s: %w", store.driverLabel, ErrEmailChallengeNotFound)
+	}
+	if findErr != nil {
+		return EmailChallenge{}, fmt.Errorf("email_login_store.consume_link.%s: %w", store.driverLabel, findErr)
+	}
+	return store.deleteExact(ctx, "consume_link", record)
+}
+
+// ConsumeCode removes and returns email's challenge when codeHash matches. A
+// mismatch counts an attempt and withdraws the challenge after maxAttempts.
+func (store *DatabaseEmailLoginStore) ConsumeCode(ctx context.Context, email string, codeHash string, maxAttempts int) (EmailChallenge, error) {
+	var record emailChallengeRecord
+	findErr := store.db.WithContext(ctx).Where("email = ?", email).First(&record).Error
+	if errors.Is(findErr, gorm.ErrRecordNotFound) {
+		return EmailChallenge{}, fmt.Errorf("email_login_store.consume_code.%s: %w", store.driverLabel, ErrEmailChallengeNotFound)
+	}
+	if findErr != nil {
+		return EmailChallenge{}, fmt.Errorf("email_login_store.consume_code.%s: %w", store.driverLabel, findErr)
+	}
+	if record.CodeHash == codeHash {
+		return store.deleteExact(ctx, "consume_code", record)
+	}
+
+	// Only the attempt that still sees the current count moves it forward, so
+	// concurrent guesses cannot exceed maxAttempts.
+	attempted := store.db.WithContext(ctx).Model(&emailChallengeRecord{}).
+		Where("email = ? AND link_token_hash = ? AND attempts = ?", record.Email, record.LinkTokenHash, record.Attempts)
+	var updateErr error
+	if record.Attempts+1 >= maxAttempts {
+		updateErr = attempted.Delete(&emailChallengeRecord{}).Error
+	} else {
+		updateErr = attempted.Update("attempts", record.Attempts+1).Error
+	}
+	if updateErr != nil {
+		return EmailChallenge{}, fmt.Errorf("email_login_store.consume_code.%s: %w", store.driverLabel, updateErr)
+	}
+	return EmailChallenge{}, fmt.Errorf("email_login_store.consume_code.%s: %w", store.driverLabel, ErrEmailChallengeNotFound)
+}
+
+// deleteExact deletes record only if it is unchanged; the caller that deletes
+// it owns the sign-in.
+func (store *DatabaseEmailLoginStore) deleteExact(ctx context.Context, operation string, record emailChallengeRecord) (EmailChallenge, error) {
+	result := store.db.WithContext(ctx).
+		Where("email = ? AND link_token_hash = ? AND attempts = ?", record.Email, record.LinkTokenHash, record.Attempts).
+		Delete(&emailChallengeRecord{})
+	if result.Error != nil {
+		return EmailChallenge{}, fmt.Errorf("email_login_store.%s.%s: %w", operation, store.driverLabel, result.Error)
+	}
+	if result.RowsAffected != 1 {
+		return EmailChallenge{}, fmt.Errorf("email_login_store.%s.%s: %w", operation, store.driverLabel, ErrEmailChallengeNotFound)
+	}
+	return record.challenge(), nil
+}
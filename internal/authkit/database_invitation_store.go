@@ -0,0 +1,127 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DatabaseInvitationStore persists invitations using GORM so every TAuth
+// instance admits the same invited addresses.
+type DatabaseInvitationStore struct {
+	db          *gorm.DB
+	driverLabel string
+}
+
+type invitationRecord struct {
+	Email       string `gorm:"column:email;primaryKey"`
+	InvitedBy   string `gorm:"column:invited_by;not null;default:''"`
+	CreatedUnix int64  `gorm:"column:created_unix;not null"`
+	ExpiresUnix int64  `gorm:"column:expires_unix;index;not null"`
+}
+
+func (invitationRecord) TableName() string {
+	return "invitations"
+}
+
+func (record invitationRecord) invitation() Invitation {
+	return Invitation{
+		Email:       record.Email,
+		InvitedBy:   record.InvitedBy,
+		CreatedUnix: record.CreatedUnix,
+		ExpiresUnix: record.ExpiresUnix,
+	}
+}
+
+// NewDatabaseInvitationStore constructs a GORM-backed invitation store on a
+// database opened by OpenDatabase.
+func NewDatabaseInvitationStore(ctx context.Context, gormDB *gorm.DB) (*DatabaseInvitationStore, error) {
+	driverLabel, err := resolveDriverLabel(gormDB)
+	if err != nil {
+		return nil, fmt.Errorf("invitation_store.open: %w", err)
+	}
+	if migrateErr := gormDB.WithContext(ctx).AutoMigrate(&invitationRecord{}); migrateErr != nil {
+		return nil, fmt.Errorf("invitation_store.migrate.%s: %w", driverLabel, migrateErr)
+	}
+	return &DatabaseInvitationStore{
+		db:          gormDB,
+		driverLabel: driverLabel,
+	}, nil
+}
+
+// Create stores invitation, replacing any earlier invitation for its email,
+// and deletes expired invitations.
+func (store *DatabaseInvitationStore) Create(ctx context.Context, invitation Invitation) error {
+	if err := validateInvitation(invitation); err != nil {
+		return fmt.Errorf("invitation_store.create.%s: %w", store.driverLabel, err)
+	}
+	if err := store.db.WithContext(ctx).Where("expires_unix < ?", time.Now().UTC().Unix()).Delete(&invitationRecord{}).Error; err != nil {
+		return fmt.Errorf("invitation_store.prune.%s: %w", store.driverLabel, err)
+	}
+	record := invitationRecord{
+		Email:       invitation.Email,
+		InvitedBy:   invitation.InvitedBy,
+		CreatedUnix: invitation.CreatedUnix,
+		ExpiresUnix: invitation.ExpiresUnix,
+	}
+	err := store.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "email"}},
+		DoUpdates: clause.AssignmentColumns([]string{"invited_by", "created_unix", "expires_unix"}),
+	}).Create(&record).Error
+	if err != nil {
+		return fmt.Errorf("invitation_store.create.%s: %w", store.driverLabel, err)
+	}
+	return nil
+}
+
+// List returns every stored invitation ordered by email.
+func (store *DatabaseInvitationStore) List(ctx context.Context) ([]Invitation, error) {
+	var records []invitationRecord
+	if err := store.db.WithContext(ctx).Order("email").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("invitation_store.list.%s: %w", store.driverLabel, err)
+	}
+	invitations := make([]Invitation, 0, len(records))
+	for _, record := range records {
+		invitations = append(invitations, record.invitation())
+	}
+	return invitations, nil
+}
+
+// Revoke removes email's invitation.
+func (store *DatabaseInvitationStore) Revoke(ctx context.Context, email string) error {
+	result := store.db.WithContext(ctx).Where("email = ?", email).Delete(&invitationRecord{})
+	if result.Error != nil {
+		return fmt.Errorf("invitation_store.revoke.%s: %w", store.driverLabel, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("invitation_store.revoke.%s: %w", store.driverLabel, ErrInvitationNotFound)
+	}
+	return nil
+}
+
+// Redeem removes and returns email's invitation. The delete only matches the
+// invitation that was read, and decides between concurrent sign-ins.
+func (store *DatabaseInvitationStore) Redeem(ctx context.Context, email string) (Invitation, error) {
+	var record invitationRecord
+	findErr := store.db.WithContext(ctx).Where("email = ?", email).Take(&record).Error
+	if errors.Is(findErr, gorm.ErrRecordNotFound) {
+		return Invitation{}, fmt.Errorf("invitation_store.redeem.%s: %w", store.driverLabel, ErrInvitationNotFound)
+	}
+	if findErr != nil {
+		return Invitation{}, fmt.Errorf("invitation_store.redeem.%s: %w", store.driverLabel, findErr)
+	}
+	result := store.db.WithContext(ctx).
+		Where("email = ? AND created_unix = ? AND expires_unix = ?", record.Email, record.CreatedUnix, record.ExpiresUnix).
+		Delete(&invitationRecord{})
+	if result.Error != nil {
+		return Invitation{}, fmt.Errorf("invitation_store.redeem.%s: %w", store.driverLabel, result.Error)
+	}
+	if result.RowsAffected != 1 {
+		return Invitation{}, fmt.Errorf("invitation_store.redeem.%s: %w", store.driverLabel, ErrInvitationNotFound)
+	}
+	return record.invitation(), nil
+}
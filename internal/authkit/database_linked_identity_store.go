@@ -0,0 +1,132 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DatabaseLinkedIdentityStore persists linked identities using GORM so every
+// TAuth instance resolves them to the same account.
+type DatabaseLinkedIdentityStore struct {
+	db          *gorm.DB
+	driverLabel string
+}
+
+type linkedIdentityRecord struct {
+	Provider    string `gorm:"column:provider;primaryKey"`
+	Subject     string `gorm:"column:subject;primaryKey"`
+	UserID      string `gorm:"column:user_id;index;not null"`
+	Email       string `gorm:"column:email;not null;default:''"`
+	CreatedUnix int64  `gorm:"column:created_unix;not null"`
+}
+
+func (linkedIdentityRecord) TableName() string {
+	return "linked_identities"
+}
+
+func (record linkedIdentityRecord) linkedIdentity() LinkedIdentity {
+	return LinkedIdentity{
+		Provider:    record.Provider,
+		Subject:     record.Subject,
+		UserID:      record.UserID,
+		Email:       record.Email,
+		CreatedUnix: record.CreatedUnix,
+	}
+}
+
+// NewDatabaseLinkedIdentityStore constructs a GORM-backed linked identity
+// store on a database opened by OpenDatabase.
+func NewDatabaseLinkedIdentityStore(ctx context.Context, gormDB *gorm.DB) (*DatabaseLinkedIdentityStore, error) {
+	driverLabel, err := resolveDriverLabel(gormDB)
+	if err != nil {
+		return nil, fmt.Errorf("linked_identity_store.open: %w", err)
+	}
+	if migrateErr := gormDB.WithContext(ctx).AutoMigrate(&linkedIdentityRecord{}); migrateErr != nil {
+		return nil, fmt.Errorf("linked_identity_store.migrate.%s: %w", driverLabel, migrateErr)
+	}
+	return &DatabaseLinkedIdentityStore{
+		db:          gormDB,
+		driverLabel: driverLabel,
+	}, nil
+}
+
+// Create links identity, failing with ErrLinkedIdentityExists when the
+// provider and subject are already linked.
+func (store *DatabaseLinkedIdentityStore) Create(ctx context.Context, identity LinkedIdentity) error {
+	if err := validateLinkedIdentity(identity); err != nil {
+		return fmt.Errorf("linked_identity_store.create.%s: %w", store.driverLabel, err)
+	}
+	record := linkedIdentityRecord{
+		Provider:    identity.Provider,
+		Subject:     identity.Subject,
+		UserID:      identity.UserID,
+		Email:       identity.Email,
+		CreatedUnix: identity.CreatedUnix,
+	}
+	result := store.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if result.Error != nil {
+		return fmt.Errorf("linked_identity_store.create.%s: %w", store.driverLabel, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("linked_identity_store.create.%s: %w", store.driverLabel, ErrLinkedIdentityExists)
+	}
+	return nil
+}
+
+// Get returns the link for the provider and subject.
+func (store *DatabaseLinkedIdentityStore) Get(ctx context.Context, provider string, subject string) (LinkedIdentity, error) {
+	var record linkedIdentityRecord
+	findErr := store.db.WithContext(ctx).Where("provider = ? AND subject = ?", provider, subject).Take(&record).Error
+	if errors.Is(findErr, gorm.ErrRecordNotFound) {
+		return LinkedIdentity{}, fmt.Errorf("linked_identity_store.get.%s: %w", store.driverLabel, ErrLinkedIdentityNotFound)
+	}
+	if findErr != nil {
+		return LinkedIdentity{}, fmt.Errorf("linked_identity_store.get.%s: %w", store.driverLabel, findErr)
+	}
+	return record.linkedIdentity(), nil
+}
+
+// ListByUser returns the identities linked to applicationUserID, oldest first.
+func (store *DatabaseLinkedIdentityStore) ListByUser(ctx context.Context, applicationUserID string) ([]LinkedIdentity, error) {
+	var records []linkedIdentityRecord
+	if err := store.db.WithContext(ctx).Where("user_id = ?", applicationUserID).Order("created_unix, provider, subject").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("linked_identity_store.list.%s: %w", store.driverLabel, err)
+	}
+	identities := make([]LinkedIdentity, 0, len(records))
+	for _, record := range records {
+		identities = append(identities, record.linkedIdentity())
+	}
+	return identities, nil
+}
+
+// UpdateEmail records the address the provider now reports for the identity.
+func (store *DatabaseLinkedIdentityStore) UpdateEmail(ctx context.Context, provider string, subject string, email string) error {
+	result := store.db.WithContext(ctx).Model(&linkedIdentityRecord{}).
+		Where("provider = ? AND subject = ?", provider, subject).
+		Update("email", email)
+	if result.Error != nil {
+		return fmt.Errorf("linked_identity_store.update_email.%s: %w", store.driverLabel, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("linked_identity_store.update_email.%s: %w", store.driverLabel, ErrLinkedIdentityNotFound)
+	}
+	return nil
+}
+
+// Delete unlinks the identity from applicationUserID.
+func (store *DatabaseLinkedIdentityStore) Delete(ctx context.Context, applicationUserID string, provider string, subject string) error {
+	result := store.db.WithContext(ctx).
+		Where("user_id = ? AND provider = ? AND subject = ?", applicationUserID, provider, subject).
+		Delete(&linkedIdentityRecord{})
+	if result.Error != nil {
+		return fmt.Errorf("linked_identity_store.delete.%s: %w", store.driverLabel, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("linked_identity_store.delete.%s: %w", store.driverLabel, ErrLinkedIdentityNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DatabasePendingSecondFactorStore persists sign-ins waiting for their second
+// factor using GORM so any TAuth instance can complete them.
+type DatabasePendingSecondFactorStore struct {
+	db          *gorm.DB
+	driverLabel string
+}
+
+type pendingSecondFactorRecord struct {
+	TokenHash   string `gorm:"column:token_hash;primaryKey"`
+	UserID      string `gorm:"column:user_id;not null"`
+	ExpiresUnix int64  `gorm:"column:expires_unix;index;not null"`
+	Attempts    int    `gorm:"column:attempts;not null;default:0"`
+}
+
+func (pendingSecondFactorRecord) TableName() string {
+	return "pending_second_factors"
+}
+
+// NewDatabasePendingSecondFactorStore constructs a GORM-backed pending sign-in
+// store on a database opened by OpenDatabase.
+func NewDatabasePendingSecondFactorStore(ctx context.Context, gormDB *gorm.DB) (*DatabasePendingSecondFactorStore, error) {
+	driverLabel, err := resolveDriverLabel(gormDB)
+	if err != nil {
+		return nil, fmt.Errorf("pending_second_factor_store.open: %w", err)
+	}
+	if migrateErr := gormDB.WithContext(ctx).AutoMigrate(&pendingSecondFactorRecord{}); migrateErr != nil {
+		return nil, fmt.Errorf("pending_second_factor_store.migrate.%s: %w", driverLabel, migrateErr)
+	}
+	return &DatabasePendingSecondFactorStore{
+		db:          gormDB,
+		driverLabel: driverLabel,
+	}, nil
+}
+
+// Create stores pending and deletes expired sign-ins.
+func (store *DatabasePendingSecondFactorStore) Create(ctx context.Context, pending PendingSecondFactor) error {
+	if err := validatePendingSecondFactor(pending); err != nil {
+		return fmt.Errorf("pending_second_factor_store.create.%s: %w", store.driverLabel, err)
+	}
+	if err := store.db.WithContext(ctx).Where("expires_unix < ?", time.Now().UTC().Unix()).Delete(&pendingSecondFactorRecord{}).Error; err != nil {
+		return fmt.Errorf("pending_second_factor_store.prune.%s: %w", store.driverLabel, err)
+	}
+	record := pendingSecondFactorRecord{
+		TokenHash:   pending.TokenHash,
+		UserID:      pending.UserID,
+		ExpiresUnix: pending.ExpiresUnix,
+	}
+	if err := store.db.WithContext(ctx).Create(&record).Error; err != nil {
+		return fmt.Errorf("pending_second_factor_store.create.%s: %w", store.driverLabel, err)
+	}
+	return nil
+}
+
+// Get returns the unexpired sign-in whose token hashes to tokenHash.
+func (store *DatabasePendingSecondFactorStore) Get(ctx context.Context, tokenHash string) (PendingSecondFactor, error) {
+	var record pendingSecondFactorRecord
+	findErr := store.db.WithContext(ctx).
+		Where("token_hash = ? AND expires_unix >= ?", tokenHash, time.Now().UTC().Unix()).
+		Take(&record).Error
+	if errors.Is(findErr, gorm.ErrRecordNotFound) {
+		return PendingSecondFactor{}, fmt.Errorf("pending_second_factor_store.get.%s: %w", store.driverLabel, ErrPendingSecondFactorNotFound)
+	}
+	if findErr != nil {
+		return PendingSecondFactor{}, fmt.Errorf("pending_second_factor_store.get.%s: %w", store.driverLabel, findErr)
+	}
+	return PendingSecondFactor{
+		TokenHash:   record.TokenHash,
+		UserID:      record.UserID,
+		ExpiresUnix: record.ExpiresUnix,
+		Attempts:    record.Attempts,
+	}, nil
+}
+
+// RecordFailure counts a wrong code and withdraws the sign-in after
+// maxAttempts. The update is conditional on the count it read, so concurrent
+// failures cannot exceed maxAttempts.
+func (store *DatabasePendingSecondFactorStore) RecordFailure(ctx context.Context, tokenHash string, maxAttempts int) error {
+	var record pendingSecondFactorRecord
+	findErr := store.db.WithContext(ctx).Where("token_hash = ?", tokenHash).Take(&record).Error
+	if errors.Is(findErr, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("pending_second_factor_store.record_failure.%s: %w", store.driverLabel, ErrPendingSecondFactorNotFound)
+	}
+	if findErr != nil {
+		return fmt.Errorf("pending_second_factor_store.record_failure.%s: %w", store.driverLabel, findErr)
+	}
+	attempted := store.db.WithContext(ctx).Model(&pendingSecondFactorRecord{}).
+		Where("token_hash = ? AND attempts = ?", record.TokenHash, record.Attempts)
+	var updateErr error
+	if record.Attempts+1 >= maxAttempts {
+		updateErr = attempted.Delete(&pendingSecondFactorRecord{}).Error
+	} else {
+		updateErr = attempted.Update("attempts", record.Attempts+1).Error
+	}
+	if updateErr != nil {
+		return fmt.Errorf("pending_second_factor_store.record_failure.%s: %w", store.driverLabel, updateErr)
+	}
+	return nil
+}
+
+// Delete removes the sign-in whose token hashes to tokenHash. The delete
+// decides between concurrent callers.
+func (store *DatabasePendingSecondFactorStore) Delete(ctx context.Context, tokenHash string) error {
+	result := store.db.WithContext(ctx).Where("token_hash = ?", tokenHash).Delete(&pendingSecondFactorRecord{})
+	if result.Error != nil {
+		return fmt.Errorf("pending_second_factor_store.delete.%s: %w", store.driverLabel, result.Error)
+	}
+	if result.RowsAffected != 1 {
+		return fmt.Errorf("pending_second_factor_store.delete.%s: %w", store.driverLabel, ErrPendingSecondFactorNotFound)
+	}
+	return nil
+}
@@ -20,6 +20,7 @@ var (
 
 	errEmptyOpaqueToken      = errors.New("refresh_store.empty_token")
 	errEmptyDatabaseURL      = errors.New("refresh_store.empty_database_url")
+	errNilDatabase           = errors.New("refresh_store.nil_database")
 	errSQLiteEmptyPath       = errors.New("refresh_store.sqlite.empty_path")
 	errSQLiteInvalidURL      = errors.New("refresh_store.sqlite.invalid_url")
 	errSQLiteUnsupportedHost = errors.New("refresh_store.sqlite.unsupported_host")
@@ -44,6 +45,10 @@ type refreshTokenRecord struct {
 	ExpiresUnix     int64  `gorm:"column:expires_unix;not null"`
 	RevokedAtUnix   int64  `gorm:"column:revoked_at_unix;not null;default:0"`
 	PreviousTokenID string `gorm:"column:previous_token_id;not null;default:''"`
+	SessionID       string `gorm:"column:session_id;index;not null;default:''"`
+	AuthMethods     string `gorm:"column:auth_methods;not null;default:''"`
+	ClientID        string `gorm:"column:client_id;not null;default:''"`
+	AuthTimeUnix    int64  `gorm:"column:auth_time_unix;not null;default:0"`
 	IssuedAtUnix    int64  `gorm:"column:issued_at_unix;not null"`
 }
 
@@ -51,10 +56,10 @@ func (refreshTokenRecord) TableName() string {
 	return "refresh_tokens"
 }
 
-// NewDatabaseRefreshTokenStore constructs a GORM-backed store.
-func NewDatabaseRefreshTokenStore(ctx context.Context, databaseURL string) (*DatabaseRefreshTokenStore, error) {
+// OpenDatabase opens the connection pool shared by every GORM-backed store.
+func OpenDatabase(databaseURL string) (*gorm.DB, error) {
 	if strings.TrimSpace(databaseURL) == "" {
-		return nil, fmt.Errorf("refresh_store.open: %w", errEmptyDatabaseURL)
+		return nil, fmt.Errorf("database.open: %w", errEmptyDatabaseURL)
 	}
 	dialector, driverLabel, err := resolveDialector(databaseURL)
 	if err != nil {
@@ -64,7 +69,16 @@ func NewDatabaseRefreshTokenStore(ctx context.Context, databaseURL string) (*Dat
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
 	if openErr != nil {
-		return nil, fmt.Errorf("refresh_store.open.%s: %w", driverLabel, openErr)
+		return nil, fmt.Errorf("database.open.%s: %w", driverLabel, openErr)
+	}
+	return gormDB, nil
+}
+
+// NewDatabaseRefreshTokenStore constructs a GORM-backed store on a database opened by OpenDatabase.
+func NewDatabaseRefreshTokenStore(ctx context.Context, gormDB *gorm.DB) (*DatabaseRefreshTokenStore, error) {
+	driverLabel, err := resolveDriverLabel(gormDB)
+	if err != nil {
+		return nil, fmt.Errorf("refresh_store.open: %w", err)
 	}
 	if migrateErr := gormDB.WithContext(ctx).AutoMigrate(&refreshTokenRecord{}); migrateErr != nil {
 		return nil, fmt.Errorf("refresh_store.migrate.%s: %w", driverLabel, migrateErr)
@@ -76,13 +90,33 @@ func NewDatabaseRefreshTokenStore(ctx context.Context, databaseURL string) (*Dat
 }
 
 // Issue inserts a new refresh token record and returns its identifiers.
-func (store *DatabaseRefreshTokenStore) Issue(ctx context.Context, applicationUserID string, expiresUnix int64, previousTokenID string) (string, string, error) {
+func (store *DatabaseRefreshTokenStore) Issue(ctx context.Context, applicationUserID string, expiresUnix int64, previousTokenID string, authMethods []string, clientID string, authTimeUnix int64) (string, string, error) {
 	now := time.Now().UTC()
 	tokenID := newRefreshTokenID(now)
 	opaqueToken, hashValue, randomErr := generateRefreshOpaque()
 	if randomErr != nil {
 		return "", "", fmt.Errorf("refresh_store.issue.%s: %w", store.driverLabel, randomErr)
 	}
+	var inheritedSessionID string
+	encodedAuthMethods := strings.Join(authMethods, " ")
+	if previousTokenID != "" {
+		var previous refreshTokenRecord
+		previousErr := store.db.WithContext(ctx).Select("session_id", "auth_methods", "client_id", "auth_time_unix").Where("token_id = ?", previousTokenID).Take(&previous).Error
+		if errors.Is(previousErr, gorm.ErrRecordNotFound) {
+			return "", "", fmt.Errorf("refresh_store.issue.%s: %w", store.driverLabel, ErrRefreshTokenNotFound)
+		}
+		if previousErr != nil {
+			return "", "", fmt.Errorf("refresh_store.issue.%s: %w", store.driverLabel, previousErr)
+		}
+		inheritedSessionID = previous.SessionID
+		encodedAuthMethods = previous.AuthMethods
+		clientID = previous.ClientID
+		authTimeUnix = previous.AuthTimeUnix
+	}
+	sessionID, sessionErr := resolveSessionID(inheritedSessionID)
+	if sessionErr != nil {
+		return "", "", fmt.Errorf("refresh_store.issue.%s: %w", store.driverLabel, sessionErr)
+	}
 	record := refreshTokenRecord{
 		TokenID:         tokenID,
 		UserID:          applicationUserID,
@@ -90,6 +124,10 @@ func (store *DatabaseRefreshTokenStore) Issue(ctx context.Context, applicationUs
 		ExpiresUnix:     expiresUnix,
 		RevokedAtUnix:   0,
 		PreviousTokenID: previousTokenID,
+		SessionID:       sessionID,
+		AuthMethods:     encodedAuthMethods,
+		ClientID:        clientID,
+		AuthTimeUnix:    authTimeUnix,
 		IssuedAtUnix:    now.Unix(),
 	}
 	if err := store.db.WithContext(ctx).Create(&record).Error; err != nil {
@@ -148,6 +186,65 @@ func (store *DatabaseRefreshTokenStore) Revoke(ctx context.Context, tokenID stri
 	return nil
 }
 
+// SessionID returns the session the refresh token belongs to.
+func (store *DatabaseRefreshTokenStore) SessionID(ctx context.Context, tokenID string) (string, error) {
+	var record refreshTokenRecord
+	err := store.db.WithContext(ctx).Select("session_id").Where("token_id = ?", tokenID).Take(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", fmt.Errorf("refresh_store.session_id.%s: %w", store.driverLabel, ErrRefreshTokenNotFound)
+		}
+		return "", fmt.Errorf("refresh_store.session_id.%s: %w", store.driverLabel, err)
+	}
+	return record.SessionID, nil
+}
+
+// AuthMethods returns how the refresh token's session was authenticated.
+func (store *DatabaseRefreshTokenStore) AuthMethods(ctx context.Context, tokenID string) ([]string, error) {
+	var record refreshTokenRecord
+	err := store.db.WithContext(ctx).Select("auth_methods").Where("token_id = ?", tokenID).Take(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("refresh_store.auth_methods.%s: %w", store.driverLabel, ErrRefreshTokenNotFound)
+		}
+		return nil, fmt.Errorf("refresh_store.auth_methods.%s: %w", store.driverLabel, err)
+	}
+	return strings.Fields(record.AuthMethods), nil
+}
+
+// ClientID returns the OAuth client the refresh token was issued to.
+func (store *DatabaseRefreshTokenStore) ClientID(ctx context.Context, tokenID string) (string, error) {
+	var record refreshTokenRecord
+	err := store.db.WithContext(ctx).Select("client_id").Where("token_id = ?", tokenID).Take(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", fmt.Errorf("refresh_store.client_id.%s: %w", store.driverLabel, ErrRefreshTokenNotFound)
+		}
+		return "", fmt.Errorf("refresh_store.client_id.%s: %w", store.driverLabel, err)
+	}
+	return record.ClientID, nil
+}
+
+// AuthTime returns when the refresh token's session was authenticated.
+func (store *DatabaseRefreshTokenStore) AuthTime(ctx context.Context, tokenID string) (int64, error) {
+	var record refreshTokenRecord
+	err := store.db.WithContext(ctx).Select("auth_time_unix").Where("token_id = ?", tokenID).Take(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, fmt.Errorf("refresh_store.auth_time.%s: %w", store.driverLabel, ErrRefreshTokenNotFound)
+		}
+		return 0, fmt.Errorf("refresh_store.auth_time.%s: %w", store.driverLabel, err)
+	}
+	return record.AuthTimeUnix, nil
+}
+
+func resolveDriverLabel(gormDB *gorm.DB) (string, error) {
+	if gormDB == nil || gormDB.Dialector == nil {
+		return "", errNilDatabase
+	}
+	return gormDB.Dialector.Name(), nil
+}
+
 func resolveDialector(databaseURL string) (gorm.Dialector, string, error) {
 	parsed, err := url.Parse(databaseURL)
 	if err != nil {
@@ -0,0 +1,119 @@
+package authkit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	revocationKindSession = "session"
+	revocationKindToken   = "token"
+)
+
+// DatabaseSessionRevocationStore persists revoked sessions and tokens using GORM
+// so every TAuth instance sees the same revocations.
+type DatabaseSessionRevocationStore struct {
+	db          *gorm.DB
+	driverLabel string
+}
+
+type sessionRevocationRecord struct {
+	Kind          string `gorm:"column:kind;primaryKey"`
+	Identifier    string `gorm:"column:identifier;primaryKey"`
+	ExpiresUnix   int64  `gorm:"column:expires_unix;index;not null"`
+	RevokedAtUnix int64  `gorm:"column:revoked_at_unix;not null"`
+}
+
+func (sessionRevocationRecord) TableName() string {
+	return "session_revocations"
+}
+
+// NewDatabaseSessionRevocationStore constructs a GORM-backed revocation store.
+// It shares the database opened by OpenDatabase with the refresh token store.
+func NewDatabaseSessionRevocationStore(ctx context.Context, gormDB *gorm.DB) (*DatabaseSessionRevocationStore, error) {
+	driverLabel, err := resolveDriverLabel(gormDB)
+	if err != nil {
+		return nil, fmt.Errorf("revocation_store.open: %w", err)
+	}
+	if migrateErr := gormDB.WithContext(ctx).AutoMigrate(&sessionRevocationRecord{}); migrateErr != nil {
+		return nil, fmt.Errorf("revocation_store.migrate.%s: %w", driverLabel, migrateErr)
+	}
+	return &DatabaseSessionRevocationStore{
+		db:          gormDB,
+		driverLabel: driverLabel,
+	}, nil
+}
+
+// RevokeSession revokes every token carrying sessionID until expiresUnix.
+func (store *DatabaseSessionRevocationStore) RevokeSession(ctx context.Context, sessionID string, expiresUnix int64) error {
+	if err := store.revoke(ctx, revocationKindSession, sessionID, expiresUnix); err != nil {
+		return fmt.Errorf("revocation_store.revoke_session.%s: %w", store.driverLabel, err)
+	}
+	return nil
+}
+
+// RevokeToken revokes the token identified by its jti until expiresUnix.
+func (store *DatabaseSessionRevocationStore) RevokeToken(ctx context.Context, tokenID string, expiresUnix int64) error {
+	if err := store.revoke(ctx, revocationKindToken, tokenID, expiresUnix); err != nil {
+		return fmt.Errorf("revocation_store.revoke_token.%s: %w", store.driverLabel, err)
+	}
+	return nil
+}
+
+// IsRevoked reports whether the session or the token has an unexpired revocation.
+func (store *DatabaseSessionRevocationStore) IsRevoked(ctx context.Context, sessionID string, tokenID string) (bool, error) {
+	var count int64
+	err := store.db.WithContext(ctx).Model(&sessionRevocationRecord{}).
+		Where("expires_unix >= ?", time.Now().UTC().Unix()).
+		Where(store.db.Where("kind = ? AND identifier = ? AND identifier <> ''", revocationKindSession, sessionID).
+			Or("kind = ? AND identifier = ? AND identifier <> ''", revocationKindToken, tokenID)).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("revocation_store.is_revoked.%s: %w", store.driverLabel, err)
+	}
+	return count > 0, nil
+}
+
+// ListRevoked returns the sessions and tokens with unexpired revocations and
+// deletes the expired ones.
+func (store *DatabaseSessionRevocationStore) ListRevoked(ctx context.Context) ([]string, []string, error) {
+	nowUnix := time.Now().UTC().Unix()
+	if err := store.db.WithContext(ctx).Where("expires_unix < ?", nowUnix).Delete(&sessionRevocationRecord{}).Error; err != nil {
+		return nil, nil, fmt.Errorf("revocation_store.prune.%s: %w", store.driverLabel, err)
+	}
+	var records []sessionRevocationRecord
+	if err := store.db.WithContext(ctx).Order("identifier").Find(&records).Error; err != nil {
+		return nil, nil, fmt.Errorf("revocation_store.list.%s: %w", store.driverLabel, err)
+	}
+	sessionIDs := make([]string, 0, len(records))
+	tokenIDs := make([]string, 0, len(records))
+	for _, record := range records {
+		if record.Kind == revocationKindSession {
+			sessionIDs = append(sessionIDs, record.Identifier)
+			continue
+		}
+		tokenIDs = append(tokenIDs, record.Identifier)
+	}
+	return sessionIDs, tokenIDs, nil
+}
+
+func (store *DatabaseSessionRevocationStore) revoke(ctx context.Context, kind string, identifier string, expiresUnix int64) error {
+	if strings.TrimSpace(identifier) == "" {
+		return ErrRevocationEmptyIdentifier
+	}
+	record := sessionRevocationRecord{
+		Kind:          kind,
+		Identifier:    identifier,
+		ExpiresUnix:   expiresUnix,
+		RevokedAtUnix: time.Now().UTC().Unix(),
+	}
+	return store.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "kind"}, {Name: "identifier"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"expires_unix": gorm.Expr("CASE WHEN session_revocations.expires_unix > ? THEN session_revocations.expires_unix ELSE ? END", expiresUnix, expiresUnix)}),
+	}).Create(&record).Error
+}
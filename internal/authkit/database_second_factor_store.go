@@ -0,0 +1,171 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DatabaseSecondFactorStore persists TOTP enrollments and recovery codes
+// using GORM so every TAuth instance enforces the same second factors.
+type DatabaseSecondFactorStore struct {
+	db          *gorm.DB
+	driverLabel string
+}
+
+type totpEnrollmentRecord struct {
+	UserID       string `gorm:"column:user_id;primaryKey"`
+	Secret       string `gorm:"column:secret;not null"`
+	Confirmed    bool   `gorm:"column:confirmed;not null;default:false"`
+	LastUsedStep int64  `gorm:"column:last_used_step;not null;default:0"`
+	CreatedUnix  int64  `gorm:"column:created_unix;not null"`
+}
+
+func (totpEnrollmentRecord) TableName() string {
+	return "totp_enrollments"
+}
+
+type recoveryCodeRecord struct {
+	UserID   string `gorm:"column:user_id;primaryKey"`
+	CodeHash string `gorm:"column:code_hash;primaryKey"`
+}
+
+func (recoveryCodeRecord) TableName() string {
+	return "recovery_codes"
+}
+
+// NewDatabaseSecondFactorStore constructs a GORM-backed second factor store
+// on a database opened by OpenDatabase.
+func NewDatabaseSecondFactorStore(ctx context.Context, gormDB *gorm.DB) (*DatabaseSecondFactorStore, error) {
+	driverLabel, err := resolveDriverLabel(gormDB)
+	if err != nil {
+		return nil, fmt.Errorf("second_factor_store.open: %w", err)
+	}
+	if migrateErr := gormDB.WithContext(ctx).AutoMigrate(&totpEnrollmentRecord{}, &recoveryCodeRecord{}); migrateErr != nil {
+		return nil, fmt.Errorf("second_factor_store.migrate.%s: %w", driverLabel, migrateErr)
+	}
+	return &DatabaseSecondFactorStore{
+		db:          gormDB,
+		driverLabel: driverLabel,
+	}, nil
+}
+
+// Get returns the user's enrollment with its unused recovery code hashes.
+func (store *DatabaseSecondFactorStore) Get(ctx context.Context, applicationUserID string) (TOTPEnrollment, error) {
+	var record totpEnrollmentRecord
+	findErr := store.db.WithContext(ctx).Where("user_id = ?", applicationUserID).Take(&record).Error
+	if errors.Is(findErr, gorm.ErrRecordNotFound) {
+		return TOTPEnrollment{}, fmt.Errorf("second_factor_store.get.%s: %w", store.driverLabel, ErrSecondFactorNotFound)
+	}
+	if findErr != nil {
+		return TOTPEnrollment{}, fmt.Errorf("second_factor_store.get.%s: %w", store.driverLabel, findErr)
+	}
+	var codeHashes []string
+	if err := store.db.WithContext(ctx).Model(&recoveryCodeRecord{}).Where("user_id = ?", applicationUserID).Order("code_hash").Pluck("code_hash", &codeHashes).Error; err != nil {
+		return TOTPEnrollment{}, fmt.Errorf("second_factor_store.get.%s: %w", store.driverLabel, err)
+	}
+	return TOTPEnrollment{
+		UserID:             record.UserID,
+		Secret:             record.Secret,
+		Confirmed:          record.Confirmed,
+		LastUsedStep:       record.LastUsedStep,
+		RecoveryCodeHashes: codeHashes,
+		CreatedUnix:        record.CreatedUnix,
+	}, nil
+}
+
+// Save creates or replaces the user's enrollment and recovery codes in one transaction.
+func (store *DatabaseSecondFactorStore) Save(ctx context.Context, enrollment TOTPEnrollment) error {
+	if err := validateTOTPEnrollment(enrollment); err != nil {
+		return fmt.Errorf("second_factor_store.save.%s: %w", store.driverLabel, err)
+	}
+	record := totpEnrollmentRecord{
+		UserID:       enrollment.UserID,
+		Secret:       enrollment.Secret,
+		Confirmed:    enrollment.Confirmed,
+		LastUsedStep: enrollment.LastUsedStep,
+		CreatedUnix:  enrollment.CreatedUnix,
+	}
+	err := store.db.WithContext(ctx).Transaction(func(transaction *gorm.DB) error {
+		upsertErr := transaction.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"secret", "confirmed", "last_used_step", "created_unix"}),
+		}).Create(&record).Error
+		if upsertErr != nil {
+			return upsertErr
+		}
+		if deleteErr := transaction.Where("user_id = ?", enrollment.UserID).Delete(&recoveryCodeRecord{}).Error; deleteErr != nil {
+			return deleteErr
+		}
+		if len(enrollment.RecoveryCodeHashes) == 0 {
+			return nil
+		}
+		codes := make([]recoveryCodeRecord, 0, len(enrollment.RecoveryCodeHashes))
+		for _, codeHash := range enrollment.RecoveryCodeHashes {
+			codes = append(codes, recoveryCodeRecord{UserID: enrollment.UserID, CodeHash: codeHash})
+		}
+		return transaction.Create(&codes).Error
+	})
+	if err != nil {
+		return fmt.Errorf("second_factor_store.save.%s: %w", store.driverLabel, err)
+	}
+	return nil
+}
+
+// Delete removes the user's enrollment and recovery codes.
+func (store *DatabaseSecondFactorStore) Delete(ctx context.Context, applicationUserID string) error {
+	var deleted int64
+	err := store.db.WithContext(ctx).Transaction(func(transaction *gorm.DB) error {
+		if deleteErr := transaction.Where("user_id = ?", applicationUserID).Delete(&recoveryCodeRecord{}).Error; deleteErr != nil {
+			return deleteErr
+		}
+		result := transaction.Where("user_id = ?", applicationUserID).Delete(&totpEnrollmentRecord{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return fmt.Errorf("second_factor_store.delete.%s: %w", store.driverLabel, err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("second_factor_store.delete.%s: %w", store.driverLabel, ErrSecondFactorNotFound)
+	}
+	return nil
+}
+
+// UseTOTPStep records that a code for step was accepted. The conditional
+// update decides between concurrent uses of the same code.
+func (store *DatabaseSecondFactorStore) UseTOTPStep(ctx context.Context, applicationUserID string, step int64) error {
+	result := store.db.WithContext(ctx).Model(&totpEnrollmentRecord{}).
+		Where("user_id = ? AND last_used_step < ?", applicationUserID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return fmt.Errorf("second_factor_store.use_totp_step.%s: %w", store.driverLabel, result.Error)
+	}
+	if result.RowsAffected == 1 {
+		return nil
+	}
+	var count int64
+	if err := store.db.WithContext(ctx).Model(&totpEnrollmentRecord{}).Where("user_id = ?", applicationUserID).Count(&count).Error; err != nil {
+		return fmt.Errorf("second_factor_store.use_totp_step.%s: %w", store.driverLabel, err)
+	}
+	if count == 0 {
+		return fmt.Errorf("second_factor_store.use_totp_step.%s: %w", store.driverLabel, ErrSecondFactorNotFound)
+	}
+	return fmt.Errorf("second_factor_store.use_totp_step.%s: %w", store.driverLabel, ErrTOTPStepUsed)
+}
+
+// UseRecoveryCode removes the user's recovery code hashing to codeHash; the
+// caller whose delete succeeds owns the code.
+func (store *DatabaseSecondFactorStore) UseRecoveryCode(ctx context.Context, applicationUserID string, codeHash string) error {
+	result := store.db.WithContext(ctx).Where("user_id = ? AND code_hash = ?", applicationUserID, codeHash).Delete(&recoveryCodeRecord{})
+	if result.Error != nil {
+		return fmt.Errorf("second_factor_store.use_recovery_code.%s: %w", store.driverLabel, result.Error)
+	}
+	if result.RowsAffected != 1 {
+		return fmt.Errorf("second_factor_store.use_recovery_code.%s: %w", store.driverLabel, ErrRecoveryCodeNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,489 @@
+package authkit
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+	"go.uber.org/zap"
+)
+
+const (
+	deviceCodePath         = "/auth/device/code"
+	deviceVerificationPath = "/auth/device"
+	tokenPath              = "/auth/token"
+
+	grantTypeDeviceCode   = "urn:ietf:params:oauth:grant-type:device_code"
+	grantTypeRefreshToken = "refresh_token"
+
+	defaultDeviceCodeTTL = 10 * time.Minute
+	devicePollInterval   = 5 * time.Second
+	deviceCodeByteLength = 32
+
+	// userCodeAlphabet holds consonants only, so user codes never spell
+	// words and survive being read aloud (RFC 8628 section 6.1).
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+
+	// deviceCSRFCookieName carries the nonce behind the verification page's
+	// csrf_token field, so only a page TAuth rendered can post a decision.
+	deviceCSRFCookieName = "app_device_csrf"
+
+	// Rate limits applied per TAuth instance within deviceRateWindow.
+	deviceRateWindow             = 15 * time.Minute
+	deviceCodesPerClient         = 20
+	deviceVerificationsPerClient = 30
+)
+
+func (configuration ServerConfig) deviceCodeTTL() time.Duration {
+	if configuration.DeviceCodeTTL <= 0 {
+		return defaultDeviceCodeTTL
+	}
+	return configuration.DeviceCodeTTL
+}
+
+// devicePageTemplate is the verification page. It has no scripts, so the
+// page works under the strict Content-Security-Policy it is served with.
+var devicePageTemplate = template.Must(template.New("device").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Device sign-in</title>
+</head>
+<body>
+<main>
+<h1>Device sign-in</h1>
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if .ClientID}}
+<p>Signed in as {{.Email}}. <strong>{{.ClientID}}</strong> is asking to sign in as you.</p>
+<p>Continue only if your device shows the code <strong>{{.UserCode}}</strong>.</p>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="user_code" value="{{.UserCode}}">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<button type="submit" name="decision" value="approve">Approve</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+{{else if .ShowCodeForm}}
+<form method="get" action="{{.Action}}">
+<label for="user_code">Enter the code shown on your device</label>
+<input id="user_code" name="user_code" autocomplete="off" autocapitalize="characters" required>
+<button type="submit">Continue</button>
+</form>
+{{end}}
+</main>
+</body>
+</html>
+`))
+
+type devicePage struct {
+	Action       string
+	Message      string
+	ShowCodeForm bool
+	ClientID     string
+	UserCode     string
+	Email        string
+	CSRFToken    string
+}
+
+// mountDeviceAuthorizationRoutes registers the RFC 8628 device authorization
+// grant: devices request a device code and user code, a signed-in user
+// approves the user code on the verification page, and the device polls the
+// token endpoint until it receives an access token and a refresh token. The
+// token endpoint also rotates those refresh tokens.
+func mountDeviceAuthorizationRoutes(router gin.IRouter, clock Clock, configuration ServerConfig, sessionValidator *sessionvalidator.Validator, users UserStore, refreshTokens RefreshTokenStore) {
+	codesPerClient := newAttemptLimiter(deviceCodesPerClient, deviceRateWindow)
+	verificationsPerClient := newAttemptLimiter(deviceVerificationsPerClient, deviceRateWindow)
+
+	router.POST(deviceCodePath, func(contextGin *gin.Context) {
+		contextGin.Header("Cache-Control", "no-store")
+		clientID, admitted := admitDeviceClient(contextGin, configuration)
+		if !admitted {
+			return
+		}
+		if !allowAttempt(contextGin, codesPerClient, contextGin.ClientIP(), clock.Now().UTC()) {
+			return
+		}
+		deviceCode, userCode, issueErr := issueDeviceAuthorization(contextGin, clock, configuration, clientID)
+		if issueErr != nil {
+			logAuthError("auth.device.issue", issueErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		recordMetric(metricAuthDeviceCodeIssued)
+		verificationURI := strings.TrimRight(requestBaseURL(configuration, contextGin.Request), "/") + deviceVerificationPath
+		contextGin.JSON(http.StatusOK, gin.H{
+			"device_code":               deviceCode,
+			"user_code":                 formatUserCode(userCode),
+			"verification_uri":          verificationURI,
+			"verification_uri_complete": verificationURI + "?user_code=" + url.QueryEscape(formatUserCode(userCode)),
+			"expires_in":                int(configuration.deviceCodeTTL().Seconds()),
+			"interval":                  int(devicePollInterval.Seconds()),
+		})
+	})
+
+	router.GET(deviceVerificationPath, func(contextGin *gin.Context) {
+		claims, validateErr := sessionValidator.ValidateRequest(contextGin.Request)
+		if validateErr != nil {
+			if configuration.DeviceLoginURL != "" {
+				returnTo := strings.TrimRight(requestBaseURL(configuration, contextGin.Request), "/") + contextGin.Request.URL.RequestURI()
+				if loginURL, ok := loginRedirectURL(configuration.DeviceLoginURL, returnTo); ok {
+					contextGin.Redirect(http.StatusFound, loginURL)
+					contextGin.Abort()
+					return
+				}
+			}
+			renderDevicePage(contextGin, http.StatusUnauthorized, devicePage{Message: "Sign in first, then open this page again."})
+			return
+		}
+		rawUserCode := contextGin.Query("user_code")
+		if strings.TrimSpace(rawUserCode) == "" {
+			renderDevicePage(contextGin, http.StatusOK, devicePage{ShowCodeForm: true})
+			return
+		}
+		if !allowAttempt(contextGin, verificationsPerClient, contextGin.ClientIP(), clock.Now().UTC()) {
+			return
+		}
+		authorization, found := lookupDeviceAuthorization(contextGin, clock, normalizeUserCode(rawUserCode))
+		if !found {
+			return
+		}
+		csrfToken, csrfErr := issueDeviceCSRFToken(contextGin, configuration, claims)
+		if csrfErr != nil {
+			logAuthError("auth.device.csrf_issue", csrfErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		renderDevicePage(contextGin, http.StatusOK, devicePage{
+			ClientID:  authorization.ClientID,
+			UserCode:  formatUserCode(authorization.UserCode),
+			Email:     claims.GetUserEmail(),
+			CSRFToken: csrfToken,
+		})
+	})
+
+	router.POST(deviceVerificationPath, func(contextGin *gin.Context) {
+		if fetchSite := contextGin.GetHeader("Sec-Fetch-Site"); fetchSite != "" && fetchSite != "same-origin" && fetchSite != "none" {
+			logAuthWarning("auth.device.cross_site", nil, zap.String("sec_fetch_site", fetchSite))
+			renderDevicePage(contextGin, http.StatusForbidden, devicePage{Message: "Approve devices from this page only."})
+			return
+		}
+		if origin := contextGin.GetHeader("Origin"); origin != "" && origin != urlOrigin(requestBaseURL(configuration, contextGin.Request)) {
+			logAuthWarning("auth.device.cross_site", nil, zap.String("origin", origin))
+			renderDevicePage(contextGin, http.StatusForbidden, devicePage{Message: "Approve devices from this page only."})
+			return
+		}
+		claims, validateErr := sessionValidator.ValidateRequest(contextGin.Request)
+		if validateErr != nil {
+			renderDevicePage(contextGin, http.StatusUnauthorized, devicePage{Message: "Sign in first, then open this page again."})
+			return
+		}
+		if !verifyDeviceCSRFToken(contextGin, claims) {
+			logAuthWarning("auth.device.invalid_csrf_token", nil)
+			renderDevicePage(contextGin, http.StatusForbidden, devicePage{Message: "Approve devices from this page only."})
+			return
+		}
+		if !allowAttempt(contextGin, verificationsPerClient, contextGin.ClientIP(), clock.Now().UTC()) {
+			return
+		}
+		var status DeviceAuthorizationStatus
+		switch contextGin.PostForm("decision") {
+		case "approve":
+			status = DeviceAuthorizationApproved
+		case "deny":
+			status = DeviceAuthorizationDenied
+		default:
+			renderDevicePage(contextGin, http.StatusBadRequest, devicePage{Message: "Choose whether to approve the device.", ShowCodeForm: true})
+			return
+		}
+		userCode := normalizeUserCode(contextGin.PostForm("user_code"))
+		authorization, found := lookupDeviceAuthorization(contextGin, clock, userCode)
+		if !found {
+			return
+		}
+		decideErr := resolveDeviceAuthorizations().Decide(contextGin, userCode, status, claims.GetUserID(), claims.GetAuthMethods())
+		if errors.Is(decideErr, ErrDeviceAuthorizationNotFound) {
+			renderDevicePage(contextGin, http.StatusNotFound, devicePage{Message: "This code was already used or has expired.", ShowCodeForm: true})
+			return
+		}
+		if decideErr != nil {
+			logAuthError("auth.device.decide", decideErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if status == DeviceAuthorizationDenied {
+			recordMetric(metricAuthDeviceDenied)
+			renderDevicePage(contextGin, http.StatusOK, devicePage{Message: "The sign-in was denied. You can close this page."})
+			return
+		}
+		recordMetric(metricAuthDeviceApproved)
+		renderDevicePage(contextGin, http.StatusOK, devicePage{Message: fmt.Sprintf("%s is signed in. You can close this page and return to your device.", authorization.ClientID)})
+	})
+
+	router.POST(tokenPath, func(contextGin *gin.Context) {
+		contextGin.Header("Cache-Control", "no-store")
+		clientID, admitted := admitDeviceClient(contextGin, configuration)
+		if !admitted {
+			return
+		}
+		switch contextGin.PostForm("grant_type") {
+		case grantTypeDeviceCode:
+			redeemDeviceCode(contextGin, clock, configuration, users, refreshTokens, clientID)
+		case grantTypeRefreshToken:
+			refreshToken := strings.TrimSpace(contextGin.PostForm("refresh_token"))
+			if refreshToken == "" {
+				contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+				return
+			}
+			tokens, failureStatus := rotateSessionTokens(contextGin, clock, configuration, users, refreshTokens, clientID, refreshToken)
+			if failureStatus == http.StatusUnauthorized {
+				contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+				return
+			}
+			if failureStatus != 0 {
+				contextGin.AbortWithStatus(failureStatus)
+				return
+			}
+			writeTokenResponse(contextGin, clock, tokens)
+		default:
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unsupported_grant_type"})
+		}
+	})
+}
+
+// admitDeviceClient requires HTTPS and a client_id listed in
+// ServerConfig.DeviceClientIDs. Device clients are public: they hold no secret.
+func admitDeviceClient(contextGin *gin.Context, configuration ServerConfig) (string, bool) {
+	if !configuration.AllowInsecureHTTP && !isHTTPS(contextGin.Request) {
+		logAuthWarning("auth.device.insecure_http", nil)
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "https_required"})
+		return "", false
+	}
+	clientID := strings.TrimSpace(contextGin.PostForm("client_id"))
+	if clientID == "" || !slices.Contains(configuration.DeviceClientIDs, clientID) {
+		logAuthWarning("auth.device.invalid_client", nil, zap.String("client_id", clientID))
+		contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+		return "", false
+	}
+	return clientID, true
+}
+
+// issueDeviceAuthorization stores a pending authorization for clientID and
+// returns its device code and normalized user code. A user code that is
+// already pending is drawn again.
+func issueDeviceAuthorization(contextGin *gin.Context, clock Clock, configuration ServerConfig, clientID string) (string, string, error) {
+	randomBytes := make([]byte, deviceCodeByteLength)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", "", fmt.Errorf("device_authorization.random: %w", err)
+	}
+	deviceCode := base64.RawURLEncoding.EncodeToString(randomBytes)
+	for {
+		userCode, userCodeErr := newUserCode()
+		if userCodeErr != nil {
+			return "", "", userCodeErr
+		}
+		createErr := resolveDeviceAuthorizations().Create(contextGin, DeviceAuthorization{
+			DeviceCodeHash: hashOpaque(deviceCode),
+			UserCode:       userCode,
+			ClientID:       clientID,
+			ExpiresUnix:    clock.Now().UTC().Add(configuration.deviceCodeTTL()).Unix(),
+		})
+		if errors.Is(createErr, ErrDeviceAuthorizationExists) {
+			continue
+		}
+		return deviceCode, userCode, createErr
+	}
+}
+
+// lookupDeviceAuthorization returns the pending, unexpired authorization for
+// userCode, or renders the page explaining why there is none.
+func lookupDeviceAuthorization(contextGin *gin.Context, clock Clock, userCode string) (DeviceAuthorization, bool) {
+	authorization, lookupErr := resolveDeviceAuthorizations().GetByUserCode(contextGin, userCode)
+	if lookupErr != nil && !errors.Is(lookupErr, ErrDeviceAuthorizationNotFound) {
+		logAuthError("auth.device.store", lookupErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return DeviceAuthorization{}, false
+	}
+	if lookupErr != nil || authorization.ExpiresUnix < clock.Now().UTC().Unix() {
+		logAuthWarning("auth.device.unknown_user_code", lookupErr)
+		renderDevicePage(contextGin, http.StatusNotFound, devicePage{Message: "This code is not valid or has expired. Check the code on your device and try again.", ShowCodeForm: true})
+		return DeviceAuthorization{}, false
+	}
+	return authorization, true
+}
+
+// redeemDeviceCode answers a device's poll. Until the user decides it reports
+// authorization_pending, and slow_down when polled faster than
+// devicePollInterval; an approved authorization is deleted as its tokens are
+// issued, so it is redeemed once.
+func redeemDeviceCode(contextGin *gin.Context, clock Clock, configuration ServerConfig, users UserStore, refreshTokens RefreshTokenStore, clientID string) {
+	deviceCode := strings.TrimSpace(contextGin.PostForm("device_code"))
+	if deviceCode == "" {
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+		return
+	}
+	store := resolveDeviceAuthorizations()
+	deviceCodeHash := hashOpaque(deviceCode)
+	nowUnix := clock.Now().UTC().Unix()
+	authorization, pollErr := store.Poll(contextGin, deviceCodeHash, nowUnix)
+	if pollErr != nil && !errors.Is(pollErr, ErrDeviceAuthorizationNotFound) {
+		logAuthError("auth.device.store", pollErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if pollErr != nil || authorization.ClientID != clientID {
+		logAuthWarning("auth.device.invalid_grant", pollErr, zap.String("client_id", clientID))
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		return
+	}
+	if authorization.ExpiresUnix < nowUnix {
+		if deleteErr := store.Delete(contextGin, deviceCodeHash); deleteErr != nil && !errors.Is(deleteErr, ErrDeviceAuthorizationNotFound) {
+			logAuthWarning("auth.device.delete", deleteErr)
+		}
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "expired_token"})
+		return
+	}
+	if authorization.LastPolledUnix > 0 && nowUnix-authorization.LastPolledUnix < int64(devicePollInterval/time.Second) {
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "slow_down"})
+		return
+	}
+	switch authorization.Status {
+	case DeviceAuthorizationApproved:
+	case DeviceAuthorizationDenied:
+		if deleteErr := store.Delete(contextGin, deviceCodeHash); deleteErr != nil && !errors.Is(deleteErr, ErrDeviceAuthorizationNotFound) {
+			logAuthWarning("auth.device.delete", deleteErr)
+		}
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "access_denied"})
+		return
+	default:
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "authorization_pending"})
+		return
+	}
+
+	deleteErr := store.Delete(contextGin, deviceCodeHash)
+	if errors.Is(deleteErr, ErrDeviceAuthorizationNotFound) {
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		return
+	}
+	if deleteErr != nil {
+		logAuthError("auth.device.delete", deleteErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	userEmail, userDisplayName, userAvatarURL, userRoles, profileErr := users.GetUserProfile(contextGin, authorization.UserID)
+	if profileErr != nil {
+		logAuthWarning("auth.device.profile", profileErr, zap.String("user_id", authorization.UserID))
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		return
+	}
+	tokens, issued := issueSessionTokens(contextGin, clock, configuration, refreshTokens, clientID, authorization.AuthMethods, authorization.UserID, userEmail, userDisplayName, userAvatarURL, userRoles)
+	if !issued {
+		return
+	}
+	recordMetric(metricAuthDeviceAuthorized)
+	writeTokenResponse(contextGin, clock, tokens)
+}
+
+// writeTokenResponse writes an RFC 6749 access token response carrying the
+// session JWT as a bearer token and the opaque refresh token.
+func writeTokenResponse(contextGin *gin.Context, clock Clock, tokens sessionTokens) {
+	contextGin.JSON(http.StatusOK, gin.H{
+		"access_token":  tokens.sessionToken,
+		"token_type":    "Bearer",
+		"expires_in":    max(0, int(tokens.sessionExpiresAt.Sub(clock.Now().UTC()).Seconds())),
+		"refresh_token": tokens.refreshToken,
+	})
+}
+
+// issueDeviceCSRFToken sets a fresh nonce cookie and returns the form token
+// derived from it and the viewer's session, so a token works only for the
+// browser and session that loaded the page. The cookie is SameSite=Strict
+// even when sessions are not: decisions are posted from TAuth's own page.
+func issueDeviceCSRFToken(contextGin *gin.Context, configuration ServerConfig, claims *JwtCustomClaims) (string, error) {
+	nonce, nonceErr := newRandomIdentifier()
+	if nonceErr != nil {
+		return "", nonceErr
+	}
+	http.SetCookie(contextGin.Writer, &http.Cookie{
+		Name:     deviceCSRFCookieName,
+		Value:    nonce,
+		Path:     deviceVerificationPath,
+		Domain:   configuration.CookieDomain,
+		MaxAge:   int(configuration.deviceCodeTTL().Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return deviceCSRFToken(nonce, claims), nil
+}
+
+func verifyDeviceCSRFToken(contextGin *gin.Context, claims *JwtCustomClaims) bool {
+	cookie, cookieErr := contextGin.Request.Cookie(deviceCSRFCookieName)
+	formToken := contextGin.PostForm("csrf_token")
+	if cookieErr != nil || cookie.Value == "" || formToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(formToken), []byte(deviceCSRFToken(cookie.Value, claims))) == 1
+}
+
+// deviceCSRFToken binds nonce to the session, or to the user for sessions
+// minted before session IDs existed.
+func deviceCSRFToken(nonce string, claims *JwtCustomClaims) string {
+	binding := claims.GetSessionID()
+	if binding == "" {
+		binding = claims.GetUserID()
+	}
+	return hashOpaque(nonce + "." + binding)
+}
+
+func renderDevicePage(contextGin *gin.Context, status int, page devicePage) {
+	page.Action = deviceVerificationPath
+	var rendered strings.Builder
+	if err := devicePageTemplate.Execute(&rendered, page); err != nil {
+		logAuthError("auth.device.render", err)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	contextGin.Header("Cache-Control", "no-store")
+	contextGin.Header("Content-Security-Policy", "default-src 'none'; form-action 'self'; frame-ancestors 'none'")
+	contextGin.Header("X-Frame-Options", "DENY")
+	contextGin.Data(status, "text/html; charset=utf-8", []byte(rendered.String()))
+	contextGin.Abort()
+}
+
+func newUserCode() (string, error) {
+	alphabetSize := big.NewInt(int64(len(userCodeAlphabet)))
+	var userCode strings.Builder
+	for position := 0; position < userCodeLength; position++ {
+		index, randomErr := rand.Int(rand.Reader, alphabetSize)
+		if randomErr != nil {
+			return "", fmt.Errorf("device_authorization.random: %w", randomErr)
+		}
+		userCode.WriteByte(userCodeAlphabet[index.Int64()])
+	}
+	return userCode.String(), nil
+}
+
+// normalizeUserCode ignores case, spaces, and dashes.
+func normalizeUserCode(rawUserCode string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(strings.TrimSpace(rawUserCode)))
+}
+
+// formatUserCode splits a normalized user code as XXXX-XXXX for display.
+func formatUserCode(userCode string) string {
+	if len(userCode) != userCodeLength {
+		return userCode
+	}
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
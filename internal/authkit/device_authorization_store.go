@@ -0,0 +1,198 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrDeviceAuthorizationNotFound indicates no pending device authorization
+	// matches the device or user code, because it was never issued, has been
+	// decided already, or its tokens were handed out.
+	ErrDeviceAuthorizationNotFound = errors.New("device_authorization_store.not_found")
+	// ErrDeviceAuthorizationExists indicates the device or user code is already in use.
+	ErrDeviceAuthorizationExists = errors.New("device_authorization_store.exists")
+	// ErrDeviceAuthorizationInvalid indicates an authorization without codes, client, or expiry.
+	ErrDeviceAuthorizationInvalid = errors.New("device_authorization_store.invalid_authorization")
+)
+
+// DeviceAuthorizationStatus is the user's decision on a device authorization.
+type DeviceAuthorizationStatus string
+
+const (
+	// DeviceAuthorizationPending awaits the user on the verification page.
+	DeviceAuthorizationPending DeviceAuthorizationStatus = "pending"
+	// DeviceAuthorizationApproved lets the device redeem its code for tokens.
+	DeviceAuthorizationApproved DeviceAuthorizationStatus = "approved"
+	// DeviceAuthorizationDenied makes the device's next poll fail with access_denied.
+	DeviceAuthorizationDenied DeviceAuthorizationStatus = "denied"
+)
+
+// DeviceAuthorization is an RFC 8628 device authorization. The device code
+// is stored as a hashOpaque digest; the short user code is what the user
+// types on the verification page. Once approved, UserID and AuthMethods
+// describe the session that approved it.
+type DeviceAuthorization struct {
+	DeviceCodeHash string
+	UserCode       string
+	ClientID       string
+	Status         DeviceAuthorizationStatus
+	UserID         string
+	AuthMethods    []string
+	ExpiresUnix    int64
+	LastPolledUnix int64
+}
+
+// DeviceAuthorizationStore keeps device authorizations until the device
+// redeems or abandons them.
+type DeviceAuthorizationStore interface {
+	// Create stores a pending authorization and deletes expired ones.
+	Create(ctx context.Context, authorization DeviceAuthorization) error
+	// GetByUserCode returns the authorization awaiting the user code.
+	GetByUserCode(ctx context.Context, userCode string) (DeviceAuthorization, error)
+	// Decide records the user's decision on a pending authorization.
+	Decide(ctx context.Context, userCode string, status DeviceAuthorizationStatus, applicationUserID string, authMethods []string) error
+	// Poll returns the authorization as it was before this poll and records polledUnix as its last poll.
+	Poll(ctx context.Context, deviceCodeHash string, polledUnix int64) (DeviceAuthorization, error)
+	// Delete removes the authorization; of several concurrent deletes exactly one succeeds.
+	Delete(ctx context.Context, deviceCodeHash string) error
+}
+
+var configuredDeviceAuthorizations DeviceAuthorizationStore
+
+var defaultDeviceAuthorizations struct {
+	sync.Mutex
+	value DeviceAuthorizationStore
+}
+
+// ProvideDeviceAuthorizationStore injects the store holding device
+// authorizations. Without one, an in-memory store is used.
+func ProvideDeviceAuthorizationStore(store DeviceAuthorizationStore) {
+	configuredDeviceAuthorizations = store
+	defaultDeviceAuthorizations.Lock()
+	defaultDeviceAuthorizations.value = nil
+	defaultDeviceAuthorizations.Unlock()
+}
+
+func resolveDeviceAuthorizations() DeviceAuthorizationStore {
+	if configuredDeviceAuthorizations != nil {
+		return configuredDeviceAuthorizations
+	}
+	defaultDeviceAuthorizations.Lock()
+	defer defaultDeviceAuthorizations.Unlock()
+	if defaultDeviceAuthorizations.value == nil {
+		defaultDeviceAuthorizations.value = NewMemoryDeviceAuthorizationStore()
+	}
+	return defaultDeviceAuthorizations.value
+}
+
+func validateDeviceAuthorization(authorization DeviceAuthorization) error {
+	if authorization.DeviceCodeHash == "" || authorization.UserCode == "" || strings.TrimSpace(authorization.ClientID) == "" || authorization.ExpiresUnix <= 0 {
+		return ErrDeviceAuthorizationInvalid
+	}
+	return nil
+}
+
+// MemoryDeviceAuthorizationStore keeps device authorizations in memory;
+// intended for tests and single-instance deployments.
+type MemoryDeviceAuthorizationStore struct {
+	mutex          sync.Mutex
+	authorizations map[string]DeviceAuthorization
+	userCodes      map[string]string
+}
+
+// NewMemoryDeviceAuthorizationStore creates an empty in-memory device authorization store.
+func NewMemoryDeviceAuthorizationStore() *MemoryDeviceAuthorizationStore {
+	return &MemoryDeviceAuthorizationStore{
+		authorizations: make(map[string]DeviceAuthorization),
+		userCodes:      make(map[string]string),
+	}
+}
+
+// Create stores a pending authorization and deletes expired ones.
+func (store *MemoryDeviceAuthorizationStore) Create(ctx context.Context, authorization DeviceAuthorization) error {
+	if err := validateDeviceAuthorization(authorization); err != nil {
+		return fmt.Errorf("device_authorization_store.create.memory: %w", err)
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	nowUnix := time.Now().UTC().Unix()
+	for deviceCodeHash, stored := range store.authorizations {
+		if stored.ExpiresUnix < nowUnix {
+			store.deleteLocked(deviceCodeHash)
+		}
+	}
+	_, deviceCodeTaken := store.authorizations[authorization.DeviceCodeHash]
+	_, userCodeTaken := store.userCodes[authorization.UserCode]
+	if deviceCodeTaken || userCodeTaken {
+		return fmt.Errorf("device_authorization_store.create.memory: %w", ErrDeviceAuthorizationExists)
+	}
+	authorization.Status = DeviceAuthorizationPending
+	authorization.UserID = ""
+	authorization.AuthMethods = nil
+	store.authorizations[authorization.DeviceCodeHash] = authorization
+	store.userCodes[authorization.UserCode] = authorization.DeviceCodeHash
+	return nil
+}
+
+// GetByUserCode returns the authorization awaiting the user code.
+func (store *MemoryDeviceAuthorizationStore) GetByUserCode(ctx context.Context, userCode string) (DeviceAuthorization, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	authorization, found := store.authorizations[store.userCodes[userCode]]
+	if !found || authorization.Status != DeviceAuthorizationPending {
+		return DeviceAuthorization{}, fmt.Errorf("device_authorization_store.get.memory: %w", ErrDeviceAuthorizationNotFound)
+	}
+	return authorization, nil
+}
+
+// Decide records the user's decision on a pending authorization.
+func (store *MemoryDeviceAuthorizationStore) Decide(ctx context.Context, userCode string, status DeviceAuthorizationStatus, applicationUserID string, authMethods []string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	deviceCodeHash := store.userCodes[userCode]
+	authorization, found := store.authorizations[deviceCodeHash]
+	if !found || authorization.Status != DeviceAuthorizationPending {
+		return fmt.Errorf("device_authorization_store.decide.memory: %w", ErrDeviceAuthorizationNotFound)
+	}
+	authorization.Status = status
+	authorization.UserID = applicationUserID
+	authorization.AuthMethods = slices.Clone(authMethods)
+	store.authorizations[deviceCodeHash] = authorization
+	return nil
+}
+
+// Poll returns the authorization as it was before this poll and records polledUnix.
+func (store *MemoryDeviceAuthorizationStore) Poll(ctx context.Context, deviceCodeHash string, polledUnix int64) (DeviceAuthorization, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	authorization, found := store.authorizations[deviceCodeHash]
+	if !found {
+		return DeviceAuthorization{}, fmt.Errorf("device_authorization_store.poll.memory: %w", ErrDeviceAuthorizationNotFound)
+	}
+	polled := authorization
+	polled.LastPolledUnix = polledUnix
+	store.authorizations[deviceCodeHash] = polled
+	return authorization, nil
+}
+
+// Delete removes the authorization.
+func (store *MemoryDeviceAuthorizationStore) Delete(ctx context.Context, deviceCodeHash string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, found := store.authorizations[deviceCodeHash]; !found {
+		return fmt.Errorf("device_authorization_store.delete.memory: %w", ErrDeviceAuthorizationNotFound)
+	}
+	store.deleteLocked(deviceCodeHash)
+	return nil
+}
+
+func (store *MemoryDeviceAuthorizationStore) deleteLocked(deviceCodeHash string) {
+	delete(store.userCodes, store.authorizations[deviceCodeHash].UserCode)
+	delete(store.authorizations, deviceCodeHash)
+}
@@ -0,0 +1,129 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func forEachDeviceAuthorizationStore(t *testing.T, test func(t *testing.T, store DeviceAuthorizationStore)) {
+	t.Helper()
+	forEachStore(t,
+		func() DeviceAuthorizationStore { return NewMemoryDeviceAuthorizationStore() },
+		func(ctx context.Context, gormDB *gorm.DB) (DeviceAuthorizationStore, error) {
+			return NewDatabaseDeviceAuthorizationStore(ctx, gormDB)
+		},
+		test,
+	)
+}
+
+func createDeviceAuthorizationForTest(t *testing.T, store DeviceAuthorizationStore, deviceCodeHash string, userCode string, expiresAt time.Time) {
+	t.Helper()
+	authorization := DeviceAuthorization{DeviceCodeHash: deviceCodeHash, UserCode: userCode, ClientID: "cli", ExpiresUnix: expiresAt.Unix()}
+	if err := store.Create(context.Background(), authorization); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+}
+
+func TestDeviceAuthorizationStoreRejectsAuthorizationsWithoutClient(t *testing.T) {
+	forEachDeviceAuthorizationStore(t, func(t *testing.T, store DeviceAuthorizationStore) {
+		if err := store.Create(context.Background(), DeviceAuthorization{DeviceCodeHash: "hash-1", UserCode: "BCDFGHJK"}); !errors.Is(err, ErrDeviceAuthorizationInvalid) {
+			t.Fatalf("expected ErrDeviceAuthorizationInvalid, got %v", err)
+		}
+	})
+}
+
+func TestDeviceAuthorizationStorePrunesExpiredAuthorizationsOnCreate(t *testing.T) {
+	forEachDeviceAuthorizationStore(t, func(t *testing.T, store DeviceAuthorizationStore) {
+		now := time.Now().UTC()
+		createDeviceAuthorizationForTest(t, store, "hash-expired", "ZZZZZZZZ", now.Add(-time.Minute))
+		createDeviceAuthorizationForTest(t, store, "hash-1", "BCDFGHJK", now.Add(time.Minute))
+
+		if _, err := store.Poll(context.Background(), "hash-expired", now.Unix()); !errors.Is(err, ErrDeviceAuthorizationNotFound) {
+			t.Fatalf("expected expired authorizations to be pruned on create, got %v", err)
+		}
+		if _, err := store.GetByUserCode(context.Background(), "ZZZZZZZZ"); !errors.Is(err, ErrDeviceAuthorizationNotFound) {
+			t.Fatalf("expected the expired user code to be gone, got %v", err)
+		}
+	})
+}
+
+func TestDeviceAuthorizationStoreUserCodesAreUnique(t *testing.T) {
+	forEachDeviceAuthorizationStore(t, func(t *testing.T, store DeviceAuthorizationStore) {
+		ctx := context.Background()
+		expiresAt := time.Now().Add(time.Minute)
+		createDeviceAuthorizationForTest(t, store, "hash-1", "BCDFGHJK", expiresAt)
+
+		if err := store.Create(ctx, DeviceAuthorization{DeviceCodeHash: "hash-2", UserCode: "BCDFGHJK", ClientID: "cli", ExpiresUnix: expiresAt.Unix()}); !errors.Is(err, ErrDeviceAuthorizationExists) {
+			t.Fatalf("expected ErrDeviceAuthorizationExists for a taken user code, got %v", err)
+		}
+		fetched, getErr := store.GetByUserCode(ctx, "BCDFGHJK")
+		if getErr != nil || fetched.DeviceCodeHash != "hash-1" || fetched.ClientID != "cli" || fetched.Status != DeviceAuthorizationPending {
+			t.Fatalf("expected the first authorization to keep the user code, got %+v (%v)", fetched, getErr)
+		}
+
+		if err := store.Delete(ctx, "hash-1"); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		createDeviceAuthorizationForTest(t, store, "hash-3", "BCDFGHJK", expiresAt)
+	})
+}
+
+func TestDeviceAuthorizationStorePollReportsThePreviousPoll(t *testing.T) {
+	forEachDeviceAuthorizationStore(t, func(t *testing.T, store DeviceAuthorizationStore) {
+		ctx := context.Background()
+		createDeviceAuthorizationForTest(t, store, "hash-1", "BCDFGHJK", time.Now().Add(time.Minute))
+
+		firstPoll, pollErr := store.Poll(ctx, "hash-1", 100)
+		if pollErr != nil || firstPoll.LastPolledUnix != 0 || firstPoll.Status != DeviceAuthorizationPending {
+			t.Fatalf("expected the first poll to see no earlier poll, got %+v (%v)", firstPoll, pollErr)
+		}
+		if secondPoll, err := store.Poll(ctx, "hash-1", 105); err != nil || secondPoll.LastPolledUnix != 100 {
+			t.Fatalf("expected the second poll to see the first, got %+v (%v)", secondPoll, err)
+		}
+		if _, err := store.Poll(ctx, "hash-missing", 110); !errors.Is(err, ErrDeviceAuthorizationNotFound) {
+			t.Fatalf("expected an unknown device code to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestDeviceAuthorizationStoreDecidesOnce(t *testing.T) {
+	forEachDeviceAuthorizationStore(t, func(t *testing.T, store DeviceAuthorizationStore) {
+		ctx := context.Background()
+		createDeviceAuthorizationForTest(t, store, "hash-1", "BCDFGHJK", time.Now().Add(time.Minute))
+
+		if err := store.Decide(ctx, "BCDFGHJK", DeviceAuthorizationApproved, "user-1", []string{"otp", "mfa"}); err != nil {
+			t.Fatalf("decide: %v", err)
+		}
+		if err := store.Decide(ctx, "BCDFGHJK", DeviceAuthorizationDenied, "user-2", nil); !errors.Is(err, ErrDeviceAuthorizationNotFound) {
+			t.Fatalf("expected a decided authorization not to be decided again, got %v", err)
+		}
+		if _, err := store.GetByUserCode(ctx, "BCDFGHJK"); !errors.Is(err, ErrDeviceAuthorizationNotFound) {
+			t.Fatalf("expected a decided user code not to be offered again, got %v", err)
+		}
+		approved, approvedErr := store.Poll(ctx, "hash-1", 110)
+		if approvedErr != nil || approved.Status != DeviceAuthorizationApproved || approved.UserID != "user-1" || len(approved.AuthMethods) != 2 || approved.AuthMethods[1] != "mfa" {
+			t.Fatalf("expected the approval, got %+v (%v)", approved, approvedErr)
+		}
+	})
+}
+
+func TestDeviceAuthorizationStoreDeleteSucceedsOnce(t *testing.T) {
+	forEachDeviceAuthorizationStore(t, func(t *testing.T, store DeviceAuthorizationStore) {
+		ctx := context.Background()
+		createDeviceAuthorizationForTest(t, store, "hash-1", "BCDFGHJK", time.Now().Add(time.Minute))
+
+		if err := store.Delete(ctx, "hash-1"); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if err := store.Delete(ctx, "hash-1"); !errors.Is(err, ErrDeviceAuthorizationNotFound) {
+			t.Fatalf("expected a second delete to fail, got %v", err)
+		}
+		if _, err := store.Poll(ctx, "hash-1", 100); !errors.Is(err, ErrDeviceAuthorizationNotFound) {
+			t.Fatalf("expected a deleted authorization to be gone, got %v", err)
+		}
+	})
+}
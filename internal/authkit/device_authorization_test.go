@@ -0,0 +1,232 @@
+package authkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var csrfTokenFieldPattern = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// openDevicePageForTest loads the confirmation page for userCode and returns
+// its CSRF token with the session cookies plus the page's CSRF cookie.
+func openDevicePageForTest(t *testing.T, router http.Handler, userCode string, cookies map[string]*http.Cookie) (string, map[string]*http.Cookie) {
+	t.Helper()
+	page := serveWithCookies(router, http.MethodGet, deviceVerificationPath+"?user_code="+url.QueryEscape(userCode), nil, cookies, "app_session")
+	match := csrfTokenFieldPattern.FindStringSubmatch(page.Body.String())
+	csrfCookie := collectCookies(page.Result().Cookies())[deviceCSRFCookieName]
+	if page.Code != http.StatusOK || match == nil || csrfCookie == nil || csrfCookie.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("expected the confirmation page with a CSRF token, got %d %s", page.Code, page.Body.String())
+	}
+	pageCookies := map[string]*http.Cookie{deviceCSRFCookieName: csrfCookie}
+	for name, cookie := range cookies {
+		pageCookies[name] = cookie
+	}
+	return match[1], pageCookies
+}
+
+func decideDeviceForTest(router http.Handler, userCode string, decision string, csrfToken string, cookies map[string]*http.Cookie, headers map[string]string) *httptest.ResponseRecorder {
+	form := url.Values{"user_code": {userCode}, "decision": {decision}, "csrf_token": {csrfToken}}
+	request := httptest.NewRequest(http.MethodPost, deviceVerificationPath, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	addCookies(request, cookies, "app_session", deviceCSRFCookieName)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	return response
+}
+
+// newDeviceRouterForTest mounts the auth routes with two device clients and a
+// clock that the tests advance past poll intervals.
+func newDeviceRouterForTest(t *testing.T) (*gin.Engine, ServerConfig, *controllableClock) {
+	t.Helper()
+	// Starting in the past keeps issued sessions valid for sessionClaimsForTest's wall clock.
+	clock := provideClockForTest(t, time.Now().UTC().Add(-30*time.Second))
+	router, config, _ := newAuthRouterForTest(t, func(config *ServerConfig) {
+		config.DeviceClientIDs = []string{"deploy-cli", "other-cli"}
+		config.DeviceLoginURL = "/login"
+	})
+	return router, config, clock
+}
+
+func requestDeviceCodeForTest(t *testing.T, router http.Handler) (string, string) {
+	t.Helper()
+	response := postForTest(router, deviceCodePath, url.Values{"client_id": {"deploy-cli"}}, nil)
+	status, body := response.status, response.body
+	deviceCode, _ := body["device_code"].(string)
+	userCode, _ := body["user_code"].(string)
+	complete, _ := body["verification_uri_complete"].(string)
+	if status != http.StatusOK || deviceCode == "" || len(userCode) != userCodeLength+1 || !strings.HasSuffix(complete, deviceVerificationPath+"?user_code="+userCode) || body["interval"] != float64(5) {
+		t.Fatalf("unexpected device authorization response %d %v", status, body)
+	}
+	return deviceCode, userCode
+}
+
+func pollDeviceForTest(router http.Handler, clientID string, deviceCode string) (int, map[string]interface{}) {
+	response := postForTest(router, tokenPath, url.Values{"grant_type": {grantTypeDeviceCode}, "client_id": {clientID}, "device_code": {deviceCode}}, nil)
+	return response.status, response.body
+}
+
+func TestDeviceAuthorizationGrant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, config, clock := newDeviceRouterForTest(t)
+
+	if response := postForTest(router, deviceCodePath, url.Values{"client_id": {"unknown-cli"}}, nil); response.status != http.StatusUnauthorized || response.body["error"] != "invalid_client" {
+		t.Fatalf("expected 401 invalid_client, got %d %v", response.status, response.body)
+	}
+	deviceCode, userCode := requestDeviceCodeForTest(t, router)
+	if status, body := pollDeviceForTest(router, "deploy-cli", deviceCode); status != http.StatusBadRequest || body["error"] != "authorization_pending" {
+		t.Fatalf("expected authorization_pending, got %d %v", status, body)
+	}
+	if status, body := pollDeviceForTest(router, "deploy-cli", deviceCode); status != http.StatusBadRequest || body["error"] != "slow_down" {
+		t.Fatalf("expected slow_down for a fast poll, got %d %v", status, body)
+	}
+
+	pagePath := deviceVerificationPath + "?user_code=" + url.QueryEscape(strings.ToLower(strings.ReplaceAll(userCode, "-", "")))
+	anonymous := serveWithCookies(router, http.MethodGet, pagePath, nil, nil)
+	if location := anonymous.Header().Get("Location"); anonymous.Code != http.StatusFound || !strings.HasPrefix(location, "/login?return_to=") {
+		t.Fatalf("expected a redirect to the login page, got %d %q", anonymous.Code, location)
+	}
+	cookies := loginForTest(t, router, "cli-user")
+	page := serveWithCookies(router, http.MethodGet, pagePath, nil, cookies, "app_session")
+	if page.Code != http.StatusOK || !strings.Contains(page.Body.String(), "deploy-cli") || !strings.Contains(page.Body.String(), userCode) || page.Header().Get("X-Frame-Options") != "DENY" {
+		t.Fatalf("expected the confirmation page, got %d %s", page.Code, page.Body.String())
+	}
+	csrfToken, pageCookies := openDevicePageForTest(t, router, userCode, cookies)
+	otherSession := loginForTest(t, router, "cli-user")
+	_, otherPageCookies := openDevicePageForTest(t, router, userCode, otherSession)
+	forgeries := []struct {
+		name      string
+		csrfToken string
+		cookies   map[string]*http.Cookie
+		headers   map[string]string
+	}{
+		{name: "cross-site fetch", csrfToken: csrfToken, cookies: pageCookies, headers: map[string]string{"Sec-Fetch-Site": "cross-site"}},
+		{name: "foreign origin", csrfToken: csrfToken, cookies: pageCookies, headers: map[string]string{"Origin": "https://attacker.example"}},
+		{name: "missing token", csrfToken: "", cookies: pageCookies},
+		{name: "missing cookie", csrfToken: csrfToken, cookies: cookies},
+		{name: "another page's cookie", csrfToken: csrfToken, cookies: map[string]*http.Cookie{"app_session": cookies["app_session"], deviceCSRFCookieName: otherPageCookies[deviceCSRFCookieName]}},
+		{name: "another session", csrfToken: csrfToken, cookies: map[string]*http.Cookie{"app_session": otherSession["app_session"], deviceCSRFCookieName: pageCookies[deviceCSRFCookieName]}},
+	}
+	for _, forgery := range forgeries {
+		if rejected := decideDeviceForTest(router, userCode, "approve", forgery.csrfToken, forgery.cookies, forgery.headers); rejected.Code != http.StatusForbidden {
+			t.Fatalf("%s: expected the approval to be rejected, got %d", forgery.name, rejected.Code)
+		}
+	}
+	if approved := decideDeviceForTest(router, userCode, "approve", csrfToken, pageCookies, map[string]string{"Origin": "http://example.com"}); approved.Code != http.StatusOK {
+		t.Fatalf("expected the approval to succeed, got %d %s", approved.Code, approved.Body.String())
+	}
+	if again := decideDeviceForTest(router, userCode, "deny", csrfToken, pageCookies, nil); again.Code != http.StatusNotFound {
+		t.Fatalf("expected a decided code to be gone, got %d", again.Code)
+	}
+
+	clock.Advance(devicePollInterval)
+	if status, body := pollDeviceForTest(router, "other-cli", deviceCode); status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Fatalf("expected invalid_grant for another client, got %d %v", status, body)
+	}
+	clock.Advance(devicePollInterval)
+	status, tokens := pollDeviceForTest(router, "deploy-cli", deviceCode)
+	accessToken, _ := tokens["access_token"].(string)
+	refreshToken, _ := tokens["refresh_token"].(string)
+	if status != http.StatusOK || tokens["token_type"] != "Bearer" || accessToken == "" || refreshToken == "" {
+		t.Fatalf("expected tokens, got %d %v", status, tokens)
+	}
+	if claims := sessionClaimsForTest(t, config, &http.Cookie{Name: config.SessionCookieName, Value: accessToken}); claims.GetUserID() != "google:cli-user" {
+		t.Fatalf("expected the approving user's session, got %q", claims.GetUserID())
+	}
+	clock.Advance(devicePollInterval)
+	if status, body := pollDeviceForTest(router, "deploy-cli", deviceCode); status != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Fatalf("expected a redeemed device code to be gone, got %d %v", status, body)
+	}
+
+	refreshForm := url.Values{"grant_type": {grantTypeRefreshToken}, "client_id": {"deploy-cli"}, "refresh_token": {refreshToken}}
+	refreshed := postForTest(router, tokenPath, refreshForm, nil)
+	status, rotated := refreshed.status, refreshed.body
+	if rotatedRefresh, _ := rotated["refresh_token"].(string); status != http.StatusOK || rotatedRefresh == "" || rotatedRefresh == refreshToken {
+		t.Fatalf("expected a rotated refresh token, got %d %v", status, rotated)
+	}
+	if response := postForTest(router, tokenPath, refreshForm, nil); response.status != http.StatusBadRequest || response.body["error"] != "invalid_grant" {
+		t.Fatalf("expected the previous refresh token to be spent, got %d %v", response.status, response.body)
+	}
+	if response := postForTest(router, tokenPath, url.Values{"grant_type": {"password"}, "client_id": {"deploy-cli"}}, nil); response.status != http.StatusBadRequest || response.body["error"] != "unsupported_grant_type" {
+		t.Fatalf("expected unsupported_grant_type, got %d %v", response.status, response.body)
+	}
+}
+
+func TestDeviceAuthorizationDeniedAndExpired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, _, clock := newDeviceRouterForTest(t)
+	cookies := loginForTest(t, router, "cli-user")
+
+	deniedCode, deniedUserCode := requestDeviceCodeForTest(t, router)
+	csrfToken, pageCookies := openDevicePageForTest(t, router, deniedUserCode, cookies)
+	if denied := decideDeviceForTest(router, deniedUserCode, "deny", csrfToken, pageCookies, nil); denied.Code != http.StatusOK {
+		t.Fatalf("expected the denial to succeed, got %d", denied.Code)
+	}
+	if status, body := pollDeviceForTest(router, "deploy-cli", deniedCode); status != http.StatusBadRequest || body["error"] != "access_denied" {
+		t.Fatalf("expected access_denied, got %d %v", status, body)
+	}
+
+	expiredCode, expiredUserCode := requestDeviceCodeForTest(t, router)
+	clock.Advance(defaultDeviceCodeTTL + time.Second)
+	if page := serveWithCookies(router, http.MethodGet, deviceVerificationPath+"?user_code="+expiredUserCode, nil, cookies, "app_session"); page.Code != http.StatusNotFound {
+		t.Fatalf("expected an expired code to be refused on the page, got %d", page.Code)
+	}
+	if status, body := pollDeviceForTest(router, "deploy-cli", expiredCode); status != http.StatusBadRequest || body["error"] != "expired_token" {
+		t.Fatalf("expected expired_token, got %d %v", status, body)
+	}
+}
+
+func TestDeviceRefreshGrantRequiresTheIssuingClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, config, clock := newDeviceRouterForTest(t)
+	cookies := loginForTest(t, router, "cli-user")
+
+	deviceCode, userCode := requestDeviceCodeForTest(t, router)
+	csrfToken, pageCookies := openDevicePageForTest(t, router, userCode, cookies)
+	if approved := decideDeviceForTest(router, userCode, "approve", csrfToken, pageCookies, nil); approved.Code != http.StatusOK {
+		t.Fatalf("expected the approval to succeed, got %d", approved.Code)
+	}
+	clock.Advance(devicePollInterval)
+	status, tokens := pollDeviceForTest(router, "deploy-cli", deviceCode)
+	deviceRefreshToken, _ := tokens["refresh_token"].(string)
+	if status != http.StatusOK || deviceRefreshToken == "" {
+		t.Fatalf("expected tokens, got %d %v", status, tokens)
+	}
+
+	browserRefreshToken := cookies[config.RefreshCookieName].Value
+	refusals := []struct {
+		name         string
+		clientID     string
+		refreshToken string
+	}{
+		{name: "browser refresh token", clientID: "deploy-cli", refreshToken: browserRefreshToken},
+		{name: "another client's refresh token", clientID: "other-cli", refreshToken: deviceRefreshToken},
+	}
+	for _, refusal := range refusals {
+		form := url.Values{"grant_type": {grantTypeRefreshToken}, "client_id": {refusal.clientID}, "refresh_token": {refusal.refreshToken}}
+		if response := postForTest(router, tokenPath, form, nil); response.status != http.StatusBadRequest || response.body["error"] != "invalid_grant" {
+			t.Fatalf("%s: expected invalid_grant, got %d %v", refusal.name, response.status, response.body)
+		}
+	}
+	deviceCookie := map[string]*http.Cookie{config.RefreshCookieName: {Name: config.RefreshCookieName, Value: deviceRefreshToken}}
+	if refreshed := serveWithCookies(router, http.MethodPost, "/auth/refresh", nil, deviceCookie, config.RefreshCookieName); refreshed.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the browser refresh to refuse a device refresh token, got %d", refreshed.Code)
+	}
+
+	if refreshed := serveWithCookies(router, http.MethodPost, "/auth/refresh", nil, cookies, config.RefreshCookieName); refreshed.Code != http.StatusNoContent {
+		t.Fatalf("expected the refused grant to leave the browser session usable, got %d", refreshed.Code)
+	}
+	form := url.Values{"grant_type": {grantTypeRefreshToken}, "client_id": {"deploy-cli"}, "refresh_token": {deviceRefreshToken}}
+	if response := postForTest(router, tokenPath, form, nil); response.status != http.StatusOK {
+		t.Fatalf("expected the issuing client to refresh, got %d %v", response.status, response.body)
+	}
+}
@@ -0,0 +1,86 @@
+package authkit
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+	jwksPath      = "/.well-known/jwks.json"
+)
+
+// DiscoveryDocument is the OpenID Connect discovery metadata describing
+// TAuth-issued sessions. Fields without an OIDC counterpart use TAuth-specific
+// names so generic clients can ignore them.
+type DiscoveryDocument struct {
+	Issuer                           string   `json:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	UserInfoEndpoint                 string   `json:"userinfo_endpoint"`
+	EndSessionEndpoint               string   `json:"end_session_endpoint"`
+	NonceEndpoint                    string   `json:"nonce_endpoint"`
+	GoogleSignInEndpoint             string   `json:"google_sign_in_endpoint"`
+	RefreshEndpoint                  string   `json:"refresh_endpoint"`
+	RevocationListEndpoint           string   `json:"session_revocations_endpoint"`
+	IntrospectionEndpoint            string   `json:"introspection_endpoint"`
+	IntrospectionAuthMethods         []string `json:"introspection_endpoint_auth_methods_supported"`
+	DeviceAuthorizationEndpoint      string   `json:"device_authorization_endpoint,omitempty"`
+	TokenEndpoint                    string   `json:"token_endpoint,omitempty"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported                  []string `json:"claims_supported"`
+}
+
+// NewDiscoveryDocument describes the issuer, keys, claims, and auth endpoints
+// served under baseURL.
+func NewDiscoveryDocument(configuration ServerConfig, baseURL string) DiscoveryDocument {
+	baseURL = strings.TrimRight(baseURL, "/")
+	document := DiscoveryDocument{
+		Issuer:                           configuration.AppJWTIssuer,
+		JWKSURI:                          baseURL + jwksPath,
+		UserInfoEndpoint:                 baseURL + "/me",
+		EndSessionEndpoint:               baseURL + "/auth/logout",
+		NonceEndpoint:                    baseURL + "/auth/nonce",
+		GoogleSignInEndpoint:             baseURL + "/auth/google",
+		RefreshEndpoint:                  baseURL + "/auth/refresh",
+		RevocationListEndpoint:           baseURL + revocationsPath,
+		IntrospectionEndpoint:            baseURL + introspectionPath,
+		IntrospectionAuthMethods:         []string{"client_secret_basic", "client_secret_post"},
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: configuration.AppJWTKeyring.Algorithms(),
+		ClaimsSupported:                  sessionvalidator.ClaimNames(),
+	}
+	if len(configuration.DeviceClientIDs) > 0 {
+		document.DeviceAuthorizationEndpoint = baseURL + deviceCodePath
+		document.TokenEndpoint = baseURL + tokenPath
+	}
+	return document
+}
+
+// requestBaseURL prefers the configured public base URL and otherwise derives
+// one from the scheme and host of the inbound request.
+func requestBaseURL(configuration ServerConfig, request *http.Request) string {
+	if configuration.PublicBaseURL != "" {
+		return configuration.PublicBaseURL
+	}
+	scheme := "http"
+	forwarded := strings.ToLower(request.Header.Get("Forwarded"))
+	if request.TLS != nil || strings.EqualFold(request.Header.Get("X-Forwarded-Proto"), "https") || strings.Contains(forwarded, "proto=https") {
+		scheme = "https"
+	}
+	host := request.Host
+	if forwardedHost := request.Header.Get("X-Forwarded-Host"); forwardedHost != "" {
+		host = forwardedHost
+	}
+	return scheme + "://" + host
+}
+
+func handleDiscovery(configuration ServerConfig) gin.HandlerFunc {
+	return func(contextGin *gin.Context) {
+		contextGin.Header("Cache-Control", jwksCacheControl)
+		contextGin.JSON(http.StatusOK, NewDiscoveryDocument(configuration, requestBaseURL(configuration, contextGin.Request)))
+	}
+}
@@ -0,0 +1,77 @@
+package authkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDiscoveryDocumentDescribesSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config := newTestServerConfig()
+	rotated, keyringErr := NewKeyring([]KeyringEntry{
+		{Status: KeyStatusActive, Key: mustKeyWithID(t, mustEd25519SigningKey(t), "current")},
+		{Status: KeyStatusVerifyOnly, Key: mustKeyWithID(t, mustHMACSigningKey("previous"), "previous")},
+	})
+	if keyringErr != nil {
+		t.Fatalf("new keyring: %v", keyringErr)
+	}
+	config.AppJWTKeyring = rotated
+
+	testCases := []struct {
+		name            string
+		publicBaseURL   string
+		headers         map[string]string
+		expectedBaseURL string
+	}{
+		{name: "ConfiguredBaseURL", publicBaseURL: "https://auth.example.com", headers: map[string]string{"X-Forwarded-Host": "ignored.example.com"}, expectedBaseURL: "https://auth.example.com"},
+		{name: "RequestHost", expectedBaseURL: "http://tauth.local:8080"},
+		{name: "ForwardedProxy", headers: map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "login.example.com"}, expectedBaseURL: "https://login.example.com"},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			caseConfig := config
+			caseConfig.PublicBaseURL = testCase.publicBaseURL
+			router := gin.New()
+			MountAuthRoutes(router, caseConfig, newTestUserStore(), NewMemoryRefreshTokenStore(), nil)
+
+			request := httptest.NewRequest(http.MethodGet, "http://tauth.local:8080/.well-known/openid-configuration", nil)
+			for name, value := range testCase.headers {
+				request.Header.Set(name, value)
+			}
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			if response.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", response.Code)
+			}
+			if response.Header().Get("Cache-Control") != jwksCacheControl {
+				t.Fatalf("unexpected cache control %q", response.Header().Get("Cache-Control"))
+			}
+			var document DiscoveryDocument
+			if err := json.Unmarshal(response.Body.Bytes(), &document); err != nil {
+				t.Fatalf("decode discovery document: %v", err)
+			}
+			if document.Issuer != config.AppJWTIssuer {
+				t.Fatalf("expected issuer %q, got %q", config.AppJWTIssuer, document.Issuer)
+			}
+			if document.JWKSURI != testCase.expectedBaseURL+"/.well-known/jwks.json" {
+				t.Fatalf("unexpected jwks_uri %q", document.JWKSURI)
+			}
+			if document.UserInfoEndpoint != testCase.expectedBaseURL+"/me" || document.GoogleSignInEndpoint != testCase.expectedBaseURL+"/auth/google" {
+				t.Fatalf("unexpected endpoints: %#v", document)
+			}
+			if !slices.Contains(document.ClaimsSupported, "user_roles") {
+				t.Fatalf("expected claims_supported to mirror session claims, got %v", document.ClaimsSupported)
+			}
+			if !slices.Equal(document.IDTokenSigningAlgValuesSupported, []string{"EdDSA", "HS256"}) {
+				t.Fatalf("unexpected algorithms %v", document.IDTokenSigningAlgValuesSupported)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package authkit
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	emailLoginStartPath  = "/auth/email/start"
+	emailLoginVerifyPath = "/auth/email/verify"
+
+	// EmailLoginTokenParameter carries the link token in the URL a sign-in
+	// email points at; the page posts it to /auth/email/verify as token.
+	EmailLoginTokenParameter = "email_token"
+
+	emailIdentityProviderName = "email"
+	defaultEmailLoginTTL      = 10 * time.Minute
+	emailLoginCodeDigits      = 6
+	emailLoginMaxCodeAttempts = 5
+
+	// Rate limits applied per TAuth instance within emailLoginRateWindow.
+	emailLoginRateWindow             = 15 * time.Minute
+	emailLoginStartsPerAddress       = 5
+	emailLoginStartsPerClient        = 20
+	emailLoginVerificationsPerClient = 30
+)
+
+func (configuration ServerConfig) emailLoginTTL() time.Duration {
+	if configuration.EmailLoginTTL <= 0 {
+		return defaultEmailLoginTTL
+	}
+	return configuration.EmailLoginTTL
+}
+
+// mountEmailLoginRoutes registers passwordless email sign-in: /auth/email/start
+// mails a single-use link and code, and /auth/email/verify exchanges either one
+// for a session.
+func mountEmailLoginRoutes(router gin.IRouter, clock Clock, configuration ServerConfig, users UserStore, refreshTokens RefreshTokenStore) {
+	startsPerAddress := newAttemptLimiter(emailLoginStartsPerAddress, emailLoginRateWindow)
+	startsPerClient := newAttemptLimiter(emailLoginStartsPerClient, emailLoginRateWindow)
+	verificationsPerClient := newAttemptLimiter(emailLoginVerificationsPerClient, emailLoginRateWindow)
+
+	router.POST(emailLoginStartPath, func(contextGin *gin.Context) {
+		var inbound struct {
+			Email string `json:"email"`
+		}
+		bindErr := contextGin.BindJSON(&inbound)
+		email, validEmail := normalizeEmailAddress(inbound.Email)
+		if bindErr != nil || !validEmail {
+			logAuthWarning("auth.email.invalid_email", bindErr)
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_email"})
+			return
+		}
+		if !configuration.AllowInsecureHTTP && !isHTTPS(contextGin.Request) {
+			logAuthWarning("auth.email.insecure_http", nil)
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "https_required"})
+			return
+		}
+		now := clock.Now().UTC()
+		if !allowAttempt(contextGin, startsPerClient, contextGin.ClientIP(), now) || !allowAttempt(contextGin, startsPerAddress, email, now) {
+			return
+		}
+		if !allowLoginPolicy(contextGin, configuration, ExternalIdentity{Provider: emailIdentityProviderName, Email: email}) {
+			return
+		}
+
+		linkToken, linkTokenErr := newRandomIdentifier()
+		code, codeErr := newEmailLoginCode()
+		if linkTokenErr != nil || codeErr != nil {
+			logAuthError("auth.email.random", errors.Join(linkTokenErr, codeErr))
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		challenge := EmailChallenge{
+			Email:         email,
+			LinkTokenHash: hashOpaque(linkToken),
+			CodeHash:      hashOpaque(code),
+			ExpiresUnix:   now.Add(configuration.emailLoginTTL()).Unix(),
+		}
+		if createErr := resolveEmailLogins().Create(contextGin, challenge); createErr != nil {
+			logAuthError("auth.email.store", createErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if sendErr := configuration.Mailer.Send(contextGin, emailLoginMessage(configuration, email, linkToken, code)); sendErr != nil {
+			logAuthError("auth.email.send", sendErr)
+			contextGin.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "mailer_unavailable"})
+			return
+		}
+		recordMetric(metricAuthEmailSent)
+		contextGin.JSON(http.StatusAccepted, gin.H{"expires_in": int64(configuration.emailLoginTTL().Seconds())})
+	})
+
+	router.POST(emailLoginVerifyPath, func(contextGin *gin.Context) {
+		identity, verified := consumeEmailChallenge(contextGin, clock, configuration, verificationsPerClient)
+		if !verified {
+			return
+		}
+		profile, started := startSession(contextGin, clock, configuration, users, refreshTokens, identity)
+		if !started {
+			return
+		}
+		respondWithSession(contextGin, profile)
+	})
+}
+
+// consumeEmailChallenge reads { token } or { email, code } from the request and
+// consumes the matching email challenge, returning the verified email identity.
+func consumeEmailChallenge(contextGin *gin.Context, clock Clock, configuration ServerConfig, verificationsPerClient *attemptLimiter) (ExternalIdentity, bool) {
+	var inbound struct {
+		Token string `json:"token"`
+		Email string `json:"email"`
+		Code  string `json:"code"`
+	}
+	if bindErr := contextGin.BindJSON(&inbound); bindErr != nil {
+		recordMetric(metricAuthLoginFailure)
+		logAuthWarning("auth.email.invalid_json", bindErr)
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+		return ExternalIdentity{}, false
+	}
+	if !configuration.AllowInsecureHTTP && !isHTTPS(contextGin.Request) {
+		recordMetric(metricAuthLoginFailure)
+		logAuthWarning("auth.login.insecure_http", nil)
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "https_required"})
+		return ExternalIdentity{}, false
+	}
+	now := clock.Now().UTC()
+	if !allowAttempt(contextGin, verificationsPerClient, contextGin.ClientIP(), now) {
+		recordMetric(metricAuthLoginFailure)
+		return ExternalIdentity{}, false
+	}
+
+	var challenge EmailChallenge
+	var consumeErr error
+	failureCode := "invalid_token"
+	email, validEmail := normalizeEmailAddress(inbound.Email)
+	switch {
+	case strings.TrimSpace(inbound.Token) != "":
+		challenge, consumeErr = resolveEmailLogins().ConsumeLink(contextGin, hashOpaque(strings.TrimSpace(inbound.Token)))
+	case validEmail && strings.TrimSpace(inbound.Code) != "":
+		failureCode = "invalid_code"
+		challenge, consumeErr = resolveEmailLogins().ConsumeCode(contextGin, email, hashOpaque(strings.TrimSpace(inbound.Code)), emailLoginMaxCodeAttempts)
+	default:
+		recordMetric(metricAuthLoginFailure)
+		logAuthWarning("auth.email.invalid_json", nil)
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+		return ExternalIdentity{}, false
+	}
+	if consumeErr == nil && challenge.ExpiresUnix < now.Unix() {
+		consumeErr = fmt.Errorf("auth.email.verify: %w: expired", ErrEmailChallengeNotFound)
+	}
+	if errors.Is(consumeErr, ErrEmailChallengeNotFound) {
+		recordMetric(metricAuthLoginFailure)
+		logAuthWarning("auth.email."+failureCode, consumeErr)
+		contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": failureCode})
+		return ExternalIdentity{}, false
+	}
+	if consumeErr != nil {
+		recordMetric(metricAuthLoginFailure)
+		logAuthError("auth.email.store", consumeErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return ExternalIdentity{}, false
+	}
+	return ExternalIdentity{
+		Provider:      emailIdentityProviderName,
+		Subject:       challenge.Email,
+		Email:         challenge.Email,
+		EmailVerified: true,
+	}, true
+}
+
+// allowAttempt fails the request with 429 and Retry-After when key is over the limit.
+func allowAttempt(contextGin *gin.Context, limiter *attemptLimiter, key string, now time.Time) bool {
+	allowed, retryAfter := limiter.allow(key, now)
+	if allowed {
+		return true
+	}
+	logAuthWarning("auth.rate_limited", nil, zap.String("path", contextGin.FullPath()))
+	contextGin.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	contextGin.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate_limited"})
+	return false
+}
+
+// normalizeEmailAddress accepts a bare address and lowercases it.
+func normalizeEmailAddress(rawEmail string) (string, bool) {
+	rawEmail = strings.TrimSpace(rawEmail)
+	parsed, parseErr := mail.ParseAddress(rawEmail)
+	if parseErr != nil || parsed.Address != rawEmail {
+		return "", false
+	}
+	return strings.ToLower(parsed.Address), true
+}
+
+func newEmailLoginCode() (string, error) {
+	upperBound := big.NewInt(int64(math.Pow10(emailLoginCodeDigits)))
+	value, randomErr := rand.Int(rand.Reader, upperBound)
+	if randomErr != nil {
+		return "", fmt.Errorf("email_login.random: %w", randomErr)
+	}
+	return fmt.Sprintf("%0*d", emailLoginCodeDigits, value.Int64()), nil
+}
+
+func emailLoginMessage(configuration ServerConfig, email string, linkToken string, code string) EmailMessage {
+	var body strings.Builder
+	fmt.Fprintf(&body, "Your sign-in code is %s.\n", code)
+	if link, ok := emailLoginLink(configuration, linkToken); ok {
+		fmt.Fprintf(&body, "\nOr sign in with this link:\n%s\n", link)
+	}
+	fmt.Fprintf(&body, "\nThe code and link work once and expire in %d minutes. If you did not try to sign in, you can ignore this email.\n", max(1, int(configuration.emailLoginTTL().Minutes())))
+	return EmailMessage{To: email, Subject: "Your sign-in code", Body: body.String()}
+}
+
+// emailLoginLink builds the magic link from ServerConfig.EmailLoginURL. A path
+// is resolved against PublicBaseURL, never the request's Host, so a forged
+// Host header cannot send the token elsewhere.
+func emailLoginLink(configuration ServerConfig, linkToken string) (string, bool) {
+	if configuration.EmailLoginURL == "" {
+		return "", false
+	}
+	rawURL := configuration.EmailLoginURL
+	if strings.HasPrefix(rawURL, "/") {
+		if configuration.PublicBaseURL == "" {
+			return "", false
+		}
+		rawURL = configuration.PublicBaseURL + rawURL
+	}
+	parsedURL, parseErr := url.Parse(rawURL)
+	if parseErr != nil {
+		return "", false
+	}
+	query := parsedURL.Query()
+	query.Set(EmailLoginTokenParameter, linkToken)
+	parsedURL.RawQuery = query.Encode()
+	return parsedURL.String(), true
+}
@@ -0,0 +1,140 @@
+package authkit
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrEmailChallengeNotFound indicates no pending sign-in email matches the
+	// link token or code, because it was never sent, was already used, or was
+	// withdrawn after too many wrong codes.
+	ErrEmailChallengeNotFound = errors.New("email_login_store.challenge_not_found")
+	// ErrEmailChallengeInvalid indicates a challenge without an email address or hashes.
+	ErrEmailChallengeInvalid = errors.New("email_login_store.invalid_challenge")
+)
+
+// EmailChallenge is a pending email sign-in. The link token and the code are
+// stored as hashOpaque digests, like refresh tokens, and either one completes
+// the sign-in exactly once.
+type EmailChallenge struct {
+	Email         string
+	LinkTokenHash string
+	CodeHash      string
+	ExpiresUnix   int64
+	Attempts      int
+}
+
+// EmailLoginStore keeps at most one pending challenge per email address.
+type EmailLoginStore interface {
+	// Create stores challenge, replacing any earlier challenge for its email.
+	Create(ctx context.Context, challenge EmailChallenge) error
+	// ConsumeLink removes and returns the challenge whose link token hashes to linkTokenHash.
+	ConsumeLink(ctx context.Context, linkTokenHash string) (EmailChallenge, error)
+	// ConsumeCode removes and returns email's challenge when codeHash matches.
+	// A mismatch counts an attempt and withdraws the challenge after maxAttempts.
+	ConsumeCode(ctx context.Context, email string, codeHash string, maxAttempts int) (EmailChallenge, error)
+}
+
+var configuredEmailLogins EmailLoginStore
+
+var defaultEmailLogins struct {
+	sync.Mutex
+	value EmailLoginStore
+}
+
+// ProvideEmailLoginStore injects the store holding pending email sign-ins.
+// Without one, an in-memory store is used.
+func ProvideEmailLoginStore(store EmailLoginStore) {
+	configuredEmailLogins = store
+	defaultEmailLogins.Lock()
+	defaultEmailLogins.value = nil
+	defaultEmailLogins.Unlock()
+}
+
+func resolveEmailLogins() EmailLoginStore {
+	if configuredEmailLogins != nil {
+		return configuredEmailLogins
+	}
+	defaultEmailLogins.Lock()
+	defer defaultEmailLogins.Unlock()
+	if defaultEmailLogins.value == nil {
+		defaultEmailLogins.value = NewMemoryEmailLoginStore()
+	}
+	return defaultEmailLogins.value
+}
+
+func validateEmailChallenge(challenge EmailChallenge) error {
+	if strings.TrimSpace(challenge.Email) == "" || challenge.LinkTokenHash == "" || challenge.CodeHash == "" {
+		return ErrEmailChallengeInvalid
+	}
+	return nil
+}
+
+// MemoryEmailLoginStore keeps pending email sign-ins in memory; intended for
+// tests and single-instance deployments.
+type MemoryEmailLoginStore struct {
+	mutex      sync.Mutex
+	challenges map[string]EmailChallenge
+}
+
+// NewMemoryEmailLoginStore creates an empty in-memory email sign-in store.
+func NewMemoryEmailLoginStore() *MemoryEmailLoginStore {
+	return &MemoryEmailLoginStore{challenges: make(map[string]EmailChallenge)}
+}
+
+// Create stores challenge, replacing any earlier challenge for its email.
+func (store *MemoryEmailLoginStore) Create(ctx context.Context, challenge EmailChallenge) error {
+	if err := validateEmailChallenge(challenge); err != nil {
+		return fmt.Errorf("email_login_store.create.memory: %w", err)
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	nowUnix := time.Now().UTC().Unix()
+	for email, pending := range store.challenges {
+		if pending.ExpiresUnix < nowUnix {
+			delete(store.challenges, email)
+		}
+	}
+	store.challenges[challenge.Email] = challenge
+	return nil
+}
+
+// ConsumeLink removes and returns the challenge whose link token hashes to linkTokenHash.
+func (store *MemoryEmailLoginStore) ConsumeLink(ctx context.Context, linkTokenHash string) (EmailChallenge, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for email, pending := range store.challenges {
+		if subtle.ConstantTimeCompare([]byte(pending.LinkTokenHash), []byte(linkTokenHash)) == 1 {
+			delete(store.challenges, email)
+			return pending, nil
+		}
+	}
+	return EmailChallenge{}, fmt.Errorf("email_login_store.consume_link.memory: %w", ErrEmailChallengeNotFound)
+}
+
+// ConsumeCode removes and returns email's challenge when codeHash matches.
+func (store *MemoryEmailLoginStore) ConsumeCode(ctx context.Context, email string, codeHash string, maxAttempts int) (EmailChallenge, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	pending, found := store.challenges[email]
+	if !found {
+		return EmailChallenge{}, fmt.Errorf("email_login_store.consume_code.memory: %w", ErrEmailChallengeNotFound)
+	}
+	if subtle.ConstantTimeCompare([]byte(pending.CodeHash), []byte(codeHash)) != 1 {
+		pending.Attempts++
+		if pending.Attempts >= maxAttempts {
+			delete(store.challenges, email)
+		} else {
+			store.challenges[email] = pending
+		}
+		return EmailChallenge{}, fmt.Errorf("email_login_store.consume_code.memory: %w", ErrEmailChallengeNotFound)
+	}
+	delete(store.challenges, email)
+	return pending, nil
+}
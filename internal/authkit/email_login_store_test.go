@@ -0,0 +1,136 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func forEachEmailLoginStore(t *testing.T, test func(t *testing.T, store EmailLoginStore)) {
+	t.Helper()
+	forEachStore(t,
+		func() EmailLoginStore { return NewMemoryEmailLoginStore() },
+		func(ctx context.Context, gormDB *gorm.DB) (EmailLoginStore, error) {
+			return NewDatabaseEmailLoginStore(ctx, gormDB)
+		},
+		test,
+	)
+}
+
+func newEmailChallengeForTest(email string, linkToken string, code string, expiresAt time.Time) EmailChallenge {
+	return EmailChallenge{Email: email, LinkTokenHash: hashOpaque(linkToken), CodeHash: hashOpaque(code), ExpiresUnix: expiresAt.Unix()}
+}
+
+func TestEmailLoginStoreRejectsIncompleteChallenges(t *testing.T) {
+	forEachEmailLoginStore(t, func(t *testing.T, store EmailLoginStore) {
+		if err := store.Create(context.Background(), EmailChallenge{Email: "user@example.com"}); !errors.Is(err, ErrEmailChallengeInvalid) {
+			t.Fatalf("expected ErrEmailChallengeInvalid, got %v", err)
+		}
+	})
+}
+
+func TestEmailLoginStoreLinkIsSingleUse(t *testing.T) {
+	forEachEmailLoginStore(t, func(t *testing.T, store EmailLoginStore) {
+		ctx := context.Background()
+		challenge := newEmailChallengeForTest("user@example.com", "link-1", "123456", time.Now().Add(10*time.Minute))
+		if err := store.Create(ctx, challenge); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		consumed, consumeErr := store.ConsumeLink(ctx, hashOpaque("link-1"))
+		if consumeErr != nil || consumed.Email != "user@example.com" || consumed.ExpiresUnix != challenge.ExpiresUnix {
+			t.Fatalf("expected the link to be consumed, got %+v (%v)", consumed, consumeErr)
+		}
+		if _, err := store.ConsumeLink(ctx, hashOpaque("link-1")); !errors.Is(err, ErrEmailChallengeNotFound) {
+			t.Fatalf("expected a consumed link to be gone, got %v", err)
+		}
+		if _, err := store.ConsumeCode(ctx, "user@example.com", hashOpaque("123456"), 3); !errors.Is(err, ErrEmailChallengeNotFound) {
+			t.Fatalf("expected the code to be consumed with the link, got %v", err)
+		}
+	})
+}
+
+func TestEmailLoginStoreCodeIsSingleUse(t *testing.T) {
+	forEachEmailLoginStore(t, func(t *testing.T, store EmailLoginStore) {
+		ctx := context.Background()
+		if err := store.Create(ctx, newEmailChallengeForTest("user@example.com", "link-1", "123456", time.Now().Add(10*time.Minute))); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if _, err := store.ConsumeCode(ctx, "user@example.com", hashOpaque("123456"), 3); err != nil {
+			t.Fatalf("consume code: %v", err)
+		}
+		if _, err := store.ConsumeCode(ctx, "user@example.com", hashOpaque("123456"), 3); !errors.Is(err, ErrEmailChallengeNotFound) {
+			t.Fatalf("expected a consumed code to be gone, got %v", err)
+		}
+		if _, err := store.ConsumeLink(ctx, hashOpaque("link-1")); !errors.Is(err, ErrEmailChallengeNotFound) {
+			t.Fatalf("expected the link to be consumed with the code, got %v", err)
+		}
+	})
+}
+
+func TestEmailLoginStoreKeepsOneChallengePerEmail(t *testing.T) {
+	forEachEmailLoginStore(t, func(t *testing.T, store EmailLoginStore) {
+		ctx := context.Background()
+		expiresAt := time.Now().Add(10 * time.Minute)
+		if err := store.Create(ctx, newEmailChallengeForTest("user@example.com", "link-1", "123456", expiresAt)); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if err := store.Create(ctx, newEmailChallengeForTest("user@example.com", "link-2", "654321", expiresAt)); err != nil {
+			t.Fatalf("create replacement: %v", err)
+		}
+		if _, err := store.ConsumeLink(ctx, hashOpaque("link-1")); !errors.Is(err, ErrEmailChallengeNotFound) {
+			t.Fatalf("expected the replaced link to be gone, got %v", err)
+		}
+		if _, err := store.ConsumeCode(ctx, "user@example.com", hashOpaque("123456"), 3); !errors.Is(err, ErrEmailChallengeNotFound) {
+			t.Fatalf("expected the replaced code to be rejected, got %v", err)
+		}
+		if _, err := store.ConsumeLink(ctx, hashOpaque("link-2")); err != nil {
+			t.Fatalf("expected the replacement link to be consumed, got %v", err)
+		}
+	})
+}
+
+func TestEmailLoginStoreCountsWrongCodes(t *testing.T) {
+	forEachEmailLoginStore(t, func(t *testing.T, store EmailLoginStore) {
+		ctx := context.Background()
+		challenge := newEmailChallengeForTest("user@example.com", "link-1", "123456", time.Now().Add(10*time.Minute))
+		if err := store.Create(ctx, challenge); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		for attempt := 0; attempt < 2; attempt++ {
+			if _, err := store.ConsumeCode(ctx, "user@example.com", hashOpaque("000000"), 3); !errors.Is(err, ErrEmailChallengeNotFound) {
+				t.Fatalf("expected a wrong code to fail, got %v", err)
+			}
+		}
+		if consumed, err := store.ConsumeCode(ctx, "user@example.com", hashOpaque("123456"), 3); err != nil || consumed.Attempts != 2 {
+			t.Fatalf("expected the code to be consumed after two wrong attempts, got %+v (%v)", consumed, err)
+		}
+
+		if err := store.Create(ctx, challenge); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		for attempt := 0; attempt < 3; attempt++ {
+			_, _ = store.ConsumeCode(ctx, "user@example.com", hashOpaque("000000"), 3)
+		}
+		if _, err := store.ConsumeLink(ctx, hashOpaque("link-1")); !errors.Is(err, ErrEmailChallengeNotFound) {
+			t.Fatalf("expected the challenge to be withdrawn after three wrong codes, got %v", err)
+		}
+	})
+}
+
+func TestEmailLoginStorePrunesExpiredChallenges(t *testing.T) {
+	forEachEmailLoginStore(t, func(t *testing.T, store EmailLoginStore) {
+		ctx := context.Background()
+		if err := store.Create(ctx, newEmailChallengeForTest("stale@example.com", "link-stale", "111111", time.Now().Add(-time.Minute))); err != nil {
+			t.Fatalf("create expired: %v", err)
+		}
+		if err := store.Create(ctx, newEmailChallengeForTest("user@example.com", "link-1", "123456", time.Now().Add(10*time.Minute))); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if _, err := store.ConsumeLink(ctx, hashOpaque("link-stale")); !errors.Is(err, ErrEmailChallengeNotFound) {
+			t.Fatalf("expected the expired challenge to be pruned, got %v", err)
+		}
+	})
+}
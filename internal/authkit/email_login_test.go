@@ -0,0 +1,189 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordingMailer keeps sent messages so tests can read the link and code.
+type recordingMailer struct {
+	mutex    sync.Mutex
+	messages []EmailMessage
+	sendErr  error
+}
+
+func (mailer *recordingMailer) Send(ctx context.Context, message EmailMessage) error {
+	if mailer.sendErr != nil {
+		return mailer.sendErr
+	}
+	mailer.mutex.Lock()
+	defer mailer.mutex.Unlock()
+	mailer.messages = append(mailer.messages, message)
+	return nil
+}
+
+var (
+	emailLoginCodePattern = regexp.MustCompile(`code is (\d{6})`)
+	emailLoginLinkPattern = regexp.MustCompile(`https://\S+`)
+)
+
+// lastCredentials returns the link and code of the most recent message.
+func (mailer *recordingMailer) lastCredentials(t *testing.T) (string, string) {
+	t.Helper()
+	mailer.mutex.Lock()
+	defer mailer.mutex.Unlock()
+	if len(mailer.messages) == 0 {
+		t.Fatalf("expected a sign-in email")
+	}
+	body := mailer.messages[len(mailer.messages)-1].Body
+	codeMatch := emailLoginCodePattern.FindStringSubmatch(body)
+	if codeMatch == nil {
+		t.Fatalf("expected a code in %q", body)
+	}
+	return emailLoginLinkPattern.FindString(body), codeMatch[1]
+}
+
+// withEmailLoginForTest enables email sign-in through mailer.
+func withEmailLoginForTest(mailer Mailer) func(*ServerConfig) {
+	return func(config *ServerConfig) {
+		config.Mailer = mailer
+		config.PublicBaseURL = "https://auth.example.com"
+		config.EmailLoginURL = "/login/email"
+	}
+}
+
+func TestEmailLoginWithLink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mailer := &recordingMailer{}
+	router, config, _ := newAuthRouterForTest(t, withEmailLoginForTest(mailer))
+
+	if started := postForTest(router, "/auth/email/start", map[string]string{"email": "User@Example.com"}, nil); started.status != http.StatusAccepted {
+		t.Fatalf("expected 202 from /auth/email/start, got %d", started.status)
+	}
+	if mailer.messages[0].To != "user@example.com" {
+		t.Fatalf("expected the normalized address as recipient, got %q", mailer.messages[0].To)
+	}
+	link, _ := mailer.lastCredentials(t)
+	linkURL, parseErr := url.Parse(link)
+	if parseErr != nil || linkURL.Host != "auth.example.com" || linkURL.Path != "/login/email" {
+		t.Fatalf("unexpected magic link %q", link)
+	}
+	token := linkURL.Query().Get(EmailLoginTokenParameter)
+
+	verified := postForTest(router, "/auth/email/verify", map[string]string{"token": token}, nil)
+	if verified.status != http.StatusOK {
+		t.Fatalf("expected 200 from /auth/email/verify, got %d", verified.status)
+	}
+	if verified.body["user_id"] != "email:user@example.com" || verified.body["user_email"] != "user@example.com" {
+		t.Fatalf("unexpected profile %v", verified.body)
+	}
+	if verified.cookies[config.SessionCookieName] == nil || verified.cookies[config.RefreshCookieName] == nil {
+		t.Fatalf("expected session and refresh cookies, got %v", verified.cookies)
+	}
+
+	if replayed := postForTest(router, "/auth/email/verify", map[string]string{"token": token}, nil); replayed.status != http.StatusUnauthorized || replayed.body["error"] != "invalid_token" {
+		t.Fatalf("expected a replayed link to be rejected, got %d %v", replayed.status, replayed.body)
+	}
+}
+
+func TestEmailLoginWithCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mailer := &recordingMailer{}
+	router, _, _ := newAuthRouterForTest(t, withEmailLoginForTest(mailer))
+
+	postForTest(router, "/auth/email/start", map[string]string{"email": "user@example.com"}, nil)
+	firstLink, _ := mailer.lastCredentials(t)
+	postForTest(router, "/auth/email/start", map[string]string{"email": "user@example.com"}, nil)
+	_, code := mailer.lastCredentials(t)
+
+	firstURL, _ := url.Parse(firstLink)
+	if superseded := postForTest(router, "/auth/email/verify", map[string]string{"token": firstURL.Query().Get(EmailLoginTokenParameter)}, nil); superseded.status != http.StatusUnauthorized {
+		t.Fatalf("expected a superseded link to be rejected, got %d", superseded.status)
+	}
+	if verified := postForTest(router, "/auth/email/verify", map[string]string{"email": "USER@example.com", "code": code}, nil); verified.status != http.StatusOK || verified.body["user_id"] != "email:user@example.com" {
+		t.Fatalf("expected the code to sign in, got %d %v", verified.status, verified.body)
+	}
+	if replayed := postForTest(router, "/auth/email/verify", map[string]string{"email": "user@example.com", "code": code}, nil); replayed.status != http.StatusUnauthorized {
+		t.Fatalf("expected a replayed code to be rejected, got %d", replayed.status)
+	}
+
+	postForTest(router, "/auth/email/start", map[string]string{"email": "user@example.com"}, nil)
+	_, code = mailer.lastCredentials(t)
+	wrongCode := "000000"
+	if code == wrongCode {
+		wrongCode = "111111"
+	}
+	for attempt := 0; attempt < emailLoginMaxCodeAttempts; attempt++ {
+		if rejected := postForTest(router, "/auth/email/verify", map[string]string{"email": "user@example.com", "code": wrongCode}, nil); rejected.status != http.StatusUnauthorized || rejected.body["error"] != "invalid_code" {
+			t.Fatalf("expected a wrong code to be rejected, got %d %v", rejected.status, rejected.body)
+		}
+	}
+	if withdrawn := postForTest(router, "/auth/email/verify", map[string]string{"email": "user@example.com", "code": code}, nil); withdrawn.status != http.StatusUnauthorized {
+		t.Fatalf("expected the code to be withdrawn after %d wrong attempts, got %d", emailLoginMaxCodeAttempts, withdrawn.status)
+	}
+}
+
+func TestEmailLoginRateLimitsStarts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router, _, _ := newAuthRouterForTest(t, withEmailLoginForTest(&recordingMailer{}))
+	for attempt := 0; attempt < emailLoginStartsPerAddress; attempt++ {
+		if started := postForTest(router, "/auth/email/start", map[string]string{"email": "user@example.com"}, nil); started.status != http.StatusAccepted {
+			t.Fatalf("expected start %d to be accepted, got %d", attempt+1, started.status)
+		}
+	}
+	limited := postForTest(router, "/auth/email/start", map[string]string{"email": "user@example.com"}, nil)
+	if limited.status != http.StatusTooManyRequests || limited.body["error"] != "rate_limited" || limited.header.Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After, got %d %v", limited.status, limited.body)
+	}
+	if other := postForTest(router, "/auth/email/start", map[string]string{"email": "other@example.com"}, nil); other.status != http.StatusAccepted {
+		t.Fatalf("expected other addresses to be unaffected, got %d", other.status)
+	}
+}
+
+func TestEmailLoginRejections(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testCases := []struct {
+		name           string
+		sendErr        error
+		path           string
+		payload        map[string]string
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "display name address", path: "/auth/email/start", payload: map[string]string{"email": "User <user@example.com>"}, expectedStatus: http.StatusBadRequest, expectedError: "invalid_email"},
+		{name: "missing address", path: "/auth/email/start", payload: map[string]string{}, expectedStatus: http.StatusBadRequest, expectedError: "invalid_email"},
+		{name: "mailer failure", sendErr: errors.New("relay down"), path: "/auth/email/start", payload: map[string]string{"email": "user@example.com"}, expectedStatus: http.StatusServiceUnavailable, expectedError: "mailer_unavailable"},
+		{name: "unknown token", path: "/auth/email/verify", payload: map[string]string{"token": "guess"}, expectedStatus: http.StatusUnauthorized, expectedError: "invalid_token"},
+		{name: "code without address", path: "/auth/email/verify", payload: map[string]string{"code": "123456"}, expectedStatus: http.StatusBadRequest, expectedError: "invalid_json"},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			router, _, _ := newAuthRouterForTest(t, withEmailLoginForTest(&recordingMailer{sendErr: testCase.sendErr}))
+			response := postForTest(router, testCase.path, testCase.payload, nil)
+			if response.status != testCase.expectedStatus || response.body["error"] != testCase.expectedError {
+				t.Fatalf("expected %d %q, got %d %v", testCase.expectedStatus, testCase.expectedError, response.status, response.body)
+			}
+		})
+	}
+}
+
+func TestEmailLoginRoutesRequireMailer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router, _, _ := newAuthRouterForTest(t, nil)
+	if response := postForTest(router, "/auth/email/start", map[string]string{"email": "user@example.com"}, nil); response.status != http.StatusNotFound {
+		t.Fatalf("expected email sign-in to be disabled without a mailer, got %d", response.status)
+	}
+}
@@ -0,0 +1,105 @@
+package authkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// ExtAuthzServer implements Envoy's envoy.service.auth.v3.Authorization
+// service. It accepts the session cookie or an Authorization: Bearer token and
+// applies the same validation as RequireSession. Per-route role requirements
+// come from the any_role and all_roles context extensions.
+type ExtAuthzServer struct {
+	authv3.UnimplementedAuthorizationServer
+	validator *sessionvalidator.Validator
+}
+
+// NewExtAuthzServer validates the configuration and constructs an ExtAuthzServer.
+func NewExtAuthzServer(configuration ServerConfig) (*ExtAuthzServer, error) {
+	validatorConfig := configuration.sessionValidatorConfig()
+	validatorConfig.TokenSources = []sessionvalidator.TokenSource{sessionvalidator.CookieSource(""), sessionvalidator.BearerSource()}
+	validator, validatorErr := sessionvalidator.New(validatorConfig)
+	if validatorErr != nil {
+		return nil, fmt.Errorf("ext_authz.new: %w", validatorErr)
+	}
+	return &ExtAuthzServer{validator: validator}, nil
+}
+
+// Register adds the authorization service to grpcServer.
+func (server *ExtAuthzServer) Register(grpcServer *grpc.Server) {
+	authv3.RegisterAuthorizationServer(grpcServer, server)
+}
+
+// Check allows requests carrying a valid session and returns a denied HTTP
+// response (401 or 403) otherwise. Denials are responses, not gRPC errors, so
+// Envoy relays them to the client.
+func (server *ExtAuthzServer) Check(ctx context.Context, checkRequest *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	httpAttributes := checkRequest.GetAttributes().GetRequest().GetHttp()
+	httpRequest, requestErr := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+	if requestErr != nil {
+		return nil, requestErr
+	}
+	for name, value := range httpAttributes.GetHeaders() {
+		httpRequest.Header.Set(name, value)
+	}
+
+	claims, validateErr := server.validator.ValidateRequest(httpRequest)
+	if validateErr != nil {
+		return deniedCheckResponse(codes.Unauthenticated, typev3.StatusCode_Unauthorized, "unauthorized", sessionvalidator.ValidationErrorCode(validateErr)), nil
+	}
+
+	extensions := url.Values{}
+	for name, value := range checkRequest.GetAttributes().GetContextExtensions() {
+		extensions.Set(name, value)
+	}
+	for _, requirement := range verifyRequirements(extensions) {
+		var authorizationErr *sessionvalidator.AuthorizationError
+		if errors.As(requirement.Check(claims), &authorizationErr) {
+			return deniedCheckResponse(codes.PermissionDenied, typev3.StatusCode_Forbidden, "forbidden", authorizationErr.Reason.Error()), nil
+		}
+	}
+
+	return &authv3.CheckResponse{
+		Status: &status.Status{Code: int32(codes.OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{OkResponse: &authv3.OkHttpResponse{
+			Headers: []*corev3.HeaderValueOption{
+				overwriteHeader(HeaderAuthUserID, claims.GetUserID()),
+				overwriteHeader(HeaderAuthEmail, claims.GetUserEmail()),
+				overwriteHeader(HeaderAuthRoles, strings.Join(claims.GetUserRoles(), ",")),
+			},
+		}},
+	}, nil
+}
+
+func deniedCheckResponse(code codes.Code, httpStatus typev3.StatusCode, errorCode string, reason string) *authv3.CheckResponse {
+	body, _ := json.Marshal(map[string]string{"error": errorCode, "reason": reason})
+	return &authv3.CheckResponse{
+		Status: &status.Status{Code: int32(code), Message: reason},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{DeniedResponse: &authv3.DeniedHttpResponse{
+			Status:  &typev3.HttpStatus{Code: httpStatus},
+			Headers: []*corev3.HeaderValueOption{overwriteHeader("Content-Type", "application/json")},
+			Body:    string(body),
+		}},
+	}
+}
+
+// overwriteHeader replaces any client-supplied value so upstreams can trust the header.
+func overwriteHeader(name string, value string) *corev3.HeaderValueOption {
+	return &corev3.HeaderValueOption{
+		Header:       &corev3.HeaderValue{Key: name, Value: value},
+		AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	}
+}
@@ -0,0 +1,117 @@
+package authkit
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func startExtAuthzForTest(t *testing.T, configuration ServerConfig) authv3.AuthorizationClient {
+	t.Helper()
+	server, serverErr := NewExtAuthzServer(configuration)
+	if serverErr != nil {
+		t.Fatalf("new ext_authz server: %v", serverErr)
+	}
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatalf("listen: %v", listenErr)
+	}
+	grpcServer := grpc.NewServer()
+	server.Register(grpcServer)
+	go func() { _ = grpcServer.Serve(listener) }()
+	t.Cleanup(grpcServer.Stop)
+
+	connection, dialErr := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if dialErr != nil {
+		t.Fatalf("dial ext_authz: %v", dialErr)
+	}
+	t.Cleanup(func() { _ = connection.Close() })
+	return authv3.NewAuthorizationClient(connection)
+}
+
+func checkRequestForTest(headers map[string]string, extensions map[string]string) *authv3.CheckRequest {
+	return &authv3.CheckRequest{Attributes: &authv3.AttributeContext{
+		Request: &authv3.AttributeContext_Request{Http: &authv3.AttributeContext_HttpRequest{
+			Method:  "GET",
+			Path:    "/dashboard",
+			Headers: headers,
+		}},
+		ContextExtensions: extensions,
+	}}
+}
+
+func responseHeaders(options []*corev3.HeaderValueOption) map[string]string {
+	headers := map[string]string{}
+	for _, option := range options {
+		headers[option.GetHeader().GetKey()] = option.GetHeader().GetValue()
+		if option.GetAppendAction() != corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD {
+			headers["append:"+option.GetHeader().GetKey()] = "true"
+		}
+	}
+	return headers
+}
+
+func TestExtAuthzServerChecksSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer ProvideGoogleTokenValidator(nil)
+	ProvideSessionRevocationStore(NewMemorySessionRevocationStore())
+	defer ProvideSessionRevocationStore(nil)
+
+	config := newTestServerConfig()
+	router := gin.New()
+	MountAuthRoutes(router, config, newTestUserStore(), NewMemoryRefreshTokenStore(), nil)
+	sessionToken := loginForTest(t, router, "sub-envoy")[config.SessionCookieName].Value
+	client := startExtAuthzForTest(t, config)
+
+	testCases := []struct {
+		name           string
+		headers        map[string]string
+		extensions     map[string]string
+		expectedCode   codes.Code
+		expectedStatus typev3.StatusCode
+		expectedReason string
+	}{
+		{name: "session cookie", headers: map[string]string{"cookie": "other=1; " + config.SessionCookieName + "=" + sessionToken}, expectedCode: codes.OK},
+		{name: "bearer token", headers: map[string]string{"authorization": "Bearer " + sessionToken}, expectedCode: codes.OK},
+		{name: "role satisfied", headers: map[string]string{"authorization": "Bearer " + sessionToken}, extensions: map[string]string{"any_role": "user,admin"}, expectedCode: codes.OK},
+		{name: "no credentials", headers: map[string]string{}, expectedCode: codes.Unauthenticated, expectedStatus: typev3.StatusCode_Unauthorized, expectedReason: "session.validator.no_credentials"},
+		{name: "invalid token", headers: map[string]string{"authorization": "Bearer not-a-jwt"}, expectedCode: codes.Unauthenticated, expectedStatus: typev3.StatusCode_Unauthorized, expectedReason: "session.validator.invalid_token"},
+		{name: "role missing", headers: map[string]string{"authorization": "Bearer " + sessionToken}, extensions: map[string]string{"all_roles": "admin"}, expectedCode: codes.PermissionDenied, expectedStatus: typev3.StatusCode_Forbidden, expectedReason: "session.validator.missing_role"},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			response, checkErr := client.Check(context.Background(), checkRequestForTest(testCase.headers, testCase.extensions))
+			if checkErr != nil {
+				t.Fatalf("check: %v", checkErr)
+			}
+			if codes.Code(response.GetStatus().GetCode()) != testCase.expectedCode {
+				t.Fatalf("expected %s, got %s", testCase.expectedCode, codes.Code(response.GetStatus().GetCode()))
+			}
+			if testCase.expectedCode == codes.OK {
+				headers := responseHeaders(response.GetOkResponse().GetHeaders())
+				if headers[HeaderAuthUserID] != "google:sub-envoy" || headers[HeaderAuthEmail] != "sub-envoy@example.com" || headers[HeaderAuthRoles] != "user" || len(headers) != 3 {
+					t.Fatalf("unexpected identity headers %v", headers)
+				}
+				return
+			}
+			denied := response.GetDeniedResponse()
+			if denied.GetStatus().GetCode() != testCase.expectedStatus {
+				t.Fatalf("expected HTTP %s, got %s", testCase.expectedStatus, denied.GetStatus().GetCode())
+			}
+			if !strings.Contains(denied.GetBody(), testCase.expectedReason) {
+				t.Fatalf("expected reason %q in body %q", testCase.expectedReason, denied.GetBody())
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+)
+
+const (
+	verifyPath = "/auth/verify"
+
+	// ForwardAuthReturnParameter carries the originally requested URL to the
+	// login page when /auth/verify redirects a browser.
+	ForwardAuthReturnParameter = "return_to"
+
+	// Identity headers set by /auth/verify for the proxy to copy upstream.
+	HeaderAuthUserID = "X-Auth-User-Id"
+	HeaderAuthEmail  = "X-Auth-Email"
+	HeaderAuthRoles  = "X-Auth-Roles"
+
+	verifyAnyRoleParameter  = "any_role"
+	verifyAllRolesParameter = "all_roles"
+)
+
+// handleVerify answers forward-auth subrequests from nginx auth_request,
+// Traefik forwardAuth, and Caddy forward_auth. The session is validated like
+// RequireSession; any_role and all_roles query parameters add per-route role
+// requirements.
+func handleVerify(configuration ServerConfig, sessionValidator *sessionvalidator.Validator) gin.HandlerFunc {
+	return func(contextGin *gin.Context) {
+		contextGin.Header("Cache-Control", "no-store")
+		claims, validateErr := sessionValidator.ValidateRequest(contextGin.Request)
+		if validateErr != nil {
+			if loginURL, ok := forwardAuthLoginRedirect(configuration, contextGin.Request); ok {
+				contextGin.Redirect(forwardAuthRedirectStatus(contextGin.Request), loginURL)
+				contextGin.Abort()
+				return
+			}
+			contextGin.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		for _, requirement := range verifyRequirements(contextGin.Request.URL.Query()) {
+			var authorizationErr *sessionvalidator.AuthorizationError
+			if errors.As(requirement.Check(claims), &authorizationErr) {
+				_ = contextGin.Error(authorizationErr)
+				contextGin.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+		}
+
+		contextGin.Header(HeaderAuthUserID, claims.GetUserID())
+		contextGin.Header(HeaderAuthEmail, claims.GetUserEmail())
+		contextGin.Header(HeaderAuthRoles, strings.Join(claims.GetUserRoles(), ","))
+		contextGin.Status(http.StatusOK)
+	}
+}
+
+// verifyRequirements builds role requirements from repeatable or
+// comma-separated any_role and all_roles parameters.
+func verifyRequirements(query url.Values) []sessionvalidator.Requirement {
+	var requirements []sessionvalidator.Requirement
+	if anyRoles := splitQueryValues(query[verifyAnyRoleParameter]); len(anyRoles) > 0 {
+		requirements = append(requirements, sessionvalidator.RequireAnyRole(anyRoles...))
+	}
+	if allRoles := splitQueryValues(query[verifyAllRolesParameter]); len(allRoles) > 0 {
+		requirements = append(requirements, sessionvalidator.RequireAllRoles(allRoles...))
+	}
+	return requirements
+}
+
+func splitQueryValues(values []string) []string {
+	var split []string
+	for _, value := range values {
+		for _, chunk := range strings.Split(value, ",") {
+			if chunk = strings.TrimSpace(chunk); chunk != "" {
+				split = append(split, chunk)
+			}
+		}
+	}
+	return split
+}
+
+// forwardAuthLoginRedirect returns the login URL for browser navigations: the
+// proxy supplied X-Forwarded-Uri and the original request accepts HTML.
+func forwardAuthLoginRedirect(configuration ServerConfig, request *http.Request) (string, bool) {
+	forwardedURI := request.Header.Get("X-Forwarded-Uri")
+	if configuration.ForwardAuthLoginURL == "" || forwardedURI == "" || !strings.Contains(request.Header.Get("Accept"), "text/html") {
+		return "", false
+	}
+	returnTo := forwardedURI
+	if forwardedHost := request.Header.Get("X-Forwarded-Host"); forwardedHost != "" {
+		scheme := request.Header.Get("X-Forwarded-Proto")
+		if scheme == "" {
+			scheme = "https"
+		}
+		returnTo = scheme + "://" + forwardedHost + forwardedURI
+	}
+	return loginRedirectURL(configuration.ForwardAuthLoginURL, returnTo)
+}
+
+// loginRedirectURL appends the return_to parameter to loginURL.
+func loginRedirectURL(loginURL string, returnTo string) (string, bool) {
+	parsedURL, parseErr := url.Parse(loginURL)
+	if parseErr != nil {
+		return "", false
+	}
+	query := parsedURL.Query()
+	query.Set(ForwardAuthReturnParameter, returnTo)
+	parsedURL.RawQuery = query.Encode()
+	return parsedURL.String(), true
+}
+
+func forwardAuthRedirectStatus(request *http.Request) int {
+	method := request.Header.Get("X-Forwarded-Method")
+	if method == "" || method == http.MethodGet || method == http.MethodHead {
+		return http.StatusFound
+	}
+	return http.StatusSeeOther
+}
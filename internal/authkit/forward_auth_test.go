@@ -0,0 +1,104 @@
+package authkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestVerifyEndpointForwardsIdentity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer ProvideGoogleTokenValidator(nil)
+	ProvideSessionRevocationStore(NewMemorySessionRevocationStore())
+	defer ProvideSessionRevocationStore(nil)
+
+	config := newTestServerConfig()
+	router := gin.New()
+	MountAuthRoutes(router, config, newTestUserStore(), NewMemoryRefreshTokenStore(), nil)
+	cookies := loginForTest(t, router, "sub-verify")
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{name: "session only", query: "", expectedStatus: http.StatusOK},
+		{name: "any role satisfied", query: "?any_role=admin,user", expectedStatus: http.StatusOK},
+		{name: "all roles satisfied", query: "?all_roles=user", expectedStatus: http.StatusOK},
+		{name: "any role missing", query: "?any_role=admin", expectedStatus: http.StatusForbidden},
+		{name: "all roles missing", query: "?all_roles=user&all_roles=admin", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			response := serveWithCookies(router, http.MethodGet, verifyPath+testCase.query, nil, cookies, config.SessionCookieName)
+			if response.Code != testCase.expectedStatus {
+				t.Fatalf("expected %d, got %d", testCase.expectedStatus, response.Code)
+			}
+			if testCase.expectedStatus != http.StatusOK {
+				if response.Header().Get(HeaderAuthUserID) != "" {
+					t.Fatalf("expected no identity headers on denial")
+				}
+				return
+			}
+			if response.Header().Get(HeaderAuthUserID) != "google:sub-verify" ||
+				response.Header().Get(HeaderAuthEmail) != "sub-verify@example.com" ||
+				response.Header().Get(HeaderAuthRoles) != "user" {
+				t.Fatalf("unexpected identity headers %v", response.Header())
+			}
+		})
+	}
+}
+
+func TestVerifyEndpointRejectsUnauthenticatedRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config := newTestServerConfig()
+	config.ForwardAuthLoginURL = "https://auth.example.com/login?app=wiki"
+	router := gin.New()
+	MountAuthRoutes(router, config, newTestUserStore(), NewMemoryRefreshTokenStore(), nil)
+
+	testCases := []struct {
+		name             string
+		headers          map[string]string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{name: "api request", headers: map[string]string{"X-Forwarded-Uri": "/api/pages", "Accept": "application/json"}, expectedStatus: http.StatusUnauthorized},
+		{name: "no forwarded uri", headers: map[string]string{"Accept": "text/html"}, expectedStatus: http.StatusUnauthorized},
+		{
+			name:             "browser navigation",
+			headers:          map[string]string{"X-Forwarded-Uri": "/pages/home?tab=1", "X-Forwarded-Host": "wiki.example.com", "X-Forwarded-Proto": "https", "Accept": "text/html,application/xhtml+xml"},
+			expectedStatus:   http.StatusFound,
+			expectedLocation: "https://auth.example.com/login?app=wiki&return_to=" + url.QueryEscape("https://wiki.example.com/pages/home?tab=1"),
+		},
+		{
+			name:             "browser form post",
+			headers:          map[string]string{"X-Forwarded-Uri": "/pages/edit", "X-Forwarded-Method": http.MethodPost, "Accept": "text/html"},
+			expectedStatus:   http.StatusSeeOther,
+			expectedLocation: "https://auth.example.com/login?app=wiki&return_to=" + url.QueryEscape("/pages/edit"),
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, verifyPath, nil)
+			for name, value := range testCase.headers {
+				request.Header.Set(name, value)
+			}
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			if response.Code != testCase.expectedStatus {
+				t.Fatalf("expected %d, got %d", testCase.expectedStatus, response.Code)
+			}
+			if location := response.Header().Get("Location"); location != testCase.expectedLocation {
+				t.Fatalf("expected location %q, got %q", testCase.expectedLocation, location)
+			}
+		})
+	}
+}
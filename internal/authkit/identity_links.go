@@ -0,0 +1,222 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+	"go.uber.org/zap"
+)
+
+const (
+	identitiesPath     = "/auth/identities"
+	linkIdentityPath   = "/auth/identities/link/:provider"
+	unlinkIdentityPath = "/auth/identities/unlink"
+
+	// identityLinkMaxAuthAge bounds how long after signing in a session may
+	// link another identity; older sessions must sign in again first.
+	identityLinkMaxAuthAge = 10 * time.Minute
+)
+
+// signInLinkedIdentity signs in the account that linked identity. A changed
+// email address at the provider is recorded on the link, but the identity
+// stays with its account: links are keyed by subject, never by email.
+func signInLinkedIdentity(contextGin *gin.Context, clock Clock, configuration ServerConfig, users UserStore, refreshTokens RefreshTokenStore, identity ExternalIdentity, linked LinkedIdentity) (gin.H, bool) {
+	if !strings.EqualFold(linked.Email, identity.Email) {
+		logAuthWarning("auth.identities.email_changed", nil, zap.String("provider", identity.Provider), zap.String("user_id", linked.UserID))
+		if updateErr := resolveLinkedIdentities().UpdateEmail(contextGin, identity.Provider, identity.Subject, identity.Email); updateErr != nil {
+			logAuthError("auth.identities.update_email", updateErr)
+		}
+	}
+	userEmail, userDisplayName, userAvatarURL, userRoles, profileErr := users.GetUserProfile(contextGin, linked.UserID)
+	if profileErr != nil {
+		recordMetric(metricAuthLoginFailure)
+		logAuthError("auth.login.user_store", profileErr, zap.String("user_id", linked.UserID))
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	return issueSession(contextGin, clock, configuration, refreshTokens, linked.UserID, userEmail, userDisplayName, userAvatarURL, userRoles)
+}
+
+// mountIdentityLinkRoutes lets a signed-in user list the external identities
+// linked to their account, link another one by proving it the same way a
+// sign-in would, and unlink one again.
+func mountIdentityLinkRoutes(router gin.IRouter, clock Clock, configuration ServerConfig, sessionValidator *sessionvalidator.Validator, users UserStore, providers map[string]IdentityProvider, nonces NonceStore) {
+	verificationsPerClient := newAttemptLimiter(emailLoginVerificationsPerClient, emailLoginRateWindow)
+
+	router.GET(identitiesPath, requireSessionWith(sessionValidator), func(contextGin *gin.Context) {
+		claims, ok := sessionClaims(contextGin)
+		if !ok {
+			return
+		}
+		identities, listErr := resolveLinkedIdentities().ListByUser(contextGin, claims.GetUserID())
+		if listErr != nil {
+			logAuthError("auth.identities.list", listErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		listed := make([]gin.H, 0, len(identities))
+		for _, identity := range identities {
+			listed = append(listed, linkedIdentityResponse(identity))
+		}
+		contextGin.Header("Cache-Control", "no-store")
+		contextGin.JSON(http.StatusOK, gin.H{"identities": listed})
+	})
+
+	router.POST(linkIdentityPath, requireSessionWith(sessionValidator), func(contextGin *gin.Context) {
+		claims, ok := sessionClaims(contextGin)
+		if !ok {
+			return
+		}
+		if !requireRecentSignIn(contextGin, clock, configuration, claims) {
+			return
+		}
+		var identity ExternalIdentity
+		var verified bool
+		providerName := contextGin.Param("provider")
+		if providerName == emailIdentityProviderName && configuration.Mailer != nil {
+			identity, verified = consumeEmailChallenge(contextGin, clock, configuration, verificationsPerClient)
+		} else {
+			provider, knownProvider := providers[providerName]
+			if !knownProvider {
+				logAuthWarning("auth.identities.unknown_provider", nil, zap.String("provider", providerName))
+				contextGin.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_provider"})
+				return
+			}
+			identity, verified = verifyIdentityTokenRequest(contextGin, configuration, provider, nonces)
+		}
+		if !verified {
+			return
+		}
+		if identity.Subject == "" || identity.Email == "" || !identity.EmailVerified {
+			logAuthWarning("auth.identities.unverified_identity", nil)
+			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unverified_identity"})
+			return
+		}
+		if !allowLoginPolicy(contextGin, configuration, identity) {
+			return
+		}
+
+		applicationUserID := claims.GetUserID()
+		existing, getErr := resolveLinkedIdentities().Get(contextGin, identity.Provider, identity.Subject)
+		if getErr != nil && !errors.Is(getErr, ErrLinkedIdentityNotFound) {
+			logAuthError("auth.identities.store", getErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if getErr == nil {
+			if existing.UserID != applicationUserID {
+				logAuthWarning("auth.identities.in_use", nil, zap.String("provider", identity.Provider), zap.String("user_id", applicationUserID))
+				contextGin.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "identity_in_use"})
+				return
+			}
+			contextGin.JSON(http.StatusOK, linkedIdentityResponse(existing))
+			return
+		}
+		ownerID, found, lookupErr := users.LookupExternalUser(contextGin, identity.Provider, identity.Subject)
+		if lookupErr != nil {
+			logAuthError("auth.identities.user_store", lookupErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if found && ownerID != applicationUserID {
+			logAuthWarning("auth.identities.in_use", nil, zap.String("provider", identity.Provider), zap.String("user_id", applicationUserID))
+			contextGin.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "identity_in_use"})
+			return
+		}
+		if found {
+			contextGin.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "primary_identity"})
+			return
+		}
+
+		linked := LinkedIdentity{
+			Provider:    identity.Provider,
+			Subject:     identity.Subject,
+			UserID:      applicationUserID,
+			Email:       identity.Email,
+			CreatedUnix: clock.Now().UTC().Unix(),
+		}
+		createErr := resolveLinkedIdentities().Create(contextGin, linked)
+		if errors.Is(createErr, ErrLinkedIdentityExists) {
+			contextGin.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "identity_in_use"})
+			return
+		}
+		if createErr != nil {
+			logAuthError("auth.identities.create", createErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		recordMetric(metricAuthIdentityLinked)
+		contextGin.JSON(http.StatusCreated, linkedIdentityResponse(linked))
+	})
+
+	router.POST(unlinkIdentityPath, requireSessionWith(sessionValidator), func(contextGin *gin.Context) {
+		claims, ok := sessionClaims(contextGin)
+		if !ok {
+			return
+		}
+		var inbound struct {
+			Provider string `json:"provider"`
+			Subject  string `json:"subject"`
+		}
+		if bindErr := contextGin.BindJSON(&inbound); bindErr != nil || inbound.Provider == "" || inbound.Subject == "" {
+			logAuthWarning("auth.identities.invalid_json", bindErr)
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+			return
+		}
+		deleteErr := resolveLinkedIdentities().Delete(contextGin, claims.GetUserID(), inbound.Provider, inbound.Subject)
+		if errors.Is(deleteErr, ErrLinkedIdentityNotFound) {
+			contextGin.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "identity_not_found"})
+			return
+		}
+		if deleteErr != nil {
+			logAuthError("auth.identities.delete", deleteErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		recordMetric(metricAuthIdentityUnlinked)
+		contextGin.Status(http.StatusNoContent)
+	})
+}
+
+func linkedIdentityResponse(identity LinkedIdentity) gin.H {
+	return gin.H{
+		"provider":  identity.Provider,
+		"subject":   identity.Subject,
+		"email":     identity.Email,
+		"linked_at": identity.CreatedUnix,
+	}
+}
+
+// requireRecentSignIn guards changes to how an account signs in: the session
+// must have signed in within identityLinkMaxAuthAge, and an account with a
+// second factor must have used it. Refreshing a session keeps its original
+// auth_time, so a stolen refresh cookie cannot satisfy the check. It answers
+// 403 reauthentication_required or mfa_required otherwise.
+func requireRecentSignIn(contextGin *gin.Context, clock Clock, configuration ServerConfig, claims *JwtCustomClaims) bool {
+	authTime := claims.GetAuthTime()
+	if authTime.IsZero() || clock.Now().UTC().Sub(authTime) > identityLinkMaxAuthAge {
+		logAuthWarning("auth.identities.stale_session", nil, zap.String("user_id", claims.GetUserID()))
+		contextGin.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "reauthentication_required"})
+		return false
+	}
+	if configuration.TOTPIssuer == "" || slices.Contains(claims.GetAuthMethods(), sessionvalidator.AuthMethodMFA) {
+		return true
+	}
+	enrollment, lookupErr := resolveSecondFactors().Get(contextGin, claims.GetUserID())
+	if lookupErr != nil && !errors.Is(lookupErr, ErrSecondFactorNotFound) {
+		logAuthError("auth.identities.second_factor_store", lookupErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	if lookupErr == nil && enrollment.Confirmed {
+		logAuthWarning("auth.identities.mfa_required", nil, zap.String("user_id", claims.GetUserID()))
+		contextGin.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "mfa_required"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package authkit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/idtoken"
+)
+
+// linkGoogleIdentityForTest links the Google account subject to the session in cookies.
+func linkGoogleIdentityForTest(t *testing.T, router http.Handler, cookies map[string]*http.Cookie, subject string, email string) (int, map[string]interface{}) {
+	t.Helper()
+	payload := &idtoken.Payload{Claims: map[string]interface{}{
+		"iss":            "https://accounts.google.com",
+		"sub":            subject,
+		"email":          email,
+		"email_verified": true,
+	}}
+	ProvideGoogleTokenValidator(&fakeGoogleValidator{results: map[string]validatorResult{
+		"valid-token": {payload: payload, expectedAudience: "client-id"},
+	}})
+	response := postForTest(router, "/auth/identities/link/google", prepareLoginBody(t, router, payload, "valid-token"), cookies, "app_session")
+	return response.status, response.body
+}
+
+func TestIdentityLinking(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, _, users := newAuthRouterForTest(t, nil)
+
+	if status, _ := linkGoogleIdentityForTest(t, router, nil, "secondary", "alt@example.com"); status != http.StatusUnauthorized {
+		t.Fatalf("expected linking without a session to be rejected, got %d", status)
+	}
+	owner := loginForTest(t, router, "primary")
+	if status, body := linkGoogleIdentityForTest(t, router, owner, "secondary", "alt@example.com"); status != http.StatusCreated || body["subject"] != "secondary" {
+		t.Fatalf("expected 201 from linking, got %d %v", status, body)
+	}
+	if status, _ := linkGoogleIdentityForTest(t, router, owner, "secondary", "alt@example.com"); status != http.StatusOK {
+		t.Fatalf("expected linking again to be idempotent, got %d", status)
+	}
+	if status, body := linkGoogleIdentityForTest(t, router, owner, "primary", "primary@example.com"); status != http.StatusConflict || body["error"] != "primary_identity" {
+		t.Fatalf("expected 409 primary_identity, got %d %v", status, body)
+	}
+
+	listResponse := serveWithCookies(router, http.MethodGet, identitiesPath, nil, owner, "app_session")
+	var listed struct {
+		Identities []map[string]interface{} `json:"identities"`
+	}
+	if err := json.Unmarshal(listResponse.Body.Bytes(), &listed); err != nil || listResponse.Code != http.StatusOK || len(listed.Identities) != 1 || listed.Identities[0]["email"] != "alt@example.com" {
+		t.Fatalf("expected the linked identity to be listed, got %d %s", listResponse.Code, listResponse.Body.String())
+	}
+
+	if status, errorCode := googleSignInForTest(t, router, "secondary", "renamed@example.com"); status != http.StatusOK {
+		t.Fatalf("expected the linked identity to sign in, got %d %q", status, errorCode)
+	}
+	if _, found, _ := users.LookupExternalUser(context.Background(), "google", "secondary"); found {
+		t.Fatalf("expected the linked identity not to create a second account")
+	}
+	linked, getErr := resolveLinkedIdentities().Get(context.Background(), "google", "secondary")
+	if getErr != nil || linked.UserID != "google:primary" || linked.Email != "renamed@example.com" {
+		t.Fatalf("expected the changed email on the owner's link, got %+v (%v)", linked, getErr)
+	}
+
+	other := loginForTest(t, router, "other")
+	if status, body := linkGoogleIdentityForTest(t, router, other, "secondary", "renamed@example.com"); status != http.StatusConflict || body["error"] != "identity_in_use" {
+		t.Fatalf("expected 409 identity_in_use for a linked identity, got %d %v", status, body)
+	}
+	if status, body := linkGoogleIdentityForTest(t, router, other, "primary", "primary@example.com"); status != http.StatusConflict || body["error"] != "identity_in_use" {
+		t.Fatalf("expected 409 identity_in_use for another account's identity, got %d %v", status, body)
+	}
+	unlink := map[string]string{"provider": "google", "subject": "secondary"}
+	if response := postForTest(router, unlinkIdentityPath, unlink, other, "app_session"); response.status != http.StatusNotFound || response.body["error"] != "identity_not_found" {
+		t.Fatalf("expected 404 when unlinking another account's identity, got %d %v", response.status, response.body)
+	}
+	if response := postForTest(router, unlinkIdentityPath, unlink, owner, "app_session"); response.status != http.StatusNoContent {
+		t.Fatalf("expected 204 from unlink, got %d", response.status)
+	}
+	if status, _ := googleSignInForTest(t, router, "secondary", "renamed@example.com"); status != http.StatusOK {
+		t.Fatalf("expected the unlinked identity to sign in on its own, got %d", status)
+	}
+	if applicationUserID, found, _ := users.LookupExternalUser(context.Background(), "google", "secondary"); !found || applicationUserID != "google:secondary" {
+		t.Fatalf("expected the unlinked identity to get its own account, got %q %v", applicationUserID, found)
+	}
+}
+
+func TestIdentityLinkingRequiresARecentSignIn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Session tokens are validated against the wall clock, so the sign-in
+	// happens in the past and the clock then catches up to a TOTP time step.
+	staleAge := identityLinkMaxAuthAge + time.Minute
+	clock := provideClockForTest(t, time.Now().UTC().Truncate(totpPeriodSeconds*time.Second).Add(-staleAge))
+	router, _, _ := newAuthRouterForTest(t, withTOTPForTest)
+
+	cookies := loginForTest(t, router, "stale-user")
+	clock.Advance(staleAge)
+	refreshed := serveWithCookies(router, http.MethodPost, "/auth/refresh", nil, cookies, "app_refresh")
+	if refreshed.Code != http.StatusNoContent {
+		t.Fatalf("expected the session to refresh, got %d", refreshed.Code)
+	}
+	if status, body := linkGoogleIdentityForTest(t, router, collectCookies(refreshed.Result().Cookies()), "stale-secondary", "stale@example.com"); status != http.StatusForbidden || body["error"] != "reauthentication_required" {
+		t.Fatalf("expected a refreshed but old session to be refused, got %d %v", status, body)
+	}
+	if status, _ := linkGoogleIdentityForTest(t, router, loginForTest(t, router, "stale-user"), "stale-secondary", "stale@example.com"); status != http.StatusCreated {
+		t.Fatalf("expected a fresh sign-in to link, got %d", status)
+	}
+
+	cookies = loginForTest(t, router, "mfa-link-user")
+	secret := "JBSWY3DPEHPK3PXP"
+	if err := resolveSecondFactors().Save(context.Background(), TOTPEnrollment{UserID: "google:mfa-link-user", Secret: secret, Confirmed: true}); err != nil {
+		t.Fatalf("save enrollment: %v", err)
+	}
+	if status, body := linkGoogleIdentityForTest(t, router, cookies, "mfa-secondary", "mfa@example.com"); status != http.StatusForbidden || body["error"] != "mfa_required" {
+		t.Fatalf("expected a session without its second factor to be refused, got %d %v", status, body)
+	}
+	steppedUp := postForTest(router, mfaVerifyPath, map[string]string{"code": totpCodeForTest(t, secret, clock.Now())}, cookies, "app_session", "app_refresh")
+	if steppedUp.status != http.StatusOK {
+		t.Fatalf("expected the session to step up, got %d", steppedUp.status)
+	}
+	if status, _ := linkGoogleIdentityForTest(t, router, steppedUp.cookies, "mfa-secondary", "mfa@example.com"); status != http.StatusCreated {
+		t.Fatalf("expected the stepped-up session to link, got %d", status)
+	}
+}
@@ -0,0 +1,294 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+)
+
+const (
+	identityLoginPath          = "/auth/:provider"
+	googleIdentityProviderName = "google"
+)
+
+// Sentinel errors returned by identity providers.
+var (
+	ErrInvalidIdentityProvider     = errors.New("identity_provider.invalid_config")
+	ErrInvalidIDToken              = errors.New("identity_provider.invalid_id_token")
+	ErrIDTokenIssuerMismatch       = errors.New("identity_provider.invalid_issuer")
+	ErrIdentityProviderUnavailable = errors.New("identity_provider.unavailable")
+)
+
+// identityProviderNamePattern keeps provider names usable as the path segment
+// of POST /auth/{provider} and as the prefix of application user IDs.
+var identityProviderNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// reservedIdentityProviderNames are taken by the static /auth routes.
+var reservedIdentityProviderNames = []string{"nonce", "refresh", "logout", "verify", "introspect", "revocations", "sessions", "login", "callback", "email", "webauthn", "mfa", "invitations", "identities", "device", "token"}
+
+// ExternalIdentity is the identity an IdentityProvider vouches for after
+// verifying an ID token. Claims holds the token's full claim set.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	DisplayName   string
+	AvatarURL     string
+	Nonce         string
+	Claims        map[string]interface{}
+}
+
+// IdentityProvider verifies ID tokens from one OpenID Connect provider.
+// Name is the {provider} segment of POST /auth/{provider}. VerifyIDToken
+// returns ErrInvalidIDToken or ErrIDTokenIssuerMismatch for tokens it rejects
+// and ErrIdentityProviderUnavailable when the provider's keys cannot be fetched.
+type IdentityProvider interface {
+	Name() string
+	VerifyIDToken(ctx context.Context, idToken string) (ExternalIdentity, error)
+}
+
+// ClaimMappings names the ID token claims holding each identity field; empty
+// fields fall back to the standard OpenID Connect claims.
+type ClaimMappings struct {
+	Subject       string `json:"subject"`
+	Email         string `json:"email"`
+	EmailVerified string `json:"email_verified"`
+	DisplayName   string `json:"display_name"`
+	AvatarURL     string `json:"avatar_url"`
+}
+
+func (mappings ClaimMappings) withDefaults() ClaimMappings {
+	return ClaimMappings{
+		Subject:       claimNameOrDefault(mappings.Subject, "sub"),
+		Email:         claimNameOrDefault(mappings.Email, "email"),
+		EmailVerified: claimNameOrDefault(mappings.EmailVerified, "email_verified"),
+		DisplayName:   claimNameOrDefault(mappings.DisplayName, "name"),
+		AvatarURL:     claimNameOrDefault(mappings.AvatarURL, "picture"),
+	}
+}
+
+func claimNameOrDefault(name string, fallback string) string {
+	if name = strings.TrimSpace(name); name != "" {
+		return name
+	}
+	return fallback
+}
+
+// OIDCProviderConfig configures an OpenID Connect provider such as Microsoft
+// Entra ID, Okta, or Keycloak. ID tokens must be signed by a key published at
+// JWKSURL, carry Issuer as iss, and list one of ClientIDs in aud. TrustEmail
+// treats the email claim as verified for providers that never emit
+// email_verified but only release verified addresses. AuthorizationURL and
+// TokenURL, set together, enable the authorization code flow for the first of
+// ClientIDs; Scopes defaults to openid, email, and profile.
+type OIDCProviderConfig struct {
+	Name             string
+	Issuer           string
+	JWKSURL          string
+	ClientIDs        []string
+	ClaimMappings    ClaimMappings
+	TrustEmail       bool
+	AuthorizationURL string
+	TokenURL         string
+	ClientSecret     string
+	Scopes           []string
+	HTTPClient       *http.Client
+}
+
+// OIDCProvider verifies ID tokens against a remote JWKS.
+type OIDCProvider struct {
+	name              string
+	clientIDs         []string
+	claimMappings     ClaimMappings
+	trustEmail        bool
+	validator         *sessionvalidator.Validator
+	authorizationCode *authorizationCodeClient
+}
+
+// NewOIDCProvider validates the configuration and constructs an OIDCProvider.
+// Keys are fetched on first use and cached per the JWKS response headers.
+func NewOIDCProvider(configuration OIDCProviderConfig) (*OIDCProvider, error) {
+	if validateErr := validateIdentityProviderName(configuration.Name); validateErr != nil {
+		return nil, fmt.Errorf("identity_provider.new: %w", validateErr)
+	}
+	if strings.TrimSpace(configuration.Issuer) == "" {
+		return nil, fmt.Errorf("identity_provider.new: %w: %s: issuer is required", ErrInvalidIdentityProvider, configuration.Name)
+	}
+	clientIDs := make([]string, 0, len(configuration.ClientIDs))
+	for _, clientID := range configuration.ClientIDs {
+		if clientID = strings.TrimSpace(clientID); clientID != "" {
+			clientIDs = append(clientIDs, clientID)
+		}
+	}
+	if len(clientIDs) == 0 {
+		return nil, fmt.Errorf("identity_provider.new: %w: %s: at least one client ID is required", ErrInvalidIdentityProvider, configuration.Name)
+	}
+	var authorizationCode *authorizationCodeClient
+	if configuration.AuthorizationURL != "" || configuration.TokenURL != "" {
+		if !isAbsoluteHTTPURL(configuration.AuthorizationURL) || !isAbsoluteHTTPURL(configuration.TokenURL) {
+			return nil, fmt.Errorf("identity_provider.new: %w: %s: authorization and token URLs must both be absolute http(s) URLs", ErrInvalidIdentityProvider, configuration.Name)
+		}
+		authorizationCode = newAuthorizationCodeClient(configuration.AuthorizationURL, configuration.TokenURL, clientIDs[0], configuration.ClientSecret, configuration.Scopes, configuration.HTTPClient)
+	}
+	validator, validatorErr := sessionvalidator.New(sessionvalidator.Config{
+		JWKSURL:        configuration.JWKSURL,
+		HTTPClient:     configuration.HTTPClient,
+		Issuer:         configuration.Issuer,
+		RequiredClaims: []string{"exp"},
+	})
+	if validatorErr != nil {
+		return nil, fmt.Errorf("identity_provider.new: %w: %s: %v", ErrInvalidIdentityProvider, configuration.Name, validatorErr)
+	}
+	return &OIDCProvider{
+		name:              configuration.Name,
+		clientIDs:         clientIDs,
+		claimMappings:     configuration.ClaimMappings.withDefaults(),
+		trustEmail:        configuration.TrustEmail,
+		validator:         validator,
+		authorizationCode: authorizationCode,
+	}, nil
+}
+
+// Name returns the provider name.
+func (provider *OIDCProvider) Name() string {
+	return provider.name
+}
+
+// VerifyIDToken checks the token's signature, issuer, expiry, and audience and
+// maps its claims onto an ExternalIdentity.
+func (provider *OIDCProvider) VerifyIDToken(ctx context.Context, idToken string) (ExternalIdentity, error) {
+	rawClaims, claims, validateErr := sessionvalidator.ValidateInto[map[string]interface{}](provider.validator, idToken)
+	switch {
+	case errors.Is(validateErr, sessionvalidator.ErrKeySetUnavailable):
+		return ExternalIdentity{}, fmt.Errorf("identity_provider.verify: %w: %v", ErrIdentityProviderUnavailable, validateErr)
+	case errors.Is(validateErr, sessionvalidator.ErrInvalidIssuer):
+		return ExternalIdentity{}, fmt.Errorf("identity_provider.verify: %w", ErrIDTokenIssuerMismatch)
+	case validateErr != nil:
+		return ExternalIdentity{}, fmt.Errorf("identity_provider.verify: %w: %v", ErrInvalidIDToken, validateErr)
+	}
+	if !slices.ContainsFunc(claims.Audience, func(audience string) bool { return slices.Contains(provider.clientIDs, audience) }) {
+		return ExternalIdentity{}, fmt.Errorf("identity_provider.verify: %w: audience not accepted", ErrInvalidIDToken)
+	}
+	// OpenID Connect Core 3.1.3.7: azp, when present, names the client the token was issued to.
+	if authorizedParty, _ := rawClaims["azp"].(string); authorizedParty != "" && !slices.Contains(provider.clientIDs, authorizedParty) {
+		return ExternalIdentity{}, fmt.Errorf("identity_provider.verify: %w: authorized party not accepted", ErrInvalidIDToken)
+	}
+	return identityFromClaims(provider.name, rawClaims, provider.claimMappings, provider.trustEmail), nil
+}
+
+// AuthorizationURL returns the provider's authorization endpoint URL with the
+// state, nonce, and S256 PKCE challenge for codeVerifier.
+func (provider *OIDCProvider) AuthorizationURL(redirectURI string, state string, nonce string, codeVerifier string) (string, error) {
+	return provider.authorizationCode.authorizationURL(redirectURI, state, nonce, codeVerifier)
+}
+
+// ExchangeCode redeems an authorization code at the token endpoint and returns the ID token.
+func (provider *OIDCProvider) ExchangeCode(ctx context.Context, redirectURI string, code string, codeVerifier string) (string, error) {
+	return provider.authorizationCode.exchangeCode(ctx, redirectURI, code, codeVerifier)
+}
+
+// googleIdentityProvider verifies Google Sign-In credentials through the
+// injected GoogleTokenValidator and, with a client secret, runs Google's
+// authorization code flow.
+type googleIdentityProvider struct {
+	clientID          string
+	authorizationCode *authorizationCodeClient
+}
+
+func (googleIdentityProvider) Name() string {
+	return googleIdentityProviderName
+}
+
+func (provider googleIdentityProvider) VerifyIDToken(ctx context.Context, idToken string) (ExternalIdentity, error) {
+	validator, validatorErr := resolveGoogleValidator(ctx)
+	if validatorErr != nil {
+		return ExternalIdentity{}, fmt.Errorf("identity_provider.google.validator_init: %w", validatorErr)
+	}
+	payload, validateErr := validator.Validate(ctx, idToken, provider.clientID)
+	if validateErr != nil {
+		return ExternalIdentity{}, fmt.Errorf("identity_provider.google.verify: %w: %v", ErrInvalidIDToken, validateErr)
+	}
+	issuerValue, _ := payload.Claims["iss"].(string)
+	if issuerValue != "https://accounts.google.com" && issuerValue != "accounts.google.com" {
+		return ExternalIdentity{}, fmt.Errorf("identity_provider.google.verify: %w: %q", ErrIDTokenIssuerMismatch, issuerValue)
+	}
+	return identityFromClaims(googleIdentityProviderName, payload.Claims, ClaimMappings{}.withDefaults(), false), nil
+}
+
+func (provider googleIdentityProvider) AuthorizationURL(redirectURI string, state string, nonce string, codeVerifier string) (string, error) {
+	return provider.authorizationCode.authorizationURL(redirectURI, state, nonce, codeVerifier)
+}
+
+func (provider googleIdentityProvider) ExchangeCode(ctx context.Context, redirectURI string, code string, codeVerifier string) (string, error) {
+	return provider.authorizationCode.exchangeCode(ctx, redirectURI, code, codeVerifier)
+}
+
+func identityFromClaims(providerName string, claims map[string]interface{}, mappings ClaimMappings, trustEmail bool) ExternalIdentity {
+	return ExternalIdentity{
+		Provider:      providerName,
+		Subject:       claimString(claims, mappings.Subject),
+		Email:         claimString(claims, mappings.Email),
+		EmailVerified: trustEmail || claimBool(claims, mappings.EmailVerified),
+		DisplayName:   claimString(claims, mappings.DisplayName),
+		AvatarURL:     claimString(claims, mappings.AvatarURL),
+		Nonce:         claimString(claims, "nonce"),
+		Claims:        claims,
+	}
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// claimBool accepts JSON booleans and the "true" strings some providers emit.
+func claimBool(claims map[string]interface{}, name string) bool {
+	switch value := claims[name].(type) {
+	case bool:
+		return value
+	case string:
+		return strings.EqualFold(value, "true")
+	}
+	return false
+}
+
+func isAbsoluteHTTPURL(rawURL string) bool {
+	parsedURL, parseErr := url.Parse(rawURL)
+	return parseErr == nil && (parsedURL.Scheme == "https" || parsedURL.Scheme == "http") && parsedURL.Host != ""
+}
+
+func validateIdentityProviderName(name string) error {
+	if !identityProviderNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: provider name %q must be lowercase letters, digits, '-' or '_'", ErrInvalidIdentityProvider, name)
+	}
+	if slices.Contains(reservedIdentityProviderNames, name) {
+		return fmt.Errorf("%w: provider name %q is reserved", ErrInvalidIdentityProvider, name)
+	}
+	return nil
+}
+
+// identityProviders indexes the configured providers by name. Google Sign-In
+// is available as "google" whenever GoogleWebClientID is set, unless a
+// configured provider claims that name.
+func identityProviders(configuration ServerConfig) map[string]IdentityProvider {
+	providers := make(map[string]IdentityProvider, len(configuration.IdentityProviders)+1)
+	if configuration.GoogleWebClientID != "" {
+		provider := googleIdentityProvider{clientID: configuration.GoogleWebClientID}
+		if configuration.GoogleWebClientSecret != "" {
+			provider.authorizationCode = newAuthorizationCodeClient(googleAuthorizationURL, googleTokenURL, configuration.GoogleWebClientID, configuration.GoogleWebClientSecret, nil, nil)
+		}
+		providers[googleIdentityProviderName] = provider
+	}
+	for _, provider := range configuration.IdentityProviders {
+		providers[provider.Name()] = provider
+	}
+	return providers
+}
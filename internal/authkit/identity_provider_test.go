@@ -0,0 +1,266 @@
+package authkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+)
+
+// fakeOIDCIssuer is a local OpenID Connect provider publishing its signing key
+// as a JWKS and redeeming the authorization codes registered with issueCode.
+type fakeOIDCIssuer struct {
+	server     *httptest.Server
+	signingKey *rsa.PrivateKey
+	codesMutex sync.Mutex
+	codes      map[string]fakeAuthorizationCode
+}
+
+const fakeOIDCKeyID = "fake-oidc-key"
+
+func newFakeOIDCIssuer(t *testing.T) *fakeOIDCIssuer {
+	t.Helper()
+	signingKey, keyErr := rsa.GenerateKey(rand.Reader, 2048)
+	if keyErr != nil {
+		t.Fatalf("generate rsa key: %v", keyErr)
+	}
+	webKey, webKeyErr := sessionvalidator.NewJSONWebKey(&signingKey.PublicKey, fakeOIDCKeyID)
+	if webKeyErr != nil {
+		t.Fatalf("encode jwk: %v", webKeyErr)
+	}
+	issuer := &fakeOIDCIssuer{signingKey: signingKey, codes: make(map[string]fakeAuthorizationCode)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys", func(writer http.ResponseWriter, request *http.Request) {
+		_ = json.NewEncoder(writer).Encode(sessionvalidator.JSONWebKeySet{Keys: []sessionvalidator.JSONWebKey{webKey}})
+	})
+	mux.HandleFunc("/token", issuer.serveToken)
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (issuer *fakeOIDCIssuer) providerConfig(name string) OIDCProviderConfig {
+	return OIDCProviderConfig{
+		Name:      name,
+		Issuer:    issuer.server.URL,
+		JWKSURL:   issuer.server.URL + "/keys",
+		ClientIDs: []string{"tauth-client"},
+	}
+}
+
+// idToken signs an ID token for tauth-client; overrides replace or, when nil, remove claims.
+func (issuer *fakeOIDCIssuer) idToken(t *testing.T, subject string, overrides map[string]interface{}) string {
+	t.Helper()
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            issuer.server.URL,
+		"sub":            subject,
+		"aud":            "tauth-client",
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"email":          subject + "@corp.example.com",
+		"email_verified": true,
+		"name":           "Corp User",
+		"picture":        "https://corp.example.com/avatar.png",
+	}
+	for name, value := range overrides {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = fakeOIDCKeyID
+	signed, signErr := token.SignedString(issuer.signingKey)
+	if signErr != nil {
+		t.Fatalf("sign id token: %v", signErr)
+	}
+	return signed
+}
+
+func TestOIDCProviderVerifyIDToken(t *testing.T) {
+	issuer := newFakeOIDCIssuer(t)
+	provider, providerErr := NewOIDCProvider(issuer.providerConfig("okta"))
+	if providerErr != nil {
+		t.Fatalf("new oidc provider: %v", providerErr)
+	}
+
+	identity, verifyErr := provider.VerifyIDToken(context.Background(), issuer.idToken(t, "user-1", map[string]interface{}{"nonce": "nonce-1"}))
+	if verifyErr != nil {
+		t.Fatalf("verify id token: %v", verifyErr)
+	}
+	if identity.Provider != "okta" || identity.Subject != "user-1" || identity.Email != "user-1@corp.example.com" || !identity.EmailVerified || identity.DisplayName != "Corp User" || identity.AvatarURL != "https://corp.example.com/avatar.png" || identity.Nonce != "nonce-1" {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+
+	testCases := []struct {
+		name          string
+		overrides     map[string]interface{}
+		expectedError error
+	}{
+		{name: "foreign issuer", overrides: map[string]interface{}{"iss": "https://evil.example.com"}, expectedError: ErrIDTokenIssuerMismatch},
+		{name: "other client", overrides: map[string]interface{}{"aud": "other-client"}, expectedError: ErrInvalidIDToken},
+		{name: "other authorized party", overrides: map[string]interface{}{"aud": []string{"tauth-client", "other-client"}, "azp": "other-client"}, expectedError: ErrInvalidIDToken},
+		{name: "expired", overrides: map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}, expectedError: ErrInvalidIDToken},
+		{name: "no expiry", overrides: map[string]interface{}{"exp": nil}, expectedError: ErrInvalidIDToken},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			_, verifyErr := provider.VerifyIDToken(context.Background(), issuer.idToken(t, "user-1", testCase.overrides))
+			if !errors.Is(verifyErr, testCase.expectedError) {
+				t.Fatalf("expected %v, got %v", testCase.expectedError, verifyErr)
+			}
+		})
+	}
+}
+
+func TestOIDCProviderClaimMappings(t *testing.T) {
+	issuer := newFakeOIDCIssuer(t)
+	providerConfig := issuer.providerConfig("entra")
+	providerConfig.ClaimMappings = ClaimMappings{Subject: "oid", Email: "preferred_username"}
+	providerConfig.TrustEmail = true
+	provider, providerErr := NewOIDCProvider(providerConfig)
+	if providerErr != nil {
+		t.Fatalf("new oidc provider: %v", providerErr)
+	}
+
+	identity, verifyErr := provider.VerifyIDToken(context.Background(), issuer.idToken(t, "pairwise-sub", map[string]interface{}{
+		"oid":                "object-id",
+		"preferred_username": "user@tenant.example.com",
+		"email":              nil,
+		"email_verified":     nil,
+	}))
+	if verifyErr != nil {
+		t.Fatalf("verify id token: %v", verifyErr)
+	}
+	if identity.Subject != "object-id" || identity.Email != "user@tenant.example.com" || !identity.EmailVerified {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+}
+
+func TestOIDCProviderUnavailableKeys(t *testing.T) {
+	issuer := newFakeOIDCIssuer(t)
+	providerConfig := issuer.providerConfig("keycloak")
+	providerConfig.JWKSURL = issuer.server.URL + "/missing"
+	provider, providerErr := NewOIDCProvider(providerConfig)
+	if providerErr != nil {
+		t.Fatalf("new oidc provider: %v", providerErr)
+	}
+	if _, verifyErr := provider.VerifyIDToken(context.Background(), issuer.idToken(t, "user-1", nil)); !errors.Is(verifyErr, ErrIdentityProviderUnavailable) {
+		t.Fatalf("expected ErrIdentityProviderUnavailable, got %v", verifyErr)
+	}
+}
+
+func TestNewOIDCProviderValidatesConfiguration(t *testing.T) {
+	valid := OIDCProviderConfig{Name: "okta", Issuer: "https://corp.okta.com", JWKSURL: "https://corp.okta.com/oauth2/v1/keys", ClientIDs: []string{"client"}}
+	if _, err := NewOIDCProvider(valid); err != nil {
+		t.Fatalf("expected valid configuration, got %v", err)
+	}
+
+	testCases := []struct {
+		name   string
+		mutate func(*OIDCProviderConfig)
+	}{
+		{name: "reserved name", mutate: func(config *OIDCProviderConfig) { config.Name = "refresh" }},
+		{name: "name with slash", mutate: func(config *OIDCProviderConfig) { config.Name = "corp/okta" }},
+		{name: "missing issuer", mutate: func(config *OIDCProviderConfig) { config.Issuer = "" }},
+		{name: "missing client IDs", mutate: func(config *OIDCProviderConfig) { config.ClientIDs = []string{" "} }},
+		{name: "missing JWKS URL", mutate: func(config *OIDCProviderConfig) { config.JWKSURL = "" }},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			config := valid
+			testCase.mutate(&config)
+			if _, err := NewOIDCProvider(config); !errors.Is(err, ErrInvalidIdentityProvider) {
+				t.Fatalf("expected ErrInvalidIdentityProvider, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthProviderLoginWithOIDCProvider(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	issuer := newFakeOIDCIssuer(t)
+	provider, providerErr := NewOIDCProvider(issuer.providerConfig("okta"))
+	if providerErr != nil {
+		t.Fatalf("new oidc provider: %v", providerErr)
+	}
+	config := newTestServerConfig()
+	config.IdentityProviders = []IdentityProvider{provider}
+	userStore := newTestUserStore()
+	router := gin.New()
+	MountAuthRoutes(router, config, userStore, NewMemoryRefreshTokenStore(), nil)
+
+	login := func(path string, idToken string, nonce string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"id_token": idToken, "nonce_token": nonce})
+		request := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(body))
+		request.Header.Set("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		return response
+	}
+
+	nonce := issueNonceForTest(t, router)
+	response := login("/auth/okta", issuer.idToken(t, "okta-user", map[string]interface{}{"nonce": nonce}), nonce)
+	if response.Code != http.StatusOK {
+		t.Fatalf("expected 200 from okta login, got %d: %s", response.Code, response.Body.String())
+	}
+	var profile map[string]interface{}
+	if decodeErr := json.Unmarshal(response.Body.Bytes(), &profile); decodeErr != nil {
+		t.Fatalf("decode login response: %v", decodeErr)
+	}
+	if profile["user_id"] != "okta:okta-user" || profile["user_email"] != "okta-user@corp.example.com" {
+		t.Fatalf("unexpected login response %v", profile)
+	}
+	cookies := collectCookies(response.Result().Cookies())
+	if cookies[config.SessionCookieName] == nil || cookies[config.RefreshCookieName] == nil {
+		t.Fatalf("expected session and refresh cookies, got %v", response.Result().Cookies())
+	}
+
+	testCases := []struct {
+		name           string
+		path           string
+		overrides      map[string]interface{}
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "unknown provider", path: "/auth/keycloak", expectedStatus: http.StatusNotFound, expectedError: "unknown_provider"},
+		{name: "foreign issuer", path: "/auth/okta", overrides: map[string]interface{}{"iss": "https://evil.example.com"}, expectedStatus: http.StatusUnauthorized, expectedError: "invalid_issuer"},
+		{name: "other client", path: "/auth/okta", overrides: map[string]interface{}{"aud": "other-client"}, expectedStatus: http.StatusUnauthorized, expectedError: "invalid_id_token"},
+		{name: "unverified email", path: "/auth/okta", overrides: map[string]interface{}{"email_verified": false}, expectedStatus: http.StatusUnauthorized, expectedError: "unverified_identity"},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			nonce := issueNonceForTest(t, router)
+			overrides := map[string]interface{}{"nonce": nonce}
+			for name, value := range testCase.overrides {
+				overrides[name] = value
+			}
+			response := login(testCase.path, issuer.idToken(t, "okta-user", overrides), nonce)
+			if response.Code != testCase.expectedStatus {
+				t.Fatalf("expected %d, got %d", testCase.expectedStatus, response.Code)
+			}
+			var body map[string]string
+			_ = json.Unmarshal(response.Body.Bytes(), &body)
+			if body["error"] != testCase.expectedError {
+				t.Fatalf("expected error %q, got %q", testCase.expectedError, body["error"])
+			}
+		})
+	}
+}
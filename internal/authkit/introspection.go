@@ -0,0 +1,150 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+	"go.uber.org/zap"
+)
+
+const (
+	introspectionPath = "/auth/introspect"
+
+	tokenTypeAccess  = "access_token"
+	tokenTypeRefresh = "refresh_token"
+)
+
+// introspectionResponse is the RFC 7662 response body. Inactive tokens carry
+// only "active": false.
+type introspectionResponse struct {
+	Active      bool     `json:"active"`
+	TokenType   string   `json:"token_type,omitempty"`
+	Subject     string   `json:"sub,omitempty"`
+	Username    string   `json:"username,omitempty"`
+	Issuer      string   `json:"iss,omitempty"`
+	Audience    []string `json:"aud,omitempty"`
+	ExpiresAt   int64    `json:"exp,omitempty"`
+	IssuedAt    int64    `json:"iat,omitempty"`
+	TokenID     string   `json:"jti,omitempty"`
+	SessionID   string   `json:"sid,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	AuthMethods []string `json:"amr,omitempty"`
+}
+
+type tokenIntrospector func(ctx context.Context, token string) (introspectionResponse, error)
+
+// handleIntrospection implements RFC 7662 for session JWTs and refresh tokens
+// so services without sessionvalidator can check a token, including whether
+// it was revoked. Callers authenticate with configuration.IntrospectionClients.
+func handleIntrospection(configuration ServerConfig, sessionValidator *sessionvalidator.Validator, users UserStore, refreshTokens RefreshTokenStore) gin.HandlerFunc {
+	introspectSession := func(ctx context.Context, token string) (introspectionResponse, error) {
+		claims, validateErr := sessionValidator.ValidateTokenContext(ctx, token)
+		if errors.Is(validateErr, sessionvalidator.ErrRevocationUnavailable) {
+			return introspectionResponse{}, validateErr
+		}
+		if validateErr != nil {
+			return introspectionResponse{}, nil
+		}
+		response := introspectionResponse{
+			Active:      true,
+			TokenType:   tokenTypeAccess,
+			Subject:     claims.GetUserID(),
+			Username:    claims.GetUserEmail(),
+			Issuer:      claims.Issuer,
+			Audience:    claims.Audience,
+			TokenID:     claims.ID,
+			SessionID:   claims.GetSessionID(),
+			Roles:       claims.GetUserRoles(),
+			AuthMethods: claims.GetAuthMethods(),
+		}
+		if claims.ExpiresAt != nil {
+			response.ExpiresAt = claims.ExpiresAt.Unix()
+		}
+		if claims.IssuedAt != nil {
+			response.IssuedAt = claims.IssuedAt.Unix()
+		}
+		return response, nil
+	}
+
+	introspectRefresh := func(ctx context.Context, token string) (introspectionResponse, error) {
+		applicationUserID, tokenID, expiresUnix, validateErr := refreshTokens.Validate(ctx, token)
+		if errors.Is(validateErr, ErrRefreshTokenNotFound) || errors.Is(validateErr, ErrRefreshTokenRevoked) || errors.Is(validateErr, ErrRefreshTokenExpired) {
+			return introspectionResponse{}, nil
+		}
+		if validateErr != nil {
+			return introspectionResponse{}, validateErr
+		}
+		sessionID, sessionErr := refreshTokens.SessionID(ctx, tokenID)
+		if sessionErr != nil {
+			return introspectionResponse{}, sessionErr
+		}
+		authMethods, authMethodsErr := refreshTokens.AuthMethods(ctx, tokenID)
+		if authMethodsErr != nil {
+			return introspectionResponse{}, authMethodsErr
+		}
+		revoked, revocationErr := resolveSessionRevocations().IsRevoked(ctx, sessionID, "")
+		if revocationErr != nil {
+			return introspectionResponse{}, revocationErr
+		}
+		if revoked {
+			return introspectionResponse{}, nil
+		}
+		userEmail, _, _, userRoles, profileErr := users.GetUserProfile(ctx, applicationUserID)
+		if profileErr != nil {
+			logAuthWarning("auth.introspect.profile", profileErr)
+			return introspectionResponse{}, nil
+		}
+		return introspectionResponse{
+			Active:      true,
+			TokenType:   tokenTypeRefresh,
+			Subject:     applicationUserID,
+			Username:    userEmail,
+			Issuer:      configuration.AppJWTIssuer,
+			ExpiresAt:   expiresUnix,
+			SessionID:   sessionID,
+			Roles:       userRoles,
+			AuthMethods: authMethods,
+		}, nil
+	}
+
+	return func(contextGin *gin.Context) {
+		contextGin.Header("Cache-Control", "no-store")
+		clientID, authenticated := authenticateClient(contextGin.Request, configuration.IntrospectionClients)
+		if !authenticated {
+			logAuthWarning("auth.introspect.invalid_client", nil)
+			contextGin.Header("WWW-Authenticate", `Basic realm="tauth"`)
+			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+			return
+		}
+		token := strings.TrimSpace(contextGin.PostForm("token"))
+		if token == "" {
+			logAuthWarning("auth.introspect.missing_token", nil, zap.String("client_id", clientID))
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+
+		introspectors := []tokenIntrospector{introspectSession, introspectRefresh}
+		if contextGin.PostForm("token_type_hint") == tokenTypeRefresh {
+			introspectors = []tokenIntrospector{introspectRefresh, introspectSession}
+		}
+		for _, introspect := range introspectors {
+			response, introspectErr := introspect(contextGin, token)
+			if introspectErr != nil {
+				logAuthError("auth.introspect", introspectErr, zap.String("client_id", clientID))
+				contextGin.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "temporarily_unavailable"})
+				return
+			}
+			if response.Active {
+				recordMetric(metricAuthIntrospectActive)
+				contextGin.JSON(http.StatusOK, response)
+				return
+			}
+		}
+		recordMetric(metricAuthIntrospectInactive)
+		contextGin.JSON(http.StatusOK, introspectionResponse{Active: false})
+	}
+}
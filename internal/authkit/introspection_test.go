@@ -0,0 +1,138 @@
+package authkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func introspectForTest(t *testing.T, router http.Handler, form url.Values, configure func(request *http.Request)) (int, map[string]interface{}) {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodPost, introspectionPath, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if configure != nil {
+		configure(request)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected no-store introspection response")
+	}
+	var body map[string]interface{}
+	if decodeErr := json.Unmarshal(response.Body.Bytes(), &body); decodeErr != nil {
+		t.Fatalf("decode introspection response %q: %v", response.Body.String(), decodeErr)
+	}
+	return response.Code, body
+}
+
+func withBasicClient(clientID string, secret string) func(request *http.Request) {
+	return func(request *http.Request) {
+		request.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(secret))
+	}
+}
+
+func TestIntrospectionDescribesSessionAndRefreshTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer ProvideGoogleTokenValidator(nil)
+	ProvideSessionRevocationStore(NewMemorySessionRevocationStore())
+	defer ProvideSessionRevocationStore(nil)
+
+	config := newTestServerConfig()
+	client, clientErr := NewClientCredential("billing", "s3cret:&")
+	if clientErr != nil {
+		t.Fatalf("new client credential: %v", clientErr)
+	}
+	config.IntrospectionClients = []ClientCredential{client}
+	router := gin.New()
+	MountAuthRoutes(router, config, newTestUserStore(), NewMemoryRefreshTokenStore(), nil)
+
+	cookies := loginForTest(t, router, "sub-introspect")
+	sessionCookie := cookies[config.SessionCookieName]
+	refreshCookie := cookies[config.RefreshCookieName]
+	claims := sessionClaimsForTest(t, config, sessionCookie)
+
+	status, body := introspectForTest(t, router, url.Values{"token": {sessionCookie.Value}}, withBasicClient("billing", "s3cret:&"))
+	if status != http.StatusOK || body["active"] != true || body["token_type"] != tokenTypeAccess {
+		t.Fatalf("expected active access token, got %d %v", status, body)
+	}
+	if body["sub"] != "google:sub-introspect" || body["sid"] != claims.GetSessionID() || body["jti"] != claims.ID || body["iss"] != config.AppJWTIssuer {
+		t.Fatalf("unexpected session introspection %v", body)
+	}
+	if int64(body["exp"].(float64)) != claims.ExpiresAt.Unix() {
+		t.Fatalf("expected exp %d, got %v", claims.ExpiresAt.Unix(), body["exp"])
+	}
+	if roles, _ := body["roles"].([]interface{}); !slices.Contains(roles, interface{}("user")) {
+		t.Fatalf("expected roles in introspection, got %v", body["roles"])
+	}
+
+	form := url.Values{"token": {refreshCookie.Value}, "token_type_hint": {tokenTypeRefresh}, "client_id": {"billing"}, "client_secret": {"s3cret:&"}}
+	status, body = introspectForTest(t, router, form, nil)
+	if status != http.StatusOK || body["active"] != true || body["token_type"] != tokenTypeRefresh {
+		t.Fatalf("expected active refresh token, got %d %v", status, body)
+	}
+	if body["sub"] != "google:sub-introspect" || body["sid"] != claims.GetSessionID() || body["username"] != "sub-introspect@example.com" {
+		t.Fatalf("unexpected refresh introspection %v", body)
+	}
+
+	status, body = introspectForTest(t, router, url.Values{"token": {"unknown"}}, withBasicClient("billing", "s3cret:&"))
+	if status != http.StatusOK || len(body) != 1 || body["active"] != false {
+		t.Fatalf("expected bare inactive response, got %d %v", status, body)
+	}
+
+	logoutResponse := serveWithCookies(router, http.MethodPost, "/auth/logout", nil, cookies, config.SessionCookieName, config.RefreshCookieName)
+	if logoutResponse.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 from logout, got %d", logoutResponse.Code)
+	}
+	for _, token := range []string{sessionCookie.Value, refreshCookie.Value} {
+		status, body = introspectForTest(t, router, url.Values{"token": {token}}, withBasicClient("billing", "s3cret:&"))
+		if status != http.StatusOK || len(body) != 1 || body["active"] != false {
+			t.Fatalf("expected revoked token to be inactive, got %d %v", status, body)
+		}
+	}
+}
+
+func TestIntrospectionRequiresClientCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config := newTestServerConfig()
+	client, clientErr := NewClientCredential("billing", "s3cret")
+	if clientErr != nil {
+		t.Fatalf("new client credential: %v", clientErr)
+	}
+	config.IntrospectionClients = []ClientCredential{client}
+	router := gin.New()
+	MountAuthRoutes(router, config, newTestUserStore(), NewMemoryRefreshTokenStore(), nil)
+
+	testCases := []struct {
+		name           string
+		form           url.Values
+		configure      func(request *http.Request)
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "no credentials", form: url.Values{"token": {"token"}}, expectedStatus: http.StatusUnauthorized, expectedError: "invalid_client"},
+		{name: "wrong secret", form: url.Values{"token": {"token"}}, configure: withBasicClient("billing", "wrong"), expectedStatus: http.StatusUnauthorized, expectedError: "invalid_client"},
+		{name: "unknown client", form: url.Values{"token": {"token"}, "client_id": {"reports"}, "client_secret": {"s3cret"}}, expectedStatus: http.StatusUnauthorized, expectedError: "invalid_client"},
+		{name: "missing token", form: url.Values{}, configure: withBasicClient("billing", "s3cret"), expectedStatus: http.StatusBadRequest, expectedError: "invalid_request"},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			status, body := introspectForTest(t, router, testCase.form, testCase.configure)
+			if status != testCase.expectedStatus || body["error"] != testCase.expectedError {
+				t.Fatalf("expected %d %s, got %d %v", testCase.expectedStatus, testCase.expectedError, status, body)
+			}
+		})
+	}
+
+	if _, err := NewClientCredential(" ", "secret"); err == nil {
+		t.Fatalf("expected empty client ID to be rejected")
+	}
+}
@@ -0,0 +1,142 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvitationNotFound indicates no invitation exists for the email
+	// address, because none was created, it was revoked, or it was redeemed.
+	ErrInvitationNotFound = errors.New("invitation_store.not_found")
+	// ErrInvitationInvalid indicates an invitation without an email address or expiry.
+	ErrInvitationInvalid = errors.New("invitation_store.invalid_invitation")
+)
+
+// Invitation admits one new account with Email under invite-only registration.
+// InvitedBy is the application user ID of the administrator who created it.
+type Invitation struct {
+	Email       string
+	InvitedBy   string
+	CreatedUnix int64
+	ExpiresUnix int64
+}
+
+// InvitationStore keeps at most one invitation per normalized email address.
+type InvitationStore interface {
+	// Create stores invitation, replacing any earlier invitation for its email.
+	Create(ctx context.Context, invitation Invitation) error
+	// List returns every stored invitation ordered by email, expired ones included.
+	List(ctx context.Context) ([]Invitation, error)
+	// Revoke removes email's invitation.
+	Revoke(ctx context.Context, email string) error
+	// Redeem removes and returns email's invitation; callers check ExpiresUnix.
+	Redeem(ctx context.Context, email string) (Invitation, error)
+}
+
+var configuredInvitations InvitationStore
+
+var defaultInvitations struct {
+	sync.Mutex
+	value InvitationStore
+}
+
+// ProvideInvitationStore injects the store holding invitations.
+// Without one, an in-memory store is used.
+func ProvideInvitationStore(store InvitationStore) {
+	configuredInvitations = store
+	defaultInvitations.Lock()
+	defaultInvitations.value = nil
+	defaultInvitations.Unlock()
+}
+
+func resolveInvitations() InvitationStore {
+	if configuredInvitations != nil {
+		return configuredInvitations
+	}
+	defaultInvitations.Lock()
+	defer defaultInvitations.Unlock()
+	if defaultInvitations.value == nil {
+		defaultInvitations.value = NewMemoryInvitationStore()
+	}
+	return defaultInvitations.value
+}
+
+func validateInvitation(invitation Invitation) error {
+	if strings.TrimSpace(invitation.Email) == "" || invitation.ExpiresUnix <= 0 {
+		return ErrInvitationInvalid
+	}
+	return nil
+}
+
+// MemoryInvitationStore keeps invitations in memory; intended for tests and
+// single-instance deployments.
+type MemoryInvitationStore struct {
+	mutex       sync.Mutex
+	invitations map[string]Invitation
+}
+
+// NewMemoryInvitationStore creates an empty in-memory invitation store.
+func NewMemoryInvitationStore() *MemoryInvitationStore {
+	return &MemoryInvitationStore{invitations: make(map[string]Invitation)}
+}
+
+// Create stores invitation, replacing any earlier invitation for its email,
+// and deletes expired invitations.
+func (store *MemoryInvitationStore) Create(ctx context.Context, invitation Invitation) error {
+	if err := validateInvitation(invitation); err != nil {
+		return fmt.Errorf("invitation_store.create.memory: %w", err)
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	nowUnix := time.Now().UTC().Unix()
+	for email, pending := range store.invitations {
+		if pending.ExpiresUnix < nowUnix {
+			delete(store.invitations, email)
+		}
+	}
+	store.invitations[invitation.Email] = invitation
+	return nil
+}
+
+// List returns every stored invitation ordered by email.
+func (store *MemoryInvitationStore) List(ctx context.Context) ([]Invitation, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	invitations := make([]Invitation, 0, len(store.invitations))
+	for _, invitation := range store.invitations {
+		invitations = append(invitations, invitation)
+	}
+	slices.SortFunc(invitations, func(left Invitation, right Invitation) int {
+		return strings.Compare(left.Email, right.Email)
+	})
+	return invitations, nil
+}
+
+// Revoke removes email's invitation.
+func (store *MemoryInvitationStore) Revoke(ctx context.Context, email string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, found := store.invitations[email]; !found {
+		return fmt.Errorf("invitation_store.revoke.memory: %w", ErrInvitationNotFound)
+	}
+	delete(store.invitations, email)
+	return nil
+}
+
+// Redeem removes and returns email's invitation.
+func (store *MemoryInvitationStore) Redeem(ctx context.Context, email string) (Invitation, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	invitation, found := store.invitations[email]
+	if !found {
+		return Invitation{}, fmt.Errorf("invitation_store.redeem.memory: %w", ErrInvitationNotFound)
+	}
+	delete(store.invitations, email)
+	return invitation, nil
+}
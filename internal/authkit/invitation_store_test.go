@@ -0,0 +1,105 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func forEachInvitationStore(t *testing.T, test func(t *testing.T, store InvitationStore)) {
+	t.Helper()
+	forEachStore(t,
+		func() InvitationStore { return NewMemoryInvitationStore() },
+		func(ctx context.Context, gormDB *gorm.DB) (InvitationStore, error) {
+			return NewDatabaseInvitationStore(ctx, gormDB)
+		},
+		test,
+	)
+}
+
+func newInvitationForTest(email string, invitedBy string, createdAt time.Time, expiresAt time.Time) Invitation {
+	return Invitation{Email: email, InvitedBy: invitedBy, CreatedUnix: createdAt.Unix(), ExpiresUnix: expiresAt.Unix()}
+}
+
+func TestInvitationStoreRejectsIncompleteInvitations(t *testing.T) {
+	forEachInvitationStore(t, func(t *testing.T, store InvitationStore) {
+		if err := store.Create(context.Background(), Invitation{Email: "new@example.com"}); !errors.Is(err, ErrInvitationInvalid) {
+			t.Fatalf("expected ErrInvitationInvalid, got %v", err)
+		}
+	})
+}
+
+func TestInvitationStorePrunesExpiredInvitationsOnCreate(t *testing.T) {
+	forEachInvitationStore(t, func(t *testing.T, store InvitationStore) {
+		ctx := context.Background()
+		now := time.Now().UTC()
+		if err := store.Create(ctx, newInvitationForTest("late@example.com", "admin-1", now.Add(-2*time.Hour), now.Add(-time.Hour))); err != nil {
+			t.Fatalf("create expired: %v", err)
+		}
+		current := newInvitationForTest("new@example.com", "admin-1", now, now.Add(time.Hour))
+		if err := store.Create(ctx, current); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if listed, err := store.List(ctx); err != nil || len(listed) != 1 || listed[0] != current {
+			t.Fatalf("expected expired invitations to be pruned on create, got %+v (%v)", listed, err)
+		}
+	})
+}
+
+func TestInvitationStoreKeepsOneInvitationPerEmail(t *testing.T) {
+	forEachInvitationStore(t, func(t *testing.T, store InvitationStore) {
+		ctx := context.Background()
+		now := time.Now().UTC()
+		replacement := newInvitationForTest("new@example.com", "admin-2", now.Add(time.Second), now.Add(2*time.Hour))
+		other := newInvitationForTest("another@example.com", "admin-1", now, now.Add(time.Hour))
+		for _, invitation := range []Invitation{newInvitationForTest("new@example.com", "admin-1", now, now.Add(time.Hour)), replacement, other} {
+			if err := store.Create(ctx, invitation); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+		}
+		listed, listErr := store.List(ctx)
+		if listErr != nil || len(listed) != 2 || listed[0] != other || listed[1] != replacement {
+			t.Fatalf("expected both invitations ordered by email, got %+v (%v)", listed, listErr)
+		}
+	})
+}
+
+func TestInvitationStoreRedeemSucceedsOnce(t *testing.T) {
+	forEachInvitationStore(t, func(t *testing.T, store InvitationStore) {
+		ctx := context.Background()
+		now := time.Now().UTC()
+		invitation := newInvitationForTest("new@example.com", "admin-1", now, now.Add(time.Hour))
+		if err := store.Create(ctx, invitation); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		redeemed, redeemErr := store.Redeem(ctx, "new@example.com")
+		if redeemErr != nil || redeemed != invitation {
+			t.Fatalf("expected the invitation to be redeemed, got %+v (%v)", redeemed, redeemErr)
+		}
+		if _, err := store.Redeem(ctx, "new@example.com"); !errors.Is(err, ErrInvitationNotFound) {
+			t.Fatalf("expected a redeemed invitation to be gone, got %v", err)
+		}
+	})
+}
+
+func TestInvitationStoreRevokedInvitationsCannotBeRedeemed(t *testing.T) {
+	forEachInvitationStore(t, func(t *testing.T, store InvitationStore) {
+		ctx := context.Background()
+		now := time.Now().UTC()
+		if err := store.Create(ctx, newInvitationForTest("another@example.com", "admin-1", now, now.Add(time.Hour))); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		if err := store.Revoke(ctx, "another@example.com"); err != nil {
+			t.Fatalf("revoke: %v", err)
+		}
+		if err := store.Revoke(ctx, "another@example.com"); !errors.Is(err, ErrInvitationNotFound) {
+			t.Fatalf("expected ErrInvitationNotFound after revoke, got %v", err)
+		}
+		if _, err := store.Redeem(ctx, "another@example.com"); !errors.Is(err, ErrInvitationNotFound) {
+			t.Fatalf("expected a revoked invitation not to be redeemable, got %v", err)
+		}
+	})
+}
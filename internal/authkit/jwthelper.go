@@ -32,31 +32,76 @@ var errJWTMintFailure = errors.New("jwt.mint.failure")
 // JwtCustomClaims aliases the shared sessionvalidator claims for backward compatibility.
 type JwtCustomClaims = sessionvalidator.Claims
 
-// MintAppJWT creates a signed HS256 access token using the provided clock.
-func MintAppJWT(clock Clock, applicationUserID string, userEmail string, userDisplayName string, userAvatarURL string, userRoles []string, issuer string, signingKey []byte, ttl time.Duration) (string, time.Time, error) {
+// MintAppJWT creates an access token signed with the provided key using the provided clock.
+// A non-empty audience scopes the token to the listed applications.
+func MintAppJWT(clock Clock, applicationUserID string, userEmail string, userDisplayName string, userAvatarURL string, userRoles []string, issuer string, audience []string, signingKey SigningKey, ttl time.Duration) (string, time.Time, error) {
+	return MintAppJWTWithClaims(clock, applicationUserID, userEmail, userDisplayName, userAvatarURL, userRoles, issuer, audience, signingKey, ttl, nil)
+}
+
+// MintAppJWTWithClaims behaves like MintAppJWT and additionally embeds the
+// namespaced custom claims produced by a ClaimsEnricher.
+func MintAppJWTWithClaims(clock Clock, applicationUserID string, userEmail string, userDisplayName string, userAvatarURL string, userRoles []string, issuer string, audience []string, signingKey SigningKey, ttl time.Duration, customClaims map[string]interface{}) (string, time.Time, error) {
+	return mintAppJWT(clock, "", nil, time.Time{}, applicationUserID, userEmail, userDisplayName, userAvatarURL, userRoles, issuer, audience, signingKey, ttl, customClaims)
+}
+
+// mintAppJWT mints a token with a fresh jti and, when sessionID is set, a sid
+// tying it to its refresh token family so both can be revoked server-side.
+// authMethods becomes the amr claim and a non-zero authTime the auth_time claim.
+func mintAppJWT(clock Clock, sessionID string, authMethods []string, authTime time.Time, applicationUserID string, userEmail string, userDisplayName string, userAvatarURL string, userRoles []string, issuer string, audience []string, signingKey SigningKey, ttl time.Duration, customClaims map[string]interface{}) (string, time.Time, error) {
 	if strings.TrimSpace(applicationUserID) == "" {
 		return "", time.Time{}, fmt.Errorf("%w: subject must be non-empty", errJWTMintFailure)
 	}
 
 	current := clock.Now().UTC()
 	expiresAt := current.Add(ttl)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, JwtCustomClaims{
+	if signingKey.method == nil {
+		return "", time.Time{}, fmt.Errorf("%w: signing key must be configured", errJWTMintFailure)
+	}
+	var authTimeClaim *jwt.NumericDate
+	if !authTime.IsZero() {
+		authTimeClaim = jwt.NewNumericDate(authTime)
+	}
+	tokenID, tokenIDErr := newRandomIdentifier()
+	if tokenIDErr != nil {
+		return "", time.Time{}, fmt.Errorf("%w: token id: %v", errJWTMintFailure, tokenIDErr)
+	}
+	token := jwt.NewWithClaims(signingKey.method, JwtCustomClaims{
 		UserID:          applicationUserID,
 		UserEmail:       userEmail,
 		UserDisplayName: userDisplayName,
 		UserAvatarURL:   userAvatarURL,
 		UserRoles:       userRoles,
+		SessionID:       sessionID,
+		AuthMethods:     authMethods,
+		AuthTime:        authTimeClaim,
+		Custom:          customClaims,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    issuer,
 			Subject:   applicationUserID,
+			Audience:  audience,
+			ID:        tokenID,
 			IssuedAt:  jwt.NewNumericDate(current),
-			NotBefore: jwt.NewNumericDate(current.Add(-30 * time.Second)),
+			NotBefore: jwt.NewNumericDate(current),
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
 	})
-	signed, signErr := token.SignedString(signingKey)
+	signed, signErr := signingKey.sign(token)
 	if signErr != nil {
 		return "", time.Time{}, fmt.Errorf("%w: sign", errJWTMintFailure)
 	}
 	return signed, expiresAt, nil
 }
+
+// mintSessionToken mints the session JWT described by configuration and, when
+// encryption keys are configured, seals it in a JWE so the cookie hides PII.
+func mintSessionToken(clock Clock, configuration ServerConfig, sessionID string, authMethods []string, authTime time.Time, applicationUserID string, userEmail string, userDisplayName string, userAvatarURL string, userRoles []string, customClaims map[string]interface{}) (string, time.Time, error) {
+	signedToken, expiresAt, mintErr := mintAppJWT(clock, sessionID, authMethods, authTime, applicationUserID, userEmail, userDisplayName, userAvatarURL, userRoles, configuration.AppJWTIssuer, configuration.AppJWTAudience, configuration.AppJWTKeyring.ActiveKey(), configuration.SessionTTL, customClaims)
+	if mintErr != nil || len(configuration.AppJWTEncryptionKeys) == 0 {
+		return signedToken, expiresAt, mintErr
+	}
+	encryptedToken, encryptErr := sessionvalidator.EncryptToken(signedToken, configuration.AppJWTEncryptionKeys[0])
+	if encryptErr != nil {
+		return "", time.Time{}, fmt.Errorf("%w: encrypt: %v", errJWTMintFailure, encryptErr)
+	}
+	return encryptedToken, expiresAt, nil
+}
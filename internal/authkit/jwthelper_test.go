@@ -1,8 +1,16 @@
 package authkit
 
 import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/gin-gonic/gin"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
 )
 
 type fixedClock struct {
@@ -16,7 +24,7 @@ func (clock fixedClock) Now() time.Time {
 func TestMintAppJWTRejectsEmptySubject(t *testing.T) {
 	t.Parallel()
 
-	_, _, err := MintAppJWT(fixedClock{timestamp: time.Unix(1700000000, 0)}, "", "user@example.com", "User", "https://example.com/avatar.png", []string{"user"}, "issuer", []byte("signing-key"), time.Minute)
+	_, _, err := MintAppJWT(fixedClock{timestamp: time.Unix(1700000000, 0)}, "", "user@example.com", "User", "https://example.com/avatar.png", []string{"user"}, "issuer", nil, mustHMACSigningKey("signing-key"), time.Minute)
 	if err == nil {
 		t.Fatalf("expected error when user ID is empty")
 	}
@@ -31,7 +39,7 @@ func TestMintAppJWTCarriesClockTimestamps(t *testing.T) {
 	t.Parallel()
 
 	reference := time.Unix(1700000000, 0).UTC()
-	token, expiresAt, err := MintAppJWT(fixedClock{timestamp: reference}, "user-123", "user@example.com", "User", "https://example.com/avatar.png", []string{"user"}, "issuer", []byte("signing-key"), 2*time.Minute)
+	token, expiresAt, err := MintAppJWT(fixedClock{timestamp: reference}, "user-123", "user@example.com", "User", "https://example.com/avatar.png", []string{"user"}, "issuer", nil, mustHMACSigningKey("signing-key"), 2*time.Minute)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -44,6 +52,78 @@ func TestMintAppJWTCarriesClockTimestamps(t *testing.T) {
 	}
 }
 
+func TestMintAppJWTScopesAudience(t *testing.T) {
+	t.Parallel()
+
+	reference := time.Now().UTC()
+	signingKey := mustHMACSigningKey("signing-key")
+	token, _, err := MintAppJWT(fixedClock{timestamp: reference}, "user-123", "user@example.com", "User", "", []string{"user"}, "issuer", []string{"billing", "reports"}, signingKey, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, testCase := range []struct {
+		audience  string
+		expectErr error
+	}{
+		{audience: "billing"},
+		{audience: "reports"},
+		{audience: "admin", expectErr: sessionvalidator.ErrInvalidAudience},
+	} {
+		validator, validatorErr := sessionvalidator.New(sessionvalidator.Config{SigningKey: []byte("signing-key"), Issuer: "issuer", Audience: testCase.audience})
+		if validatorErr != nil {
+			t.Fatalf("validator: %v", validatorErr)
+		}
+		if _, validateErr := validator.ValidateToken(token); !errors.Is(validateErr, testCase.expectErr) {
+			t.Fatalf("audience %s: expected %v, got %v", testCase.audience, testCase.expectErr, validateErr)
+		}
+	}
+}
+
+func TestMintSessionTokenEncryptsWhenKeysConfigured(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	encryptionKey, keyErr := sessionvalidator.NewEncryptionKey(bytes.Repeat([]byte{7}, sessionvalidator.EncryptionKeySize))
+	if keyErr != nil {
+		t.Fatalf("encryption key: %v", keyErr)
+	}
+	config := newTestServerConfig()
+	config.AppJWTEncryptionKeys = []sessionvalidator.EncryptionKey{encryptionKey}
+
+	token, _, err := mintSessionToken(NewSystemClock(), config, "session-1", nil, time.Time{}, "user-123", "user@example.com", "User", "", []string{"user"}, nil)
+	if err != nil {
+		t.Fatalf("mint session: %v", err)
+	}
+	if strings.Count(token, ".") != 4 {
+		t.Fatalf("expected a compact JWE, got %q", token)
+	}
+
+	router := gin.New()
+	router.Use(RequireSession(config))
+	router.GET("/secure", func(contextGin *gin.Context) {
+		contextGin.String(http.StatusOK, contextGin.MustGet("auth_claims").(*JwtCustomClaims).UserEmail)
+	})
+	request := httptest.NewRequest(http.MethodGet, "/secure", nil)
+	request.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: token})
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != http.StatusOK || response.Body.String() != "user@example.com" {
+		t.Fatalf("expected encrypted session to be accepted, got %d %q", response.Code, response.Body.String())
+	}
+
+	plainConfig := newTestServerConfig()
+	plainToken, _, err := mintSessionToken(NewSystemClock(), plainConfig, "session-1", nil, time.Time{}, "user-123", "user@example.com", "User", "", nil, nil)
+	if err != nil {
+		t.Fatalf("mint session: %v", err)
+	}
+	plainRequest := httptest.NewRequest(http.MethodGet, "/secure", nil)
+	plainRequest.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: plainToken})
+	plainResponse := httptest.NewRecorder()
+	router.ServeHTTP(plainResponse, plainRequest)
+	if plainResponse.Code != http.StatusUnauthorized {
+		t.Fatalf("expected unencrypted session to be rejected once encryption is enabled, got %d", plainResponse.Code)
+	}
+}
+
 func TestJwtCustomClaimsAvatarAccessor(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,142 @@
+package authkit
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+)
+
+// KeyStatus describes where a key sits in its rotation lifecycle.
+type KeyStatus string
+
+const (
+	// KeyStatusActive marks the single key that mints new sessions.
+	KeyStatusActive KeyStatus = "active"
+	// KeyStatusVerifyOnly marks keys that still validate live sessions but never mint.
+	KeyStatusVerifyOnly KeyStatus = "verify_only"
+	// KeyStatusRetired marks keys that are no longer trusted; their kid may not be reused.
+	KeyStatusRetired KeyStatus = "retired"
+)
+
+var (
+	// ErrKeyringNoActiveKey indicates the keyring has no key able to mint sessions.
+	ErrKeyringNoActiveKey = errors.New("keyring.no_active_key")
+	// ErrKeyringMultipleActiveKeys indicates more than one key was marked active.
+	ErrKeyringMultipleActiveKeys = errors.New("keyring.multiple_active_keys")
+	// ErrKeyringDuplicateKeyID indicates two entries share a kid.
+	ErrKeyringDuplicateKeyID = errors.New("keyring.duplicate_key_id")
+	// ErrKeyringUnknownStatus indicates an entry carried an unrecognised status.
+	ErrKeyringUnknownStatus = errors.New("keyring.unknown_status")
+	// ErrKeyringActiveKeyCannotSign indicates the active key lacks private material.
+	ErrKeyringActiveKeyCannotSign = errors.New("keyring.active_key_cannot_sign")
+)
+
+// KeyringEntry binds a signing key to its rotation status.
+type KeyringEntry struct {
+	Status KeyStatus
+	Key    SigningKey
+}
+
+// Keyring holds the active signing key plus the keys that still verify live sessions.
+type Keyring struct {
+	active        SigningKey
+	verifyOnly    []SigningKey
+	retiredKeyIDs []string
+}
+
+// NewKeyring validates that exactly one entry is active and that every kid is unique.
+func NewKeyring(entries []KeyringEntry) (*Keyring, error) {
+	keyring := &Keyring{}
+	seenKeyIDs := make(map[string]struct{}, len(entries))
+	activeCount := 0
+	for _, entry := range entries {
+		keyID := entry.Key.KeyID()
+		if keyID == "" {
+			return nil, fmt.Errorf("keyring.new: %w", ErrEmptyKeyID)
+		}
+		if _, duplicate := seenKeyIDs[keyID]; duplicate {
+			return nil, fmt.Errorf("keyring.new.%s: %w", keyID, ErrKeyringDuplicateKeyID)
+		}
+		seenKeyIDs[keyID] = struct{}{}
+		switch entry.Status {
+		case KeyStatusActive:
+			if !entry.Key.CanSign() {
+				return nil, fmt.Errorf("keyring.new.%s: %w", keyID, ErrKeyringActiveKeyCannotSign)
+			}
+			activeCount++
+			keyring.active = entry.Key
+		case KeyStatusVerifyOnly:
+			keyring.verifyOnly = append(keyring.verifyOnly, entry.Key)
+		case KeyStatusRetired:
+			keyring.retiredKeyIDs = append(keyring.retiredKeyIDs, keyID)
+		default:
+			return nil, fmt.Errorf("keyring.new.%s: %w", keyID, ErrKeyringUnknownStatus)
+		}
+	}
+	switch {
+	case activeCount == 0:
+		return nil, fmt.Errorf("keyring.new: %w", ErrKeyringNoActiveKey)
+	case activeCount > 1:
+		return nil, fmt.Errorf("keyring.new: %w", ErrKeyringMultipleActiveKeys)
+	}
+	return keyring, nil
+}
+
+// NewSingleKeyKeyring builds a keyring whose only entry is the active key.
+func NewSingleKeyKeyring(key SigningKey) (*Keyring, error) {
+	return NewKeyring([]KeyringEntry{{Status: KeyStatusActive, Key: key}})
+}
+
+// ActiveKey returns the key used to mint new sessions.
+func (keyring *Keyring) ActiveKey() SigningKey {
+	return keyring.active
+}
+
+// RetiredKeyIDs lists kids that are no longer trusted.
+func (keyring *Keyring) RetiredKeyIDs() []string {
+	return append([]string(nil), keyring.retiredKeyIDs...)
+}
+
+func (keyring *Keyring) verifyingKeys() []SigningKey {
+	return append([]SigningKey{keyring.active}, keyring.verifyOnly...)
+}
+
+// Algorithms lists the distinct JWS algorithms of the active and verify-only keys.
+func (keyring *Keyring) Algorithms() []string {
+	algorithms := make([]string, 0, 1+len(keyring.verifyOnly))
+	for _, key := range keyring.verifyingKeys() {
+		if !slices.Contains(algorithms, key.Algorithm()) {
+			algorithms = append(algorithms, key.Algorithm())
+		}
+	}
+	return algorithms
+}
+
+// ValidatorConfig returns the sessionvalidator configuration trusting the active and verify-only keys.
+func (keyring *Keyring) ValidatorConfig(issuer string, cookieName string) sessionvalidator.Config {
+	verifying := keyring.verifyingKeys()
+	keys := make([]sessionvalidator.VerificationKey, 0, len(verifying))
+	for _, key := range verifying {
+		keys = append(keys, key.verificationKey())
+	}
+	return sessionvalidator.Config{Keys: keys, Issuer: issuer, CookieName: cookieName}
+}
+
+// PublicKeySet returns the JWKS document for the active and verify-only
+// asymmetric keys. HMAC secrets are never published.
+func (keyring *Keyring) PublicKeySet() (sessionvalidator.JSONWebKeySet, error) {
+	keySet := sessionvalidator.JSONWebKeySet{Keys: []sessionvalidator.JSONWebKey{}}
+	for _, key := range keyring.verifyingKeys() {
+		if key.IsSymmetric() {
+			continue
+		}
+		webKey, webKeyErr := sessionvalidator.NewJSONWebKey(key.PublicKey(), key.KeyID())
+		if webKeyErr != nil {
+			return sessionvalidator.JSONWebKeySet{}, fmt.Errorf("keyring.jwks.%s: %w", key.KeyID(), webKeyErr)
+		}
+		keySet.Keys = append(keySet.Keys, webKey)
+	}
+	return keySet, nil
+}
@@ -0,0 +1,151 @@
+package authkit
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func mustKeyWithID(t *testing.T, key SigningKey, keyID string) SigningKey {
+	t.Helper()
+	identified, err := key.WithKeyID(keyID)
+	if err != nil {
+		t.Fatalf("assign key id: %v", err)
+	}
+	return identified
+}
+
+func mustEd25519SigningKey(t *testing.T) SigningKey {
+	t.Helper()
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %v", err)
+	}
+	signingKey, signingKeyErr := NewAsymmetricSigningKey(privateKey)
+	if signingKeyErr != nil {
+		t.Fatalf("signing key: %v", signingKeyErr)
+	}
+	return signingKey
+}
+
+func TestNewKeyringRejectsInvalidEntries(t *testing.T) {
+	t.Parallel()
+
+	active := mustKeyWithID(t, mustHMACSigningKey("active-secret"), "active")
+	other := mustKeyWithID(t, mustHMACSigningKey("other-secret"), "other")
+	publicOnly, publicErr := newPublicSigningKey(nil, mustEd25519SigningKey(t).PublicKey())
+	if publicErr != nil {
+		t.Fatalf("public signing key: %v", publicErr)
+	}
+
+	testCases := []struct {
+		name        string
+		entries     []KeyringEntry
+		expectedErr error
+	}{
+		{name: "NoActiveKey", entries: []KeyringEntry{{Status: KeyStatusVerifyOnly, Key: active}}, expectedErr: ErrKeyringNoActiveKey},
+		{name: "MultipleActiveKeys", entries: []KeyringEntry{{Status: KeyStatusActive, Key: active}, {Status: KeyStatusActive, Key: other}}, expectedErr: ErrKeyringMultipleActiveKeys},
+		{name: "DuplicateKeyID", entries: []KeyringEntry{{Status: KeyStatusActive, Key: active}, {Status: KeyStatusRetired, Key: mustKeyWithID(t, other, "active")}}, expectedErr: ErrKeyringDuplicateKeyID},
+		{name: "UnknownStatus", entries: []KeyringEntry{{Status: KeyStatusActive, Key: active}, {Status: "standby", Key: other}}, expectedErr: ErrKeyringUnknownStatus},
+		{name: "ActiveKeyWithoutPrivateMaterial", entries: []KeyringEntry{{Status: KeyStatusActive, Key: publicOnly}}, expectedErr: ErrKeyringActiveKeyCannotSign},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := NewKeyring(testCase.entries); !errors.Is(err, testCase.expectedErr) {
+				t.Fatalf("expected %v, got %v", testCase.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestMintAppJWTCarriesActiveKeyID(t *testing.T) {
+	t.Parallel()
+
+	keyring := mustKeyring(mustKeyWithID(t, mustHMACSigningKey("secret"), "2026-10"))
+	token, _, err := MintAppJWT(NewSystemClock(), "user", "user@example.com", "User", "", nil, "issuer", nil, keyring.ActiveKey(), time.Minute)
+	if err != nil {
+		t.Fatalf("mint token: %v", err)
+	}
+	parsed, _, parseErr := jwt.NewParser().ParseUnverified(token, &JwtCustomClaims{})
+	if parseErr != nil {
+		t.Fatalf("parse token: %v", parseErr)
+	}
+	if parsed.Header["kid"] != "2026-10" {
+		t.Fatalf("expected kid header 2026-10, got %v", parsed.Header["kid"])
+	}
+}
+
+func TestKeyringRotationKeepsLiveSessionsValid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	previousKey := mustKeyWithID(t, mustHMACSigningKey("previous-secret"), "previous")
+	retiredKey := mustKeyWithID(t, mustEd25519SigningKey(t), "retired")
+	currentKey := mustKeyWithID(t, mustEd25519SigningKey(t), "current")
+	verifyOnlyKey := mustKeyWithID(t, mustEd25519SigningKey(t), "verify-only")
+
+	rotated, err := NewKeyring([]KeyringEntry{
+		{Status: KeyStatusActive, Key: currentKey},
+		{Status: KeyStatusVerifyOnly, Key: previousKey},
+		{Status: KeyStatusVerifyOnly, Key: verifyOnlyKey},
+		{Status: KeyStatusRetired, Key: retiredKey},
+	})
+	if err != nil {
+		t.Fatalf("new keyring: %v", err)
+	}
+	config := newTestServerConfig()
+	config.AppJWTKeyring = rotated
+
+	router := gin.New()
+	router.Use(RequireSession(config))
+	router.GET("/secure", func(contextGin *gin.Context) {
+		contextGin.Status(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name           string
+		signingKey     SigningKey
+		expectedStatus int
+	}{
+		{name: "ActiveKey", signingKey: currentKey, expectedStatus: http.StatusOK},
+		{name: "VerifyOnlyHMACKey", signingKey: previousKey, expectedStatus: http.StatusOK},
+		{name: "VerifyOnlyAsymmetricKey", signingKey: verifyOnlyKey, expectedStatus: http.StatusOK},
+		{name: "RetiredKey", signingKey: retiredKey, expectedStatus: http.StatusUnauthorized},
+	}
+	for _, testCase := range testCases {
+		token, _, mintErr := MintAppJWT(NewSystemClock(), "user", "user@example.com", "User", "", nil, config.AppJWTIssuer, nil, testCase.signingKey, config.SessionTTL)
+		if mintErr != nil {
+			t.Fatalf("%s: mint token: %v", testCase.name, mintErr)
+		}
+		request := httptest.NewRequest(http.MethodGet, "/secure", nil)
+		request.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: token})
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		if response.Code != testCase.expectedStatus {
+			t.Fatalf("%s: expected %d, got %d", testCase.name, testCase.expectedStatus, response.Code)
+		}
+	}
+
+	keySet, keySetErr := rotated.PublicKeySet()
+	if keySetErr != nil {
+		t.Fatalf("public key set: %v", keySetErr)
+	}
+	publishedKeyIDs := make([]string, 0, len(keySet.Keys))
+	for _, webKey := range keySet.Keys {
+		publishedKeyIDs = append(publishedKeyIDs, webKey.KeyID)
+	}
+	if len(publishedKeyIDs) != 2 || publishedKeyIDs[0] != "current" || publishedKeyIDs[1] != "verify-only" {
+		t.Fatalf("expected active and verify-only asymmetric keys to be published, got %v", publishedKeyIDs)
+	}
+	if retired := rotated.RetiredKeyIDs(); len(retired) != 1 || retired[0] != "retired" {
+		t.Fatalf("unexpected retired key ids: %v", retired)
+	}
+}
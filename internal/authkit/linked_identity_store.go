@@ -0,0 +1,170 @@
+package authkit
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrLinkedIdentityNotFound indicates no account has linked the external identity.
+	ErrLinkedIdentityNotFound = errors.New("linked_identity_store.not_found")
+	// ErrLinkedIdentityExists indicates the external identity is already linked to an account.
+	ErrLinkedIdentityExists = errors.New("linked_identity_store.exists")
+	// ErrLinkedIdentityInvalid indicates a linked identity without a provider, subject, or owner.
+	ErrLinkedIdentityInvalid = errors.New("linked_identity_store.invalid_identity")
+)
+
+// LinkedIdentity is an external (Provider, Subject) pair that signs in to
+// the account UserID in addition to the identity that created it. Email is
+// the address the provider reported most recently.
+type LinkedIdentity struct {
+	Provider    string
+	Subject     string
+	UserID      string
+	Email       string
+	CreatedUnix int64
+}
+
+// LinkedIdentityStore persists linked identities, keyed by provider and subject.
+type LinkedIdentityStore interface {
+	// Create links identity, failing with ErrLinkedIdentityExists when the pair is taken.
+	Create(ctx context.Context, identity LinkedIdentity) error
+	// Get returns the link for the provider and subject.
+	Get(ctx context.Context, provider string, subject string) (LinkedIdentity, error)
+	// ListByUser returns the identities linked to applicationUserID.
+	ListByUser(ctx context.Context, applicationUserID string) ([]LinkedIdentity, error)
+	// UpdateEmail records the address the provider now reports for the identity.
+	UpdateEmail(ctx context.Context, provider string, subject string, email string) error
+	// Delete unlinks the identity from applicationUserID.
+	Delete(ctx context.Context, applicationUserID string, provider string, subject string) error
+}
+
+var configuredLinkedIdentities LinkedIdentityStore
+
+var defaultLinkedIdentities struct {
+	sync.Mutex
+	value LinkedIdentityStore
+}
+
+// ProvideLinkedIdentityStore injects the store holding linked identities.
+// Without one, an in-memory store is used.
+func ProvideLinkedIdentityStore(store LinkedIdentityStore) {
+	configuredLinkedIdentities = store
+	defaultLinkedIdentities.Lock()
+	defaultLinkedIdentities.value = nil
+	defaultLinkedIdentities.Unlock()
+}
+
+func resolveLinkedIdentities() LinkedIdentityStore {
+	if configuredLinkedIdentities != nil {
+		return configuredLinkedIdentities
+	}
+	defaultLinkedIdentities.Lock()
+	defer defaultLinkedIdentities.Unlock()
+	if defaultLinkedIdentities.value == nil {
+		defaultLinkedIdentities.value = NewMemoryLinkedIdentityStore()
+	}
+	return defaultLinkedIdentities.value
+}
+
+func validateLinkedIdentity(identity LinkedIdentity) error {
+	if strings.TrimSpace(identity.Provider) == "" || strings.TrimSpace(identity.Subject) == "" || strings.TrimSpace(identity.UserID) == "" {
+		return ErrLinkedIdentityInvalid
+	}
+	return nil
+}
+
+type linkedIdentityKey struct {
+	provider string
+	subject  string
+}
+
+// MemoryLinkedIdentityStore keeps linked identities in memory; intended for
+// tests and single-instance deployments.
+type MemoryLinkedIdentityStore struct {
+	mutex      sync.Mutex
+	identities map[linkedIdentityKey]LinkedIdentity
+}
+
+// NewMemoryLinkedIdentityStore creates an empty in-memory linked identity store.
+func NewMemoryLinkedIdentityStore() *MemoryLinkedIdentityStore {
+	return &MemoryLinkedIdentityStore{identities: make(map[linkedIdentityKey]LinkedIdentity)}
+}
+
+// Create links identity unless the provider and subject are already linked.
+func (store *MemoryLinkedIdentityStore) Create(ctx context.Context, identity LinkedIdentity) error {
+	if err := validateLinkedIdentity(identity); err != nil {
+		return fmt.Errorf("linked_identity_store.create.memory: %w", err)
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	key := linkedIdentityKey{provider: identity.Provider, subject: identity.Subject}
+	if _, exists := store.identities[key]; exists {
+		return fmt.Errorf("linked_identity_store.create.memory: %w", ErrLinkedIdentityExists)
+	}
+	store.identities[key] = identity
+	return nil
+}
+
+// Get returns the link for the provider and subject.
+func (store *MemoryLinkedIdentityStore) Get(ctx context.Context, provider string, subject string) (LinkedIdentity, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	identity, found := store.identities[linkedIdentityKey{provider: provider, subject: subject}]
+	if !found {
+		return LinkedIdentity{}, fmt.Errorf("linked_identity_store.get.memory: %w", ErrLinkedIdentityNotFound)
+	}
+	return identity, nil
+}
+
+// ListByUser returns the identities linked to applicationUserID, oldest first.
+func (store *MemoryLinkedIdentityStore) ListByUser(ctx context.Context, applicationUserID string) ([]LinkedIdentity, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	var identities []LinkedIdentity
+	for _, identity := range store.identities {
+		if identity.UserID == applicationUserID {
+			identities = append(identities, identity)
+		}
+	}
+	slices.SortFunc(identities, func(left LinkedIdentity, right LinkedIdentity) int {
+		return cmp.Or(
+			cmp.Compare(left.CreatedUnix, right.CreatedUnix),
+			strings.Compare(left.Provider, right.Provider),
+			strings.Compare(left.Subject, right.Subject),
+		)
+	})
+	return identities, nil
+}
+
+// UpdateEmail records the address the provider now reports for the identity.
+func (store *MemoryLinkedIdentityStore) UpdateEmail(ctx context.Context, provider string, subject string, email string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	key := linkedIdentityKey{provider: provider, subject: subject}
+	identity, found := store.identities[key]
+	if !found {
+		return fmt.Errorf("linked_identity_store.update_email.memory: %w", ErrLinkedIdentityNotFound)
+	}
+	identity.Email = email
+	store.identities[key] = identity
+	return nil
+}
+
+// Delete unlinks the identity from applicationUserID.
+func (store *MemoryLinkedIdentityStore) Delete(ctx context.Context, applicationUserID string, provider string, subject string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	key := linkedIdentityKey{provider: provider, subject: subject}
+	identity, found := store.identities[key]
+	if !found || identity.UserID != applicationUserID {
+		return fmt.Errorf("linked_identity_store.delete.memory: %w", ErrLinkedIdentityNotFound)
+	}
+	delete(store.identities, key)
+	return nil
+}
@@ -0,0 +1,106 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func forEachLinkedIdentityStore(t *testing.T, test func(t *testing.T, store LinkedIdentityStore)) {
+	t.Helper()
+	forEachStore(t,
+		func() LinkedIdentityStore { return NewMemoryLinkedIdentityStore() },
+		func(ctx context.Context, gormDB *gorm.DB) (LinkedIdentityStore, error) {
+			return NewDatabaseLinkedIdentityStore(ctx, gormDB)
+		},
+		test,
+	)
+}
+
+func createLinkedIdentitiesForTest(t *testing.T, store LinkedIdentityStore, identities ...LinkedIdentity) {
+	t.Helper()
+	for _, identity := range identities {
+		if err := store.Create(context.Background(), identity); err != nil {
+			t.Fatalf("create %s: %v", identity.Provider, err)
+		}
+	}
+}
+
+func TestLinkedIdentityStoreRejectsIdentitiesWithoutOwner(t *testing.T) {
+	forEachLinkedIdentityStore(t, func(t *testing.T, store LinkedIdentityStore) {
+		if err := store.Create(context.Background(), LinkedIdentity{Provider: "google", Subject: "sub-1"}); !errors.Is(err, ErrLinkedIdentityInvalid) {
+			t.Fatalf("expected ErrLinkedIdentityInvalid, got %v", err)
+		}
+	})
+}
+
+func TestLinkedIdentityStoreProviderSubjectPairsAreUnique(t *testing.T) {
+	forEachLinkedIdentityStore(t, func(t *testing.T, store LinkedIdentityStore) {
+		ctx := context.Background()
+		createLinkedIdentitiesForTest(t, store, LinkedIdentity{Provider: "google", Subject: "sub-1", UserID: "user-1", CreatedUnix: 100})
+
+		if err := store.Create(ctx, LinkedIdentity{Provider: "google", Subject: "sub-1", UserID: "user-2", CreatedUnix: 300}); !errors.Is(err, ErrLinkedIdentityExists) {
+			t.Fatalf("expected ErrLinkedIdentityExists, got %v", err)
+		}
+		if err := store.Create(ctx, LinkedIdentity{Provider: "github", Subject: "sub-1", UserID: "user-2", CreatedUnix: 300}); err != nil {
+			t.Fatalf("expected the same subject at another provider to be linkable, got %v", err)
+		}
+		fetched, getErr := store.Get(ctx, "google", "sub-1")
+		if getErr != nil || fetched.UserID != "user-1" {
+			t.Fatalf("expected the first owner to keep the identity, got %+v (%v)", fetched, getErr)
+		}
+	})
+}
+
+func TestLinkedIdentityStoreListsUserIdentitiesOldestFirst(t *testing.T) {
+	forEachLinkedIdentityStore(t, func(t *testing.T, store LinkedIdentityStore) {
+		first := LinkedIdentity{Provider: "google", Subject: "sub-1", UserID: "user-1", Email: "first@example.com", CreatedUnix: 100}
+		second := LinkedIdentity{Provider: "email", Subject: "second@example.com", UserID: "user-1", Email: "second@example.com", CreatedUnix: 200}
+		createLinkedIdentitiesForTest(t, store, second, first, LinkedIdentity{Provider: "google", Subject: "sub-2", UserID: "user-2", CreatedUnix: 50})
+
+		listed, listErr := store.ListByUser(context.Background(), "user-1")
+		if listErr != nil || len(listed) != 2 || listed[0] != first || listed[1] != second {
+			t.Fatalf("expected both identities oldest first, got %+v (%v)", listed, listErr)
+		}
+	})
+}
+
+func TestLinkedIdentityStoreUpdateEmail(t *testing.T) {
+	forEachLinkedIdentityStore(t, func(t *testing.T, store LinkedIdentityStore) {
+		ctx := context.Background()
+		createLinkedIdentitiesForTest(t, store, LinkedIdentity{Provider: "google", Subject: "sub-1", UserID: "user-1", Email: "first@example.com", CreatedUnix: 100})
+
+		if err := store.UpdateEmail(ctx, "google", "sub-1", "renamed@example.com"); err != nil {
+			t.Fatalf("update email: %v", err)
+		}
+		fetched, getErr := store.Get(ctx, "google", "sub-1")
+		if getErr != nil || fetched.UserID != "user-1" || fetched.Email != "renamed@example.com" || fetched.CreatedUnix != 100 {
+			t.Fatalf("expected the updated email, got %+v (%v)", fetched, getErr)
+		}
+		if err := store.UpdateEmail(ctx, "google", "missing", "x@example.com"); !errors.Is(err, ErrLinkedIdentityNotFound) {
+			t.Fatalf("expected ErrLinkedIdentityNotFound from update, got %v", err)
+		}
+	})
+}
+
+func TestLinkedIdentityStoreDeleteOnlyUnlinksOwnIdentities(t *testing.T) {
+	forEachLinkedIdentityStore(t, func(t *testing.T, store LinkedIdentityStore) {
+		ctx := context.Background()
+		createLinkedIdentitiesForTest(t, store, LinkedIdentity{Provider: "google", Subject: "sub-1", UserID: "user-1", CreatedUnix: 100})
+
+		if err := store.Delete(ctx, "user-2", "google", "sub-1"); !errors.Is(err, ErrLinkedIdentityNotFound) {
+			t.Fatalf("expected another user's identity not to be unlinked, got %v", err)
+		}
+		if err := store.Delete(ctx, "user-1", "google", "sub-1"); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if _, err := store.Get(ctx, "google", "sub-1"); !errors.Is(err, ErrLinkedIdentityNotFound) {
+			t.Fatalf("expected ErrLinkedIdentityNotFound after delete, got %v", err)
+		}
+		if err := store.Delete(ctx, "user-1", "google", "sub-1"); !errors.Is(err, ErrLinkedIdentityNotFound) {
+			t.Fatalf("expected a second delete to fail, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package authkit
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrHostedDomainNotAllowed indicates a Google account outside the allowed Workspace domains.
+	ErrHostedDomainNotAllowed = errors.New("login_policy.hosted_domain_not_allowed")
+	// ErrEmailNotAllowed indicates an email address or domain the policy does not admit.
+	ErrEmailNotAllowed = errors.New("login_policy.email_not_allowed")
+)
+
+// LoginPolicy restricts which verified identities may sign in; the zero value
+// admits everyone. An address in AllowedEmails is always admitted. Otherwise
+// addresses in DeniedEmailDomains are rejected, Google identities must carry
+// an hd (Workspace hosted domain) claim listed in AllowedHostedDomains, and
+// addresses must belong to AllowedEmailDomains. Each list applies only when
+// non-empty; domains match exactly, without subdomains, and all entries are
+// compared case-insensitively.
+type LoginPolicy struct {
+	AllowedHostedDomains []string
+	AllowedEmailDomains  []string
+	DeniedEmailDomains   []string
+	AllowedEmails        []string
+}
+
+// Check returns ErrHostedDomainNotAllowed or ErrEmailNotAllowed when identity may not sign in.
+func (policy LoginPolicy) Check(identity ExternalIdentity) error {
+	email := strings.ToLower(strings.TrimSpace(identity.Email))
+	if containsFold(policy.AllowedEmails, email) {
+		return nil
+	}
+	domain := ""
+	if separator := strings.LastIndex(email, "@"); separator >= 0 {
+		domain = email[separator+1:]
+	}
+	if containsFold(policy.DeniedEmailDomains, domain) {
+		return ErrEmailNotAllowed
+	}
+	if len(policy.AllowedHostedDomains) > 0 && identity.Provider == googleIdentityProviderName {
+		hostedDomain, _ := identity.Claims["hd"].(string)
+		if !containsFold(policy.AllowedHostedDomains, hostedDomain) {
+			return ErrHostedDomainNotAllowed
+		}
+	}
+	if len(policy.AllowedEmailDomains) > 0 && !containsFold(policy.AllowedEmailDomains, domain) {
+		return ErrEmailNotAllowed
+	}
+	return nil
+}
+
+func containsFold(values []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	return slices.ContainsFunc(values, func(candidate string) bool {
+		return strings.EqualFold(strings.TrimSpace(candidate), value)
+	})
+}
@@ -0,0 +1,114 @@
+package authkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/idtoken"
+)
+
+func TestLoginPolicyCheck(t *testing.T) {
+	policy := LoginPolicy{
+		AllowedHostedDomains: []string{"ourcompany.com"},
+		AllowedEmailDomains:  []string{"ourcompany.com", "partner.example"},
+		DeniedEmailDomains:   []string{"gmail.com"},
+		AllowedEmails:        []string{"contractor@gmail.com"},
+	}
+	googleIdentity := func(email string, hostedDomain string) ExternalIdentity {
+		claims := map[string]interface{}{}
+		if hostedDomain != "" {
+			claims["hd"] = hostedDomain
+		}
+		return ExternalIdentity{Provider: googleIdentityProviderName, Email: email, Claims: claims}
+	}
+
+	testCases := []struct {
+		name     string
+		policy   LoginPolicy
+		identity ExternalIdentity
+		expected error
+	}{
+		{name: "empty policy", identity: googleIdentity("someone@gmail.com", "")},
+		{name: "workspace account", policy: policy, identity: googleIdentity("Employee@OurCompany.com", "OurCompany.com")},
+		{name: "consumer account with the company address", policy: policy, identity: googleIdentity("employee@ourcompany.com", ""), expected: ErrHostedDomainNotAllowed},
+		{name: "other workspace", policy: policy, identity: googleIdentity("employee@partner.example", "partner.example"), expected: ErrHostedDomainNotAllowed},
+		{name: "workspace outside the email domains", policy: policy, identity: googleIdentity("employee@subsidiary.ourcompany.com", "ourcompany.com"), expected: ErrEmailNotAllowed},
+		{name: "denied domain", policy: policy, identity: googleIdentity("someone@gmail.com", ""), expected: ErrEmailNotAllowed},
+		{name: "exact email allowed", policy: policy, identity: googleIdentity("Contractor@gmail.com", "")},
+		{name: "other provider ignores hosted domains", policy: policy, identity: ExternalIdentity{Provider: "okta", Email: "employee@partner.example"}},
+		{name: "other provider outside the email domains", policy: policy, identity: ExternalIdentity{Provider: "okta", Email: "employee@example.org"}, expected: ErrEmailNotAllowed},
+		{name: "denylist only", policy: LoginPolicy{DeniedEmailDomains: []string{"gmail.com"}}, identity: ExternalIdentity{Provider: emailIdentityProviderName, Email: "someone@example.org"}},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			if err := testCase.policy.Check(testCase.identity); !errors.Is(err, testCase.expected) {
+				t.Fatalf("expected %v, got %v", testCase.expected, err)
+			}
+		})
+	}
+}
+
+func TestLoginPolicyRejectsGoogleSignIn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, _, users := newAuthRouterForTest(t, func(config *ServerConfig) {
+		config.LoginPolicy = LoginPolicy{AllowedHostedDomains: []string{"ourcompany.com"}}
+	})
+
+	signIn := func(hostedDomain string) *httptest.ResponseRecorder {
+		claims := map[string]interface{}{
+			"iss":            "https://accounts.google.com",
+			"sub":            "sub-" + hostedDomain,
+			"email":          "employee@ourcompany.com",
+			"email_verified": true,
+		}
+		if hostedDomain != "" {
+			claims["hd"] = hostedDomain
+		}
+		payload := &idtoken.Payload{Claims: claims}
+		ProvideGoogleTokenValidator(&fakeGoogleValidator{results: map[string]validatorResult{
+			"valid-token": {payload: payload, expectedAudience: "client-id"},
+		}})
+		return serveWithCookies(router, http.MethodPost, "/auth/google", prepareLoginBody(t, router, payload, "valid-token"), nil)
+	}
+
+	rejected := signIn("")
+	var body map[string]string
+	_ = json.Unmarshal(rejected.Body.Bytes(), &body)
+	if rejected.Code != http.StatusForbidden || body["error"] != "hosted_domain_not_allowed" {
+		t.Fatalf("expected 403 hosted_domain_not_allowed, got %d %s", rejected.Code, rejected.Body.String())
+	}
+	if len(rejected.Result().Cookies()) != 0 {
+		t.Fatalf("expected no cookies for a rejected sign-in")
+	}
+	if _, _, _, _, err := users.GetUserProfile(t.Context(), "google:sub-"); err == nil {
+		t.Fatalf("expected the rejected account not to be created")
+	}
+
+	if admitted := signIn("ourcompany.com"); admitted.Code != http.StatusOK {
+		t.Fatalf("expected the workspace account to sign in, got %d %s", admitted.Code, admitted.Body.String())
+	}
+}
+
+func TestLoginPolicyRejectsEmailSignInBeforeSending(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mailer := &recordingMailer{}
+	router, _, _ := newAuthRouterForTest(t, func(config *ServerConfig) {
+		withEmailLoginForTest(mailer)(config)
+		config.LoginPolicy = LoginPolicy{DeniedEmailDomains: []string{"gmail.com"}}
+	})
+
+	if denied := postForTest(router, "/auth/email/start", map[string]string{"email": "someone@Gmail.com"}, nil); denied.status != http.StatusForbidden || denied.body["error"] != "email_not_allowed" {
+		t.Fatalf("expected 403 email_not_allowed, got %d %v", denied.status, denied.body)
+	}
+	if len(mailer.messages) != 0 {
+		t.Fatalf("expected no email for a denied address")
+	}
+	if allowed := postForTest(router, "/auth/email/start", map[string]string{"email": "someone@example.org"}, nil); allowed.status != http.StatusAccepted {
+		t.Fatalf("expected other addresses to be mailed, got %d", allowed.status)
+	}
+}
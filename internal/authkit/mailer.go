@@ -0,0 +1,117 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidMailer indicates an SMTPConfig without a server address or sender.
+var ErrInvalidMailer = errors.New("mailer.invalid_config")
+
+// EmailMessage is a plain-text email.
+type EmailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers the emails TAuth sends, such as sign-in links and codes.
+type Mailer interface {
+	Send(ctx context.Context, message EmailMessage) error
+}
+
+// SMTPConfig configures SMTPMailer. Address is host:port; Username and
+// Password, when set, authenticate with PLAIN over the STARTTLS connection.
+type SMTPConfig struct {
+	Address  string
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer sends email through an SMTP relay.
+type SMTPMailer struct {
+	configuration SMTPConfig
+	auth          smtp.Auth
+}
+
+// NewSMTPMailer validates the configuration and constructs an SMTPMailer.
+func NewSMTPMailer(configuration SMTPConfig) (*SMTPMailer, error) {
+	host, _, splitErr := net.SplitHostPort(configuration.Address)
+	if splitErr != nil || host == "" {
+		return nil, fmt.Errorf("mailer.new: %w: address must be host:port", ErrInvalidMailer)
+	}
+	if strings.TrimSpace(configuration.From) == "" || strings.ContainsAny(configuration.From, "\r\n") {
+		return nil, fmt.Errorf("mailer.new: %w: sender address is required", ErrInvalidMailer)
+	}
+	var auth smtp.Auth
+	if configuration.Username != "" {
+		auth = smtp.PlainAuth("", configuration.Username, configuration.Password, host)
+	}
+	return &SMTPMailer{configuration: configuration, auth: auth}, nil
+}
+
+// Send delivers message to the relay.
+func (mailer *SMTPMailer) Send(ctx context.Context, message EmailMessage) error {
+	encoded, encodeErr := encodeEmailMessage(mailer.configuration.From, message)
+	if encodeErr != nil {
+		return fmt.Errorf("mailer.smtp.send: %w", encodeErr)
+	}
+	if sendErr := smtp.SendMail(mailer.configuration.Address, mailer.auth, mailer.configuration.From, []string{message.To}, encoded); sendErr != nil {
+		return fmt.Errorf("mailer.smtp.send: %w", sendErr)
+	}
+	return nil
+}
+
+// WriterMailer writes each message to an io.Writer instead of sending it. It
+// is meant for local development, where the outbox is a log or a file.
+type WriterMailer struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	from   string
+}
+
+// NewWriterMailer constructs a WriterMailer appending messages to writer.
+func NewWriterMailer(writer io.Writer, from string) *WriterMailer {
+	return &WriterMailer{writer: writer, from: from}
+}
+
+// Send writes message followed by a separator line.
+func (mailer *WriterMailer) Send(ctx context.Context, message EmailMessage) error {
+	encoded, encodeErr := encodeEmailMessage(mailer.from, message)
+	if encodeErr != nil {
+		return fmt.Errorf("mailer.writer.send: %w", encodeErr)
+	}
+	mailer.mutex.Lock()
+	defer mailer.mutex.Unlock()
+	if _, writeErr := fmt.Fprintf(mailer.writer, "%s\r\n-----\r\n", encoded); writeErr != nil {
+		return fmt.Errorf("mailer.writer.send: %w", writeErr)
+	}
+	return nil
+}
+
+// encodeEmailMessage renders an RFC 5322 plain-text message, refusing header
+// values that would inject additional headers.
+func encodeEmailMessage(from string, message EmailMessage) ([]byte, error) {
+	for _, headerValue := range []string{from, message.To, message.Subject} {
+		if strings.ContainsAny(headerValue, "\r\n") {
+			return nil, errors.New("header values must not contain line breaks")
+		}
+	}
+	var builder strings.Builder
+	builder.WriteString("From: " + from + "\r\n")
+	builder.WriteString("To: " + message.To + "\r\n")
+	builder.WriteString("Subject: " + message.Subject + "\r\n")
+	builder.WriteString("Date: " + time.Now().UTC().Format(time.RFC1123Z) + "\r\n")
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	builder.WriteString(strings.ReplaceAll(strings.ReplaceAll(message.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(builder.String()), nil
+}
@@ -0,0 +1,41 @@
+package authkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWriterMailerWritesMessages(t *testing.T) {
+	var outbox bytes.Buffer
+	mailer := NewWriterMailer(&outbox, "TAuth <no-reply@example.com>")
+	if err := mailer.Send(context.Background(), EmailMessage{To: "user@example.com", Subject: "Your sign-in code", Body: "line one\nline two\n"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	written := outbox.String()
+	for _, expected := range []string{"From: TAuth <no-reply@example.com>\r\n", "To: user@example.com\r\n", "Subject: Your sign-in code\r\n", "\r\n\r\nline one\r\nline two\r\n"} {
+		if !strings.Contains(written, expected) {
+			t.Fatalf("expected %q in %q", expected, written)
+		}
+	}
+
+	if err := mailer.Send(context.Background(), EmailMessage{To: "user@example.com\r\nBcc: attacker@example.com", Subject: "hi"}); err == nil {
+		t.Fatalf("expected header injection to be rejected")
+	}
+}
+
+func TestNewSMTPMailerValidatesConfiguration(t *testing.T) {
+	if _, err := NewSMTPMailer(SMTPConfig{Address: "smtp.example.com:587", Username: "tauth", Password: "secret", From: "no-reply@example.com"}); err != nil {
+		t.Fatalf("expected valid configuration, got %v", err)
+	}
+	for _, invalid := range []SMTPConfig{
+		{Address: "smtp.example.com", From: "no-reply@example.com"},
+		{Address: "smtp.example.com:587"},
+	} {
+		if _, err := NewSMTPMailer(invalid); !errors.Is(err, ErrInvalidMailer) {
+			t.Fatalf("expected ErrInvalidMailer for %+v, got %v", invalid, err)
+		}
+	}
+}
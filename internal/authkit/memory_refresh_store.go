@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 )
@@ -23,6 +24,10 @@ type memoryRecord struct {
 	ExpiresUnix     int64
 	RevokedAtUnix   int64
 	PreviousTokenID string
+	SessionID       string
+	AuthMethods     []string
+	ClientID        string
+	AuthTimeUnix    int64
 	IssuedAtUnix    int64
 }
 
@@ -35,7 +40,7 @@ func NewMemoryRefreshTokenStore() *MemoryRefreshTokenStore {
 }
 
 // Issue creates a new token, optionally linked to a previous token.
-func (store *MemoryRefreshTokenStore) Issue(ctx context.Context, applicationUserID string, expiresUnix int64, previousTokenID string) (string, string, error) {
+func (store *MemoryRefreshTokenStore) Issue(ctx context.Context, applicationUserID string, expiresUnix int64, previousTokenID string, authMethods []string, clientID string, authTimeUnix int64) (string, string, error) {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
@@ -44,6 +49,21 @@ func (store *MemoryRefreshTokenStore) Issue(ctx context.Context, applicationUser
 	if err != nil {
 		return "", "", fmt.Errorf("refresh_store.issue.memory: %w", err)
 	}
+	var inheritedSessionID string
+	if previousTokenID != "" {
+		previous := store.byID[previousTokenID]
+		if previous == nil {
+			return "", "", fmt.Errorf("refresh_store.issue.memory: %w", ErrRefreshTokenNotFound)
+		}
+		inheritedSessionID = previous.SessionID
+		authMethods = previous.AuthMethods
+		clientID = previous.ClientID
+		authTimeUnix = previous.AuthTimeUnix
+	}
+	sessionID, sessionErr := resolveSessionID(inheritedSessionID)
+	if sessionErr != nil {
+		return "", "", fmt.Errorf("refresh_store.issue.memory: %w", sessionErr)
+	}
 	nowUnix := time.Now().UTC().Unix()
 
 	record := &memoryRecord{
@@ -53,6 +73,10 @@ func (store *MemoryRefreshTokenStore) Issue(ctx context.Context, applicationUser
 		ExpiresUnix:     expiresUnix,
 		RevokedAtUnix:   0,
 		PreviousTokenID: previousTokenID,
+		SessionID:       sessionID,
+		AuthMethods:     slices.Clone(authMethods),
+		ClientID:        clientID,
+		AuthTimeUnix:    authTimeUnix,
 		IssuedAtUnix:    nowUnix,
 	}
 	store.byID[tokenID] = record
@@ -99,6 +123,54 @@ func (store *MemoryRefreshTokenStore) Revoke(ctx context.Context, tokenID string
 	return nil
 }
 
+// SessionID returns the session the refresh token belongs to.
+func (store *MemoryRefreshTokenStore) SessionID(ctx context.Context, tokenID string) (string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	rec := store.byID[tokenID]
+	if rec == nil {
+		return "", fmt.Errorf("refresh_store.session_id.memory: %w", ErrRefreshTokenNotFound)
+	}
+	return rec.SessionID, nil
+}
+
+// AuthMethods returns how the refresh token's session was authenticated.
+func (store *MemoryRefreshTokenStore) AuthMethods(ctx context.Context, tokenID string) ([]string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	rec := store.byID[tokenID]
+	if rec == nil {
+		return nil, fmt.Errorf("refresh_store.auth_methods.memory: %w", ErrRefreshTokenNotFound)
+	}
+	return slices.Clone(rec.AuthMethods), nil
+}
+
+// ClientID returns the OAuth client the refresh token was issued to.
+func (store *MemoryRefreshTokenStore) ClientID(ctx context.Context, tokenID string) (string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	rec := store.byID[tokenID]
+	if rec == nil {
+		return "", fmt.Errorf("refresh_store.client_id.memory: %w", ErrRefreshTokenNotFound)
+	}
+	return rec.ClientID, nil
+}
+
+// AuthTime returns when the refresh token's session was authenticated.
+func (store *MemoryRefreshTokenStore) AuthTime(ctx context.Context, tokenID string) (int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	rec := store.byID[tokenID]
+	if rec == nil {
+		return 0, fmt.Errorf("refresh_store.auth_time.memory: %w", ErrRefreshTokenNotFound)
+	}
+	return rec.AuthTimeUnix, nil
+}
+
 func (store *MemoryRefreshTokenStore) nextID() string {
 	store.sequenceID++
 	timestampID := newRefreshTokenID(time.Now().UTC())
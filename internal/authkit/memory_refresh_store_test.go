@@ -15,7 +15,7 @@ func TestMemoryRefreshTokenStoreErrors(t *testing.T) {
 		t.Fatalf("expected error when revoking unknown token")
 	}
 
-	tokenID, opaque, err := store.Issue(context.Background(), "user", time.Now().Add(time.Minute).Unix(), "")
+	tokenID, opaque, err := store.Issue(context.Background(), "user", time.Now().Add(time.Minute).Unix(), "", nil, "", 0)
 	if err != nil {
 		t.Fatalf("issue error: %v", err)
 	}
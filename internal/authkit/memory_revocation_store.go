@@ -0,0 +1,88 @@
+package authkit
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemorySessionRevocationStore keeps revocations in memory; intended for tests
+// and single-instance deployments.
+type MemorySessionRevocationStore struct {
+	mutex    sync.Mutex
+	sessions map[string]int64
+	tokens   map[string]int64
+}
+
+// NewMemorySessionRevocationStore creates an empty in-memory revocation store.
+func NewMemorySessionRevocationStore() *MemorySessionRevocationStore {
+	return &MemorySessionRevocationStore{
+		sessions: make(map[string]int64),
+		tokens:   make(map[string]int64),
+	}
+}
+
+// RevokeSession revokes every token carrying sessionID until expiresUnix.
+func (store *MemorySessionRevocationStore) RevokeSession(ctx context.Context, sessionID string, expiresUnix int64) error {
+	if strings.TrimSpace(sessionID) == "" {
+		return fmt.Errorf("revocation_store.revoke_session.memory: %w", ErrRevocationEmptyIdentifier)
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.pruneExpired(time.Now().UTC().Unix())
+	store.sessions[sessionID] = max(store.sessions[sessionID], expiresUnix)
+	return nil
+}
+
+// RevokeToken revokes the token identified by its jti until expiresUnix.
+func (store *MemorySessionRevocationStore) RevokeToken(ctx context.Context, tokenID string, expiresUnix int64) error {
+	if strings.TrimSpace(tokenID) == "" {
+		return fmt.Errorf("revocation_store.revoke_token.memory: %w", ErrRevocationEmptyIdentifier)
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.pruneExpired(time.Now().UTC().Unix())
+	store.tokens[tokenID] = max(store.tokens[tokenID], expiresUnix)
+	return nil
+}
+
+// IsRevoked reports whether the session or the token has an unexpired revocation.
+func (store *MemorySessionRevocationStore) IsRevoked(ctx context.Context, sessionID string, tokenID string) (bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	nowUnix := time.Now().UTC().Unix()
+	if sessionID != "" && store.sessions[sessionID] >= nowUnix {
+		return true, nil
+	}
+	return tokenID != "" && store.tokens[tokenID] >= nowUnix, nil
+}
+
+// ListRevoked returns the sessions and tokens with unexpired revocations.
+func (store *MemorySessionRevocationStore) ListRevoked(ctx context.Context) ([]string, []string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.pruneExpired(time.Now().UTC().Unix())
+	return sortedKeys(store.sessions), sortedKeys(store.tokens), nil
+}
+
+func (store *MemorySessionRevocationStore) pruneExpired(nowUnix int64) {
+	for _, entries := range []map[string]int64{store.sessions, store.tokens} {
+		for identifier, expiresUnix := range entries {
+			if expiresUnix < nowUnix {
+				delete(entries, identifier)
+			}
+		}
+	}
+}
+
+func sortedKeys(entries map[string]int64) []string {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
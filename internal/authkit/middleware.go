@@ -8,16 +8,21 @@ import (
 	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
 )
 
-// RequireSession validates the session cookie and injects claims.
+// RequireSession validates the session cookie, rejects revoked sessions, and
+// injects claims into the Gin context and the request context.
 func RequireSession(configuration ServerConfig) gin.HandlerFunc {
-	validator, err := sessionvalidator.New(sessionvalidator.Config{
-		SigningKey: configuration.AppJWTSigningKey,
-		Issuer:     configuration.AppJWTIssuer,
-		CookieName: configuration.SessionCookieName,
-	})
+	return requireSessionWith(newSessionValidator(configuration))
+}
+
+func newSessionValidator(configuration ServerConfig) *sessionvalidator.Validator {
+	validator, err := sessionvalidator.New(configuration.sessionValidatorConfig())
 	if err != nil {
 		panic(fmt.Sprintf("authkit.RequireSession: %v", err))
 	}
+	return validator
+}
+
+func requireSessionWith(validator *sessionvalidator.Validator) gin.HandlerFunc {
 	return func(contextGin *gin.Context) {
 		claims, validateErr := validator.ValidateRequest(contextGin.Request)
 		if validateErr != nil {
@@ -25,6 +30,7 @@ func RequireSession(configuration ServerConfig) gin.HandlerFunc {
 			return
 		}
 		contextGin.Set("auth_claims", claims)
+		contextGin.Request = contextGin.Request.WithContext(sessionvalidator.ContextWithClaims(contextGin.Request.Context(), claims))
 		contextGin.Next()
 	}
 }
@@ -0,0 +1,146 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrPendingSecondFactorNotFound indicates no sign-in waits for a second
+	// factor under the token, because it was never issued, expired, was
+	// completed, or was withdrawn after too many wrong codes.
+	ErrPendingSecondFactorNotFound = errors.New("pending_second_factor_store.not_found")
+	// ErrPendingSecondFactorInvalid indicates a pending sign-in without a token hash or user.
+	ErrPendingSecondFactorInvalid = errors.New("pending_second_factor_store.invalid")
+)
+
+// PendingSecondFactor is a sign-in that passed its primary authentication and
+// waits for the second factor. The token from the app_mfa_pending cookie is
+// stored as a hashOpaque digest.
+type PendingSecondFactor struct {
+	TokenHash   string
+	UserID      string
+	ExpiresUnix int64
+	Attempts    int
+}
+
+// PendingSecondFactorStore keeps sign-ins waiting for their second factor,
+// keyed by token hash.
+type PendingSecondFactorStore interface {
+	// Create stores pending and deletes expired sign-ins.
+	Create(ctx context.Context, pending PendingSecondFactor) error
+	// Get returns the unexpired sign-in whose token hashes to tokenHash.
+	Get(ctx context.Context, tokenHash string) (PendingSecondFactor, error)
+	// RecordFailure counts a wrong code and withdraws the sign-in after maxAttempts.
+	RecordFailure(ctx context.Context, tokenHash string, maxAttempts int) error
+	// Delete removes the sign-in. It succeeds for exactly one caller, which
+	// then owns the sign-in.
+	Delete(ctx context.Context, tokenHash string) error
+}
+
+var configuredPendingSecondFactors PendingSecondFactorStore
+
+var defaultPendingSecondFactors struct {
+	sync.Mutex
+	value PendingSecondFactorStore
+}
+
+// ProvidePendingSecondFactorStore injects the store holding sign-ins that
+// wait for their second factor. Without one, an in-memory store is used.
+func ProvidePendingSecondFactorStore(store PendingSecondFactorStore) {
+	configuredPendingSecondFactors = store
+	defaultPendingSecondFactors.Lock()
+	defaultPendingSecondFactors.value = nil
+	defaultPendingSecondFactors.Unlock()
+}
+
+func resolvePendingSecondFactors() PendingSecondFactorStore {
+	if configuredPendingSecondFactors != nil {
+		return configuredPendingSecondFactors
+	}
+	defaultPendingSecondFactors.Lock()
+	defer defaultPendingSecondFactors.Unlock()
+	if defaultPendingSecondFactors.value == nil {
+		defaultPendingSecondFactors.value = NewMemoryPendingSecondFactorStore()
+	}
+	return defaultPendingSecondFactors.value
+}
+
+func validatePendingSecondFactor(pending PendingSecondFactor) error {
+	if pending.TokenHash == "" || strings.TrimSpace(pending.UserID) == "" {
+		return ErrPendingSecondFactorInvalid
+	}
+	return nil
+}
+
+// MemoryPendingSecondFactorStore keeps pending sign-ins in memory; intended
+// for tests and single-instance deployments.
+type MemoryPendingSecondFactorStore struct {
+	mutex   sync.Mutex
+	pending map[string]PendingSecondFactor
+}
+
+// NewMemoryPendingSecondFactorStore creates an empty in-memory pending sign-in store.
+func NewMemoryPendingSecondFactorStore() *MemoryPendingSecondFactorStore {
+	return &MemoryPendingSecondFactorStore{pending: make(map[string]PendingSecondFactor)}
+}
+
+// Create stores pending and deletes expired sign-ins.
+func (store *MemoryPendingSecondFactorStore) Create(ctx context.Context, pending PendingSecondFactor) error {
+	if err := validatePendingSecondFactor(pending); err != nil {
+		return fmt.Errorf("pending_second_factor_store.create.memory: %w", err)
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	nowUnix := time.Now().UTC().Unix()
+	for tokenHash, existing := range store.pending {
+		if existing.ExpiresUnix < nowUnix {
+			delete(store.pending, tokenHash)
+		}
+	}
+	store.pending[pending.TokenHash] = pending
+	return nil
+}
+
+// Get returns the unexpired sign-in whose token hashes to tokenHash.
+func (store *MemoryPendingSecondFactorStore) Get(ctx context.Context, tokenHash string) (PendingSecondFactor, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	pending, found := store.pending[tokenHash]
+	if !found || pending.ExpiresUnix < time.Now().UTC().Unix() {
+		return PendingSecondFactor{}, fmt.Errorf("pending_second_factor_store.get.memory: %w", ErrPendingSecondFactorNotFound)
+	}
+	return pending, nil
+}
+
+// RecordFailure counts a wrong code and withdraws the sign-in after maxAttempts.
+func (store *MemoryPendingSecondFactorStore) RecordFailure(ctx context.Context, tokenHash string, maxAttempts int) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	pending, found := store.pending[tokenHash]
+	if !found {
+		return fmt.Errorf("pending_second_factor_store.record_failure.memory: %w", ErrPendingSecondFactorNotFound)
+	}
+	pending.Attempts++
+	if pending.Attempts >= maxAttempts {
+		delete(store.pending, tokenHash)
+		return nil
+	}
+	store.pending[tokenHash] = pending
+	return nil
+}
+
+// Delete removes the sign-in whose token hashes to tokenHash.
+func (store *MemoryPendingSecondFactorStore) Delete(ctx context.Context, tokenHash string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, found := store.pending[tokenHash]; !found {
+		return fmt.Errorf("pending_second_factor_store.delete.memory: %w", ErrPendingSecondFactorNotFound)
+	}
+	delete(store.pending, tokenHash)
+	return nil
+}
@@ -0,0 +1,88 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func forEachPendingSecondFactorStore(t *testing.T, test func(t *testing.T, store PendingSecondFactorStore)) {
+	t.Helper()
+	forEachStore(t,
+		func() PendingSecondFactorStore { return NewMemoryPendingSecondFactorStore() },
+		func(ctx context.Context, gormDB *gorm.DB) (PendingSecondFactorStore, error) {
+			return NewDatabasePendingSecondFactorStore(ctx, gormDB)
+		},
+		test,
+	)
+}
+
+func createPendingSecondFactorForTest(t *testing.T, store PendingSecondFactorStore, token string, userID string, expiresAt time.Time) {
+	t.Helper()
+	if err := store.Create(context.Background(), PendingSecondFactor{TokenHash: hashOpaque(token), UserID: userID, ExpiresUnix: expiresAt.Unix()}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+}
+
+func TestPendingSecondFactorStoreRejectsIncompleteSignIns(t *testing.T) {
+	forEachPendingSecondFactorStore(t, func(t *testing.T, store PendingSecondFactorStore) {
+		if err := store.Create(context.Background(), PendingSecondFactor{TokenHash: hashOpaque("token-0")}); !errors.Is(err, ErrPendingSecondFactorInvalid) {
+			t.Fatalf("expected ErrPendingSecondFactorInvalid, got %v", err)
+		}
+	})
+}
+
+func TestPendingSecondFactorStoreDeleteSucceedsOnce(t *testing.T) {
+	forEachPendingSecondFactorStore(t, func(t *testing.T, store PendingSecondFactorStore) {
+		ctx := context.Background()
+		expiresAt := time.Now().Add(5 * time.Minute)
+		createPendingSecondFactorForTest(t, store, "token-1", "user-1", expiresAt)
+
+		pending, getErr := store.Get(ctx, hashOpaque("token-1"))
+		if getErr != nil || pending.UserID != "user-1" || pending.ExpiresUnix != expiresAt.Unix() {
+			t.Fatalf("expected the pending sign-in, got %+v (%v)", pending, getErr)
+		}
+		if err := store.Delete(ctx, hashOpaque("token-1")); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if err := store.Delete(ctx, hashOpaque("token-1")); !errors.Is(err, ErrPendingSecondFactorNotFound) {
+			t.Fatalf("expected a second delete to fail, got %v", err)
+		}
+		if _, err := store.Get(ctx, hashOpaque("token-1")); !errors.Is(err, ErrPendingSecondFactorNotFound) {
+			t.Fatalf("expected a deleted sign-in to be gone, got %v", err)
+		}
+	})
+}
+
+func TestPendingSecondFactorStoreWithdrawsAfterMaxAttempts(t *testing.T) {
+	forEachPendingSecondFactorStore(t, func(t *testing.T, store PendingSecondFactorStore) {
+		ctx := context.Background()
+		createPendingSecondFactorForTest(t, store, "token-1", "user-1", time.Now().Add(5*time.Minute))
+
+		if err := store.RecordFailure(ctx, hashOpaque("token-1"), 3); err != nil {
+			t.Fatalf("record failure: %v", err)
+		}
+		if pending, _ := store.Get(ctx, hashOpaque("token-1")); pending.Attempts != 1 {
+			t.Fatalf("expected one attempt, got %+v", pending)
+		}
+		for attempt := 0; attempt < 2; attempt++ {
+			_ = store.RecordFailure(ctx, hashOpaque("token-1"), 3)
+		}
+		if _, err := store.Get(ctx, hashOpaque("token-1")); !errors.Is(err, ErrPendingSecondFactorNotFound) {
+			t.Fatalf("expected the sign-in to be withdrawn after three wrong codes, got %v", err)
+		}
+	})
+}
+
+func TestPendingSecondFactorStoreHidesExpiredSignIns(t *testing.T) {
+	forEachPendingSecondFactorStore(t, func(t *testing.T, store PendingSecondFactorStore) {
+		createPendingSecondFactorForTest(t, store, "token-1", "user-1", time.Now().Add(-time.Minute))
+
+		if _, err := store.Get(context.Background(), hashOpaque("token-1")); !errors.Is(err, ErrPendingSecondFactorNotFound) {
+			t.Fatalf("expected an expired sign-in to be gone, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package authkit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+)
+
+// ErrInvalidProxyConfig indicates a ProxyConfig without an absolute upstream URL or a login URL.
+var ErrInvalidProxyConfig = errors.New("auth_proxy.invalid_config")
+
+// ProxyConfig configures the authenticating reverse proxy. Unauthenticated
+// browser navigations are redirected to LoginURL with return_to set to the
+// requested URL.
+type ProxyConfig struct {
+	UpstreamURL *url.URL
+	LoginURL    string
+}
+
+// NewAuthProxy returns a handler that forwards authenticated requests to the
+// upstream with X-Auth-User-Id, X-Auth-Email, and X-Auth-Roles headers. An
+// expired session is renewed from the refresh cookie, as /auth/refresh would,
+// before the request is forwarded, which requires configuration.RefreshCookiePath
+// to cover the proxied paths ("/"). TAuth's cookies are not passed upstream.
+// Mount it as the router's NoRoute handler next to MountAuthRoutes.
+func NewAuthProxy(configuration ServerConfig, proxyConfiguration ProxyConfig, users UserStore, refreshTokens RefreshTokenStore) (gin.HandlerFunc, error) {
+	upstreamURL := proxyConfiguration.UpstreamURL
+	if upstreamURL == nil || (upstreamURL.Scheme != "http" && upstreamURL.Scheme != "https") || upstreamURL.Host == "" {
+		return nil, fmt.Errorf("auth_proxy.new: %w: upstream URL must be an absolute http(s) URL", ErrInvalidProxyConfig)
+	}
+	if strings.TrimSpace(proxyConfiguration.LoginURL) == "" {
+		return nil, fmt.Errorf("auth_proxy.new: %w: login URL is required", ErrInvalidProxyConfig)
+	}
+	sessionValidator, validatorErr := sessionvalidator.New(configuration.sessionValidatorConfig())
+	if validatorErr != nil {
+		return nil, fmt.Errorf("auth_proxy.new: %w", validatorErr)
+	}
+	reverseProxy := &httputil.ReverseProxy{
+		Rewrite: func(proxyRequest *httputil.ProxyRequest) {
+			proxyRequest.SetURL(upstreamURL)
+			proxyRequest.SetXForwarded()
+			removeCookies(proxyRequest.Out, configuration.SessionCookieName, configuration.RefreshCookieName)
+		},
+		ErrorHandler: func(writer http.ResponseWriter, request *http.Request, proxyErr error) {
+			logAuthError("auth.proxy.upstream", proxyErr)
+			writer.WriteHeader(http.StatusBadGateway)
+		},
+	}
+
+	return func(contextGin *gin.Context) {
+		clock := resolveClock()
+		for _, header := range []string{HeaderAuthUserID, HeaderAuthEmail, HeaderAuthRoles} {
+			contextGin.Request.Header.Del(header)
+		}
+
+		claims, validateErr := sessionValidator.ValidateRequest(contextGin.Request)
+		if validateErr != nil && hasCookie(contextGin.Request, configuration.RefreshCookieName) {
+			sessionToken, failureStatus := refreshSession(contextGin, clock, configuration, users, refreshTokens)
+			if failureStatus >= http.StatusInternalServerError {
+				contextGin.AbortWithStatus(failureStatus)
+				return
+			}
+			if failureStatus == 0 {
+				claims, validateErr = sessionValidator.ValidateTokenContext(contextGin, sessionToken)
+			}
+		}
+		if validateErr != nil {
+			if loginURL, ok := proxyLoginRedirect(configuration, proxyConfiguration, contextGin.Request); ok {
+				contextGin.Redirect(http.StatusFound, loginURL)
+				contextGin.Abort()
+				return
+			}
+			contextGin.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		contextGin.Request.Header.Set(HeaderAuthUserID, claims.GetUserID())
+		contextGin.Request.Header.Set(HeaderAuthEmail, claims.GetUserEmail())
+		contextGin.Request.Header.Set(HeaderAuthRoles, strings.Join(claims.GetUserRoles(), ","))
+		reverseProxy.ServeHTTP(proxyResponseWriter{contextGin.Writer}, contextGin.Request)
+	}, nil
+}
+
+// proxyResponseWriter hides gin's CloseNotify, which panics on writers that
+// lack it; ReverseProxy follows the request context instead. Unwrap keeps
+// flushing available through http.ResponseController.
+type proxyResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (writer proxyResponseWriter) Unwrap() http.ResponseWriter {
+	return writer.ResponseWriter
+}
+
+// proxyLoginRedirect returns the login URL for unauthenticated browser
+// navigations; other requests receive 401.
+func proxyLoginRedirect(configuration ServerConfig, proxyConfiguration ProxyConfig, request *http.Request) (string, bool) {
+	if (request.Method != http.MethodGet && request.Method != http.MethodHead) || !strings.Contains(request.Header.Get("Accept"), "text/html") {
+		return "", false
+	}
+	return loginRedirectURL(proxyConfiguration.LoginURL, requestBaseURL(configuration, request)+request.URL.RequestURI())
+}
+
+func hasCookie(request *http.Request, name string) bool {
+	cookie, cookieErr := request.Cookie(name)
+	return cookieErr == nil && strings.TrimSpace(cookie.Value) != ""
+}
+
+// removeCookies drops the named cookies from the request's Cookie header.
+func removeCookies(request *http.Request, names ...string) {
+	cookies := request.Cookies()
+	request.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if !slices.Contains(names, cookie.Name) {
+			request.AddCookie(cookie)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package authkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type upstreamEcho struct {
+	Path    string `json:"path"`
+	UserID  string `json:"user_id"`
+	Email   string `json:"email"`
+	Roles   string `json:"roles"`
+	Cookies string `json:"cookies"`
+}
+
+func newProxyRouterForTest(t *testing.T, config ServerConfig) *gin.Engine {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_ = json.NewEncoder(writer).Encode(upstreamEcho{
+			Path:    request.URL.RequestURI(),
+			UserID:  request.Header.Get(HeaderAuthUserID),
+			Email:   request.Header.Get(HeaderAuthEmail),
+			Roles:   request.Header.Get(HeaderAuthRoles),
+			Cookies: request.Header.Get("Cookie"),
+		})
+	}))
+	t.Cleanup(upstream.Close)
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	users := newTestUserStore()
+	refreshTokens := NewMemoryRefreshTokenStore()
+	proxyHandler, proxyErr := NewAuthProxy(config, ProxyConfig{UpstreamURL: upstreamURL, LoginURL: "/login"}, users, refreshTokens)
+	if proxyErr != nil {
+		t.Fatalf("new auth proxy: %v", proxyErr)
+	}
+	router := gin.New()
+	MountAuthRoutes(router, config, users, refreshTokens, nil)
+	router.NoRoute(proxyHandler)
+	return router
+}
+
+func decodeUpstreamEcho(t *testing.T, response *httptest.ResponseRecorder) upstreamEcho {
+	t.Helper()
+	if response.Code != http.StatusOK {
+		t.Fatalf("expected the request to reach the upstream, got %d", response.Code)
+	}
+	var echo upstreamEcho
+	if decodeErr := json.Unmarshal(response.Body.Bytes(), &echo); decodeErr != nil {
+		t.Fatalf("decode upstream echo: %v", decodeErr)
+	}
+	return echo
+}
+
+func TestAuthProxyForwardsAuthenticatedRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer ProvideGoogleTokenValidator(nil)
+	ProvideSessionRevocationStore(NewMemorySessionRevocationStore())
+	defer ProvideSessionRevocationStore(nil)
+
+	config := newTestServerConfig()
+	config.RefreshCookiePath = "/"
+	router := newProxyRouterForTest(t, config)
+	cookies := loginForTest(t, router, "sub-proxy")
+	if cookies[config.RefreshCookieName].Path != "/" {
+		t.Fatalf("expected the refresh cookie to cover every path, got %q", cookies[config.RefreshCookieName].Path)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/wiki/page?id=7", nil)
+	request.Header.Set(HeaderAuthUserID, "spoofed")
+	request.AddCookie(&http.Cookie{Name: "legacy_app", Value: "keep"})
+	addCookies(request, cookies, config.SessionCookieName, config.RefreshCookieName)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	echo := decodeUpstreamEcho(t, response)
+	if echo.Path != "/wiki/page?id=7" || echo.UserID != "google:sub-proxy" || echo.Email != "sub-proxy@example.com" || echo.Roles != "user" {
+		t.Fatalf("unexpected upstream request %+v", echo)
+	}
+	if echo.Cookies != "legacy_app=keep" {
+		t.Fatalf("expected only application cookies upstream, got %q", echo.Cookies)
+	}
+}
+
+func TestAuthProxyRenewsExpiredSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer ProvideGoogleTokenValidator(nil)
+	ProvideSessionRevocationStore(NewMemorySessionRevocationStore())
+	defer ProvideSessionRevocationStore(nil)
+
+	config := newTestServerConfig()
+	config.RefreshCookiePath = "/"
+	router := newProxyRouterForTest(t, config)
+	cookies := loginForTest(t, router, "sub-proxy-refresh")
+
+	response := serveWithCookies(router, http.MethodGet, "/dashboard", nil, cookies, config.RefreshCookieName)
+	echo := decodeUpstreamEcho(t, response)
+	if echo.UserID != "google:sub-proxy-refresh" {
+		t.Fatalf("expected the renewed session to be forwarded, got %+v", echo)
+	}
+	renewed := collectCookies(response.Result().Cookies())
+	if renewed[config.SessionCookieName] == nil || renewed[config.RefreshCookieName] == nil {
+		t.Fatalf("expected renewed session and refresh cookies, got %v", response.Result().Cookies())
+	}
+	if renewed[config.RefreshCookieName].Value == cookies[config.RefreshCookieName].Value {
+		t.Fatalf("expected the refresh token to rotate")
+	}
+
+	staleResponse := serveWithCookies(router, http.MethodGet, "/dashboard", nil, cookies, config.RefreshCookieName)
+	if staleResponse.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the rotated refresh token to be rejected, got %d", staleResponse.Code)
+	}
+}
+
+func TestAuthProxyRejectsUnauthenticatedRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config := newTestServerConfig()
+	config.RefreshCookiePath = "/"
+	config.PublicBaseURL = "https://legacy.example.com"
+	router := newProxyRouterForTest(t, config)
+
+	testCases := []struct {
+		name             string
+		method           string
+		accept           string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{name: "browser navigation", method: http.MethodGet, accept: "text/html", expectedStatus: http.StatusFound, expectedLocation: "/login?return_to=" + url.QueryEscape("https://legacy.example.com/reports?q=1")},
+		{name: "api request", method: http.MethodGet, accept: "application/json", expectedStatus: http.StatusUnauthorized},
+		{name: "form post", method: http.MethodPost, accept: "text/html", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			request := httptest.NewRequest(testCase.method, "/reports?q=1", nil)
+			request.Header.Set("Accept", testCase.accept)
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+			if response.Code != testCase.expectedStatus {
+				t.Fatalf("expected %d, got %d", testCase.expectedStatus, response.Code)
+			}
+			if location := response.Header().Get("Location"); location != testCase.expectedLocation {
+				t.Fatalf("expected location %q, got %q", testCase.expectedLocation, location)
+			}
+		})
+	}
+}
+
+func TestNewAuthProxyValidatesConfiguration(t *testing.T) {
+	config := newTestServerConfig()
+	upstreamURL, _ := url.Parse("http://upstream.internal:3000")
+	relativeURL, _ := url.Parse("/upstream")
+
+	for _, proxyConfig := range []ProxyConfig{
+		{LoginURL: "/login"},
+		{UpstreamURL: relativeURL, LoginURL: "/login"},
+		{UpstreamURL: upstreamURL},
+	} {
+		if _, err := NewAuthProxy(config, proxyConfig, newTestUserStore(), NewMemoryRefreshTokenStore()); !errors.Is(err, ErrInvalidProxyConfig) {
+			t.Fatalf("expected ErrInvalidProxyConfig for %+v, got %v", proxyConfig, err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package authkit
+
+import (
+	"sync"
+	"time"
+)
+
+// attemptLimiter allows at most limit events per key in each fixed window. It
+// is process-local: every TAuth instance enforces the limit on its own.
+type attemptLimiter struct {
+	mutex   sync.Mutex
+	limit   int
+	window  time.Duration
+	windows map[string]attemptWindow
+}
+
+type attemptWindow struct {
+	startedAt time.Time
+	count     int
+}
+
+func newAttemptLimiter(limit int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{limit: limit, window: window, windows: make(map[string]attemptWindow)}
+}
+
+// allow records an event for key at now. When the key is over its limit it
+// returns false and how long until its window resets.
+func (limiter *attemptLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	for windowKey, window := range limiter.windows {
+		if now.Sub(window.startedAt) >= limiter.window {
+			delete(limiter.windows, windowKey)
+		}
+	}
+	window, found := limiter.windows[key]
+	if !found {
+		window = attemptWindow{startedAt: now}
+	}
+	if window.count >= limiter.limit {
+		return false, window.startedAt.Add(limiter.window).Sub(now)
+	}
+	window.count++
+	limiter.windows[key] = window
+	return true, 0
+}
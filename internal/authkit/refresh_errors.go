@@ -13,4 +13,6 @@ var (
 	ErrRefreshTokenAlreadyRevoked = errors.New("refresh_store.already_revoked")
 	// ErrRefreshTokenEmptyOpaque indicates that the provided opaque token text is empty.
 	ErrRefreshTokenEmptyOpaque = errors.New("refresh_store.empty_token")
+	// ErrRevocationEmptyIdentifier indicates a revocation without a session or token identifier.
+	ErrRevocationEmptyIdentifier = errors.New("revocation_store.empty_identifier")
 )
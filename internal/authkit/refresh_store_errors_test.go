@@ -25,7 +25,7 @@ func TestRefreshTokenStoresShareSentinelErrors(t *testing.T) {
 			name: "sqlite",
 			store: func(t *testing.T) RefreshTokenStore {
 				t.Helper()
-				store, err := NewDatabaseRefreshTokenStore(context.Background(), "sqlite://file::memory:?cache=shared")
+				store, err := NewDatabaseRefreshTokenStore(context.Background(), openTestDatabase(t))
 				if err != nil {
 					t.Fatalf("failed to create sqlite store: %v", err)
 				}
@@ -45,7 +45,7 @@ func TestRefreshTokenStoresShareSentinelErrors(t *testing.T) {
 				t.Fatalf("expected ErrRefreshTokenNotFound, got %v", err)
 			}
 
-			tokenID, opaque, issueErr := store.Issue(context.Background(), "user", time.Now().Add(time.Minute).Unix(), "")
+			tokenID, opaque, issueErr := store.Issue(context.Background(), "user", time.Now().Add(time.Minute).Unix(), "", nil, "", 0)
 			if issueErr != nil {
 				t.Fatalf("issue failed: %v", issueErr)
 			}
@@ -62,7 +62,7 @@ func TestRefreshTokenStoresShareSentinelErrors(t *testing.T) {
 				t.Fatalf("expected ErrRefreshTokenRevoked, got %v", err)
 			}
 
-			expiredID, expiredOpaque, issueExpiredErr := store.Issue(context.Background(), "user", time.Now().Add(-time.Minute).Unix(), "")
+			expiredID, expiredOpaque, issueExpiredErr := store.Issue(context.Background(), "user", time.Now().Add(-time.Minute).Unix(), "", nil, "", 0)
 			if issueExpiredErr != nil {
 				t.Fatalf("issue expired failed: %v", issueExpiredErr)
 			}
@@ -9,7 +9,10 @@ import (
 	"time"
 )
 
-const refreshOpaqueByteLength = 32
+const (
+	refreshOpaqueByteLength = 32
+	identifierByteLength    = 16
+)
 
 var refreshTokenRandomSource io.Reader = rand.Reader
 
@@ -27,7 +30,26 @@ func generateRefreshOpaque() (string, string, error) {
 	return opaque, hashOpaque(opaque), nil
 }
 
+// newRandomIdentifier returns an unguessable identifier for sessions (sid) and
+// session tokens (jti).
+func newRandomIdentifier() (string, error) {
+	randomBytes := make([]byte, identifierByteLength)
+	if _, err := io.ReadFull(refreshTokenRandomSource, randomBytes); err != nil {
+		return "", fmt.Errorf("refresh_store.random: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
 func hashOpaque(opaque string) string {
 	sum := sha256.Sum256([]byte(opaque))
 	return base64.RawURLEncoding.EncodeToString(sum[:])
 }
+
+// resolveSessionID keeps the session inherited from the previous refresh token
+// and starts a new one for first issues and records predating session IDs.
+func resolveSessionID(inheritedSessionID string) (string, error) {
+	if inheritedSessionID != "" {
+		return inheritedSessionID, nil
+	}
+	return newRandomIdentifier()
+}
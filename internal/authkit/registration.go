@@ -0,0 +1,168 @@
+package authkit
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+	"go.uber.org/zap"
+)
+
+// RegistrationMode decides whether signing in may create an account.
+type RegistrationMode string
+
+const (
+	// RegistrationOpen creates an account for every admitted identity; it is
+	// the behavior of the zero value.
+	RegistrationOpen RegistrationMode = "open"
+	// RegistrationInviteOnly creates accounts only for email addresses holding an invitation.
+	RegistrationInviteOnly RegistrationMode = "invite_only"
+	// RegistrationClosed admits only users the UserStore already knows.
+	RegistrationClosed RegistrationMode = "closed"
+)
+
+const (
+	invitationsPath      = "/auth/invitations"
+	revokeInvitationPath = "/auth/invitations/revoke"
+
+	defaultInvitationTTL = 7 * 24 * time.Hour
+)
+
+func (configuration ServerConfig) invitationTTL() time.Duration {
+	if configuration.InvitationTTL <= 0 {
+		return defaultInvitationTTL
+	}
+	return configuration.InvitationTTL
+}
+
+// allowRegistration fails the request with 403 when identity would need a new
+// account that the registration mode does not allow. Returning users are
+// always admitted; under invite-only registration a new user redeems the
+// invitation for their email address.
+func allowRegistration(contextGin *gin.Context, clock Clock, configuration ServerConfig, users UserStore, identity ExternalIdentity) bool {
+	if configuration.RegistrationMode == "" || configuration.RegistrationMode == RegistrationOpen {
+		return true
+	}
+	_, found, lookupErr := users.LookupExternalUser(contextGin, identity.Provider, identity.Subject)
+	if lookupErr != nil {
+		recordMetric(metricAuthLoginFailure)
+		logAuthError("auth.login.user_store", lookupErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	if found {
+		return true
+	}
+	if configuration.RegistrationMode != RegistrationInviteOnly {
+		recordMetric(metricAuthRegistrationDenied)
+		logAuthWarning("auth.login.registration_closed", nil, zap.String("provider", identity.Provider))
+		contextGin.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "registration_closed"})
+		return false
+	}
+	invitation, redeemErr := resolveInvitations().Redeem(contextGin, strings.ToLower(strings.TrimSpace(identity.Email)))
+	if redeemErr != nil && !errors.Is(redeemErr, ErrInvitationNotFound) {
+		recordMetric(metricAuthLoginFailure)
+		logAuthError("auth.login.invitation_store", redeemErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	if redeemErr != nil || invitation.ExpiresUnix < clock.Now().UTC().Unix() {
+		recordMetric(metricAuthRegistrationDenied)
+		logAuthWarning("auth.login.invitation_required", redeemErr, zap.String("provider", identity.Provider))
+		contextGin.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "invitation_required"})
+		return false
+	}
+	recordMetric(metricAuthInvitationRedeemed)
+	return true
+}
+
+// mountInvitationRoutes lets administrators manage invitations: create one
+// for an email address, list the pending ones, and revoke one.
+func mountInvitationRoutes(router gin.IRouter, clock Clock, configuration ServerConfig, sessionValidator *sessionvalidator.Validator) {
+	administrators := []gin.HandlerFunc{requireSessionWith(sessionValidator), sessionvalidator.RequireAnyRole(adminRole).GinMiddleware(sessionvalidator.JSONForbidden())}
+
+	router.POST(invitationsPath, append(administrators, func(contextGin *gin.Context) {
+		var inbound struct {
+			Email string `json:"email"`
+		}
+		bindErr := contextGin.BindJSON(&inbound)
+		email, validEmail := normalizeEmailAddress(inbound.Email)
+		if bindErr != nil || !validEmail {
+			logAuthWarning("auth.invitations.invalid_email", bindErr)
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_email"})
+			return
+		}
+		claims, ok := sessionClaims(contextGin)
+		if !ok {
+			return
+		}
+		now := clock.Now().UTC()
+		invitation := Invitation{
+			Email:       email,
+			InvitedBy:   claims.GetUserID(),
+			CreatedUnix: now.Unix(),
+			ExpiresUnix: now.Add(configuration.invitationTTL()).Unix(),
+		}
+		if createErr := resolveInvitations().Create(contextGin, invitation); createErr != nil {
+			logAuthError("auth.invitations.create", createErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		recordMetric(metricAuthInvitationCreated)
+		contextGin.JSON(http.StatusCreated, invitationResponse(invitation))
+	})...)
+
+	router.GET(invitationsPath, append(administrators, func(contextGin *gin.Context) {
+		invitations, listErr := resolveInvitations().List(contextGin)
+		if listErr != nil {
+			logAuthError("auth.invitations.list", listErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		nowUnix := clock.Now().UTC().Unix()
+		pending := make([]gin.H, 0, len(invitations))
+		for _, invitation := range invitations {
+			if invitation.ExpiresUnix >= nowUnix {
+				pending = append(pending, invitationResponse(invitation))
+			}
+		}
+		contextGin.Header("Cache-Control", "no-store")
+		contextGin.JSON(http.StatusOK, gin.H{"invitations": pending})
+	})...)
+
+	router.POST(revokeInvitationPath, append(administrators, func(contextGin *gin.Context) {
+		var inbound struct {
+			Email string `json:"email"`
+		}
+		bindErr := contextGin.BindJSON(&inbound)
+		email, validEmail := normalizeEmailAddress(inbound.Email)
+		if bindErr != nil || !validEmail {
+			logAuthWarning("auth.invitations.invalid_email", bindErr)
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_email"})
+			return
+		}
+		revokeErr := resolveInvitations().Revoke(contextGin, email)
+		if errors.Is(revokeErr, ErrInvitationNotFound) {
+			contextGin.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "invitation_not_found"})
+			return
+		}
+		if revokeErr != nil {
+			logAuthError("auth.invitations.revoke", revokeErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		contextGin.Status(http.StatusNoContent)
+	})...)
+}
+
+func invitationResponse(invitation Invitation) gin.H {
+	return gin.H{
+		"email":      invitation.Email,
+		"invited_by": invitation.InvitedBy,
+		"created_at": invitation.CreatedUnix,
+		"expires_at": invitation.ExpiresUnix,
+	}
+}
@@ -0,0 +1,144 @@
+package authkit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/idtoken"
+)
+
+// withRegistrationForTest sets the registration mode and a one-hour invitation lifetime.
+func withRegistrationForTest(mode RegistrationMode) func(*ServerConfig) {
+	return func(config *ServerConfig) {
+		config.RegistrationMode = mode
+		config.InvitationTTL = time.Hour
+	}
+}
+
+func googleSignInForTest(t *testing.T, router http.Handler, subject string, email string) (int, string) {
+	t.Helper()
+	payload := &idtoken.Payload{Claims: map[string]interface{}{
+		"iss":            "https://accounts.google.com",
+		"sub":            subject,
+		"email":          email,
+		"email_verified": true,
+	}}
+	ProvideGoogleTokenValidator(&fakeGoogleValidator{results: map[string]validatorResult{
+		"valid-token": {payload: payload, expectedAudience: "client-id"},
+	}})
+	response := postForTest(router, "/auth/google", prepareLoginBody(t, router, payload, "valid-token"), nil)
+	errorCode, _ := response.body["error"].(string)
+	return response.status, errorCode
+}
+
+func TestRegistrationClosed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, _, users := newAuthRouterForTest(t, withRegistrationForTest(RegistrationClosed))
+	if _, _, err := users.UpsertExternalUser(context.Background(), "google", "existing", "existing@example.com", "Existing", ""); err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+
+	if status, _ := googleSignInForTest(t, router, "existing", "existing@example.com"); status != http.StatusOK {
+		t.Fatalf("expected an existing user to sign in, got %d", status)
+	}
+	if status, errorCode := googleSignInForTest(t, router, "stranger", "stranger@example.com"); status != http.StatusForbidden || errorCode != "registration_closed" {
+		t.Fatalf("expected 403 registration_closed, got %d %q", status, errorCode)
+	}
+	if _, found, _ := users.LookupExternalUser(context.Background(), "google", "stranger"); found {
+		t.Fatalf("expected no account for a rejected sign-in")
+	}
+	if response := serveWithCookies(router, http.MethodGet, invitationsPath, nil, nil); response.Code != http.StatusNotFound {
+		t.Fatalf("expected invitation routes only under invite-only registration, got %d", response.Code)
+	}
+}
+
+func TestRegistrationInviteOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clock := provideClockForTest(t, time.Now().UTC())
+	router, config, _ := newAuthRouterForTest(t, withRegistrationForTest(RegistrationInviteOnly))
+	adminToken, _, mintErr := mintSessionToken(NewSystemClock(), config, "admin-session", nil, time.Time{}, "admin-1", "admin@example.com", "Admin", "", []string{adminRole}, nil)
+	if mintErr != nil {
+		t.Fatalf("mint admin token: %v", mintErr)
+	}
+	adminCookies := map[string]*http.Cookie{config.SessionCookieName: {Name: config.SessionCookieName, Value: adminToken}}
+	invite := func(email string) (int, map[string]interface{}) {
+		response := postForTest(router, invitationsPath, map[string]string{"email": email}, adminCookies, config.SessionCookieName)
+		return response.status, response.body
+	}
+	listInvitations := func() []interface{} {
+		response := serveWithCookies(router, http.MethodGet, invitationsPath, nil, adminCookies, config.SessionCookieName)
+		var decoded struct {
+			Invitations []interface{} `json:"invitations"`
+		}
+		if response.Code != http.StatusOK || json.Unmarshal(response.Body.Bytes(), &decoded) != nil {
+			t.Fatalf("expected the invitation list, got %d", response.Code)
+		}
+		return decoded.Invitations
+	}
+
+	if status, errorCode := googleSignInForTest(t, router, "newcomer", "newcomer@example.com"); status != http.StatusForbidden || errorCode != "invitation_required" {
+		t.Fatalf("expected 403 invitation_required, got %d %q", status, errorCode)
+	}
+
+	userCookies := loginForTestWithInvitation(t, router, invite)
+	if response := serveWithCookies(router, http.MethodPost, invitationsPath, map[string]string{"email": "friend@example.com"}, userCookies, config.SessionCookieName); response.Code != http.StatusForbidden {
+		t.Fatalf("expected non-administrators to be refused, got %d", response.Code)
+	}
+	if status, _ := invite("Not an address"); status != http.StatusBadRequest {
+		t.Fatalf("expected an invalid address to be rejected, got %d", status)
+	}
+
+	status, created := invite("Newcomer@Example.com")
+	if status != http.StatusCreated || created["email"] != "newcomer@example.com" || created["invited_by"] != "admin-1" || created["expires_at"] != float64(clock.Now().Add(time.Hour).Unix()) {
+		t.Fatalf("expected the invitation to be created, got %d %v", status, created)
+	}
+	if invitations := listInvitations(); len(invitations) != 1 {
+		t.Fatalf("expected one pending invitation, got %v", invitations)
+	}
+	if status, _ := googleSignInForTest(t, router, "newcomer", "newcomer@example.com"); status != http.StatusOK {
+		t.Fatalf("expected the invited user to sign in, got %d", status)
+	}
+	if invitations := listInvitations(); len(invitations) != 0 {
+		t.Fatalf("expected the invitation to be redeemed, got %v", invitations)
+	}
+	if status, _ := googleSignInForTest(t, router, "newcomer", "newcomer@example.com"); status != http.StatusOK {
+		t.Fatalf("expected the new account to keep signing in, got %d", status)
+	}
+	if status, errorCode := googleSignInForTest(t, router, "impostor", "newcomer@example.com"); status != http.StatusForbidden || errorCode != "invitation_required" {
+		t.Fatalf("expected a redeemed invitation to admit one account, got %d %q", status, errorCode)
+	}
+
+	invite("revoked@example.com")
+	revokeBody := map[string]string{"email": "revoked@example.com"}
+	if response := serveWithCookies(router, http.MethodPost, revokeInvitationPath, revokeBody, adminCookies, config.SessionCookieName); response.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 from revoke, got %d", response.Code)
+	}
+	if response := serveWithCookies(router, http.MethodPost, revokeInvitationPath, revokeBody, adminCookies, config.SessionCookieName); response.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a revoked invitation, got %d", response.Code)
+	}
+	if status, _ := googleSignInForTest(t, router, "revoked", "revoked@example.com"); status != http.StatusForbidden {
+		t.Fatalf("expected a revoked invitation to be refused, got %d", status)
+	}
+
+	invite("late@example.com")
+	clock.Advance(2 * time.Hour)
+	if invitations := listInvitations(); len(invitations) != 0 {
+		t.Fatalf("expected expired invitations to be hidden, got %v", invitations)
+	}
+	if status, errorCode := googleSignInForTest(t, router, "late", "late@example.com"); status != http.StatusForbidden || errorCode != "invitation_required" {
+		t.Fatalf("expected an expired invitation to be refused, got %d %q", status, errorCode)
+	}
+}
+
+// loginForTestWithInvitation invites and signs in an ordinary user, returning their cookies.
+func loginForTestWithInvitation(t *testing.T, router http.Handler, invite func(string) (int, map[string]interface{})) map[string]*http.Cookie {
+	t.Helper()
+	if status, _ := invite("member@example.com"); status != http.StatusCreated {
+		t.Fatalf("expected the member invitation to be created, got %d", status)
+	}
+	return loginForTest(t, router, "member")
+}
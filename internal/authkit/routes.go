@@ -12,6 +12,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/tyemirov/tauth/internal/web"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
 	"go.uber.org/zap"
 	"google.golang.org/api/idtoken"
 )
@@ -88,12 +89,32 @@ func resolveGoogleValidator(ctx context.Context) (GoogleTokenValidator, error) {
 	return validator, nil
 }
 
+const jwksCacheControl = "public, max-age=300"
+
 const (
-	metricAuthLoginSuccess   = "auth.login.success"
-	metricAuthLoginFailure   = "auth.login.failure"
-	metricAuthRefreshSuccess = "auth.refresh.success"
-	metricAuthRefreshFailure = "auth.refresh.failure"
-	metricAuthLogoutSuccess  = "auth.logout.success"
+	metricAuthLoginSuccess       = "auth.login.success"
+	metricAuthLoginFailure       = "auth.login.failure"
+	metricAuthRefreshSuccess     = "auth.refresh.success"
+	metricAuthRefreshFailure     = "auth.refresh.failure"
+	metricAuthLogoutSuccess      = "auth.logout.success"
+	metricAuthSessionRevoked     = "auth.session.revoked"
+	metricAuthIntrospectActive   = "auth.introspect.active"
+	metricAuthIntrospectInactive = "auth.introspect.inactive"
+	metricAuthEmailSent          = "auth.email.sent"
+	metricAuthPasskeyRegistered  = "auth.passkey.registered"
+	metricAuthMFAChallenged      = "auth.mfa.challenged"
+	metricAuthMFAEnabled         = "auth.mfa.enabled"
+	metricAuthMFADisabled        = "auth.mfa.disabled"
+	metricAuthLoginRestricted    = "auth.login.restricted"
+	metricAuthRegistrationDenied = "auth.registration.denied"
+	metricAuthInvitationCreated  = "auth.invitation.created"
+	metricAuthInvitationRedeemed = "auth.invitation.redeemed"
+	metricAuthIdentityLinked     = "auth.identity.linked"
+	metricAuthIdentityUnlinked   = "auth.identity.unlinked"
+	metricAuthDeviceCodeIssued   = "auth.device.code_issued"
+	metricAuthDeviceApproved     = "auth.device.approved"
+	metricAuthDeviceDenied       = "auth.device.denied"
+	metricAuthDeviceAuthorized   = "auth.device.authorized"
 )
 
 func recordMetric(event string) {
@@ -125,16 +146,33 @@ func logAuthError(code string, err error, fields ...zap.Field) {
 	configuredLogger.Error("auth", logFields...)
 }
 
+func resolveClock() Clock {
+	if configuredClock == nil {
+		return NewSystemClock()
+	}
+	return configuredClock
+}
+
 // MountAuthRoutes registers /auth endpoints and session helpers.
 func MountAuthRoutes(router gin.IRouter, configuration ServerConfig, users UserStore, refreshTokens RefreshTokenStore, nonces NonceStore) {
-	clock := configuredClock
-	if clock == nil {
-		clock = NewSystemClock()
-	}
+	clock := resolveClock()
 	if nonces == nil {
 		nonces = NewMemoryNonceStore(configuration.NonceTTL)
 	}
 
+	sessionValidator := newSessionValidator(configuration)
+	publicKeySet, publicKeySetErr := configuration.AppJWTKeyring.PublicKeySet()
+	router.GET(discoveryPath, handleDiscovery(configuration))
+	router.GET(jwksPath, func(contextGin *gin.Context) {
+		if publicKeySetErr != nil {
+			logAuthError("auth.jwks.encode", publicKeySetErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		contextGin.Header("Cache-Control", jwksCacheControl)
+		contextGin.JSON(http.StatusOK, publicKeySet)
+	})
+
 	router.POST("/auth/nonce", func(contextGin *gin.Context) {
 		if nonces == nil {
 			contextGin.AbortWithStatus(http.StatusServiceUnavailable)
@@ -149,216 +187,504 @@ func MountAuthRoutes(router gin.IRouter, configuration ServerConfig, users UserS
 		contextGin.JSON(http.StatusOK, gin.H{"nonce": token})
 	})
 
-	router.POST("/auth/google", func(contextGin *gin.Context) {
-		var inbound struct {
-			GoogleIDToken string `json:"google_id_token"`
-			NonceToken    string `json:"nonce_token"`
-		}
-		if err := contextGin.BindJSON(&inbound); err != nil || strings.TrimSpace(inbound.GoogleIDToken) == "" {
+	providers := identityProviders(configuration)
+	router.POST(identityLoginPath, func(contextGin *gin.Context) {
+		provider, knownProvider := providers[contextGin.Param("provider")]
+		if !knownProvider {
 			recordMetric(metricAuthLoginFailure)
-			logAuthWarning("auth.login.invalid_json", err)
-			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+			logAuthWarning("auth.login.unknown_provider", nil, zap.String("provider", contextGin.Param("provider")))
+			contextGin.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "unknown_provider"})
 			return
 		}
-		if nonces == nil {
-			recordMetric(metricAuthLoginFailure)
-			logAuthError("auth.login.nonce_store_unavailable", nil)
-			contextGin.AbortWithStatus(http.StatusServiceUnavailable)
+		identity, verified := verifyIdentityTokenRequest(contextGin, configuration, provider, nonces)
+		if !verified {
 			return
 		}
-		if strings.TrimSpace(inbound.NonceToken) == "" {
-			recordMetric(metricAuthLoginFailure)
-			logAuthWarning("auth.login.missing_nonce", nil)
-			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing_nonce"})
-			return
-		}
-		if consumeErr := nonces.Consume(contextGin, inbound.NonceToken); consumeErr != nil {
-			recordMetric(metricAuthLoginFailure)
-			logAuthWarning("auth.login.invalid_nonce_token", consumeErr)
-			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_nonce"})
+		profile, started := startSession(contextGin, clock, configuration, users, refreshTokens, identity)
+		if !started {
 			return
 		}
+		respondWithSession(contextGin, profile)
+	})
 
-		if !configuration.AllowInsecureHTTP && !isHTTPS(contextGin.Request) {
-			recordMetric(metricAuthLoginFailure)
-			logAuthWarning("auth.login.insecure_http", nil)
-			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "https_required"})
-			return
-		}
+	router.GET(authorizationLoginPath, handleAuthorizationLogin(configuration, providers, nonces))
+	router.GET(authorizationCallbackPath, handleAuthorizationCallback(clock, configuration, providers, users, refreshTokens, nonces))
 
-		validator, validatorErr := resolveGoogleValidator(context.Background())
-		if validatorErr != nil {
-			recordMetric(metricAuthLoginFailure)
-			logAuthError("auth.login.validator_init", validatorErr)
-			contextGin.AbortWithStatus(http.StatusInternalServerError)
+	if configuration.Mailer != nil {
+		mountEmailLoginRoutes(router, clock, configuration, users, refreshTokens)
+	}
+	if configuration.WebAuthnRPID != "" {
+		mountWebAuthnRoutes(router, clock, configuration, sessionValidator, users, refreshTokens)
+	}
+	if configuration.TOTPIssuer != "" {
+		mountSecondFactorRoutes(router, clock, configuration, sessionValidator, users, refreshTokens)
+	}
+	if configuration.RegistrationMode == RegistrationInviteOnly {
+		mountInvitationRoutes(router, clock, configuration, sessionValidator)
+	}
+	mountIdentityLinkRoutes(router, clock, configuration, sessionValidator, users, providers, nonces)
+	if len(configuration.DeviceClientIDs) > 0 {
+		mountDeviceAuthorizationRoutes(router, clock, configuration, sessionValidator, users, refreshTokens)
+	}
+
+	router.POST("/auth/refresh", func(contextGin *gin.Context) {
+		if _, failureStatus := refreshSession(contextGin, clock, configuration, users, refreshTokens); failureStatus != 0 {
+			contextGin.AbortWithStatus(failureStatus)
 			return
 		}
-		payload, validateErr := validator.Validate(context.Background(), inbound.GoogleIDToken, configuration.GoogleWebClientID)
-		if validateErr != nil {
+		contextGin.Status(http.StatusNoContent)
+	})
+
+	router.POST("/auth/logout", func(contextGin *gin.Context) {
+		revokeCurrentSession(contextGin, clock, configuration, sessionValidator, refreshTokens)
+		clearCookie(contextGin, configuration.SessionCookieName, configuration.CookieDomain, configuration.SameSiteMode)
+		clearCookie(contextGin, configuration.RefreshCookieName, configuration.CookieDomain, configuration.SameSiteMode)
+		contextGin.Status(http.StatusNoContent)
+		recordMetric(metricAuthLogoutSuccess)
+	})
+
+	router.GET(revocationsPath, handleRevocations())
+	router.GET(verifyPath, handleVerify(configuration, sessionValidator))
+	router.POST(introspectionPath, handleIntrospection(configuration, sessionValidator, users, refreshTokens))
+	router.POST(revokeSessionPath, requireSessionWith(sessionValidator), sessionvalidator.RequireAnyRole(adminRole).GinMiddleware(sessionvalidator.JSONForbidden()), handleRevokeSession(clock, configuration))
+
+	whoAmI := router.Group("/")
+	whoAmI.Use(requireSessionWith(sessionValidator))
+	whoAmI.GET("/me", web.HandleWhoAmI(users, configuredLogger))
+}
+
+// verifyIdentityTokenRequest reads { id_token, nonce_token } from the request,
+// consumes the nonce, and verifies the ID token with provider, failing the
+// request unless the token is valid and carries the nonce.
+func verifyIdentityTokenRequest(contextGin *gin.Context, configuration ServerConfig, provider IdentityProvider, nonces NonceStore) (ExternalIdentity, bool) {
+	var inbound struct {
+		IDToken       string `json:"id_token"`
+		GoogleIDToken string `json:"google_id_token"`
+		NonceToken    string `json:"nonce_token"`
+	}
+	bindErr := contextGin.BindJSON(&inbound)
+	if inbound.IDToken == "" {
+		inbound.IDToken = inbound.GoogleIDToken
+	}
+	if bindErr != nil || strings.TrimSpace(inbound.IDToken) == "" {
+		recordMetric(metricAuthLoginFailure)
+		logAuthWarning("auth.login.invalid_json", bindErr)
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+		return ExternalIdentity{}, false
+	}
+	if nonces == nil {
+		recordMetric(metricAuthLoginFailure)
+		logAuthError("auth.login.nonce_store_unavailable", nil)
+		contextGin.AbortWithStatus(http.StatusServiceUnavailable)
+		return ExternalIdentity{}, false
+	}
+	if strings.TrimSpace(inbound.NonceToken) == "" {
+		recordMetric(metricAuthLoginFailure)
+		logAuthWarning("auth.login.missing_nonce", nil)
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing_nonce"})
+		return ExternalIdentity{}, false
+	}
+	if consumeErr := nonces.Consume(contextGin, inbound.NonceToken); consumeErr != nil {
+		recordMetric(metricAuthLoginFailure)
+		logAuthWarning("auth.login.invalid_nonce_token", consumeErr)
+		contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_nonce"})
+		return ExternalIdentity{}, false
+	}
+
+	if !configuration.AllowInsecureHTTP && !isHTTPS(contextGin.Request) {
+		recordMetric(metricAuthLoginFailure)
+		logAuthWarning("auth.login.insecure_http", nil)
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "https_required"})
+		return ExternalIdentity{}, false
+	}
+
+	identity, verified := verifyIdentityToken(contextGin, provider, inbound.IDToken)
+	if !verified {
+		return ExternalIdentity{}, false
+	}
+	nonceClaim := identity.Nonce
+	if nonceClaim == "" {
+		recordMetric(metricAuthLoginFailure)
+		logAuthWarning("auth.login.nonce_mismatch", nil, zap.String("id_token_nonce", nonceClaim))
+		contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_nonce"})
+		return ExternalIdentity{}, false
+	}
+	if nonceClaim != inbound.NonceToken {
+		expectedHashedNonce := hashOpaque(inbound.NonceToken)
+		if nonceClaim != expectedHashedNonce {
 			recordMetric(metricAuthLoginFailure)
-			logAuthWarning("auth.login.invalid_google_token", validateErr)
-			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_google_token"})
-			return
+			logAuthWarning(
+				"auth.login.nonce_mismatch",
+				nil,
+				zap.String("id_token_nonce", nonceClaim),
+				zap.String("expected_nonce_hashed", expectedHashedNonce),
+			)
+			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_nonce"})
+			return ExternalIdentity{}, false
 		}
-		issuerValue, okIssuer := payload.Claims["iss"].(string)
-		if !okIssuer || (issuerValue != "https://accounts.google.com" && issuerValue != "accounts.google.com") {
-			recordMetric(metricAuthLoginFailure)
-			logAuthWarning("auth.login.invalid_issuer", nil, zap.String("issuer", issuerValue))
-			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_issuer"})
-			return
+	}
+	return identity, true
+}
+
+// revokeCurrentSession revokes the session presented by the request's cookies:
+// the session JWT, its session ID, and the refresh token. Failures are logged
+// and otherwise ignored, since the caller replaces or clears the cookies.
+func revokeCurrentSession(contextGin *gin.Context, clock Clock, configuration ServerConfig, sessionValidator *sessionvalidator.Validator, refreshTokens RefreshTokenStore) {
+	revocations := resolveSessionRevocations()
+	revocationDeadline := sessionRevocationDeadline(clock, configuration)
+	if sessionClaims, validateErr := sessionValidator.ValidateRequest(contextGin.Request); validateErr == nil {
+		if sessionClaims.GetSessionID() != "" {
+			if revokeErr := revocations.RevokeSession(contextGin, sessionClaims.GetSessionID(), revocationDeadline); revokeErr != nil {
+				logAuthWarning("auth.logout.revoke_session", revokeErr)
+			}
 		}
-		googleSub, _ := payload.Claims["sub"].(string)
-		userEmail, _ := payload.Claims["email"].(string)
-		emailVerified, _ := payload.Claims["email_verified"].(bool)
-		userDisplayName, _ := payload.Claims["name"].(string)
-		userAvatarURL, _ := payload.Claims["picture"].(string)
-		nonceClaim, _ := payload.Claims["nonce"].(string)
-		if nonceClaim == "" {
-			recordMetric(metricAuthLoginFailure)
-			logAuthWarning("auth.login.nonce_mismatch", nil, zap.String("google_nonce", nonceClaim))
-			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_nonce"})
-			return
+		if sessionClaims.ID != "" {
+			if revokeErr := revocations.RevokeToken(contextGin, sessionClaims.ID, revocationDeadline); revokeErr != nil {
+				logAuthWarning("auth.logout.revoke_token", revokeErr)
+			}
 		}
-		if nonceClaim != inbound.NonceToken {
-			expectedHashedNonce := hashOpaque(inbound.NonceToken)
-			if nonceClaim != expectedHashedNonce {
-				recordMetric(metricAuthLoginFailure)
-				logAuthWarning(
-					"auth.login.nonce_mismatch",
-					nil,
-					zap.String("google_nonce", nonceClaim),
-					zap.String("expected_nonce_hashed", expectedHashedNonce),
-				)
-				contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_nonce"})
-				return
+	}
+	refreshCookie, cookieErr := contextGin.Request.Cookie(configuration.RefreshCookieName)
+	if cookieErr == nil && refreshCookie != nil && strings.TrimSpace(refreshCookie.Value) != "" {
+		_, tokenID, _, validateErr := refreshTokens.Validate(contextGin, refreshCookie.Value)
+		if validateErr == nil && tokenID != "" {
+			if sessionID, sessionErr := refreshTokens.SessionID(contextGin, tokenID); sessionErr == nil && sessionID != "" {
+				if revokeErr := revocations.RevokeSession(contextGin, sessionID, revocationDeadline); revokeErr != nil {
+					logAuthWarning("auth.logout.revoke_session", revokeErr)
+				}
+			}
+			if revokeErr := refreshTokens.Revoke(contextGin, tokenID); revokeErr != nil && !errors.Is(revokeErr, ErrRefreshTokenAlreadyRevoked) {
+				logAuthWarning("auth.logout.revoke", revokeErr)
 			}
 		}
+	}
+}
 
-		if googleSub == "" || userEmail == "" || !emailVerified {
-			recordMetric(metricAuthLoginFailure)
-			logAuthWarning("auth.login.unverified_identity", nil)
-			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unverified_identity"})
-			return
-		}
+// invalidIDTokenErrorCode keeps the invalid_google_token code deployed
+// Google Sign-In clients already handle; other providers report invalid_id_token.
+func invalidIDTokenErrorCode(provider IdentityProvider) string {
+	if provider.Name() == googleIdentityProviderName {
+		return "invalid_google_token"
+	}
+	return "invalid_id_token"
+}
 
-		applicationUserID, userRoles, upsertErr := users.UpsertGoogleUser(contextGin, googleSub, userEmail, userDisplayName, userAvatarURL)
-		if upsertErr != nil || applicationUserID == "" {
-			recordMetric(metricAuthLoginFailure)
-			logAuthError("auth.login.user_store", upsertErr)
-			contextGin.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
+// verifyIdentityToken verifies idToken with the provider, failing the request
+// when the token is rejected or the provider cannot be reached.
+func verifyIdentityToken(contextGin *gin.Context, provider IdentityProvider, idToken string) (ExternalIdentity, bool) {
+	identity, verifyErr := provider.VerifyIDToken(contextGin, idToken)
+	switch {
+	case errors.Is(verifyErr, ErrInvalidIDToken):
+		recordMetric(metricAuthLoginFailure)
+		errorCode := invalidIDTokenErrorCode(provider)
+		logAuthWarning("auth.login."+errorCode, verifyErr, zap.String("provider", provider.Name()))
+		contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": errorCode})
+		return ExternalIdentity{}, false
+	case errors.Is(verifyErr, ErrIDTokenIssuerMismatch):
+		recordMetric(metricAuthLoginFailure)
+		logAuthWarning("auth.login.invalid_issuer", verifyErr, zap.String("provider", provider.Name()))
+		contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_issuer"})
+		return ExternalIdentity{}, false
+	case errors.Is(verifyErr, ErrIdentityProviderUnavailable):
+		recordMetric(metricAuthLoginFailure)
+		logAuthError("auth.login.provider_unavailable", verifyErr, zap.String("provider", provider.Name()))
+		contextGin.AbortWithStatus(http.StatusServiceUnavailable)
+		return ExternalIdentity{}, false
+	case verifyErr != nil:
+		recordMetric(metricAuthLoginFailure)
+		logAuthError("auth.login.provider_error", verifyErr, zap.String("provider", provider.Name()))
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return ExternalIdentity{}, false
+	}
+	return identity, true
+}
 
-		sessionToken, sessionExpiresAt, mintErr := MintAppJWT(clock, applicationUserID, userEmail, userDisplayName, userAvatarURL, userRoles, configuration.AppJWTIssuer, configuration.AppJWTSigningKey, configuration.SessionTTL)
-		if mintErr != nil {
-			recordMetric(metricAuthLoginFailure)
-			logAuthError("auth.login.mint_jwt", mintErr)
-			contextGin.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
+// allowLoginPolicy fails the request with 403 when configuration.LoginPolicy
+// does not admit identity.
+func allowLoginPolicy(contextGin *gin.Context, configuration ServerConfig, identity ExternalIdentity) bool {
+	policyErr := configuration.LoginPolicy.Check(identity)
+	if policyErr == nil {
+		return true
+	}
+	recordMetric(metricAuthLoginRestricted)
+	logAuthWarning("auth.login.restricted", policyErr, zap.String("provider", identity.Provider))
+	errorCode := "email_not_allowed"
+	if errors.Is(policyErr, ErrHostedDomainNotAllowed) {
+		errorCode = "hosted_domain_not_allowed"
+	}
+	contextGin.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": errorCode})
+	return false
+}
+
+// startSession signs in a verified identity: it resolves the account that
+// linked the identity or upserts the user, starts a refresh token family, and
+// writes the session and refresh cookies. It returns the profile reported to
+// the client, or false once the request has failed.
+func startSession(contextGin *gin.Context, clock Clock, configuration ServerConfig, users UserStore, refreshTokens RefreshTokenStore, identity ExternalIdentity) (gin.H, bool) {
+	userEmail, userDisplayName, userAvatarURL := identity.Email, identity.DisplayName, identity.AvatarURL
+	if identity.Subject == "" || userEmail == "" || !identity.EmailVerified {
+		recordMetric(metricAuthLoginFailure)
+		logAuthWarning("auth.login.unverified_identity", nil)
+		contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unverified_identity"})
+		return nil, false
+	}
+	if !allowLoginPolicy(contextGin, configuration, identity) {
+		return nil, false
+	}
+	linked, linkErr := resolveLinkedIdentities().Get(contextGin, identity.Provider, identity.Subject)
+	if linkErr == nil {
+		return signInLinkedIdentity(contextGin, clock, configuration, users, refreshTokens, identity, linked)
+	}
+	if !errors.Is(linkErr, ErrLinkedIdentityNotFound) {
+		recordMetric(metricAuthLoginFailure)
+		logAuthError("auth.login.linked_identity_store", linkErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	if !allowRegistration(contextGin, clock, configuration, users, identity) {
+		return nil, false
+	}
+
+	applicationUserID, userRoles, upsertErr := users.UpsertExternalUser(contextGin, identity.Provider, identity.Subject, userEmail, userDisplayName, userAvatarURL)
+	if upsertErr != nil || applicationUserID == "" {
+		recordMetric(metricAuthLoginFailure)
+		logAuthError("auth.login.user_store", upsertErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	return issueSession(contextGin, clock, configuration, refreshTokens, applicationUserID, userEmail, userDisplayName, userAvatarURL, userRoles)
+}
 
-		refreshDeadline := clock.Now().UTC().Add(configuration.RefreshTTL)
-		_, refreshOpaque, issueErr := refreshTokens.Issue(contextGin, applicationUserID, refreshDeadline.Unix(), "")
-		if issueErr != nil || strings.TrimSpace(refreshOpaque) == "" {
+// issueSession signs in a known application user who passed their primary
+// authentication. Users with a second factor get a pending second factor
+// instead of a session and must complete it at /auth/mfa/verify.
+func issueSession(contextGin *gin.Context, clock Clock, configuration ServerConfig, refreshTokens RefreshTokenStore, applicationUserID string, userEmail string, userDisplayName string, userAvatarURL string, userRoles []string) (gin.H, bool) {
+	if configuration.TOTPIssuer != "" {
+		enrollment, lookupErr := resolveSecondFactors().Get(contextGin, applicationUserID)
+		if lookupErr != nil && !errors.Is(lookupErr, ErrSecondFactorNotFound) {
 			recordMetric(metricAuthLoginFailure)
-			logAuthError("auth.login.issue_refresh", issueErr)
+			logAuthError("auth.login.second_factor_store", lookupErr)
 			contextGin.AbortWithStatus(http.StatusInternalServerError)
-			return
+			return nil, false
+		}
+		if lookupErr == nil && enrollment.Confirmed {
+			return beginSecondFactor(contextGin, clock, configuration, applicationUserID)
 		}
+	}
+	return establishSession(contextGin, clock, configuration, refreshTokens, nil, applicationUserID, userEmail, userDisplayName, userAvatarURL, userRoles)
+}
 
-		writeSessionCookie(contextGin, configuration, sessionToken, sessionExpiresAt)
-		writeRefreshCookie(contextGin, configuration, refreshOpaque, refreshDeadline)
-
-		contextGin.JSON(http.StatusOK, gin.H{
-			"user_id":    applicationUserID,
-			"user_email": userEmail,
-			"display":    userDisplayName,
-			"avatar_url": userAvatarURL,
-			"roles":      userRoles,
-		})
-		recordMetric(metricAuthLoginSuccess)
-	})
+// respondWithSession answers a sign-in with the user's profile, or with 401
+// mfa_required while the user still owes their second factor, so clients never
+// mistake a pending sign-in for a session.
+func respondWithSession(contextGin *gin.Context, profile gin.H) {
+	if profile["mfa_required"] == true {
+		contextGin.JSON(http.StatusUnauthorized, profile)
+		return
+	}
+	contextGin.JSON(http.StatusOK, profile)
+}
 
-	router.POST("/auth/refresh", func(contextGin *gin.Context) {
-		refreshCookie, cookieErr := contextGin.Request.Cookie(configuration.RefreshCookieName)
-		if cookieErr != nil || refreshCookie == nil || strings.TrimSpace(refreshCookie.Value) == "" {
-			recordMetric(metricAuthRefreshFailure)
-			logAuthWarning("auth.refresh.missing_cookie", cookieErr)
-			contextGin.AbortWithStatus(http.StatusUnauthorized)
-			return
-		}
+// establishSession starts a refresh token family authenticated with
+// authMethods and writes the session and refresh cookies.
+func establishSession(contextGin *gin.Context, clock Clock, configuration ServerConfig, refreshTokens RefreshTokenStore, authMethods []string, applicationUserID string, userEmail string, userDisplayName string, userAvatarURL string, userRoles []string) (gin.H, bool) {
+	tokens, issued := issueSessionTokens(contextGin, clock, configuration, refreshTokens, "", authMethods, applicationUserID, userEmail, userDisplayName, userAvatarURL, userRoles)
+	if !issued {
+		return nil, false
+	}
+	writeSessionCookie(contextGin, configuration, tokens.sessionToken, tokens.sessionExpiresAt)
+	writeRefreshCookie(contextGin, configuration, tokens.refreshToken, tokens.refreshExpiresAt)
+
+	recordMetric(metricAuthLoginSuccess)
+	return gin.H{
+		"user_id":    applicationUserID,
+		"user_email": userEmail,
+		"display":    userDisplayName,
+		"avatar_url": userAvatarURL,
+		"roles":      userRoles,
+	}, true
+}
 
-		applicationUserID, currentTokenID, expiresUnix, validateErr := refreshTokens.Validate(contextGin, refreshCookie.Value)
-		if validateErr != nil {
-			recordMetric(metricAuthRefreshFailure)
-			logAuthWarning("auth.refresh.validate", validateErr)
-			contextGin.AbortWithStatus(http.StatusUnauthorized)
-			return
-		}
-		if time.Unix(expiresUnix, 0).Before(clock.Now().UTC()) {
-			recordMetric(metricAuthRefreshFailure)
-			logAuthWarning("auth.refresh.expired", nil)
-			contextGin.AbortWithStatus(http.StatusUnauthorized)
-			return
-		}
+// sessionTokens are the session JWT and opaque refresh token handed to a
+// client, in cookies or in a token response.
+type sessionTokens struct {
+	sessionToken     string
+	sessionExpiresAt time.Time
+	refreshToken     string
+	refreshExpiresAt time.Time
+}
 
-		userEmail, userDisplayName, userAvatarURL, userRoles, profileErr := users.GetUserProfile(contextGin, applicationUserID)
-		if profileErr != nil {
-			recordMetric(metricAuthRefreshFailure)
-			logAuthWarning("auth.refresh.profile", profileErr)
-			contextGin.AbortWithStatus(http.StatusUnauthorized)
-			return
-		}
+// issueSessionTokens starts a refresh token family for clientID, empty for
+// browser sessions, authenticated with authMethods and mints its first session
+// token.
+func issueSessionTokens(contextGin *gin.Context, clock Clock, configuration ServerConfig, refreshTokens RefreshTokenStore, clientID string, authMethods []string, applicationUserID string, userEmail string, userDisplayName string, userAvatarURL string, userRoles []string) (sessionTokens, bool) {
+	customClaims, enrichErr := enrichSessionClaims(contextGin, applicationUserID, userEmail, userRoles)
+	if enrichErr != nil {
+		recordMetric(metricAuthLoginFailure)
+		logAuthError("auth.login.enrich_claims", enrichErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return sessionTokens{}, false
+	}
 
-		sessionToken, sessionExpiresAt, mintErr := MintAppJWT(clock, applicationUserID, userEmail, userDisplayName, userAvatarURL, userRoles, configuration.AppJWTIssuer, configuration.AppJWTSigningKey, configuration.SessionTTL)
-		if mintErr != nil {
-			recordMetric(metricAuthRefreshFailure)
-			logAuthError("auth.refresh.mint_jwt", mintErr)
-			contextGin.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
+	authTime := clock.Now().UTC()
+	refreshDeadline := authTime.Add(configuration.RefreshTTL)
+	refreshTokenID, refreshOpaque, issueErr := refreshTokens.Issue(contextGin, applicationUserID, refreshDeadline.Unix(), "", authMethods, clientID, authTime.Unix())
+	if issueErr != nil || strings.TrimSpace(refreshOpaque) == "" {
+		recordMetric(metricAuthLoginFailure)
+		logAuthError("auth.login.issue_refresh", issueErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return sessionTokens{}, false
+	}
+	sessionID, sessionErr := refreshTokens.SessionID(contextGin, refreshTokenID)
+	if sessionErr != nil {
+		recordMetric(metricAuthLoginFailure)
+		logAuthError("auth.login.session_id", sessionErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return sessionTokens{}, false
+	}
 
-		refreshDeadline := clock.Now().UTC().Add(configuration.RefreshTTL)
-		_, newOpaque, issueErr := refreshTokens.Issue(contextGin, applicationUserID, refreshDeadline.Unix(), currentTokenID)
-		if issueErr != nil || strings.TrimSpace(newOpaque) == "" {
-			recordMetric(metricAuthRefreshFailure)
-			logAuthError("auth.refresh.issue_refresh", issueErr)
-			contextGin.AbortWithStatus(http.StatusInternalServerError)
-			return
-		}
+	sessionToken, sessionExpiresAt, mintErr := mintSessionToken(clock, configuration, sessionID, authMethods, authTime, applicationUserID, userEmail, userDisplayName, userAvatarURL, userRoles, customClaims)
+	if mintErr != nil {
+		recordMetric(metricAuthLoginFailure)
+		logAuthError("auth.login.mint_jwt", mintErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return sessionTokens{}, false
+	}
+
+	return sessionTokens{
+		sessionToken:     sessionToken,
+		sessionExpiresAt: sessionExpiresAt,
+		refreshToken:     refreshOpaque,
+		refreshExpiresAt: refreshDeadline,
+	}, true
+}
+
+// refreshSession rotates the refresh cookie and writes a new session cookie.
+// It returns the new session token, or an empty token and the status to fail
+// the request with.
+func refreshSession(contextGin *gin.Context, clock Clock, configuration ServerConfig, users UserStore, refreshTokens RefreshTokenStore) (string, int) {
+	refreshCookie, cookieErr := contextGin.Request.Cookie(configuration.RefreshCookieName)
+	if cookieErr != nil || refreshCookie == nil || strings.TrimSpace(refreshCookie.Value) == "" {
+		recordMetric(metricAuthRefreshFailure)
+		logAuthWarning("auth.refresh.missing_cookie", cookieErr)
+		return "", http.StatusUnauthorized
+	}
+
+	tokens, failureStatus := rotateSessionTokens(contextGin, clock, configuration, users, refreshTokens, "", refreshCookie.Value)
+	if failureStatus != 0 {
+		return "", failureStatus
+	}
+	writeSessionCookie(contextGin, configuration, tokens.sessionToken, tokens.sessionExpiresAt)
+	writeRefreshCookie(contextGin, configuration, tokens.refreshToken, tokens.refreshExpiresAt)
+	return tokens.sessionToken, 0
+}
+
+// rotateSessionTokens exchanges refreshOpaque for a new refresh token of the
+// same session and a session token minted from the user's current profile.
+// Only the client the token was issued to, clientID, may redeem it. It returns
+// the status to fail the request with when the token is unusable.
+func rotateSessionTokens(contextGin *gin.Context, clock Clock, configuration ServerConfig, users UserStore, refreshTokens RefreshTokenStore, clientID string, refreshOpaque string) (sessionTokens, int) {
+	applicationUserID, currentTokenID, expiresUnix, validateErr := refreshTokens.Validate(contextGin, refreshOpaque)
+	if validateErr != nil {
+		recordMetric(metricAuthRefreshFailure)
+		logAuthWarning("auth.refresh.validate", validateErr)
+		return sessionTokens{}, http.StatusUnauthorized
+	}
+	if time.Unix(expiresUnix, 0).Before(clock.Now().UTC()) {
+		recordMetric(metricAuthRefreshFailure)
+		logAuthWarning("auth.refresh.expired", nil)
+		return sessionTokens{}, http.StatusUnauthorized
+	}
+	tokenClientID, clientErr := refreshTokens.ClientID(contextGin, currentTokenID)
+	if clientErr != nil {
+		recordMetric(metricAuthRefreshFailure)
+		logAuthError("auth.refresh.client_id", clientErr)
+		return sessionTokens{}, http.StatusInternalServerError
+	}
+	if tokenClientID != clientID {
+		recordMetric(metricAuthRefreshFailure)
+		logAuthWarning("auth.refresh.client_mismatch", nil, zap.String("client_id", clientID), zap.String("token_client_id", tokenClientID))
+		return sessionTokens{}, http.StatusUnauthorized
+	}
+
+	sessionID, sessionErr := refreshTokens.SessionID(contextGin, currentTokenID)
+	if sessionErr != nil {
+		recordMetric(metricAuthRefreshFailure)
+		logAuthError("auth.refresh.session_id", sessionErr)
+		return sessionTokens{}, http.StatusInternalServerError
+	}
+	authMethods, authMethodsErr := refreshTokens.AuthMethods(contextGin, currentTokenID)
+	if authMethodsErr != nil {
+		recordMetric(metricAuthRefreshFailure)
+		logAuthError("auth.refresh.auth_methods", authMethodsErr)
+		return sessionTokens{}, http.StatusInternalServerError
+	}
+	authTimeUnix, authTimeErr := refreshTokens.AuthTime(contextGin, currentTokenID)
+	if authTimeErr != nil {
+		recordMetric(metricAuthRefreshFailure)
+		logAuthError("auth.refresh.auth_time", authTimeErr)
+		return sessionTokens{}, http.StatusInternalServerError
+	}
+	var authTime time.Time
+	if authTimeUnix != 0 {
+		authTime = time.Unix(authTimeUnix, 0).UTC()
+	}
+	sessionRevoked, revokedErr := resolveSessionRevocations().IsRevoked(contextGin, sessionID, "")
+	if revokedErr != nil {
+		recordMetric(metricAuthRefreshFailure)
+		logAuthError("auth.refresh.revocation_check", revokedErr)
+		return sessionTokens{}, http.StatusInternalServerError
+	}
+	if sessionRevoked {
+		recordMetric(metricAuthRefreshFailure)
+		logAuthWarning("auth.refresh.session_revoked", nil)
 		if revokeErr := refreshTokens.Revoke(contextGin, currentTokenID); revokeErr != nil && !errors.Is(revokeErr, ErrRefreshTokenAlreadyRevoked) {
-			recordMetric(metricAuthRefreshFailure)
-			logAuthError("auth.refresh.revoke_previous", revokeErr)
-			contextGin.AbortWithStatus(http.StatusInternalServerError)
-			return
+			logAuthWarning("auth.refresh.revoke_revoked_session", revokeErr)
 		}
+		return sessionTokens{}, http.StatusUnauthorized
+	}
 
-		writeSessionCookie(contextGin, configuration, sessionToken, sessionExpiresAt)
-		writeRefreshCookie(contextGin, configuration, newOpaque, refreshDeadline)
+	userEmail, userDisplayName, userAvatarURL, userRoles, profileErr := users.GetUserProfile(contextGin, applicationUserID)
+	if profileErr != nil {
+		recordMetric(metricAuthRefreshFailure)
+		logAuthWarning("auth.refresh.profile", profileErr)
+		return sessionTokens{}, http.StatusUnauthorized
+	}
 
-		contextGin.Status(http.StatusNoContent)
-		recordMetric(metricAuthRefreshSuccess)
-	})
+	customClaims, enrichErr := enrichSessionClaims(contextGin, applicationUserID, userEmail, userRoles)
+	if enrichErr != nil {
+		recordMetric(metricAuthRefreshFailure)
+		logAuthError("auth.refresh.enrich_claims", enrichErr)
+		return sessionTokens{}, http.StatusInternalServerError
+	}
 
-	router.POST("/auth/logout", func(contextGin *gin.Context) {
-		refreshCookie, cookieErr := contextGin.Request.Cookie(configuration.RefreshCookieName)
-		if cookieErr == nil && refreshCookie != nil && strings.TrimSpace(refreshCookie.Value) != "" {
-			_, tokenID, _, validateErr := refreshTokens.Validate(contextGin, refreshCookie.Value)
-			if validateErr == nil && tokenID != "" {
-				if revokeErr := refreshTokens.Revoke(contextGin, tokenID); revokeErr != nil && !errors.Is(revokeErr, ErrRefreshTokenAlreadyRevoked) {
-					logAuthWarning("auth.logout.revoke", revokeErr)
-				}
-			}
-		}
-		clearCookie(contextGin, configuration.SessionCookieName, configuration.CookieDomain, configuration.SameSiteMode)
-		clearCookie(contextGin, configuration.RefreshCookieName, configuration.CookieDomain, configuration.SameSiteMode)
-		contextGin.Status(http.StatusNoContent)
-		recordMetric(metricAuthLogoutSuccess)
-	})
+	sessionToken, sessionExpiresAt, mintErr := mintSessionToken(clock, configuration, sessionID, authMethods, authTime, applicationUserID, userEmail, userDisplayName, userAvatarURL, userRoles, customClaims)
+	if mintErr != nil {
+		recordMetric(metricAuthRefreshFailure)
+		logAuthError("auth.refresh.mint_jwt", mintErr)
+		return sessionTokens{}, http.StatusInternalServerError
+	}
 
-	whoAmI := router.Group("/")
-	whoAmI.Use(RequireSession(configuration))
-	whoAmI.GET("/me", web.HandleWhoAmI(users, configuredLogger))
+	refreshDeadline := clock.Now().UTC().Add(configuration.RefreshTTL)
+	_, newOpaque, issueErr := refreshTokens.Issue(contextGin, applicationUserID, refreshDeadline.Unix(), currentTokenID, nil, "", 0)
+	if issueErr != nil || strings.TrimSpace(newOpaque) == "" {
+		recordMetric(metricAuthRefreshFailure)
+		logAuthError("auth.refresh.issue_refresh", issueErr)
+		return sessionTokens{}, http.StatusInternalServerError
+	}
+	if revokeErr := refreshTokens.Revoke(contextGin, currentTokenID); revokeErr != nil && !errors.Is(revokeErr, ErrRefreshTokenAlreadyRevoked) {
+		recordMetric(metricAuthRefreshFailure)
+		logAuthError("auth.refresh.revoke_previous", revokeErr)
+		return sessionTokens{}, http.StatusInternalServerError
+	}
+
+	recordMetric(metricAuthRefreshSuccess)
+	return sessionTokens{
+		sessionToken:     sessionToken,
+		sessionExpiresAt: sessionExpiresAt,
+		refreshToken:     newOpaque,
+		refreshExpiresAt: refreshDeadline,
+	}, 0
 }
 
 func writeSessionCookie(contextGin *gin.Context, configuration ServerConfig, sessionToken string, expiresAt time.Time) {
@@ -378,7 +704,7 @@ func writeRefreshCookie(contextGin *gin.Context, configuration ServerConfig, opa
 	http.SetCookie(contextGin.Writer, &http.Cookie{
 		Name:     configuration.RefreshCookieName,
 		Value:    opaque,
-		Path:     "/auth",
+		Path:     configuration.refreshCookiePath(),
 		Domain:   configuration.CookieDomain,
 		Expires:  expiresAt,
 		Secure:   true,
@@ -3,14 +3,19 @@ package authkit
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest/observer"
 	"google.golang.org/api/idtoken"
@@ -70,8 +75,14 @@ func newTestUserStore() *testUserStore {
 	return &testUserStore{profiles: make(map[string]testUserProfile)}
 }
 
-func (store *testUserStore) UpsertGoogleUser(ctx context.Context, googleSub string, userEmail string, userDisplayName string, userAvatarURL string) (string, []string, error) {
-	applicationUserID := "google:" + googleSub
+func (store *testUserStore) LookupExternalUser(ctx context.Context, provider string, subject string) (string, bool, error) {
+	applicationUserID := provider + ":" + subject
+	_, found := store.profiles[applicationUserID]
+	return applicationUserID, found, nil
+}
+
+func (store *testUserStore) UpsertExternalUser(ctx context.Context, provider string, subject string, userEmail string, userDisplayName string, userAvatarURL string) (string, []string, error) {
+	applicationUserID := provider + ":" + subject
 	profile := testUserProfile{
 		email:   userEmail,
 		display: userDisplayName,
@@ -95,7 +106,11 @@ type failingUserStore struct {
 	profileErr error
 }
 
-func (store *failingUserStore) UpsertGoogleUser(ctx context.Context, googleSub string, userEmail string, userDisplayName string, userAvatarURL string) (string, []string, error) {
+func (store *failingUserStore) LookupExternalUser(ctx context.Context, provider string, subject string) (string, bool, error) {
+	return "", false, store.upsertErr
+}
+
+func (store *failingUserStore) UpsertExternalUser(ctx context.Context, provider string, subject string, userEmail string, userDisplayName string, userAvatarURL string) (string, []string, error) {
 	return "", nil, store.upsertErr
 }
 
@@ -104,14 +119,14 @@ func (store *failingUserStore) GetUserProfile(ctx context.Context, applicationUs
 }
 
 type stubRefreshStore struct {
-	issueFunc    func(ctx context.Context, applicationUserID string, expiresUnix int64, previousTokenID string) (string, string, error)
+	issueFunc    func(ctx context.Context, applicationUserID string, expiresUnix int64, previousTokenID string, authMethods []string, clientID string, authTimeUnix int64) (string, string, error)
 	validateFunc func(ctx context.Context, tokenOpaque string) (string, string, int64, error)
 	revokeFunc   func(ctx context.Context, tokenID string) error
 }
 
-func (store *stubRefreshStore) Issue(ctx context.Context, applicationUserID string, expiresUnix int64, previousTokenID string) (string, string, error) {
+func (store *stubRefreshStore) Issue(ctx context.Context, applicationUserID string, expiresUnix int64, previousTokenID string, authMethods []string, clientID string, authTimeUnix int64) (string, string, error) {
 	if store.issueFunc != nil {
-		return store.issueFunc(ctx, applicationUserID, expiresUnix, previousTokenID)
+		return store.issueFunc(ctx, applicationUserID, expiresUnix, previousTokenID, authMethods, clientID, authTimeUnix)
 	}
 	return "", "", nil
 }
@@ -130,10 +145,26 @@ func (store *stubRefreshStore) Revoke(ctx context.Context, tokenID string) error
 	return nil
 }
 
+func (store *stubRefreshStore) SessionID(ctx context.Context, tokenID string) (string, error) {
+	return "session-" + tokenID, nil
+}
+
+func (store *stubRefreshStore) AuthMethods(ctx context.Context, tokenID string) ([]string, error) {
+	return nil, nil
+}
+
+func (store *stubRefreshStore) ClientID(ctx context.Context, tokenID string) (string, error) {
+	return "", nil
+}
+
+func (store *stubRefreshStore) AuthTime(ctx context.Context, tokenID string) (int64, error) {
+	return 0, nil
+}
+
 func newTestServerConfig() ServerConfig {
 	return ServerConfig{
 		GoogleWebClientID: "client-id",
-		AppJWTSigningKey:  []byte("secret-key-1234567890"),
+		AppJWTKeyring:     mustKeyring(mustHMACSigningKey("secret-key-1234567890")),
 		AppJWTIssuer:      "test-issuer",
 		CookieDomain:      "",
 		SessionCookieName: "app_session",
@@ -146,6 +177,22 @@ func newTestServerConfig() ServerConfig {
 	}
 }
 
+func mustHMACSigningKey(secret string) SigningKey {
+	signingKey, err := NewHMACSigningKey([]byte(secret))
+	if err != nil {
+		panic(err)
+	}
+	return signingKey
+}
+
+func mustKeyring(signingKey SigningKey) *Keyring {
+	keyring, err := NewSingleKeyKeyring(signingKey)
+	if err != nil {
+		panic(err)
+	}
+	return keyring
+}
+
 func collectCookies(cookies []*http.Cookie) map[string]*http.Cookie {
 	collected := make(map[string]*http.Cookie)
 	for _, cookie := range cookies {
@@ -162,6 +209,87 @@ func addCookies(request *http.Request, cookies map[string]*http.Cookie, names ..
 	}
 }
 
+// serveWithCookies sends payload with the named cookies: []byte is sent as
+// is and url.Values as a form; anything else is encoded as JSON.
+func serveWithCookies(router http.Handler, method string, path string, payload interface{}, cookies map[string]*http.Cookie, names ...string) *httptest.ResponseRecorder {
+	var body []byte
+	contentType := "application/json"
+	switch typedPayload := payload.(type) {
+	case nil:
+	case []byte:
+		body = typedPayload
+	case url.Values:
+		body = []byte(typedPayload.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	default:
+		body, _ = json.Marshal(typedPayload)
+	}
+	request := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+	request.Header.Set("Content-Type", contentType)
+	addCookies(request, cookies, names...)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	return response
+}
+
+// testResponse is a recorded response with its JSON body and cookies decoded.
+type testResponse struct {
+	status  int
+	body    map[string]interface{}
+	cookies map[string]*http.Cookie
+	header  http.Header
+}
+
+// postForTest posts payload to path like serveWithCookies and decodes the response.
+func postForTest(router http.Handler, path string, payload interface{}, cookies map[string]*http.Cookie, names ...string) testResponse {
+	response := serveWithCookies(router, http.MethodPost, path, payload, cookies, names...)
+	var body map[string]interface{}
+	_ = json.Unmarshal(response.Body.Bytes(), &body)
+	return testResponse{
+		status:  response.Code,
+		body:    body,
+		cookies: collectCookies(response.Result().Cookies()),
+		header:  response.Header(),
+	}
+}
+
+// newAuthRouterForTest mounts the auth routes with the test configuration,
+// adjusted by configure when given. Every injectable store starts empty and
+// is reset, with the Google token validator, when the test ends.
+func newAuthRouterForTest(t *testing.T, configure func(*ServerConfig)) (*gin.Engine, ServerConfig, *testUserStore) {
+	t.Helper()
+	resetProviders := func() {
+		ProvideSessionRevocationStore(nil)
+		ProvideEmailLoginStore(nil)
+		ProvideCredentialStore(nil)
+		ProvideSecondFactorStore(nil)
+		ProvidePendingSecondFactorStore(nil)
+		ProvideInvitationStore(nil)
+		ProvideLinkedIdentityStore(nil)
+		ProvideDeviceAuthorizationStore(nil)
+		ProvideGoogleTokenValidator(nil)
+	}
+	resetProviders()
+	t.Cleanup(resetProviders)
+	config := newTestServerConfig()
+	if configure != nil {
+		configure(&config)
+	}
+	users := newTestUserStore()
+	router := gin.New()
+	MountAuthRoutes(router, config, users, NewMemoryRefreshTokenStore(), nil)
+	return router, config, users
+}
+
+// provideClockForTest injects a controllable clock reading start until the test ends.
+func provideClockForTest(t *testing.T, start time.Time) *controllableClock {
+	t.Helper()
+	clock := &controllableClock{current: start}
+	ProvideClock(clock)
+	t.Cleanup(func() { ProvideClock(nil) })
+	return clock
+}
+
 func issueNonceForTest(t *testing.T, handler http.Handler) string {
 	t.Helper()
 	recorder := httptest.NewRecorder()
@@ -442,6 +570,9 @@ func TestAuthGoogleValidatorFailures(t *testing.T) {
 	if failureResponse.Code != http.StatusUnauthorized {
 		t.Fatalf("expected 401 for invalid google token, got %d", failureResponse.Code)
 	}
+	if !strings.Contains(failureResponse.Body.String(), `"invalid_google_token"`) {
+		t.Fatalf("expected invalid_google_token for the built-in google provider, got %s", failureResponse.Body.String())
+	}
 }
 
 func TestAuthGoogleSuccessMetrics(t *testing.T) {
@@ -906,7 +1037,7 @@ func TestAuthGoogleRefreshIssueError(t *testing.T) {
 	config := newTestServerConfig()
 	userStore := newTestUserStore()
 	refreshStore := &stubRefreshStore{
-		issueFunc: func(ctx context.Context, applicationUserID string, expiresUnix int64, previousTokenID string) (string, string, error) {
+		issueFunc: func(ctx context.Context, applicationUserID string, expiresUnix int64, previousTokenID string, authMethods []string, clientID string, authTimeUnix int64) (string, string, error) {
 			return "", "", errors.New("issue_fail")
 		},
 	}
@@ -977,7 +1108,7 @@ func TestAuthRefreshIssueFailure(t *testing.T) {
 		validateFunc: func(ctx context.Context, tokenOpaque string) (string, string, int64, error) {
 			return "user", "token", time.Now().Add(time.Minute).Unix(), nil
 		},
-		issueFunc: func(ctx context.Context, applicationUserID string, expiresUnix int64, previousTokenID string) (string, string, error) {
+		issueFunc: func(ctx context.Context, applicationUserID string, expiresUnix int64, previousTokenID string, authMethods []string, clientID string, authTimeUnix int64) (string, string, error) {
 			return "", "", errors.New("issue_fail")
 		},
 	}
@@ -1003,7 +1134,7 @@ func TestAuthRefreshRevokeFailure(t *testing.T) {
 		validateFunc: func(ctx context.Context, tokenOpaque string) (string, string, int64, error) {
 			return "user", "token", time.Now().Add(time.Minute).Unix(), nil
 		},
-		issueFunc: func(ctx context.Context, applicationUserID string, expiresUnix int64, previousTokenID string) (string, string, error) {
+		issueFunc: func(ctx context.Context, applicationUserID string, expiresUnix int64, previousTokenID string, authMethods []string, clientID string, authTimeUnix int64) (string, string, error) {
 			return "token-new", "opaque-new", nil
 		},
 		revokeFunc: func(ctx context.Context, tokenID string) error {
@@ -1026,7 +1157,7 @@ func TestRequireSessionIssuerMismatch(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	config := newTestServerConfig()
-	token, _, err := MintAppJWT(NewSystemClock(), "user", "user@example.com", "User", "https://example.com/avatar.png", []string{"user"}, config.AppJWTIssuer, config.AppJWTSigningKey, config.SessionTTL)
+	token, _, err := MintAppJWT(NewSystemClock(), "user", "user@example.com", "User", "https://example.com/avatar.png", []string{"user"}, config.AppJWTIssuer, config.AppJWTAudience, config.AppJWTKeyring.ActiveKey(), config.SessionTTL)
 	if err != nil {
 		t.Fatalf("failed to mint token: %v", err)
 	}
@@ -1049,3 +1180,59 @@ func TestRequireSessionIssuerMismatch(t *testing.T) {
 		t.Fatalf("expected 401 for issuer mismatch, got %d", response.Code)
 	}
 }
+
+func TestJWKSEndpointPublishesAsymmetricSigningKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	_, privateKey, keyErr := ed25519.GenerateKey(rand.Reader)
+	if keyErr != nil {
+		t.Fatalf("generate ed25519 key: %v", keyErr)
+	}
+	signingKey, signingKeyErr := NewAsymmetricSigningKey(privateKey)
+	if signingKeyErr != nil {
+		t.Fatalf("signing key: %v", signingKeyErr)
+	}
+	config := newTestServerConfig()
+	config.AppJWTKeyring = mustKeyring(signingKey)
+	userStore := newTestUserStore()
+	userStore.profiles["user"] = testUserProfile{email: "user@example.com", display: "User", roles: []string{"user"}}
+
+	router := gin.New()
+	MountAuthRoutes(router, config, userStore, NewMemoryRefreshTokenStore(), nil)
+
+	jwksResponse := httptest.NewRecorder()
+	router.ServeHTTP(jwksResponse, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if jwksResponse.Code != http.StatusOK {
+		t.Fatalf("expected 200 from jwks endpoint, got %d", jwksResponse.Code)
+	}
+	if jwksResponse.Header().Get("Cache-Control") != jwksCacheControl {
+		t.Fatalf("unexpected cache control %q", jwksResponse.Header().Get("Cache-Control"))
+	}
+	keySet, parseErr := sessionvalidator.ParseJSONWebKeySet(jwksResponse.Body.Bytes())
+	if parseErr != nil {
+		t.Fatalf("parse jwks: %v", parseErr)
+	}
+	if len(keySet.Keys) != 1 || keySet.Keys[0].Algorithm != "EdDSA" {
+		t.Fatalf("unexpected key set: %#v", keySet)
+	}
+
+	token, _, mintErr := MintAppJWT(NewSystemClock(), "user", "user@example.com", "User", "", []string{"user"}, config.AppJWTIssuer, config.AppJWTAudience, config.AppJWTKeyring.ActiveKey(), config.SessionTTL)
+	if mintErr != nil {
+		t.Fatalf("mint token: %v", mintErr)
+	}
+	downstream, validatorErr := sessionvalidator.New(sessionvalidator.Config{KeySet: keySet, Issuer: config.AppJWTIssuer})
+	if validatorErr != nil {
+		t.Fatalf("downstream validator: %v", validatorErr)
+	}
+	if _, validateErr := downstream.ValidateToken(token); validateErr != nil {
+		t.Fatalf("expected downstream validation with published jwks, got %v", validateErr)
+	}
+
+	meRequest := httptest.NewRequest(http.MethodGet, "/me", nil)
+	meRequest.AddCookie(&http.Cookie{Name: config.SessionCookieName, Value: token})
+	meResponse := httptest.NewRecorder()
+	router.ServeHTTP(meResponse, meRequest)
+	if meResponse.Code != http.StatusOK {
+		t.Fatalf("expected 200 from /me with asymmetric session, got %d", meResponse.Code)
+	}
+}
@@ -0,0 +1,450 @@
+package authkit
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+	"go.uber.org/zap"
+)
+
+const (
+	totpEnrollPath  = "/auth/mfa/totp/enroll"
+	totpConfirmPath = "/auth/mfa/totp/confirm"
+	totpDisablePath = "/auth/mfa/totp/disable"
+	mfaVerifyPath   = "/auth/mfa/verify"
+	mfaCookiePath   = "/auth/mfa/"
+
+	// mfaPendingCookieName carries the token of a sign-in that passed its
+	// primary authentication and waits for the second factor.
+	mfaPendingCookieName = "app_mfa_pending"
+
+	totpPeriodSeconds     = 30
+	totpSkewSteps         = 1
+	recoveryCodeCount     = 10
+	recoveryCodeLength    = 10
+	recoveryCodeAlphabet  = "abcdefghjkmnpqrstuvwxyz23456789"
+	mfaPendingTTL         = 5 * time.Minute
+	mfaMaxPendingAttempts = 5
+
+	// Rate limits applied per TAuth instance within mfaRateWindow.
+	mfaRateWindow             = 15 * time.Minute
+	mfaVerificationsPerUser   = 10
+	mfaVerificationsPerClient = 30
+)
+
+// errSecondFactorRejected marks a TOTP or recovery code that did not verify.
+var errSecondFactorRejected = errors.New("second_factor.rejected")
+
+// mountSecondFactorRoutes registers TOTP enrollment and the second factor
+// check that completes sign-ins and steps up existing sessions.
+func mountSecondFactorRoutes(router gin.IRouter, clock Clock, configuration ServerConfig, sessionValidator *sessionvalidator.Validator, users UserStore, refreshTokens RefreshTokenStore) {
+	verificationsPerUser := newAttemptLimiter(mfaVerificationsPerUser, mfaRateWindow)
+	verificationsPerClient := newAttemptLimiter(mfaVerificationsPerClient, mfaRateWindow)
+
+	router.POST(totpEnrollPath, requireSessionWith(sessionValidator), func(contextGin *gin.Context) {
+		claims, ok := sessionClaims(contextGin)
+		if !ok {
+			return
+		}
+		enrollment, lookupErr := resolveSecondFactors().Get(contextGin, claims.GetUserID())
+		if lookupErr != nil && !errors.Is(lookupErr, ErrSecondFactorNotFound) {
+			logAuthError("auth.mfa.store", lookupErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if lookupErr == nil && enrollment.Confirmed {
+			contextGin.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "totp_already_enabled"})
+			return
+		}
+		accountName := claims.GetUserEmail()
+		if accountName == "" {
+			accountName = claims.GetUserID()
+		}
+		key, generateErr := totp.Generate(totp.GenerateOpts{
+			Issuer:      configuration.TOTPIssuer,
+			AccountName: accountName,
+			Period:      totpPeriodSeconds,
+			Digits:      otp.DigitsSix,
+			Algorithm:   otp.AlgorithmSHA1,
+		})
+		if generateErr != nil {
+			logAuthError("auth.mfa.generate", generateErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		pending := TOTPEnrollment{UserID: claims.GetUserID(), Secret: key.Secret(), CreatedUnix: clock.Now().UTC().Unix()}
+		if saveErr := resolveSecondFactors().Save(contextGin, pending); saveErr != nil {
+			logAuthError("auth.mfa.store", saveErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		contextGin.JSON(http.StatusOK, gin.H{"secret": key.Secret(), "otpauth_url": key.URL()})
+	})
+
+	router.POST(totpConfirmPath, requireSessionWith(sessionValidator), func(contextGin *gin.Context) {
+		claims, ok := sessionClaims(contextGin)
+		if !ok {
+			return
+		}
+		var inbound struct {
+			Code string `json:"code"`
+		}
+		if bindErr := contextGin.BindJSON(&inbound); bindErr != nil || strings.TrimSpace(inbound.Code) == "" {
+			logAuthWarning("auth.mfa.invalid_json", bindErr)
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+			return
+		}
+		now := clock.Now().UTC()
+		if !allowAttempt(contextGin, verificationsPerUser, claims.GetUserID(), now) {
+			return
+		}
+		enrollment, lookupErr := resolveSecondFactors().Get(contextGin, claims.GetUserID())
+		if errors.Is(lookupErr, ErrSecondFactorNotFound) {
+			contextGin.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "totp_not_enrolled"})
+			return
+		}
+		if lookupErr != nil {
+			logAuthError("auth.mfa.store", lookupErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if enrollment.Confirmed {
+			contextGin.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "totp_already_enabled"})
+			return
+		}
+		step, matched := matchTOTPStep(enrollment.Secret, inbound.Code, now)
+		if !matched {
+			logAuthWarning("auth.mfa.invalid_code", nil)
+			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_code"})
+			return
+		}
+		recoveryCodes, recoveryCodeHashes, codesErr := newRecoveryCodes()
+		if codesErr != nil {
+			logAuthError("auth.mfa.random", codesErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		enrollment.Confirmed = true
+		enrollment.LastUsedStep = step
+		enrollment.RecoveryCodeHashes = recoveryCodeHashes
+		if saveErr := resolveSecondFactors().Save(contextGin, enrollment); saveErr != nil {
+			logAuthError("auth.mfa.store", saveErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		recordMetric(metricAuthMFAEnabled)
+
+		revokeCurrentSession(contextGin, clock, configuration, sessionValidator, refreshTokens)
+		profile, started := establishSession(contextGin, clock, configuration, refreshTokens, secondFactorAuthMethods(sessionvalidator.AuthMethodOTP), claims.GetUserID(), claims.GetUserEmail(), claims.GetUserDisplayName(), claims.GetUserAvatarURL(), claims.GetUserRoles())
+		if !started {
+			return
+		}
+		profile["recovery_codes"] = recoveryCodes
+		contextGin.JSON(http.StatusOK, profile)
+	})
+
+	router.POST(totpDisablePath, requireSessionWith(sessionValidator), func(contextGin *gin.Context) {
+		claims, ok := sessionClaims(contextGin)
+		if !ok {
+			return
+		}
+		var inbound struct {
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+		if bindErr := contextGin.BindJSON(&inbound); bindErr != nil {
+			logAuthWarning("auth.mfa.invalid_json", bindErr)
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+			return
+		}
+		now := clock.Now().UTC()
+		if !allowAttempt(contextGin, verificationsPerUser, claims.GetUserID(), now) {
+			return
+		}
+		enrollment, lookupErr := resolveSecondFactors().Get(contextGin, claims.GetUserID())
+		if errors.Is(lookupErr, ErrSecondFactorNotFound) {
+			contextGin.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "totp_not_enrolled"})
+			return
+		}
+		if lookupErr != nil {
+			logAuthError("auth.mfa.store", lookupErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if enrollment.Confirmed {
+			if _, verified := verifySecondFactor(contextGin, now, enrollment, inbound.Code, inbound.RecoveryCode); !verified {
+				return
+			}
+		}
+		if deleteErr := resolveSecondFactors().Delete(contextGin, claims.GetUserID()); deleteErr != nil && !errors.Is(deleteErr, ErrSecondFactorNotFound) {
+			logAuthError("auth.mfa.store", deleteErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if enrollment.Confirmed {
+			recordMetric(metricAuthMFADisabled)
+		}
+		contextGin.Status(http.StatusNoContent)
+	})
+
+	router.POST(mfaVerifyPath, func(contextGin *gin.Context) {
+		var inbound struct {
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+		if bindErr := contextGin.BindJSON(&inbound); bindErr != nil {
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.mfa.invalid_json", bindErr)
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+			return
+		}
+		if !configuration.AllowInsecureHTTP && !isHTTPS(contextGin.Request) {
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.login.insecure_http", nil)
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "https_required"})
+			return
+		}
+		now := clock.Now().UTC()
+		if !allowAttempt(contextGin, verificationsPerClient, contextGin.ClientIP(), now) {
+			recordMetric(metricAuthLoginFailure)
+			return
+		}
+
+		// A pending sign-in takes precedence; otherwise the current session
+		// steps up.
+		var applicationUserID string
+		pendingTokenHash := ""
+		if pendingCookie, cookieErr := contextGin.Request.Cookie(mfaPendingCookieName); cookieErr == nil && pendingCookie.Value != "" {
+			pending, lookupErr := resolvePendingSecondFactors().Get(contextGin, hashOpaque(pendingCookie.Value))
+			if lookupErr != nil && !errors.Is(lookupErr, ErrPendingSecondFactorNotFound) {
+				recordMetric(metricAuthLoginFailure)
+				logAuthError("auth.mfa.pending_store", lookupErr)
+				contextGin.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			if lookupErr == nil {
+				applicationUserID, pendingTokenHash = pending.UserID, pending.TokenHash
+			}
+		}
+		if applicationUserID == "" {
+			if claims, validateErr := sessionValidator.ValidateRequest(contextGin.Request); validateErr == nil {
+				applicationUserID = claims.GetUserID()
+			}
+		}
+		if applicationUserID == "" {
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.mfa.not_pending", nil)
+			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "mfa_not_pending"})
+			return
+		}
+		if !allowAttempt(contextGin, verificationsPerUser, applicationUserID, now) {
+			recordMetric(metricAuthLoginFailure)
+			return
+		}
+
+		enrollment, lookupErr := resolveSecondFactors().Get(contextGin, applicationUserID)
+		if errors.Is(lookupErr, ErrSecondFactorNotFound) || (lookupErr == nil && !enrollment.Confirmed) {
+			recordMetric(metricAuthLoginFailure)
+			contextGin.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "totp_not_enrolled"})
+			return
+		}
+		if lookupErr != nil {
+			recordMetric(metricAuthLoginFailure)
+			logAuthError("auth.mfa.store", lookupErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		authMethod, verified := verifySecondFactor(contextGin, now, enrollment, inbound.Code, inbound.RecoveryCode)
+		if !verified {
+			recordMetric(metricAuthLoginFailure)
+			if pendingTokenHash != "" {
+				if failureErr := resolvePendingSecondFactors().RecordFailure(contextGin, pendingTokenHash, mfaMaxPendingAttempts); failureErr != nil && !errors.Is(failureErr, ErrPendingSecondFactorNotFound) {
+					logAuthError("auth.mfa.pending_store", failureErr)
+				}
+			}
+			return
+		}
+
+		userEmail, userDisplayName, userAvatarURL, userRoles, profileErr := users.GetUserProfile(contextGin, applicationUserID)
+		if profileErr != nil {
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.mfa.profile", profileErr)
+			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "mfa_not_pending"})
+			return
+		}
+		if pendingTokenHash != "" {
+			// Deleting the pending sign-in claims it; a concurrent verification loses.
+			deleteErr := resolvePendingSecondFactors().Delete(contextGin, pendingTokenHash)
+			if errors.Is(deleteErr, ErrPendingSecondFactorNotFound) {
+				recordMetric(metricAuthLoginFailure)
+				contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "mfa_not_pending"})
+				return
+			}
+			if deleteErr != nil {
+				recordMetric(metricAuthLoginFailure)
+				logAuthError("auth.mfa.pending_store", deleteErr)
+				contextGin.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			clearMFAPendingCookie(contextGin, configuration)
+		} else {
+			revokeCurrentSession(contextGin, clock, configuration, sessionValidator, refreshTokens)
+		}
+		profile, started := establishSession(contextGin, clock, configuration, refreshTokens, secondFactorAuthMethods(authMethod), applicationUserID, userEmail, userDisplayName, userAvatarURL, userRoles)
+		if !started {
+			return
+		}
+		contextGin.JSON(http.StatusOK, profile)
+	})
+}
+
+// beginSecondFactor withholds the session from a user with a second factor:
+// it records the pending sign-in and hands its token to the browser in an
+// HttpOnly cookie scoped to the MFA routes. respondWithSession answers it with
+// 401 mfa_required.
+func beginSecondFactor(contextGin *gin.Context, clock Clock, configuration ServerConfig, applicationUserID string) (gin.H, bool) {
+	token, tokenErr := newRandomIdentifier()
+	if tokenErr != nil {
+		recordMetric(metricAuthLoginFailure)
+		logAuthError("auth.mfa.pending_issue", tokenErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	pending := PendingSecondFactor{TokenHash: hashOpaque(token), UserID: applicationUserID, ExpiresUnix: clock.Now().UTC().Add(mfaPendingTTL).Unix()}
+	if createErr := resolvePendingSecondFactors().Create(contextGin, pending); createErr != nil {
+		recordMetric(metricAuthLoginFailure)
+		logAuthError("auth.mfa.pending_issue", createErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	http.SetCookie(contextGin.Writer, &http.Cookie{
+		Name:     mfaPendingCookieName,
+		Value:    token,
+		Path:     mfaCookiePath,
+		Domain:   configuration.CookieDomain,
+		MaxAge:   int(mfaPendingTTL.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: configuration.SameSiteMode,
+	})
+	recordMetric(metricAuthMFAChallenged)
+	return gin.H{"error": "mfa_required", "mfa_required": true}, true
+}
+
+func clearMFAPendingCookie(contextGin *gin.Context, configuration ServerConfig) {
+	http.SetCookie(contextGin.Writer, &http.Cookie{
+		Name:     mfaPendingCookieName,
+		Value:    "",
+		Path:     mfaCookiePath,
+		Domain:   configuration.CookieDomain,
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: configuration.SameSiteMode,
+	})
+}
+
+// verifySecondFactor checks exactly one of code and recoveryCode against
+// enrollment and spends it, so neither works twice. It returns the amr value
+// for the method used, or false once the request has failed.
+func verifySecondFactor(contextGin *gin.Context, now time.Time, enrollment TOTPEnrollment, code string, recoveryCode string) (string, bool) {
+	code, recoveryCode = strings.TrimSpace(code), normalizeRecoveryCode(recoveryCode)
+	if (code == "") == (recoveryCode == "") {
+		logAuthWarning("auth.mfa.invalid_json", nil)
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+		return "", false
+	}
+	var authMethod string
+	var useErr error
+	if code != "" {
+		authMethod = sessionvalidator.AuthMethodOTP
+		step, matched := matchTOTPStep(enrollment.Secret, code, now)
+		if !matched {
+			useErr = errSecondFactorRejected
+		} else {
+			useErr = resolveSecondFactors().UseTOTPStep(contextGin, enrollment.UserID, step)
+		}
+	} else {
+		authMethod = sessionvalidator.AuthMethodRecoveryCode
+		useErr = resolveSecondFactors().UseRecoveryCode(contextGin, enrollment.UserID, hashOpaque(recoveryCode))
+	}
+	switch {
+	case errors.Is(useErr, errSecondFactorRejected), errors.Is(useErr, ErrTOTPStepUsed), errors.Is(useErr, ErrRecoveryCodeNotFound), errors.Is(useErr, ErrSecondFactorNotFound):
+		logAuthWarning("auth.mfa.invalid_code", useErr, zap.String("method", authMethod))
+		contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_code"})
+		return "", false
+	case useErr != nil:
+		logAuthError("auth.mfa.store", useErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return "", false
+	}
+	return authMethod, true
+}
+
+// matchTOTPStep returns the time step whose code equals code, allowing
+// totpSkewSteps of clock drift either way.
+func matchTOTPStep(secret string, code string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	currentStep := now.Unix() / totpPeriodSeconds
+	for offset := int64(-totpSkewSteps); offset <= totpSkewSteps; offset++ {
+		step := currentStep + offset
+		expected, generateErr := hotp.GenerateCodeCustom(secret, uint64(step), hotp.ValidateOpts{Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1})
+		if generateErr == nil && subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func secondFactorAuthMethods(authMethod string) []string {
+	return []string{authMethod, sessionvalidator.AuthMethodMFA}
+}
+
+// newRecoveryCodes returns recoveryCodeCount codes formatted as xxxxx-xxxxx
+// together with the hashes the store keeps.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	alphabetSize := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for len(codes) < recoveryCodeCount {
+		var code strings.Builder
+		for position := 0; position < recoveryCodeLength; position++ {
+			index, randomErr := rand.Int(rand.Reader, alphabetSize)
+			if randomErr != nil {
+				return nil, nil, fmt.Errorf("second_factor.random: %w", randomErr)
+			}
+			code.WriteByte(recoveryCodeAlphabet[index.Int64()])
+		}
+		formatted := code.String()[:recoveryCodeLength/2] + "-" + code.String()[recoveryCodeLength/2:]
+		codes = append(codes, formatted)
+		hashes = append(hashes, hashOpaque(normalizeRecoveryCode(formatted)))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode ignores case, spaces, and dashes.
+func normalizeRecoveryCode(rawCode string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(rawCode)))
+}
+
+// sessionClaims returns the claims requireSessionWith stored for the request.
+func sessionClaims(contextGin *gin.Context) (*JwtCustomClaims, bool) {
+	claimsValue, _ := contextGin.Get("auth_claims")
+	claims, _ := claimsValue.(*JwtCustomClaims)
+	if claims == nil || claims.GetUserID() == "" {
+		contextGin.AbortWithStatus(http.StatusUnauthorized)
+		return nil, false
+	}
+	return claims, true
+}
@@ -0,0 +1,165 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrSecondFactorNotFound indicates the user has not enrolled a second factor.
+	ErrSecondFactorNotFound = errors.New("second_factor_store.not_found")
+	// ErrSecondFactorInvalid indicates an enrollment without an owner or secret.
+	ErrSecondFactorInvalid = errors.New("second_factor_store.invalid_enrollment")
+	// ErrTOTPStepUsed indicates a TOTP code for the same or a later time step
+	// was already accepted, so the code cannot be replayed.
+	ErrTOTPStepUsed = errors.New("second_factor_store.totp_step_used")
+	// ErrRecoveryCodeNotFound indicates the recovery code was never issued or was already used.
+	ErrRecoveryCodeNotFound = errors.New("second_factor_store.recovery_code_not_found")
+)
+
+// TOTPEnrollment is a user's TOTP second factor. Secret is the base32 shared
+// secret authenticator apps derive codes from; it only protects sign-ins once
+// Confirmed. Recovery codes are stored as hashOpaque digests and each works once.
+type TOTPEnrollment struct {
+	UserID             string
+	Secret             string
+	Confirmed          bool
+	LastUsedStep       int64
+	RecoveryCodeHashes []string
+	CreatedUnix        int64
+}
+
+// SecondFactorStore persists TOTP enrollments and recovery codes, keyed by
+// application user ID.
+type SecondFactorStore interface {
+	// Get returns the user's enrollment with its unused recovery code hashes.
+	Get(ctx context.Context, applicationUserID string) (TOTPEnrollment, error)
+	// Save creates or replaces the user's enrollment and recovery codes.
+	Save(ctx context.Context, enrollment TOTPEnrollment) error
+	// Delete removes the user's enrollment and recovery codes.
+	Delete(ctx context.Context, applicationUserID string) error
+	// UseTOTPStep records that a code for step was accepted. It fails with
+	// ErrTOTPStepUsed unless step is later than every step accepted before.
+	UseTOTPStep(ctx context.Context, applicationUserID string, step int64) error
+	// UseRecoveryCode removes the user's recovery code hashing to codeHash.
+	UseRecoveryCode(ctx context.Context, applicationUserID string, codeHash string) error
+}
+
+var configuredSecondFactors SecondFactorStore
+
+var defaultSecondFactors struct {
+	sync.Mutex
+	value SecondFactorStore
+}
+
+// ProvideSecondFactorStore injects the store holding TOTP enrollments.
+// Without one, an in-memory store is used.
+func ProvideSecondFactorStore(store SecondFactorStore) {
+	configuredSecondFactors = store
+	defaultSecondFactors.Lock()
+	defaultSecondFactors.value = nil
+	defaultSecondFactors.Unlock()
+}
+
+func resolveSecondFactors() SecondFactorStore {
+	if configuredSecondFactors != nil {
+		return configuredSecondFactors
+	}
+	defaultSecondFactors.Lock()
+	defer defaultSecondFactors.Unlock()
+	if defaultSecondFactors.value == nil {
+		defaultSecondFactors.value = NewMemorySecondFactorStore()
+	}
+	return defaultSecondFactors.value
+}
+
+func validateTOTPEnrollment(enrollment TOTPEnrollment) error {
+	if strings.TrimSpace(enrollment.UserID) == "" || enrollment.Secret == "" {
+		return ErrSecondFactorInvalid
+	}
+	return nil
+}
+
+// MemorySecondFactorStore keeps TOTP enrollments in memory; intended for tests
+// and single-instance deployments.
+type MemorySecondFactorStore struct {
+	mutex       sync.Mutex
+	enrollments map[string]TOTPEnrollment
+}
+
+// NewMemorySecondFactorStore creates an empty in-memory second factor store.
+func NewMemorySecondFactorStore() *MemorySecondFactorStore {
+	return &MemorySecondFactorStore{enrollments: make(map[string]TOTPEnrollment)}
+}
+
+// Get returns the user's enrollment with its unused recovery code hashes.
+func (store *MemorySecondFactorStore) Get(ctx context.Context, applicationUserID string) (TOTPEnrollment, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	enrollment, found := store.enrollments[applicationUserID]
+	if !found {
+		return TOTPEnrollment{}, fmt.Errorf("second_factor_store.get.memory: %w", ErrSecondFactorNotFound)
+	}
+	enrollment.RecoveryCodeHashes = slices.Clone(enrollment.RecoveryCodeHashes)
+	return enrollment, nil
+}
+
+// Save creates or replaces the user's enrollment and recovery codes.
+func (store *MemorySecondFactorStore) Save(ctx context.Context, enrollment TOTPEnrollment) error {
+	if err := validateTOTPEnrollment(enrollment); err != nil {
+		return fmt.Errorf("second_factor_store.save.memory: %w", err)
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	enrollment.RecoveryCodeHashes = slices.Clone(enrollment.RecoveryCodeHashes)
+	store.enrollments[enrollment.UserID] = enrollment
+	return nil
+}
+
+// Delete removes the user's enrollment and recovery codes.
+func (store *MemorySecondFactorStore) Delete(ctx context.Context, applicationUserID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, found := store.enrollments[applicationUserID]; !found {
+		return fmt.Errorf("second_factor_store.delete.memory: %w", ErrSecondFactorNotFound)
+	}
+	delete(store.enrollments, applicationUserID)
+	return nil
+}
+
+// UseTOTPStep records that a code for step was accepted.
+func (store *MemorySecondFactorStore) UseTOTPStep(ctx context.Context, applicationUserID string, step int64) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	enrollment, found := store.enrollments[applicationUserID]
+	if !found {
+		return fmt.Errorf("second_factor_store.use_totp_step.memory: %w", ErrSecondFactorNotFound)
+	}
+	if step <= enrollment.LastUsedStep {
+		return fmt.Errorf("second_factor_store.use_totp_step.memory: %w", ErrTOTPStepUsed)
+	}
+	enrollment.LastUsedStep = step
+	store.enrollments[applicationUserID] = enrollment
+	return nil
+}
+
+// UseRecoveryCode removes the user's recovery code hashing to codeHash.
+func (store *MemorySecondFactorStore) UseRecoveryCode(ctx context.Context, applicationUserID string, codeHash string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	enrollment, found := store.enrollments[applicationUserID]
+	if !found {
+		return fmt.Errorf("second_factor_store.use_recovery_code.memory: %w", ErrSecondFactorNotFound)
+	}
+	codeIndex := slices.Index(enrollment.RecoveryCodeHashes, codeHash)
+	if codeIndex < 0 {
+		return fmt.Errorf("second_factor_store.use_recovery_code.memory: %w", ErrRecoveryCodeNotFound)
+	}
+	enrollment.RecoveryCodeHashes = slices.Delete(slices.Clone(enrollment.RecoveryCodeHashes), codeIndex, codeIndex+1)
+	store.enrollments[applicationUserID] = enrollment
+	return nil
+}
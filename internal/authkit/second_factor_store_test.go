@@ -0,0 +1,116 @@
+package authkit
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func forEachSecondFactorStore(t *testing.T, test func(t *testing.T, store SecondFactorStore)) {
+	t.Helper()
+	forEachStore(t,
+		func() SecondFactorStore { return NewMemorySecondFactorStore() },
+		func(ctx context.Context, gormDB *gorm.DB) (SecondFactorStore, error) {
+			return NewDatabaseSecondFactorStore(ctx, gormDB)
+		},
+		test,
+	)
+}
+
+func saveConfirmedEnrollmentForTest(t *testing.T, store SecondFactorStore, userID string, recoveryCodeHashes ...string) {
+	t.Helper()
+	enrollment := TOTPEnrollment{UserID: userID, Secret: "CONFIRMEDSECRET", Confirmed: true, LastUsedStep: 10, RecoveryCodeHashes: recoveryCodeHashes, CreatedUnix: 100}
+	if err := store.Save(context.Background(), enrollment); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+}
+
+func TestSecondFactorStoreSaveReplacesEnrollment(t *testing.T) {
+	forEachSecondFactorStore(t, func(t *testing.T, store SecondFactorStore) {
+		ctx := context.Background()
+		if err := store.Save(ctx, TOTPEnrollment{UserID: "user-1"}); !errors.Is(err, ErrSecondFactorInvalid) {
+			t.Fatalf("expected ErrSecondFactorInvalid, got %v", err)
+		}
+		if _, err := store.Get(ctx, "user-1"); !errors.Is(err, ErrSecondFactorNotFound) {
+			t.Fatalf("expected ErrSecondFactorNotFound, got %v", err)
+		}
+		if err := store.Save(ctx, TOTPEnrollment{UserID: "user-1", Secret: "PENDINGSECRET", RecoveryCodeHashes: []string{"hash-old"}, CreatedUnix: 100}); err != nil {
+			t.Fatalf("save pending: %v", err)
+		}
+		saveConfirmedEnrollmentForTest(t, store, "user-1", "hash-a", "hash-b")
+
+		fetched, getErr := store.Get(ctx, "user-1")
+		if getErr != nil || !fetched.Confirmed || fetched.Secret != "CONFIRMEDSECRET" || fetched.LastUsedStep != 10 || !slices.Equal(fetched.RecoveryCodeHashes, []string{"hash-a", "hash-b"}) {
+			t.Fatalf("expected the confirmed enrollment, got %+v (%v)", fetched, getErr)
+		}
+		if err := store.UseRecoveryCode(ctx, "user-1", "hash-old"); !errors.Is(err, ErrRecoveryCodeNotFound) {
+			t.Fatalf("expected the replaced recovery codes to be gone, got %v", err)
+		}
+	})
+}
+
+func TestSecondFactorStoreAcceptsEachTOTPStepOnce(t *testing.T) {
+	forEachSecondFactorStore(t, func(t *testing.T, store SecondFactorStore) {
+		ctx := context.Background()
+		saveConfirmedEnrollmentForTest(t, store, "user-1")
+
+		if err := store.UseTOTPStep(ctx, "user-1", 10); !errors.Is(err, ErrTOTPStepUsed) {
+			t.Fatalf("expected a used step to be rejected, got %v", err)
+		}
+		if err := store.UseTOTPStep(ctx, "user-1", 11); err != nil {
+			t.Fatalf("use step: %v", err)
+		}
+		if err := store.UseTOTPStep(ctx, "user-1", 11); !errors.Is(err, ErrTOTPStepUsed) {
+			t.Fatalf("expected a replayed step to be rejected, got %v", err)
+		}
+		if err := store.UseTOTPStep(ctx, "user-1", 9); !errors.Is(err, ErrTOTPStepUsed) {
+			t.Fatalf("expected an earlier step to be rejected, got %v", err)
+		}
+		if err := store.UseTOTPStep(ctx, "user-2", 11); !errors.Is(err, ErrSecondFactorNotFound) {
+			t.Fatalf("expected ErrSecondFactorNotFound for another user, got %v", err)
+		}
+		if fetched, _ := store.Get(ctx, "user-1"); fetched.LastUsedStep != 11 {
+			t.Fatalf("expected step 11 to be recorded, got %+v", fetched)
+		}
+	})
+}
+
+func TestSecondFactorStoreRecoveryCodesAreSingleUse(t *testing.T) {
+	forEachSecondFactorStore(t, func(t *testing.T, store SecondFactorStore) {
+		ctx := context.Background()
+		saveConfirmedEnrollmentForTest(t, store, "user-1", "hash-a", "hash-b")
+
+		if err := store.UseRecoveryCode(ctx, "user-2", "hash-a"); !errors.Is(err, ErrSecondFactorNotFound) && !errors.Is(err, ErrRecoveryCodeNotFound) {
+			t.Fatalf("expected another user's recovery code to be rejected, got %v", err)
+		}
+		if err := store.UseRecoveryCode(ctx, "user-1", "hash-a"); err != nil {
+			t.Fatalf("use recovery code: %v", err)
+		}
+		if err := store.UseRecoveryCode(ctx, "user-1", "hash-a"); !errors.Is(err, ErrRecoveryCodeNotFound) {
+			t.Fatalf("expected a used recovery code to be rejected, got %v", err)
+		}
+		if remaining, _ := store.Get(ctx, "user-1"); !slices.Equal(remaining.RecoveryCodeHashes, []string{"hash-b"}) {
+			t.Fatalf("expected one recovery code left, got %+v", remaining)
+		}
+	})
+}
+
+func TestSecondFactorStoreDeleteRemovesRecoveryCodes(t *testing.T) {
+	forEachSecondFactorStore(t, func(t *testing.T, store SecondFactorStore) {
+		ctx := context.Background()
+		saveConfirmedEnrollmentForTest(t, store, "user-1", "hash-a")
+
+		if err := store.Delete(ctx, "user-1"); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if err := store.Delete(ctx, "user-1"); !errors.Is(err, ErrSecondFactorNotFound) {
+			t.Fatalf("expected ErrSecondFactorNotFound after delete, got %v", err)
+		}
+		if err := store.UseRecoveryCode(ctx, "user-1", "hash-a"); err == nil {
+			t.Fatalf("expected recovery codes to be deleted with the enrollment")
+		}
+	})
+}
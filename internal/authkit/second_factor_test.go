@@ -0,0 +1,230 @@
+package authkit
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+)
+
+// withTOTPForTest enables TOTP second factors.
+func withTOTPForTest(config *ServerConfig) {
+	config.TOTPIssuer = "TAuth Test"
+}
+
+// provideTOTPClockForTest pins the clock to the start of a TOTP time step so
+// codes for it and the next step are accepted throughout the test.
+func provideTOTPClockForTest(t *testing.T) *controllableClock {
+	t.Helper()
+	return provideClockForTest(t, time.Now().UTC().Truncate(totpPeriodSeconds*time.Second))
+}
+
+func totpCodeForTest(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	code, err := totp.GenerateCode(secret, at)
+	if err != nil {
+		t.Fatalf("generate code: %v", err)
+	}
+	return code
+}
+
+// enrollTOTPForTest enrolls the signed-in user and returns the secret, the
+// recovery codes, and the MFA session cookies issued on confirmation.
+func enrollTOTPForTest(t *testing.T, router http.Handler, clock Clock, cookies map[string]*http.Cookie) (string, []string, map[string]*http.Cookie) {
+	t.Helper()
+	enrolled := postForTest(router, totpEnrollPath, nil, cookies, "app_session")
+	secret, _ := enrolled.body["secret"].(string)
+	otpauthURL, _ := enrolled.body["otpauth_url"].(string)
+	if enrolled.status != http.StatusOK || secret == "" || !strings.HasPrefix(otpauthURL, "otpauth://totp/") || !strings.Contains(otpauthURL, "issuer=TAuth") {
+		t.Fatalf("expected a TOTP secret, got %d %v", enrolled.status, enrolled.body)
+	}
+	confirmed := postForTest(router, totpConfirmPath, map[string]string{"code": totpCodeForTest(t, secret, clock.Now())}, cookies, "app_session", "app_refresh")
+	rawCodes, _ := confirmed.body["recovery_codes"].([]interface{})
+	if confirmed.status != http.StatusOK || len(rawCodes) != recoveryCodeCount {
+		t.Fatalf("expected recovery codes on confirmation, got %d %v", confirmed.status, confirmed.body)
+	}
+	recoveryCodes := make([]string, 0, len(rawCodes))
+	for _, rawCode := range rawCodes {
+		recoveryCodes = append(recoveryCodes, rawCode.(string))
+	}
+	return secret, recoveryCodes, confirmed.cookies
+}
+
+// beginSecondFactorLoginForTest signs in a user with a second factor and
+// returns the cookies of the pending sign-in.
+func beginSecondFactorLoginForTest(t *testing.T, router http.Handler, googleSub string) map[string]*http.Cookie {
+	t.Helper()
+	response := signInWithGoogleForTest(t, router, googleSub)
+	if response.Code != http.StatusUnauthorized || !strings.Contains(response.Body.String(), `"error":"mfa_required"`) {
+		t.Fatalf("expected 401 mfa_required from login, got %d %s", response.Code, response.Body.String())
+	}
+	return collectCookies(response.Result().Cookies())
+}
+
+func TestSecondFactorEnrollmentAndSignIn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clock := provideTOTPClockForTest(t)
+	router, config, _ := newAuthRouterForTest(t, withTOTPForTest)
+
+	initialCookies := loginForTest(t, router, "mfa-user")
+	if amr := sessionClaimsForTest(t, config, initialCookies["app_session"]).GetAuthMethods(); len(amr) != 0 {
+		t.Fatalf("expected a session without second factor, got amr %v", amr)
+	}
+	if response := postForTest(router, totpConfirmPath, map[string]string{"code": "000000"}, initialCookies, "app_session"); response.status != http.StatusNotFound || response.body["error"] != "totp_not_enrolled" {
+		t.Fatalf("expected confirmation without enrollment to fail, got %d %v", response.status, response.body)
+	}
+
+	secret, recoveryCodes, mfaCookies := enrollTOTPForTest(t, router, clock, initialCookies)
+	if amr := sessionClaimsForTest(t, config, mfaCookies["app_session"]).GetAuthMethods(); !slices.Equal(amr, []string{sessionvalidator.AuthMethodOTP, sessionvalidator.AuthMethodMFA}) {
+		t.Fatalf("expected confirmation to step up the session, got amr %v", amr)
+	}
+	if response := serveWithCookies(router, http.MethodGet, "/me", nil, initialCookies, "app_session"); response.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the replaced session to be revoked, got %d", response.Code)
+	}
+	if response := postForTest(router, totpEnrollPath, nil, mfaCookies, "app_session"); response.status != http.StatusConflict || response.body["error"] != "totp_already_enabled" {
+		t.Fatalf("expected a second enrollment to conflict, got %d %v", response.status, response.body)
+	}
+
+	refreshed := serveWithCookies(router, http.MethodPost, "/auth/refresh", nil, mfaCookies, "app_refresh")
+	refreshedSession := collectCookies(refreshed.Result().Cookies())["app_session"]
+	if refreshed.Code != http.StatusNoContent || refreshedSession == nil {
+		t.Fatalf("expected refresh to succeed, got %d", refreshed.Code)
+	}
+	if amr := sessionClaimsForTest(t, config, refreshedSession).GetAuthMethods(); !slices.Contains(amr, sessionvalidator.AuthMethodMFA) {
+		t.Fatalf("expected refreshed sessions to keep amr, got %v", amr)
+	}
+
+	pendingCookies := beginSecondFactorLoginForTest(t, router, "mfa-user")
+	if pendingCookies["app_session"] != nil || pendingCookies[mfaPendingCookieName] == nil || !pendingCookies[mfaPendingCookieName].HttpOnly || pendingCookies[mfaPendingCookieName].Path != mfaCookiePath {
+		t.Fatalf("expected only a pending second factor cookie after login, got %v", pendingCookies)
+	}
+	if response := postForTest(router, mfaVerifyPath, map[string]string{"code": totpCodeForTest(t, secret, clock.Now())}, pendingCookies, mfaPendingCookieName); response.status != http.StatusUnauthorized || response.body["error"] != "invalid_code" {
+		t.Fatalf("expected the confirmation code to be spent, got %d %v", response.status, response.body)
+	}
+	verified := postForTest(router, mfaVerifyPath, map[string]string{"code": totpCodeForTest(t, secret, clock.Now().Add(totpPeriodSeconds*time.Second))}, pendingCookies, mfaPendingCookieName)
+	if verified.status != http.StatusOK || verified.body["user_id"] != "google:mfa-user" || verified.cookies["app_session"] == nil || verified.cookies[mfaPendingCookieName].MaxAge >= 0 {
+		t.Fatalf("expected the TOTP code to complete the sign-in, got %d %v", verified.status, verified.body)
+	}
+	if amr := sessionClaimsForTest(t, config, verified.cookies["app_session"]).GetAuthMethods(); !slices.Equal(amr, []string{sessionvalidator.AuthMethodOTP, sessionvalidator.AuthMethodMFA}) {
+		t.Fatalf("expected amr [otp mfa], got %v", amr)
+	}
+
+	recoveryCookies := beginSecondFactorLoginForTest(t, router, "mfa-user")
+	recovered := postForTest(router, mfaVerifyPath, map[string]string{"recovery_code": strings.ToUpper(recoveryCodes[0])}, recoveryCookies, mfaPendingCookieName)
+	if recovered.status != http.StatusOK {
+		t.Fatalf("expected the recovery code to complete the sign-in, got %d", recovered.status)
+	}
+	if amr := sessionClaimsForTest(t, config, recovered.cookies["app_session"]).GetAuthMethods(); !slices.Equal(amr, []string{sessionvalidator.AuthMethodRecoveryCode, sessionvalidator.AuthMethodMFA}) {
+		t.Fatalf("expected amr [recovery_code mfa], got %v", amr)
+	}
+	replayCookies := beginSecondFactorLoginForTest(t, router, "mfa-user")
+	if response := postForTest(router, mfaVerifyPath, map[string]string{"recovery_code": recoveryCodes[0]}, replayCookies, mfaPendingCookieName); response.status != http.StatusUnauthorized || response.body["error"] != "invalid_code" {
+		t.Fatalf("expected a used recovery code to fail, got %d %v", response.status, response.body)
+	}
+
+	if response := postForTest(router, totpDisablePath, map[string]string{"recovery_code": "wrong-codes"}, recovered.cookies, "app_session"); response.status != http.StatusUnauthorized {
+		t.Fatalf("expected disabling with a wrong code to fail, got %d", response.status)
+	}
+	if response := postForTest(router, totpDisablePath, map[string]string{"recovery_code": recoveryCodes[1]}, recovered.cookies, "app_session"); response.status != http.StatusNoContent {
+		t.Fatalf("expected disabling with a recovery code to succeed, got %d", response.status)
+	}
+	if cookies := loginForTest(t, router, "mfa-user"); cookies["app_session"] == nil {
+		t.Fatalf("expected a full session once TOTP is disabled")
+	}
+}
+
+func TestSecondFactorPendingSignInExpiresByTheClock(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clock := provideTOTPClockForTest(t)
+	router, _, _ := newAuthRouterForTest(t, withTOTPForTest)
+	enrollTOTPForTest(t, router, clock, loginForTest(t, router, "mfa-user"))
+
+	clock.Advance(time.Hour)
+	pendingCookie := beginSecondFactorLoginForTest(t, router, "mfa-user")[mfaPendingCookieName]
+	if pendingCookie == nil {
+		t.Fatalf("expected a pending second factor cookie after login")
+	}
+	pending, getErr := resolvePendingSecondFactors().Get(context.Background(), hashOpaque(pendingCookie.Value))
+	if expected := clock.Now().Add(mfaPendingTTL).Unix(); getErr != nil || pending.ExpiresUnix != expected {
+		t.Fatalf("expected the pending sign-in to expire at %d, got %+v (%v)", expected, pending, getErr)
+	}
+}
+
+func TestSecondFactorStepUp(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clock := provideTOTPClockForTest(t)
+	router, config, _ := newAuthRouterForTest(t, withTOTPForTest)
+
+	cookies := loginForTest(t, router, "step-up-user")
+	secret := "JBSWY3DPEHPK3PXP"
+	if err := resolveSecondFactors().Save(context.Background(), TOTPEnrollment{UserID: "google:step-up-user", Secret: secret, Confirmed: true}); err != nil {
+		t.Fatalf("save enrollment: %v", err)
+	}
+
+	steppedUp := postForTest(router, mfaVerifyPath, map[string]string{"code": totpCodeForTest(t, secret, clock.Now())}, cookies, "app_session", "app_refresh")
+	if steppedUp.status != http.StatusOK || steppedUp.cookies["app_session"] == nil {
+		t.Fatalf("expected the session to step up, got %d", steppedUp.status)
+	}
+	if amr := sessionClaimsForTest(t, config, steppedUp.cookies["app_session"]).GetAuthMethods(); !slices.Contains(amr, sessionvalidator.AuthMethodMFA) {
+		t.Fatalf("expected the stepped-up session to carry mfa, got %v", amr)
+	}
+	if response := serveWithCookies(router, http.MethodPost, "/auth/refresh", nil, cookies, "app_refresh"); response.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the previous refresh token to be revoked, got %d", response.Code)
+	}
+}
+
+func TestSecondFactorRejections(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("RoutesRequireIssuer", func(t *testing.T) {
+		router, _, _ := newAuthRouterForTest(t, nil)
+		if response := serveWithCookies(router, http.MethodPost, mfaVerifyPath, []byte(`{"code":"123456"}`), nil); response.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 without a TOTP issuer, got %d", response.Code)
+		}
+	})
+
+	t.Run("NothingPending", func(t *testing.T) {
+		router, _, _ := newAuthRouterForTest(t, withTOTPForTest)
+		if response := postForTest(router, mfaVerifyPath, map[string]string{"code": "123456"}, nil); response.status != http.StatusUnauthorized || response.body["error"] != "mfa_not_pending" {
+			t.Fatalf("expected mfa_not_pending, got %d %v", response.status, response.body)
+		}
+		if response := postForTest(router, totpEnrollPath, nil, nil); response.status != http.StatusUnauthorized {
+			t.Fatalf("expected enrollment to require a session, got %d", response.status)
+		}
+	})
+
+	t.Run("PendingWithdrawnAfterWrongCodes", func(t *testing.T) {
+		clock := provideTOTPClockForTest(t)
+		router, _, _ := newAuthRouterForTest(t, withTOTPForTest)
+		secret := "JBSWY3DPEHPK3PXP"
+		if err := resolveSecondFactors().Save(context.Background(), TOTPEnrollment{UserID: "google:guessing-user", Secret: secret, Confirmed: true}); err != nil {
+			t.Fatalf("save enrollment: %v", err)
+		}
+		pendingCookies := beginSecondFactorLoginForTest(t, router, "guessing-user")
+		for attempt := 0; attempt < mfaMaxPendingAttempts; attempt++ {
+			if response := postForTest(router, mfaVerifyPath, map[string]string{"code": "000000"}, pendingCookies, mfaPendingCookieName); response.status != http.StatusUnauthorized {
+				t.Fatalf("expected wrong code %d to fail, got %d", attempt, response.status)
+			}
+		}
+		if response := postForTest(router, mfaVerifyPath, map[string]string{"code": totpCodeForTest(t, secret, clock.Now())}, pendingCookies, mfaPendingCookieName); response.status != http.StatusUnauthorized || response.body["error"] != "mfa_not_pending" {
+			t.Fatalf("expected the pending sign-in to be withdrawn, got %d %v", response.status, response.body)
+		}
+	})
+
+	t.Run("BothFactorsInOneRequest", func(t *testing.T) {
+		router, _, _ := newAuthRouterForTest(t, withTOTPForTest)
+		if err := resolveSecondFactors().Save(context.Background(), TOTPEnrollment{UserID: "google:greedy-user", Secret: "JBSWY3DPEHPK3PXP", Confirmed: true}); err != nil {
+			t.Fatalf("save enrollment: %v", err)
+		}
+		pendingCookies := beginSecondFactorLoginForTest(t, router, "greedy-user")
+		if response := postForTest(router, mfaVerifyPath, map[string]string{"code": "123456", "recovery_code": "abcde-fghjk"}, pendingCookies, mfaPendingCookieName); response.status != http.StatusBadRequest || response.body["error"] != "invalid_json" {
+			t.Fatalf("expected invalid_json, got %d %v", response.status, response.body)
+		}
+	})
+}
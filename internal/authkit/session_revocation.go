@@ -0,0 +1,110 @@
+package authkit
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+)
+
+const (
+	revocationsPath   = "/auth/revocations"
+	revokeSessionPath = "/auth/sessions/revoke"
+	adminRole         = "admin"
+)
+
+var configuredRevocations SessionRevocationStore
+
+var defaultRevocations struct {
+	sync.Mutex
+	value SessionRevocationStore
+}
+
+// ProvideSessionRevocationStore injects the store recording revoked sessions.
+// Without one, an in-memory store shared by the auth routes and RequireSession is used.
+func ProvideSessionRevocationStore(store SessionRevocationStore) {
+	configuredRevocations = store
+	defaultRevocations.Lock()
+	defaultRevocations.value = nil
+	defaultRevocations.Unlock()
+}
+
+func resolveSessionRevocations() SessionRevocationStore {
+	if configuredRevocations != nil {
+		return configuredRevocations
+	}
+	defaultRevocations.Lock()
+	defer defaultRevocations.Unlock()
+	if defaultRevocations.value == nil {
+		defaultRevocations.value = NewMemorySessionRevocationStore()
+	}
+	return defaultRevocations.value
+}
+
+// sessionRevocationChecker lets the session validator consult the revocation
+// store resolved at request time.
+type sessionRevocationChecker struct{}
+
+func (sessionRevocationChecker) IsRevoked(ctx context.Context, claims *sessionvalidator.Claims) (bool, error) {
+	return resolveSessionRevocations().IsRevoked(ctx, claims.GetSessionID(), claims.ID)
+}
+
+// sessionRevocationDeadline is when a revocation made now stops mattering:
+// every session token minted before it has expired by then.
+func sessionRevocationDeadline(clock Clock, configuration ServerConfig) int64 {
+	return clock.Now().UTC().Add(configuration.SessionTTL).Unix()
+}
+
+// handleRevocations serves the revocation list to sessionvalidator's cached
+// checker, or the status of a single sid/jti to its remote checker.
+func handleRevocations() gin.HandlerFunc {
+	return func(contextGin *gin.Context) {
+		revocations := resolveSessionRevocations()
+		contextGin.Header("Cache-Control", "no-store")
+		sessionID := strings.TrimSpace(contextGin.Query("sid"))
+		tokenID := strings.TrimSpace(contextGin.Query("jti"))
+		if sessionID != "" || tokenID != "" {
+			revoked, checkErr := revocations.IsRevoked(contextGin, sessionID, tokenID)
+			if checkErr != nil {
+				logAuthError("auth.revocations.check", checkErr)
+				contextGin.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			contextGin.JSON(http.StatusOK, gin.H{"revoked": revoked})
+			return
+		}
+		sessionIDs, tokenIDs, listErr := revocations.ListRevoked(contextGin)
+		if listErr != nil {
+			logAuthError("auth.revocations.list", listErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		contextGin.JSON(http.StatusOK, gin.H{"session_ids": sessionIDs, "token_ids": tokenIDs})
+	}
+}
+
+// handleRevokeSession lets administrators end another user's session. The
+// revocation outlives the refresh token family so the session cannot be renewed.
+func handleRevokeSession(clock Clock, configuration ServerConfig) gin.HandlerFunc {
+	return func(contextGin *gin.Context) {
+		var inbound struct {
+			SessionID string `json:"session_id"`
+		}
+		if err := contextGin.BindJSON(&inbound); err != nil || strings.TrimSpace(inbound.SessionID) == "" {
+			logAuthWarning("auth.sessions.revoke.invalid_json", err)
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+			return
+		}
+		deadline := clock.Now().UTC().Add(max(configuration.SessionTTL, configuration.RefreshTTL)).Unix()
+		if revokeErr := resolveSessionRevocations().RevokeSession(contextGin, inbound.SessionID, deadline); revokeErr != nil {
+			logAuthError("auth.sessions.revoke", revokeErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		recordMetric(metricAuthSessionRevoked)
+		contextGin.Status(http.StatusNoContent)
+	}
+}
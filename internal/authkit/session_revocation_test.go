@@ -0,0 +1,374 @@
+package authkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+	"google.golang.org/api/idtoken"
+)
+
+func loginForTest(t *testing.T, router http.Handler, googleSub string) map[string]*http.Cookie {
+	t.Helper()
+	response := signInWithGoogleForTest(t, router, googleSub)
+	if response.Code != http.StatusOK {
+		t.Fatalf("expected 200 from login, got %d", response.Code)
+	}
+	return collectCookies(response.Result().Cookies())
+}
+
+// signInWithGoogleForTest posts a valid Google ID token for googleSub and
+// returns the response without judging it.
+func signInWithGoogleForTest(t *testing.T, router http.Handler, googleSub string) *httptest.ResponseRecorder {
+	t.Helper()
+	payload := &idtoken.Payload{Claims: map[string]interface{}{
+		"iss":            "https://accounts.google.com",
+		"sub":            googleSub,
+		"email":          googleSub + "@example.com",
+		"email_verified": true,
+		"name":           "Test User",
+	}}
+	ProvideGoogleTokenValidator(&fakeGoogleValidator{results: map[string]validatorResult{
+		"valid-token": {payload: payload, expectedAudience: "client-id"},
+	}})
+	body := prepareLoginBody(t, router, payload, "valid-token")
+	request := httptest.NewRequest(http.MethodPost, "/auth/google", bytes.NewBuffer(body))
+	request.Header.Set("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	return response
+}
+
+func sessionClaimsForTest(t *testing.T, config ServerConfig, sessionCookie *http.Cookie) *sessionvalidator.Claims {
+	t.Helper()
+	validatorConfig := config.sessionValidatorConfig()
+	validatorConfig.RevocationChecker = nil
+	validator, err := sessionvalidator.New(validatorConfig)
+	if err != nil {
+		t.Fatalf("new validator: %v", err)
+	}
+	claims, err := validator.ValidateToken(sessionCookie.Value)
+	if err != nil {
+		t.Fatalf("validate session: %v", err)
+	}
+	return claims
+}
+
+func TestSessionTokensCarrySessionAndTokenIDs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer ProvideGoogleTokenValidator(nil)
+	ProvideSessionRevocationStore(NewMemorySessionRevocationStore())
+	defer ProvideSessionRevocationStore(nil)
+
+	config := newTestServerConfig()
+	router := gin.New()
+	MountAuthRoutes(router, config, newTestUserStore(), NewMemoryRefreshTokenStore(), nil)
+
+	cookies := loginForTest(t, router, "sub-sid")
+	loginClaims := sessionClaimsForTest(t, config, cookies[config.SessionCookieName])
+	if loginClaims.GetSessionID() == "" || loginClaims.ID == "" {
+		t.Fatalf("expected sid and jti in session token, got sid=%q jti=%q", loginClaims.GetSessionID(), loginClaims.ID)
+	}
+
+	refreshResponse := serveWithCookies(router, http.MethodPost, "/auth/refresh", nil, cookies, config.RefreshCookieName)
+	if refreshResponse.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 from refresh, got %d", refreshResponse.Code)
+	}
+	refreshedClaims := sessionClaimsForTest(t, config, collectCookies(refreshResponse.Result().Cookies())[config.SessionCookieName])
+	if refreshedClaims.GetSessionID() != loginClaims.GetSessionID() {
+		t.Fatalf("expected refresh to keep sid %q, got %q", loginClaims.GetSessionID(), refreshedClaims.GetSessionID())
+	}
+	if refreshedClaims.ID == loginClaims.ID {
+		t.Fatalf("expected a fresh jti after refresh")
+	}
+}
+
+func TestLogoutRevokesSessionImmediately(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer ProvideGoogleTokenValidator(nil)
+	revocations := NewMemorySessionRevocationStore()
+	ProvideSessionRevocationStore(revocations)
+	defer ProvideSessionRevocationStore(nil)
+
+	config := newTestServerConfig()
+	router := gin.New()
+	MountAuthRoutes(router, config, newTestUserStore(), NewMemoryRefreshTokenStore(), nil)
+
+	cookies := loginForTest(t, router, "sub-logout")
+	claims := sessionClaimsForTest(t, config, cookies[config.SessionCookieName])
+	if response := serveWithCookies(router, http.MethodGet, "/me", nil, cookies, config.SessionCookieName); response.Code != http.StatusOK {
+		t.Fatalf("expected 200 from /me before logout, got %d", response.Code)
+	}
+
+	logoutResponse := serveWithCookies(router, http.MethodPost, "/auth/logout", nil, cookies, config.SessionCookieName, config.RefreshCookieName)
+	if logoutResponse.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 from logout, got %d", logoutResponse.Code)
+	}
+	if response := serveWithCookies(router, http.MethodGet, "/me", nil, cookies, config.SessionCookieName); response.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the old session cookie to be rejected after logout, got %d", response.Code)
+	}
+
+	listResponse := serveWithCookies(router, http.MethodGet, revocationsPath, nil, nil)
+	var list struct {
+		SessionIDs []string `json:"session_ids"`
+		TokenIDs   []string `json:"token_ids"`
+	}
+	if err := json.Unmarshal(listResponse.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode revocation list: %v", err)
+	}
+	if !slices.Contains(list.SessionIDs, claims.GetSessionID()) || !slices.Contains(list.TokenIDs, claims.ID) {
+		t.Fatalf("expected sid and jti in revocation list, got %+v", list)
+	}
+	statusResponse := serveWithCookies(router, http.MethodGet, revocationsPath+"?sid="+claims.GetSessionID(), nil, nil)
+	if statusResponse.Body.String() != `{"revoked":true}` {
+		t.Fatalf("unexpected revocation status %s", statusResponse.Body.String())
+	}
+}
+
+type recordingRevocationStore struct {
+	SessionRevocationStore
+	revokedTokenIDs []string
+}
+
+func (store *recordingRevocationStore) RevokeToken(ctx context.Context, tokenID string, expiresUnix int64) error {
+	store.revokedTokenIDs = append(store.revokedTokenIDs, tokenID)
+	return store.SessionRevocationStore.RevokeToken(ctx, tokenID, expiresUnix)
+}
+
+func TestLogoutSkipsTokenRevocationWithoutTokenID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	revocations := &recordingRevocationStore{SessionRevocationStore: NewMemorySessionRevocationStore()}
+	ProvideSessionRevocationStore(revocations)
+	defer ProvideSessionRevocationStore(nil)
+
+	config := newTestServerConfig()
+	router := gin.New()
+	MountAuthRoutes(router, config, newTestUserStore(), NewMemoryRefreshTokenStore(), nil)
+
+	current := time.Now().UTC()
+	legacyToken, signErr := config.AppJWTKeyring.ActiveKey().sign(jwt.NewWithClaims(config.AppJWTKeyring.ActiveKey().method, JwtCustomClaims{
+		UserID: "legacy-user",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.AppJWTIssuer,
+			Subject:   "legacy-user",
+			IssuedAt:  jwt.NewNumericDate(current),
+			NotBefore: jwt.NewNumericDate(current),
+			ExpiresAt: jwt.NewNumericDate(current.Add(config.SessionTTL)),
+		},
+	}))
+	if signErr != nil {
+		t.Fatalf("sign legacy token: %v", signErr)
+	}
+	cookies := map[string]*http.Cookie{config.SessionCookieName: {Name: config.SessionCookieName, Value: legacyToken}}
+	if response := serveWithCookies(router, http.MethodPost, "/auth/logout", nil, cookies, config.SessionCookieName); response.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 from logout, got %d", response.Code)
+	}
+	if len(revocations.revokedTokenIDs) != 0 {
+		t.Fatalf("expected no token revocation for a session without jti, got %q", revocations.revokedTokenIDs)
+	}
+}
+
+func TestAdminRevokesAnotherSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer ProvideGoogleTokenValidator(nil)
+	ProvideSessionRevocationStore(NewMemorySessionRevocationStore())
+	defer ProvideSessionRevocationStore(nil)
+
+	config := newTestServerConfig()
+	router := gin.New()
+	MountAuthRoutes(router, config, newTestUserStore(), NewMemoryRefreshTokenStore(), nil)
+
+	userCookies := loginForTest(t, router, "sub-target")
+	userClaims := sessionClaimsForTest(t, config, userCookies[config.SessionCookieName])
+	body, err := json.Marshal(map[string]string{"session_id": userClaims.GetSessionID()})
+	if err != nil {
+		t.Fatalf("marshal body: %v", err)
+	}
+
+	forbidden := serveWithCookies(router, http.MethodPost, revokeSessionPath, body, userCookies, config.SessionCookieName)
+	if forbidden.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin revocation, got %d", forbidden.Code)
+	}
+
+	adminToken, _, mintErr := mintSessionToken(NewSystemClock(), config, "admin-session", nil, time.Time{}, "admin-1", "admin@example.com", "Admin", "", []string{adminRole}, nil)
+	if mintErr != nil {
+		t.Fatalf("mint admin token: %v", mintErr)
+	}
+	adminCookies := map[string]*http.Cookie{config.SessionCookieName: {Name: config.SessionCookieName, Value: adminToken}}
+	revokeResponse := serveWithCookies(router, http.MethodPost, revokeSessionPath, body, adminCookies, config.SessionCookieName)
+	if revokeResponse.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 from admin revocation, got %d", revokeResponse.Code)
+	}
+
+	if response := serveWithCookies(router, http.MethodGet, "/me", nil, userCookies, config.SessionCookieName); response.Code != http.StatusUnauthorized {
+		t.Fatalf("expected revoked session to be rejected, got %d", response.Code)
+	}
+	if response := serveWithCookies(router, http.MethodPost, "/auth/refresh", nil, userCookies, config.RefreshCookieName); response.Code != http.StatusUnauthorized {
+		t.Fatalf("expected revoked session to be unable to refresh, got %d", response.Code)
+	}
+}
+
+func TestSessionRevocationStores(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name  string
+		store func(t *testing.T) SessionRevocationStore
+	}{
+		{
+			name: "memory",
+			store: func(t *testing.T) SessionRevocationStore {
+				return NewMemorySessionRevocationStore()
+			},
+		},
+		{
+			name: "sqlite",
+			store: func(t *testing.T) SessionRevocationStore {
+				store, err := NewDatabaseSessionRevocationStore(context.Background(), openTestDatabase(t))
+				if err != nil {
+					t.Fatalf("failed to create sqlite store: %v", err)
+				}
+				return store
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			store := testCase.store(t)
+			ctx := context.Background()
+			future := time.Now().Add(time.Hour).Unix()
+			past := time.Now().Add(-time.Hour).Unix()
+
+			if err := store.RevokeSession(ctx, "session-live", future); err != nil {
+				t.Fatalf("revoke session: %v", err)
+			}
+			if err := store.RevokeSession(ctx, "session-live", past); err != nil {
+				t.Fatalf("re-revoke session: %v", err)
+			}
+			if err := store.RevokeToken(ctx, "token-live", future); err != nil {
+				t.Fatalf("revoke token: %v", err)
+			}
+			if err := store.RevokeSession(ctx, "session-expired", past); err != nil {
+				t.Fatalf("revoke expired session: %v", err)
+			}
+			if err := store.RevokeToken(ctx, " ", future); !errors.Is(err, ErrRevocationEmptyIdentifier) {
+				t.Fatalf("expected empty identifier error, got %v", err)
+			}
+
+			checks := []struct {
+				sessionID string
+				tokenID   string
+				revoked   bool
+			}{
+				{sessionID: "session-live", revoked: true},
+				{sessionID: "session-other", tokenID: "token-live", revoked: true},
+				{sessionID: "session-expired"},
+				{sessionID: "session-other", tokenID: "token-other"},
+				{},
+			}
+			for _, check := range checks {
+				revoked, err := store.IsRevoked(ctx, check.sessionID, check.tokenID)
+				if err != nil || revoked != check.revoked {
+					t.Fatalf("IsRevoked(%q, %q) = %v, %v; want %v", check.sessionID, check.tokenID, revoked, err, check.revoked)
+				}
+			}
+
+			sessionIDs, tokenIDs, err := store.ListRevoked(ctx)
+			if err != nil {
+				t.Fatalf("list revoked: %v", err)
+			}
+			if !slices.Equal(sessionIDs, []string{"session-live"}) || !slices.Equal(tokenIDs, []string{"token-live"}) {
+				t.Fatalf("unexpected revocation list sessions=%v tokens=%v", sessionIDs, tokenIDs)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenStoresInheritSessionID(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name  string
+		store func(t *testing.T) RefreshTokenStore
+	}{
+		{
+			name: "memory",
+			store: func(t *testing.T) RefreshTokenStore {
+				return NewMemoryRefreshTokenStore()
+			},
+		},
+		{
+			name: "sqlite",
+			store: func(t *testing.T) RefreshTokenStore {
+				store, err := NewDatabaseRefreshTokenStore(context.Background(), openTestDatabase(t))
+				if err != nil {
+					t.Fatalf("failed to create sqlite store: %v", err)
+				}
+				return store
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			store := testCase.store(t)
+			ctx := context.Background()
+			expiry := time.Now().Add(time.Hour).Unix()
+
+			firstID, _, err := store.Issue(ctx, "user", expiry, "", []string{"otp", "mfa"}, "cli", 1700000000)
+			if err != nil {
+				t.Fatalf("issue: %v", err)
+			}
+			rotatedID, _, err := store.Issue(ctx, "user", expiry, firstID, nil, "", 1800000000)
+			if err != nil {
+				t.Fatalf("issue rotated: %v", err)
+			}
+			otherID, _, err := store.Issue(ctx, "user", expiry, "", nil, "", 1800000000)
+			if err != nil {
+				t.Fatalf("issue other: %v", err)
+			}
+			firstSession, _ := store.SessionID(ctx, firstID)
+			rotatedSession, _ := store.SessionID(ctx, rotatedID)
+			otherSession, _ := store.SessionID(ctx, otherID)
+			if firstSession == "" || firstSession != rotatedSession {
+				t.Fatalf("expected rotated token to inherit session %q, got %q", firstSession, rotatedSession)
+			}
+			if otherSession == firstSession {
+				t.Fatalf("expected a new login to start a new session")
+			}
+			rotatedMethods, _ := store.AuthMethods(ctx, rotatedID)
+			otherMethods, _ := store.AuthMethods(ctx, otherID)
+			if !slices.Equal(rotatedMethods, []string{"otp", "mfa"}) || len(otherMethods) != 0 {
+				t.Fatalf("expected rotated token to inherit auth methods, got %v and %v", rotatedMethods, otherMethods)
+			}
+			rotatedClient, _ := store.ClientID(ctx, rotatedID)
+			otherClient, _ := store.ClientID(ctx, otherID)
+			if rotatedClient != "cli" || otherClient != "" {
+				t.Fatalf("expected rotated token to inherit its client, got %q and %q", rotatedClient, otherClient)
+			}
+			rotatedAuthTime, _ := store.AuthTime(ctx, rotatedID)
+			otherAuthTime, _ := store.AuthTime(ctx, otherID)
+			if rotatedAuthTime != 1700000000 || otherAuthTime != 1800000000 {
+				t.Fatalf("expected rotated token to inherit its sign-in time, got %d and %d", rotatedAuthTime, otherAuthTime)
+			}
+			if _, err := store.SessionID(ctx, "missing"); !errors.Is(err, ErrRefreshTokenNotFound) {
+				t.Fatalf("expected not found for unknown token, got %v", err)
+			}
+			if _, _, err := store.Issue(ctx, "user", expiry, "missing", nil, "", 0); !errors.Is(err, ErrRefreshTokenNotFound) {
+				t.Fatalf("expected not found for unknown previous token, got %v", err)
+			}
+		})
+	}
+}
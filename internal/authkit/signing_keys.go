@@ -0,0 +1,181 @@
+package authkit
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+)
+
+const hmacKeyIDLength = 16
+
+var (
+	// ErrEmptySigningSecret indicates an HS256 signing secret was not provided.
+	ErrEmptySigningSecret = errors.New("signing_key.empty_secret")
+	// ErrInvalidPrivateKeyPEM indicates the PEM payload does not contain a supported private key.
+	ErrInvalidPrivateKeyPEM = errors.New("signing_key.invalid_pem")
+	// ErrInvalidPublicKeyPEM indicates the PEM payload does not contain a supported public key.
+	ErrInvalidPublicKeyPEM = errors.New("signing_key.invalid_public_pem")
+	// ErrEmptyKeyID indicates a key identifier override was blank.
+	ErrEmptyKeyID = errors.New("signing_key.empty_key_id")
+)
+
+// SigningKey pairs a JWT signing method with the key material used to mint and
+// verify sessions. Keys parsed from public PEM blocks can only verify.
+type SigningKey struct {
+	method     jwt.SigningMethod
+	keyID      string
+	privateKey interface{}
+	publicKey  crypto.PublicKey
+}
+
+// NewHMACSigningKey constructs an HS256 signing key from a shared secret. The
+// default key ID is derived from the secret without revealing it.
+func NewHMACSigningKey(secret []byte) (SigningKey, error) {
+	if len(secret) == 0 {
+		return SigningKey{}, fmt.Errorf("signing_key.hmac: %w", ErrEmptySigningSecret)
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("tauth.key_id"))
+	keyID := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))[:hmacKeyIDLength]
+	return SigningKey{method: jwt.SigningMethodHS256, keyID: keyID, privateKey: secret}, nil
+}
+
+// ParsePrivateKeyPEM constructs an asymmetric signing key from a PEM-encoded
+// RSA (RS256), ECDSA (ES256/ES384/ES512), or Ed25519 (EdDSA) private key.
+func ParsePrivateKeyPEM(pemBytes []byte) (SigningKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return SigningKey{}, fmt.Errorf("signing_key.pem: %w", ErrInvalidPrivateKeyPEM)
+	}
+	var parsed interface{}
+	var parseErr error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, parseErr = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, parseErr = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, parseErr = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return SigningKey{}, fmt.Errorf("signing_key.pem.%s: %w", block.Type, ErrInvalidPrivateKeyPEM)
+	}
+	if parseErr != nil {
+		return SigningKey{}, fmt.Errorf("signing_key.pem: %w: %v", ErrInvalidPrivateKeyPEM, parseErr)
+	}
+	return NewAsymmetricSigningKey(parsed)
+}
+
+// ParsePublicKeyPEM constructs a verification-only key from a PEM-encoded
+// PKIX public key. Such keys may sit in a keyring but never mint tokens.
+func ParsePublicKeyPEM(pemBytes []byte) (SigningKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return SigningKey{}, fmt.Errorf("signing_key.public_pem: %w", ErrInvalidPublicKeyPEM)
+	}
+	publicKey, parseErr := x509.ParsePKIXPublicKey(block.Bytes)
+	if parseErr != nil {
+		return SigningKey{}, fmt.Errorf("signing_key.public_pem: %w: %v", ErrInvalidPublicKeyPEM, parseErr)
+	}
+	return newPublicSigningKey(nil, publicKey)
+}
+
+// NewAsymmetricSigningKey wraps an RSA, ECDSA, or Ed25519 private key. The
+// default key ID is the RFC 7638 thumbprint of the public key.
+func NewAsymmetricSigningKey(privateKey interface{}) (SigningKey, error) {
+	var publicKey crypto.PublicKey
+	switch typedKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		publicKey = &typedKey.PublicKey
+	case *ecdsa.PrivateKey:
+		publicKey = &typedKey.PublicKey
+	case ed25519.PrivateKey:
+		publicKey = typedKey.Public()
+	default:
+		return SigningKey{}, fmt.Errorf("signing_key.asymmetric: %w", ErrInvalidPrivateKeyPEM)
+	}
+	return newPublicSigningKey(privateKey, publicKey)
+}
+
+func newPublicSigningKey(privateKey interface{}, publicKey crypto.PublicKey) (SigningKey, error) {
+	algorithm, algorithmErr := sessionvalidator.AlgorithmForPublicKey(publicKey)
+	if algorithmErr != nil {
+		return SigningKey{}, fmt.Errorf("signing_key.asymmetric: %w", algorithmErr)
+	}
+	webKey, webKeyErr := sessionvalidator.NewJSONWebKey(publicKey, "")
+	if webKeyErr != nil {
+		return SigningKey{}, fmt.Errorf("signing_key.asymmetric: %w", webKeyErr)
+	}
+	return SigningKey{
+		method:     jwt.GetSigningMethod(algorithm),
+		keyID:      webKey.Thumbprint(),
+		privateKey: privateKey,
+		publicKey:  publicKey,
+	}, nil
+}
+
+// WithKeyID returns a copy of the key that advertises the provided kid.
+func (key SigningKey) WithKeyID(keyID string) (SigningKey, error) {
+	if strings.TrimSpace(keyID) == "" {
+		return SigningKey{}, fmt.Errorf("signing_key.key_id: %w", ErrEmptyKeyID)
+	}
+	key.keyID = keyID
+	return key, nil
+}
+
+// KeyID returns the identifier carried in the kid header of minted tokens.
+func (key SigningKey) KeyID() string {
+	return key.keyID
+}
+
+// Algorithm returns the JWS algorithm identifier, e.g. HS256 or RS256.
+func (key SigningKey) Algorithm() string {
+	if key.method == nil {
+		return ""
+	}
+	return key.method.Alg()
+}
+
+// PublicKey returns the verification key, or nil for HMAC secrets.
+func (key SigningKey) PublicKey() crypto.PublicKey {
+	return key.publicKey
+}
+
+// IsSymmetric reports whether the key is a shared HMAC secret.
+func (key SigningKey) IsSymmetric() bool {
+	return key.publicKey == nil
+}
+
+// CanSign reports whether the key holds private material for minting tokens.
+func (key SigningKey) CanSign() bool {
+	return key.method != nil && key.privateKey != nil
+}
+
+func (key SigningKey) verificationKey() sessionvalidator.VerificationKey {
+	if key.IsSymmetric() {
+		secret, _ := key.privateKey.([]byte)
+		return sessionvalidator.VerificationKey{KeyID: key.keyID, SigningKey: secret}
+	}
+	return sessionvalidator.VerificationKey{KeyID: key.keyID, PublicKey: key.publicKey}
+}
+
+func (key SigningKey) sign(token *jwt.Token) (string, error) {
+	if !key.CanSign() {
+		return "", ErrEmptySigningSecret
+	}
+	if key.keyID != "" {
+		token.Header["kid"] = key.keyID
+	}
+	return token.SignedString(key.privateKey)
+}
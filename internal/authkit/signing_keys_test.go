@@ -0,0 +1,124 @@
+package authkit
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+)
+
+func encodePrivateKeyPEM(t *testing.T, blockType string, der []byte) []byte {
+	t.Helper()
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func TestParsePrivateKeyPEMSupportedAlgorithms(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, rsaErr := rsa.GenerateKey(rand.Reader, 2048)
+	if rsaErr != nil {
+		t.Fatalf("generate rsa key: %v", rsaErr)
+	}
+	ecKey, ecErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if ecErr != nil {
+		t.Fatalf("generate ecdsa key: %v", ecErr)
+	}
+	ecDER, ecMarshalErr := x509.MarshalECPrivateKey(ecKey)
+	if ecMarshalErr != nil {
+		t.Fatalf("marshal ecdsa key: %v", ecMarshalErr)
+	}
+	_, edKey, edErr := ed25519.GenerateKey(rand.Reader)
+	if edErr != nil {
+		t.Fatalf("generate ed25519 key: %v", edErr)
+	}
+	edDER, edMarshalErr := x509.MarshalPKCS8PrivateKey(edKey)
+	if edMarshalErr != nil {
+		t.Fatalf("marshal ed25519 key: %v", edMarshalErr)
+	}
+
+	testCases := []struct {
+		name              string
+		pemBytes          []byte
+		expectedAlgorithm string
+	}{
+		{name: "RSAPKCS1", pemBytes: encodePrivateKeyPEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)), expectedAlgorithm: "RS256"},
+		{name: "ECDSA", pemBytes: encodePrivateKeyPEM(t, "EC PRIVATE KEY", ecDER), expectedAlgorithm: "ES256"},
+		{name: "Ed25519PKCS8", pemBytes: encodePrivateKeyPEM(t, "PRIVATE KEY", edDER), expectedAlgorithm: "EdDSA"},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			signingKey, err := ParsePrivateKeyPEM(testCase.pemBytes)
+			if err != nil {
+				t.Fatalf("parse pem: %v", err)
+			}
+			if signingKey.Algorithm() != testCase.expectedAlgorithm {
+				t.Fatalf("expected %s, got %s", testCase.expectedAlgorithm, signingKey.Algorithm())
+			}
+			if signingKey.IsSymmetric() {
+				t.Fatalf("expected asymmetric signing key")
+			}
+
+			token, _, mintErr := MintAppJWT(fixedClock{timestamp: time.Now().UTC()}, "user-123", "user@example.com", "User", "", []string{"user"}, "issuer", nil, signingKey, time.Minute)
+			if mintErr != nil {
+				t.Fatalf("mint token: %v", mintErr)
+			}
+			keySet, keySetErr := mustKeyring(signingKey).PublicKeySet()
+			if keySetErr != nil {
+				t.Fatalf("public key set: %v", keySetErr)
+			}
+			validator, validatorErr := sessionvalidator.New(sessionvalidator.Config{KeySet: keySet, Issuer: "issuer"})
+			if validatorErr != nil {
+				t.Fatalf("validator: %v", validatorErr)
+			}
+			claims, validateErr := validator.ValidateToken(token)
+			if validateErr != nil {
+				t.Fatalf("validate token against published key set: %v", validateErr)
+			}
+			if claims.GetUserID() != "user-123" {
+				t.Fatalf("unexpected user id %q", claims.GetUserID())
+			}
+		})
+	}
+}
+
+func TestParsePrivateKeyPEMRejectsInvalidInput(t *testing.T) {
+	t.Parallel()
+
+	inputs := map[string][]byte{
+		"NotPEM":          []byte("not a pem"),
+		"PublicKeyBlock":  pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte{1, 2, 3}}),
+		"CorruptedRSADER": pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte{1, 2, 3}}),
+	}
+	for name, input := range inputs {
+		if _, err := ParsePrivateKeyPEM(input); !errors.Is(err, ErrInvalidPrivateKeyPEM) {
+			t.Fatalf("%s: expected ErrInvalidPrivateKeyPEM, got %v", name, err)
+		}
+	}
+}
+
+func TestHMACSigningKeyPublishesEmptyKeySet(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewHMACSigningKey(nil); !errors.Is(err, ErrEmptySigningSecret) {
+		t.Fatalf("expected ErrEmptySigningSecret, got %v", err)
+	}
+	signingKey := mustHMACSigningKey("secret")
+	keySet, err := mustKeyring(signingKey).PublicKeySet()
+	if err != nil {
+		t.Fatalf("public key set: %v", err)
+	}
+	if len(keySet.Keys) != 0 {
+		t.Fatalf("expected no public keys for HMAC secret, got %d", len(keySet.Keys))
+	}
+}
@@ -2,15 +2,36 @@ package authkit
 
 import "context"
 
-// UserStore persists and retrieves application users.
+// UserStore persists and retrieves application users. UpsertExternalUser and
+// LookupExternalUser are keyed by the identity provider name and the
+// provider's subject identifier; LookupExternalUser reports found=false for
+// identities that have no account yet.
 type UserStore interface {
-	UpsertGoogleUser(ctx context.Context, googleSub string, userEmail string, userDisplayName string, userAvatarURL string) (applicationUserID string, userRoles []string, err error)
+	LookupExternalUser(ctx context.Context, provider string, subject string) (applicationUserID string, found bool, err error)
+	UpsertExternalUser(ctx context.Context, provider string, subject string, userEmail string, userDisplayName string, userAvatarURL string) (applicationUserID string, userRoles []string, err error)
 	GetUserProfile(ctx context.Context, applicationUserID string) (userEmail string, userDisplayName string, userAvatarURL string, userRoles []string, err error)
 }
 
-// RefreshTokenStore manages long-lived refresh tokens.
+// RefreshTokenStore manages long-lived refresh tokens. A token issued without a
+// previous token starts a new session authenticated with authMethods for the
+// OAuth client clientID, empty for browser sessions, at authTimeUnix; rotated
+// tokens inherit its session ID, authentication methods, client, and sign-in
+// time. Minted session JWTs carry them as the sid, amr, and auth_time claims.
 type RefreshTokenStore interface {
-	Issue(ctx context.Context, applicationUserID string, expiresUnix int64, previousTokenID string) (tokenID string, tokenOpaque string, err error)
+	Issue(ctx context.Context, applicationUserID string, expiresUnix int64, previousTokenID string, authMethods []string, clientID string, authTimeUnix int64) (tokenID string, tokenOpaque string, err error)
 	Validate(ctx context.Context, tokenOpaque string) (applicationUserID string, tokenID string, expiresUnix int64, err error)
 	Revoke(ctx context.Context, tokenID string) error
+	SessionID(ctx context.Context, tokenID string) (sessionID string, err error)
+	AuthMethods(ctx context.Context, tokenID string) (authMethods []string, err error)
+	ClientID(ctx context.Context, tokenID string) (clientID string, err error)
+	AuthTime(ctx context.Context, tokenID string) (authTimeUnix int64, err error)
+}
+
+// SessionRevocationStore records revoked sessions (sid) and session tokens
+// (jti) until expiresUnix, after which no token they cover can still be valid.
+type SessionRevocationStore interface {
+	RevokeSession(ctx context.Context, sessionID string, expiresUnix int64) error
+	RevokeToken(ctx context.Context, tokenID string, expiresUnix int64) error
+	IsRevoked(ctx context.Context, sessionID string, tokenID string) (bool, error)
+	ListRevoked(ctx context.Context) (sessionIDs []string, tokenIDs []string, err error)
 }
@@ -0,0 +1,323 @@
+package authkit
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	sessionvalidator "github.com/tyemirov/tauth/pkg/sessionvalidator"
+	"go.uber.org/zap"
+)
+
+const (
+	webAuthnRegisterBeginPath  = "/auth/webauthn/register/begin"
+	webAuthnRegisterFinishPath = "/auth/webauthn/register/finish"
+	webAuthnLoginBeginPath     = "/auth/webauthn/login/begin"
+	webAuthnLoginFinishPath    = "/auth/webauthn/login/finish"
+	webAuthnCookiePath         = "/auth/webauthn/"
+
+	// webAuthnChallengeCookieName carries the WebAuthnChallengeStore token of
+	// a pending ceremony from its begin request to its finish request.
+	webAuthnChallengeCookieName = "app_webauthn_challenge"
+
+	defaultWebAuthnRPName = "TAuth"
+
+	// webAuthnIdentityProviderName labels passkey sign-ins checked against
+	// the LoginPolicy.
+	webAuthnIdentityProviderName = "webauthn"
+)
+
+func (configuration ServerConfig) webAuthnRPName() string {
+	if configuration.WebAuthnRPName == "" {
+		return defaultWebAuthnRPName
+	}
+	return configuration.WebAuthnRPName
+}
+
+// webAuthnOrigins defaults to https://{WebAuthnRPID}.
+func (configuration ServerConfig) webAuthnOrigins() []string {
+	if len(configuration.WebAuthnOrigins) > 0 {
+		return configuration.WebAuthnOrigins
+	}
+	return []string{"https://" + configuration.WebAuthnRPID}
+}
+
+// NewWebAuthn builds the WebAuthn relying party from ServerConfig. Passkeys
+// are discoverable credentials, so sign-in needs no username.
+func NewWebAuthn(configuration ServerConfig) (*webauthn.WebAuthn, error) {
+	relyingParty, err := webauthn.New(&webauthn.Config{
+		RPID:          configuration.WebAuthnRPID,
+		RPDisplayName: configuration.webAuthnRPName(),
+		RPOrigins:     configuration.webAuthnOrigins(),
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationPreferred,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("webauthn.config: %w", err)
+	}
+	return relyingParty, nil
+}
+
+// passkeyUser adapts an application user to webauthn.User. The user handle
+// is the application user ID, which assertions echo back.
+type passkeyUser struct {
+	applicationUserID string
+	name              string
+	displayName       string
+	credentials       []webauthn.Credential
+}
+
+func (user passkeyUser) WebAuthnID() []byte {
+	return []byte(user.applicationUserID)
+}
+
+func (user passkeyUser) WebAuthnName() string {
+	return user.name
+}
+
+func (user passkeyUser) WebAuthnDisplayName() string {
+	return user.displayName
+}
+
+func (user passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	return user.credentials
+}
+
+// mountWebAuthnRoutes registers passkey registration, which requires a
+// session, and passkey sign-in. Each ceremony is a begin request returning
+// the options for navigator.credentials and a finish request posting the
+// authenticator's response.
+func mountWebAuthnRoutes(router gin.IRouter, clock Clock, configuration ServerConfig, sessionValidator *sessionvalidator.Validator, users UserStore, refreshTokens RefreshTokenStore) {
+	relyingParty, relyingPartyErr := NewWebAuthn(configuration)
+	if relyingPartyErr != nil {
+		panic(fmt.Sprintf("authkit.MountAuthRoutes: %v", relyingPartyErr))
+	}
+	challenges := NewMemoryWebAuthnChallengeStore(configuration.NonceTTL)
+
+	router.POST(webAuthnRegisterBeginPath, requireSessionWith(sessionValidator), func(contextGin *gin.Context) {
+		if !configuration.AllowInsecureHTTP && !isHTTPS(contextGin.Request) {
+			logAuthWarning("auth.webauthn.insecure_http", nil)
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "https_required"})
+			return
+		}
+		user, loaded := loadPasskeyUser(contextGin)
+		if !loaded {
+			return
+		}
+		creation, session, beginErr := relyingParty.BeginRegistration(user, webauthn.WithExclusions(webauthn.Credentials(user.credentials).CredentialDescriptors()))
+		if beginErr != nil {
+			logAuthError("auth.webauthn.begin_registration", beginErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !issueWebAuthnChallenge(contextGin, configuration, challenges, *session) {
+			return
+		}
+		contextGin.JSON(http.StatusOK, creation)
+	})
+
+	router.POST(webAuthnRegisterFinishPath, requireSessionWith(sessionValidator), func(contextGin *gin.Context) {
+		session, consumed := consumeWebAuthnChallenge(contextGin, configuration, challenges)
+		if !consumed {
+			return
+		}
+		user, loaded := loadPasskeyUser(contextGin)
+		if !loaded {
+			return
+		}
+		credential, finishErr := relyingParty.FinishRegistration(user, session, contextGin.Request)
+		if finishErr != nil {
+			logAuthWarning("auth.webauthn.invalid_registration", finishErr)
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_credential"})
+			return
+		}
+		createErr := resolveCredentials().Create(contextGin, PasskeyCredential{
+			UserID:      user.applicationUserID,
+			Credential:  *credential,
+			CreatedUnix: clock.Now().UTC().Unix(),
+		})
+		if errors.Is(createErr, ErrCredentialExists) {
+			logAuthWarning("auth.webauthn.credential_exists", createErr)
+			contextGin.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "credential_exists"})
+			return
+		}
+		if createErr != nil {
+			logAuthError("auth.webauthn.credential_store", createErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		recordMetric(metricAuthPasskeyRegistered)
+		contextGin.JSON(http.StatusCreated, gin.H{"credential_id": base64.RawURLEncoding.EncodeToString(credential.ID)})
+	})
+
+	router.POST(webAuthnLoginBeginPath, func(contextGin *gin.Context) {
+		if !configuration.AllowInsecureHTTP && !isHTTPS(contextGin.Request) {
+			logAuthWarning("auth.webauthn.insecure_http", nil)
+			contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "https_required"})
+			return
+		}
+		assertion, session, beginErr := relyingParty.BeginDiscoverableLogin()
+		if beginErr != nil {
+			logAuthError("auth.webauthn.begin_login", beginErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !issueWebAuthnChallenge(contextGin, configuration, challenges, *session) {
+			return
+		}
+		contextGin.JSON(http.StatusOK, assertion)
+	})
+
+	router.POST(webAuthnLoginFinishPath, func(contextGin *gin.Context) {
+		session, consumed := consumeWebAuthnChallenge(contextGin, configuration, challenges)
+		if !consumed {
+			recordMetric(metricAuthLoginFailure)
+			return
+		}
+
+		var stored PasskeyCredential
+		var storeErr error
+		_, credential, finishErr := relyingParty.FinishPasskeyLogin(func(rawID []byte, userHandle []byte) (webauthn.User, error) {
+			stored, storeErr = resolveCredentials().Get(contextGin, rawID)
+			if storeErr != nil {
+				return nil, storeErr
+			}
+			if stored.UserID != string(userHandle) {
+				return nil, fmt.Errorf("webauthn.login: %w: user handle mismatch", ErrCredentialNotFound)
+			}
+			return passkeyUser{applicationUserID: stored.UserID, credentials: []webauthn.Credential{stored.Credential}}, nil
+		}, session, contextGin.Request)
+		if storeErr != nil && !errors.Is(storeErr, ErrCredentialNotFound) {
+			recordMetric(metricAuthLoginFailure)
+			logAuthError("auth.webauthn.credential_store", storeErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if finishErr != nil {
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.webauthn.invalid_assertion", finishErr)
+			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_credential"})
+			return
+		}
+		if credential.Authenticator.CloneWarning {
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.webauthn.clone_warning", nil, zap.String("user_id", stored.UserID))
+			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_credential"})
+			return
+		}
+
+		stored.Credential = *credential
+		stored.LastUsedUnix = clock.Now().UTC().Unix()
+		if updateErr := resolveCredentials().Update(contextGin, stored); updateErr != nil {
+			recordMetric(metricAuthLoginFailure)
+			logAuthError("auth.webauthn.credential_store", updateErr)
+			contextGin.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		userEmail, userDisplayName, userAvatarURL, userRoles, profileErr := users.GetUserProfile(contextGin, stored.UserID)
+		if profileErr != nil {
+			recordMetric(metricAuthLoginFailure)
+			logAuthWarning("auth.webauthn.profile", profileErr, zap.String("user_id", stored.UserID))
+			contextGin.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_credential"})
+			return
+		}
+		if !allowLoginPolicy(contextGin, configuration, ExternalIdentity{Provider: webAuthnIdentityProviderName, Email: userEmail}) {
+			return
+		}
+		profile, started := issueSession(contextGin, clock, configuration, refreshTokens, stored.UserID, userEmail, userDisplayName, userAvatarURL, userRoles)
+		if !started {
+			return
+		}
+		respondWithSession(contextGin, profile)
+	})
+}
+
+// loadPasskeyUser builds the signed-in user and the passkeys they already
+// registered from the session claims set by requireSessionWith.
+func loadPasskeyUser(contextGin *gin.Context) (passkeyUser, bool) {
+	claims, ok := sessionClaims(contextGin)
+	if !ok {
+		return passkeyUser{}, false
+	}
+	registered, listErr := resolveCredentials().ListByUser(contextGin, claims.GetUserID())
+	if listErr != nil {
+		logAuthError("auth.webauthn.credential_store", listErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return passkeyUser{}, false
+	}
+	user := passkeyUser{
+		applicationUserID: claims.GetUserID(),
+		name:              claims.UserEmail,
+		displayName:       strings.TrimSpace(claims.UserDisplayName),
+	}
+	if user.displayName == "" {
+		user.displayName = user.name
+	}
+	for _, credential := range registered {
+		user.credentials = append(user.credentials, credential.Credential)
+	}
+	return user, true
+}
+
+// issueWebAuthnChallenge stores session and hands its token to the browser
+// in an HttpOnly cookie scoped to the WebAuthn routes.
+func issueWebAuthnChallenge(contextGin *gin.Context, configuration ServerConfig, challenges WebAuthnChallengeStore, session webauthn.SessionData) bool {
+	token, issueErr := challenges.Issue(contextGin, session)
+	if issueErr != nil {
+		logAuthError("auth.webauthn.challenge_issue", issueErr)
+		contextGin.AbortWithStatus(http.StatusInternalServerError)
+		return false
+	}
+	http.SetCookie(contextGin.Writer, &http.Cookie{
+		Name:     webAuthnChallengeCookieName,
+		Value:    token,
+		Path:     webAuthnCookiePath,
+		Domain:   configuration.CookieDomain,
+		MaxAge:   int(configuration.NonceTTL.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: configuration.SameSiteMode,
+	})
+	return true
+}
+
+// consumeWebAuthnChallenge clears the challenge cookie and returns the
+// ceremony it referenced, failing the request when there is none.
+func consumeWebAuthnChallenge(contextGin *gin.Context, configuration ServerConfig, challenges WebAuthnChallengeStore) (webauthn.SessionData, bool) {
+	if !configuration.AllowInsecureHTTP && !isHTTPS(contextGin.Request) {
+		logAuthWarning("auth.webauthn.insecure_http", nil)
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "https_required"})
+		return webauthn.SessionData{}, false
+	}
+	http.SetCookie(contextGin.Writer, &http.Cookie{
+		Name:     webAuthnChallengeCookieName,
+		Value:    "",
+		Path:     webAuthnCookiePath,
+		Domain:   configuration.CookieDomain,
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: configuration.SameSiteMode,
+	})
+	cookie, cookieErr := contextGin.Request.Cookie(webAuthnChallengeCookieName)
+	if cookieErr != nil || strings.TrimSpace(cookie.Value) == "" {
+		logAuthWarning("auth.webauthn.missing_challenge", cookieErr)
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_challenge"})
+		return webauthn.SessionData{}, false
+	}
+	session, consumeErr := challenges.Consume(contextGin, cookie.Value)
+	if consumeErr != nil {
+		logAuthWarning("auth.webauthn.invalid_challenge", consumeErr)
+		contextGin.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_challenge"})
+		return webauthn.SessionData{}, false
+	}
+	return session, true
+}
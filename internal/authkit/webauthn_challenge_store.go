@@ -0,0 +1,101 @@
+package authkit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var (
+	// ErrWebAuthnChallengeNotFound indicates the ceremony token was not issued or already consumed.
+	ErrWebAuthnChallengeNotFound = errors.New("webauthn challenge not found")
+	// ErrWebAuthnChallengeExpired indicates the ceremony token expired before consumption.
+	ErrWebAuthnChallengeExpired = errors.New("webauthn challenge expired")
+)
+
+// WebAuthnChallengeStore keeps the state of pending passkey ceremonies. Like
+// NonceStore, it hands out one-time tokens that expire after a TTL; the
+// token references the challenge the authenticator must sign.
+type WebAuthnChallengeStore interface {
+	// Issue stores session and returns the token that retrieves it.
+	Issue(ctx context.Context, session webauthn.SessionData) (string, error)
+	// Consume returns and invalidates the session stored under token.
+	Consume(ctx context.Context, token string) (webauthn.SessionData, error)
+}
+
+type webAuthnChallengeEntry struct {
+	session   webauthn.SessionData
+	expiresAt time.Time
+}
+
+type memoryWebAuthnChallengeStore struct {
+	mutex     sync.Mutex
+	entries   map[string]webAuthnChallengeEntry
+	ttl       time.Duration
+	now       func() time.Time
+	tokenSize int
+}
+
+// NewMemoryWebAuthnChallengeStore constructs an in-memory WebAuthnChallengeStore with the provided TTL.
+func NewMemoryWebAuthnChallengeStore(ttl time.Duration) WebAuthnChallengeStore {
+	return &memoryWebAuthnChallengeStore{
+		entries:   make(map[string]webAuthnChallengeEntry),
+		ttl:       ttl,
+		now:       time.Now,
+		tokenSize: 32,
+	}
+}
+
+func (store *memoryWebAuthnChallengeStore) Issue(ctx context.Context, session webauthn.SessionData) (string, error) {
+	token, err := store.randomToken()
+	if err != nil {
+		return "", err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.purgeExpiredLocked()
+	store.entries[token] = webAuthnChallengeEntry{session: session, expiresAt: store.now().Add(store.ttl)}
+	return token, nil
+}
+
+func (store *memoryWebAuthnChallengeStore) Consume(ctx context.Context, token string) (webauthn.SessionData, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	entry, ok := store.entries[token]
+	if !ok {
+		store.purgeExpiredLocked()
+		return webauthn.SessionData{}, ErrWebAuthnChallengeNotFound
+	}
+	delete(store.entries, token)
+	if store.now().After(entry.expiresAt) {
+		store.purgeExpiredLocked()
+		return webauthn.SessionData{}, ErrWebAuthnChallengeExpired
+	}
+	store.purgeExpiredLocked()
+	return entry.session, nil
+}
+
+func (store *memoryWebAuthnChallengeStore) purgeExpiredLocked() {
+	if len(store.entries) == 0 {
+		return
+	}
+	now := store.now()
+	for token, entry := range store.entries {
+		if now.After(entry.expiresAt) {
+			delete(store.entries, token)
+		}
+	}
+}
+
+func (store *memoryWebAuthnChallengeStore) randomToken() (string, error) {
+	buffer := make([]byte, store.tokenSize)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
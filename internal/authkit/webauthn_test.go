@@ -0,0 +1,274 @@
+package authkit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+const testWebAuthnOrigin = "https://example.com"
+
+// softwareAuthenticator answers WebAuthn ceremonies with a P-256 key and
+// "none" attestation, the way a platform authenticator would.
+type softwareAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftwareAuthenticator(t *testing.T) *softwareAuthenticator {
+	t.Helper()
+	key, keyErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	credentialID := make([]byte, 16)
+	_, randomErr := rand.Read(credentialID)
+	if keyErr != nil || randomErr != nil {
+		t.Fatalf("new authenticator: %v %v", keyErr, randomErr)
+	}
+	return &softwareAuthenticator{key: key, credentialID: credentialID}
+}
+
+func webAuthnClientData(t *testing.T, ceremonyType string, challenge protocol.URLEncodedBase64) []byte {
+	t.Helper()
+	clientData, _ := json.Marshal(map[string]interface{}{
+		"type":        ceremonyType,
+		"challenge":   challenge.String(),
+		"origin":      testWebAuthnOrigin,
+		"crossOrigin": false,
+	})
+	return clientData
+}
+
+func (authenticator *softwareAuthenticator) authenticatorData(rpID string, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, authenticator.signCount)
+}
+
+// register answers navigator.credentials.create with the options from register/begin.
+func (authenticator *softwareAuthenticator) register(t *testing.T, creation protocol.CredentialCreation) []byte {
+	t.Helper()
+	userHandle, _ := creation.Response.User.ID.(string)
+	decodedHandle, decodeErr := base64.RawURLEncoding.DecodeString(userHandle)
+	if decodeErr != nil {
+		t.Fatalf("decode user handle %q: %v", userHandle, decodeErr)
+	}
+	authenticator.userHandle = decodedHandle
+
+	publicKey, _ := authenticator.key.PublicKey.ECDH()
+	uncompressed := publicKey.Bytes()
+	coseKey, coseErr := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+		Curve:         1,
+		XCoord:        uncompressed[1:33],
+		YCoord:        uncompressed[33:],
+	})
+	if coseErr != nil {
+		t.Fatalf("encode public key: %v", coseErr)
+	}
+	authData := authenticator.authenticatorData(creation.Response.RelyingParty.ID, 0x45)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(authenticator.credentialID)))
+	authData = append(authData, authenticator.credentialID...)
+	authData = append(authData, coseKey...)
+	attestationObject, attestationErr := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if attestationErr != nil {
+		t.Fatalf("encode attestation: %v", attestationErr)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    base64.RawURLEncoding.EncodeToString(authenticator.credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(authenticator.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(webAuthnClientData(t, "webauthn.create", creation.Response.Challenge)),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+		},
+	})
+	return body
+}
+
+// assert answers navigator.credentials.get with the options from login/begin.
+func (authenticator *softwareAuthenticator) assert(t *testing.T, assertion protocol.CredentialAssertion) []byte {
+	t.Helper()
+	authenticator.signCount++
+	authData := authenticator.authenticatorData(assertion.Response.RelyingPartyID, 0x05)
+	clientData := webAuthnClientData(t, "webauthn.get", assertion.Response.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, signErr := ecdsa.SignASN1(rand.Reader, authenticator.key, digest[:])
+	if signErr != nil {
+		t.Fatalf("sign assertion: %v", signErr)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    base64.RawURLEncoding.EncodeToString(authenticator.credentialID),
+		"rawId": base64.RawURLEncoding.EncodeToString(authenticator.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+			"signature":         base64.RawURLEncoding.EncodeToString(signature),
+			"userHandle":        base64.RawURLEncoding.EncodeToString(authenticator.userHandle),
+		},
+	})
+	return body
+}
+
+// withWebAuthnForTest enables passkeys for the relying party example.com.
+func withWebAuthnForTest(config *ServerConfig) {
+	config.WebAuthnRPID = "example.com"
+}
+
+// beginWebAuthnForTest runs a begin request, decodes its options into
+// options, and adds the challenge cookie to cookies.
+func beginWebAuthnForTest(t *testing.T, router http.Handler, path string, cookies map[string]*http.Cookie, options interface{}, names ...string) {
+	t.Helper()
+	response := serveWithCookies(router, http.MethodPost, path, nil, cookies, names...)
+	if response.Code != http.StatusOK {
+		t.Fatalf("expected 200 from %s, got %d", path, response.Code)
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), options); err != nil {
+		t.Fatalf("decode %s options: %v", path, err)
+	}
+	challengeCookie := collectCookies(response.Result().Cookies())[webAuthnChallengeCookieName]
+	if challengeCookie == nil || !challengeCookie.HttpOnly || challengeCookie.Path != webAuthnCookiePath {
+		t.Fatalf("expected an HttpOnly challenge cookie from %s, got %v", path, challengeCookie)
+	}
+	cookies[webAuthnChallengeCookieName] = challengeCookie
+}
+
+func registerPasskeyForTest(t *testing.T, router http.Handler, config ServerConfig, cookies map[string]*http.Cookie, authenticator *softwareAuthenticator) {
+	t.Helper()
+	var creation protocol.CredentialCreation
+	beginWebAuthnForTest(t, router, webAuthnRegisterBeginPath, cookies, &creation, config.SessionCookieName)
+	response := serveWithCookies(router, http.MethodPost, webAuthnRegisterFinishPath, authenticator.register(t, creation), cookies, config.SessionCookieName, webAuthnChallengeCookieName)
+	if response.Code != http.StatusCreated {
+		t.Fatalf("expected 201 from register/finish, got %d: %s", response.Code, response.Body.String())
+	}
+}
+
+func TestWebAuthnRegisterAndLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router, config, _ := newAuthRouterForTest(t, withWebAuthnForTest)
+	cookies := loginForTest(t, router, "sub-passkey")
+	authenticator := newSoftwareAuthenticator(t)
+	registerPasskeyForTest(t, router, config, cookies, authenticator)
+
+	registered, _ := resolveCredentials().ListByUser(t.Context(), "google:sub-passkey")
+	if len(registered) != 1 || string(registered[0].Credential.ID) != string(authenticator.credentialID) {
+		t.Fatalf("expected the passkey to be stored for the signed-in user, got %+v", registered)
+	}
+	replayed := serveWithCookies(router, http.MethodPost, webAuthnRegisterFinishPath, nil, cookies, config.SessionCookieName, webAuthnChallengeCookieName)
+	if replayed.Code != http.StatusBadRequest {
+		t.Fatalf("expected a consumed registration challenge to be rejected, got %d", replayed.Code)
+	}
+
+	loginCookies := map[string]*http.Cookie{}
+	var assertion protocol.CredentialAssertion
+	beginWebAuthnForTest(t, router, webAuthnLoginBeginPath, loginCookies, &assertion)
+	response := serveWithCookies(router, http.MethodPost, webAuthnLoginFinishPath, authenticator.assert(t, assertion), loginCookies, webAuthnChallengeCookieName)
+	if response.Code != http.StatusOK {
+		t.Fatalf("expected 200 from login/finish, got %d: %s", response.Code, response.Body.String())
+	}
+	var profile map[string]interface{}
+	_ = json.Unmarshal(response.Body.Bytes(), &profile)
+	if profile["user_id"] != "google:sub-passkey" || profile["user_email"] != "sub-passkey@example.com" {
+		t.Fatalf("unexpected profile %v", profile)
+	}
+	issued := collectCookies(response.Result().Cookies())
+	if issued[config.SessionCookieName] == nil || issued[config.RefreshCookieName] == nil {
+		t.Fatalf("expected session and refresh cookies, got %v", response.Result().Cookies())
+	}
+	if claims := sessionClaimsForTest(t, config, issued[config.SessionCookieName]); claims.GetUserID() != "google:sub-passkey" {
+		t.Fatalf("expected a session for the passkey owner, got %q", claims.GetUserID())
+	}
+	stored, _ := resolveCredentials().Get(t.Context(), authenticator.credentialID)
+	if stored.Credential.Authenticator.SignCount != 1 || stored.LastUsedUnix == 0 {
+		t.Fatalf("expected the sign count and last use to be recorded, got %+v", stored)
+	}
+
+	// A cloned authenticator replays an old counter.
+	authenticator.signCount = 0
+	beginWebAuthnForTest(t, router, webAuthnLoginBeginPath, loginCookies, &assertion)
+	cloned := serveWithCookies(router, http.MethodPost, webAuthnLoginFinishPath, authenticator.assert(t, assertion), loginCookies, webAuthnChallengeCookieName)
+	if cloned.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a stale sign count to be rejected, got %d", cloned.Code)
+	}
+}
+
+func TestWebAuthnRejections(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router, config, _ := newAuthRouterForTest(t, withWebAuthnForTest)
+	if response := serveWithCookies(router, http.MethodPost, webAuthnRegisterBeginPath, nil, nil); response.Code != http.StatusUnauthorized {
+		t.Fatalf("expected registration to require a session, got %d", response.Code)
+	}
+
+	cookies := loginForTest(t, router, "sub-owner")
+	registerPasskeyForTest(t, router, config, cookies, newSoftwareAuthenticator(t))
+	unknown := newSoftwareAuthenticator(t)
+	unknown.userHandle = []byte("google:sub-owner")
+
+	loginCookies := map[string]*http.Cookie{}
+	var assertion protocol.CredentialAssertion
+	beginWebAuthnForTest(t, router, webAuthnLoginBeginPath, loginCookies, &assertion)
+	body := unknown.assert(t, assertion)
+	response := serveWithCookies(router, http.MethodPost, webAuthnLoginFinishPath, body, loginCookies, webAuthnChallengeCookieName)
+	if response.Code != http.StatusUnauthorized || collectCookies(response.Result().Cookies())[config.SessionCookieName] != nil {
+		t.Fatalf("expected an unregistered passkey to be rejected, got %d", response.Code)
+	}
+	if response := serveWithCookies(router, http.MethodPost, webAuthnLoginFinishPath, body, nil); response.Code != http.StatusBadRequest {
+		t.Fatalf("expected a missing challenge to be rejected, got %d", response.Code)
+	}
+}
+
+func TestWebAuthnLoginHonoursLoginPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router, config, users := newAuthRouterForTest(t, withWebAuthnForTest)
+	cookies := loginForTest(t, router, "sub-restricted")
+	authenticator := newSoftwareAuthenticator(t)
+	registerPasskeyForTest(t, router, config, cookies, authenticator)
+
+	// The owner's domain is denied after the passkey was registered.
+	restrictedConfig := config
+	restrictedConfig.LoginPolicy = LoginPolicy{DeniedEmailDomains: []string{"example.com"}}
+	restrictedRouter := gin.New()
+	MountAuthRoutes(restrictedRouter, restrictedConfig, users, NewMemoryRefreshTokenStore(), nil)
+
+	loginCookies := map[string]*http.Cookie{}
+	var assertion protocol.CredentialAssertion
+	beginWebAuthnForTest(t, restrictedRouter, webAuthnLoginBeginPath, loginCookies, &assertion)
+	response := serveWithCookies(restrictedRouter, http.MethodPost, webAuthnLoginFinishPath, authenticator.assert(t, assertion), loginCookies, webAuthnChallengeCookieName)
+	if response.Code != http.StatusForbidden || !strings.Contains(response.Body.String(), "email_not_allowed") {
+		t.Fatalf("expected a passkey of a denied domain to be refused, got %d %s", response.Code, response.Body.String())
+	}
+	if collectCookies(response.Result().Cookies())[config.SessionCookieName] != nil {
+		t.Fatalf("expected no session for a refused passkey")
+	}
+}
+
+func TestWebAuthnRoutesRequireRelyingParty(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router, _, _ := newAuthRouterForTest(t, nil)
+	if response := serveWithCookies(router, http.MethodPost, webAuthnLoginBeginPath, nil, nil); response.Code != http.StatusNotFound {
+		t.Fatalf("expected passkeys to be disabled without a relying party ID, got %d", response.Code)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -27,8 +28,10 @@ type ClaimsProvider interface {
 
 var ErrUserNotFound = errors.New("web.user.not_found")
 
-// InMemoryUsers is a simple user store used for demo and local runs.
+// InMemoryUsers is a simple user store used for demo and local runs. Its
+// methods are safe for concurrent use; set Users directly only before serving.
 type InMemoryUsers struct {
+	mutex sync.RWMutex
 	Users map[string]UserProfile
 }
 
@@ -45,21 +48,35 @@ func NewInMemoryUsers() *InMemoryUsers {
 	return &InMemoryUsers{Users: make(map[string]UserProfile)}
 }
 
-// UpsertGoogleUser inserts or updates a user based on Google sub.
-func (store *InMemoryUsers) UpsertGoogleUser(ctx context.Context, googleSub string, userEmail string, userDisplayName string, userAvatarURL string) (string, []string, error) {
-	applicationUserID := "google:" + googleSub
+// LookupExternalUser reports whether the identity already has an account.
+func (store *InMemoryUsers) LookupExternalUser(ctx context.Context, provider string, subject string) (string, bool, error) {
+	applicationUserID := provider + ":" + subject
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	_, found := store.Users[applicationUserID]
+	return applicationUserID, found, nil
+}
+
+// UpsertExternalUser inserts or updates a user based on the identity
+// provider's subject; the application user ID is "<provider>:<subject>".
+func (store *InMemoryUsers) UpsertExternalUser(ctx context.Context, provider string, subject string, userEmail string, userDisplayName string, userAvatarURL string) (string, []string, error) {
+	applicationUserID := provider + ":" + subject
 	record := UserProfile{
 		Email:     userEmail,
 		Display:   userDisplayName,
 		AvatarURL: userAvatarURL,
 		Roles:     []string{"user"},
 	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
 	store.Users[applicationUserID] = record
 	return applicationUserID, record.Roles, nil
 }
 
 // GetUserProfile returns a profile by application user id.
 func (store *InMemoryUsers) GetUserProfile(ctx context.Context, applicationUserID string) (string, string, string, []string, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
 	record, ok := store.Users[applicationUserID]
 	if !ok {
 		return "", "", "", nil, ErrUserNotFound
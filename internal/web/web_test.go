@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -241,13 +243,19 @@ func TestServeDemoConfig(t *testing.T) {
 func TestInMemoryUsers(t *testing.T) {
 	t.Parallel()
 	store := NewInMemoryUsers()
-	userID, roles, err := store.UpsertGoogleUser(nil, "sub-1", "user@example.com", "User", "https://example.com/avatar.png")
+	if _, found, err := store.LookupExternalUser(nil, "google", "sub-1"); err != nil || found {
+		t.Fatalf("expected no account before the first sign-in, got %v (%v)", found, err)
+	}
+	userID, roles, err := store.UpsertExternalUser(nil, "google", "sub-1", "user@example.com", "User", "https://example.com/avatar.png")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if userID == "" {
 		t.Fatalf("expected user id")
 	}
+	if lookedUpID, found, err := store.LookupExternalUser(nil, "google", "sub-1"); err != nil || !found || lookedUpID != userID {
+		t.Fatalf("expected the account to be found, got %q %v (%v)", lookedUpID, found, err)
+	}
 	if len(roles) == 0 {
 		t.Fatalf("expected default role")
 	}
@@ -264,3 +272,25 @@ func TestInMemoryUsers(t *testing.T) {
 		t.Fatalf("expected error for missing user")
 	}
 }
+
+func TestInMemoryUsersConcurrentSignIns(t *testing.T) {
+	t.Parallel()
+	store := NewInMemoryUsers()
+	var waitGroup sync.WaitGroup
+	for index := 0; index < 16; index++ {
+		waitGroup.Add(1)
+		go func(subject string) {
+			defer waitGroup.Done()
+			if _, found, _ := store.LookupExternalUser(nil, "google", subject); !found {
+				store.UpsertExternalUser(nil, "google", subject, subject+"@example.com", subject, "")
+			}
+			store.GetUserProfile(nil, "google:"+subject)
+		}("sub-" + strconv.Itoa(index%4))
+	}
+	waitGroup.Wait()
+	for index := 0; index < 4; index++ {
+		if _, found, _ := store.LookupExternalUser(nil, "google", "sub-"+strconv.Itoa(index)); !found {
+			t.Fatalf("expected sub-%d to have an account", index)
+		}
+	}
+}
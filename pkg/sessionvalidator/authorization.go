@@ -0,0 +1,217 @@
+package sessionvalidator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// ErrForbidden indicates an authenticated session does not satisfy a Requirement.
+	// Every AuthorizationError matches it.
+	ErrForbidden = errors.New("session.validator.forbidden")
+	// ErrMissingRole indicates the session lacks the roles required by RequireAnyRole or RequireAllRoles.
+	ErrMissingRole = errors.New("session.validator.missing_role")
+	// ErrMFARequired indicates the session was not authenticated with a second factor.
+	ErrMFARequired = errors.New("session.validator.mfa_required")
+)
+
+// Authentication method references TAuth records in the amr claim.
+const (
+	// AuthMethodMFA marks sessions that passed a second factor.
+	AuthMethodMFA = "mfa"
+	// AuthMethodOTP marks sessions verified with a TOTP code.
+	AuthMethodOTP = "otp"
+	// AuthMethodRecoveryCode marks sessions verified with a recovery code.
+	AuthMethodRecoveryCode = "recovery_code"
+)
+
+// AuthorizationError describes why an authenticated session was denied.
+type AuthorizationError struct {
+	// Reason is the stable cause: ErrMissingRole or the reason given to RequirePredicate.
+	Reason error
+	// RequiredRoles lists the roles the requirement checked, if any.
+	RequiredRoles []string
+}
+
+func (authorizationErr *AuthorizationError) Error() string {
+	return authorizationErr.Reason.Error()
+}
+
+// Unwrap exposes both ErrForbidden and the specific reason to errors.Is.
+func (authorizationErr *AuthorizationError) Unwrap() []error {
+	return []error{ErrForbidden, authorizationErr.Reason}
+}
+
+// Requirement is an authorization rule evaluated against validated claims.
+// Construct it with RequireAnyRole, RequireAllRoles, or RequirePredicate.
+type Requirement struct {
+	reason        error
+	requiredRoles []string
+	allow         func(claims *Claims) bool
+}
+
+// RequireAnyRole is satisfied when the session holds at least one of roles.
+// A requirement without roles denies every request.
+func RequireAnyRole(roles ...string) Requirement {
+	requiredRoles := normalizeRoles(roles)
+	return Requirement{
+		reason:        ErrMissingRole,
+		requiredRoles: requiredRoles,
+		allow: func(claims *Claims) bool {
+			return slices.ContainsFunc(requiredRoles, func(role string) bool {
+				return slices.Contains(claims.GetUserRoles(), role)
+			})
+		},
+	}
+}
+
+// RequireAllRoles is satisfied when the session holds every one of roles.
+// A requirement without roles denies every request.
+func RequireAllRoles(roles ...string) Requirement {
+	requiredRoles := normalizeRoles(roles)
+	return Requirement{
+		reason:        ErrMissingRole,
+		requiredRoles: requiredRoles,
+		allow: func(claims *Claims) bool {
+			if len(requiredRoles) == 0 {
+				return false
+			}
+			for _, role := range requiredRoles {
+				if !slices.Contains(claims.GetUserRoles(), role) {
+					return false
+				}
+			}
+			return true
+		},
+	}
+}
+
+// RequirePredicate is satisfied when allow returns true. reason identifies the
+// failure in AuthorizationError (ErrForbidden when nil); a nil allow denies
+// every request.
+func RequirePredicate(reason error, allow func(claims *Claims) bool) Requirement {
+	if reason == nil {
+		reason = ErrForbidden
+	}
+	return Requirement{reason: reason, allow: allow}
+}
+
+// RequireMFA is satisfied when the session passed a second factor, i.e. its
+// amr claim contains AuthMethodMFA. Sessions that have not yet done so can
+// step up through TAuth's /auth/mfa/verify.
+func RequireMFA() Requirement {
+	return Requirement{
+		reason: ErrMFARequired,
+		allow: func(claims *Claims) bool {
+			return slices.Contains(claims.GetAuthMethods(), AuthMethodMFA)
+		},
+	}
+}
+
+// Check returns nil when claims satisfy the requirement and an
+// *AuthorizationError otherwise.
+func (requirement Requirement) Check(claims *Claims) error {
+	if claims != nil && requirement.allow != nil && requirement.allow(claims) {
+		return nil
+	}
+	reason := requirement.reason
+	if reason == nil {
+		reason = ErrForbidden
+	}
+	return &AuthorizationError{Reason: reason, RequiredRoles: slices.Clone(requirement.requiredRoles)}
+}
+
+// ForbiddenHandler writes the response for an authenticated request that
+// failed a Requirement.
+type ForbiddenHandler func(writer http.ResponseWriter, request *http.Request, authorizationErr *AuthorizationError)
+
+// PlainForbidden responds with a bare 403 status. It is the default handler.
+func PlainForbidden() ForbiddenHandler {
+	return func(writer http.ResponseWriter, request *http.Request, authorizationErr *AuthorizationError) {
+		writer.WriteHeader(http.StatusForbidden)
+	}
+}
+
+// JSONForbidden responds with 403 and a JSON body such as
+// {"error":"forbidden","reason":"session.validator.missing_role","required_roles":["admin"]}.
+func JSONForbidden() ForbiddenHandler {
+	return func(writer http.ResponseWriter, request *http.Request, authorizationErr *AuthorizationError) {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(writer).Encode(struct {
+			Error         string   `json:"error"`
+			Reason        string   `json:"reason"`
+			RequiredRoles []string `json:"required_roles,omitempty"`
+		}{
+			Error:         "forbidden",
+			Reason:        authorizationErr.Reason.Error(),
+			RequiredRoles: authorizationErr.RequiredRoles,
+		})
+	}
+}
+
+// Middleware returns net/http middleware enforcing the requirement on claims
+// stored by Validator.Middleware, which must run first. Requests without
+// claims receive 401; authenticated requests that fail the requirement are
+// passed to onForbidden (PlainForbidden when nil).
+func (requirement Requirement) Middleware(onForbidden ForbiddenHandler) func(http.Handler) http.Handler {
+	if onForbidden == nil {
+		onForbidden = PlainForbidden()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			claims, ok := ClaimsFromContext(request.Context())
+			if !ok {
+				writer.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var authorizationErr *AuthorizationError
+			if errors.As(requirement.Check(claims), &authorizationErr) {
+				onForbidden(writer, request, authorizationErr)
+				return
+			}
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// GinMiddleware is the Gin counterpart of Middleware and must run after
+// Validator.GinMiddleware. The AuthorizationError is also recorded on the Gin
+// context via contextGin.Error.
+func (requirement Requirement) GinMiddleware(onForbidden ForbiddenHandler) gin.HandlerFunc {
+	if onForbidden == nil {
+		onForbidden = PlainForbidden()
+	}
+	return func(contextGin *gin.Context) {
+		claims, ok := ClaimsFromContext(contextGin.Request.Context())
+		if !ok {
+			contextGin.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		var authorizationErr *AuthorizationError
+		if errors.As(requirement.Check(claims), &authorizationErr) {
+			_ = contextGin.Error(authorizationErr)
+			onForbidden(contextGin.Writer, contextGin.Request, authorizationErr)
+			contextGin.Abort()
+			return
+		}
+		contextGin.Next()
+	}
+}
+
+func normalizeRoles(roles []string) []string {
+	normalized := make([]string, 0, len(roles))
+	for _, role := range roles {
+		role = strings.TrimSpace(role)
+		if role == "" || slices.Contains(normalized, role) {
+			continue
+		}
+		normalized = append(normalized, role)
+	}
+	return normalized
+}
@@ -0,0 +1,159 @@
+package sessionvalidator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequirementCheck(t *testing.T) {
+	t.Parallel()
+
+	errPlanRequired := errors.New("billing.plan_required")
+	claims := &Claims{UserID: "user-123", UserRoles: []string{"editor", "viewer"}, AuthMethods: []string{AuthMethodOTP, AuthMethodMFA}}
+
+	testCases := []struct {
+		name           string
+		requirement    Requirement
+		expectedReason error
+	}{
+		{name: "AnyRoleSatisfied", requirement: RequireAnyRole("admin", "editor")},
+		{name: "AnyRoleMissing", requirement: RequireAnyRole("admin"), expectedReason: ErrMissingRole},
+		{name: "AllRolesSatisfied", requirement: RequireAllRoles("editor", " viewer ")},
+		{name: "AllRolesPartial", requirement: RequireAllRoles("editor", "admin"), expectedReason: ErrMissingRole},
+		{name: "AnyRoleWithoutRolesDenies", requirement: RequireAnyRole(), expectedReason: ErrMissingRole},
+		{name: "AllRolesWithoutRolesDenies", requirement: RequireAllRoles(""), expectedReason: ErrMissingRole},
+		{name: "PredicateSatisfied", requirement: RequirePredicate(errPlanRequired, func(claims *Claims) bool {
+			return claims.GetUserID() == "user-123"
+		})},
+		{name: "PredicateDenied", requirement: RequirePredicate(errPlanRequired, func(*Claims) bool { return false }), expectedReason: errPlanRequired},
+		{name: "PredicateWithoutReason", requirement: RequirePredicate(nil, func(*Claims) bool { return false }), expectedReason: ErrForbidden},
+		{name: "NilPredicateDenies", requirement: RequirePredicate(errPlanRequired, nil), expectedReason: errPlanRequired},
+		{name: "MFASatisfied", requirement: RequireMFA()},
+		{name: "ZeroRequirementDenies", requirement: Requirement{}, expectedReason: ErrForbidden},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			checkErr := testCase.requirement.Check(claims)
+			if testCase.expectedReason == nil {
+				if checkErr != nil {
+					t.Fatalf("expected requirement to pass, got %v", checkErr)
+				}
+				return
+			}
+			var authorizationErr *AuthorizationError
+			if !errors.As(checkErr, &authorizationErr) {
+				t.Fatalf("expected authorization error, got %v", checkErr)
+			}
+			if !errors.Is(checkErr, ErrForbidden) || !errors.Is(checkErr, testCase.expectedReason) {
+				t.Fatalf("expected %v wrapped with forbidden, got %v", testCase.expectedReason, checkErr)
+			}
+		})
+	}
+
+	if err := RequireAnyRole("viewer").Check(nil); !errors.Is(err, ErrMissingRole) {
+		t.Fatalf("expected nil claims to be denied, got %v", err)
+	}
+	if err := RequireMFA().Check(&Claims{UserID: "user-123"}); !errors.Is(err, ErrMFARequired) {
+		t.Fatalf("expected a session without amr to need MFA, got %v", err)
+	}
+}
+
+func TestRequirementMiddleware(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0).UTC()
+	validator, err := New(Config{SigningKey: []byte("secret-key"), Issuer: "issuer", Clock: fixedClock{current: now}})
+	if err != nil {
+		t.Fatalf("new validator: %v", err)
+	}
+	tokenValue := mintToken(t, []byte("secret-key"), "issuer", now, time.Minute)
+	allowed := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusNoContent)
+	})
+
+	authorized := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/reports", nil)
+	request.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: tokenValue})
+	validator.Middleware(nil)(RequireAnyRole("user").Middleware(nil)(allowed)).ServeHTTP(authorized, request)
+	if authorized.Code != http.StatusNoContent {
+		t.Fatalf("expected role holder to pass, got %d", authorized.Code)
+	}
+
+	forbidden := httptest.NewRecorder()
+	request = httptest.NewRequest(http.MethodGet, "/admin", nil)
+	request.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: tokenValue})
+	validator.Middleware(nil)(RequireAllRoles("user", "admin").Middleware(JSONForbidden())(allowed)).ServeHTTP(forbidden, request)
+	if forbidden.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", forbidden.Code)
+	}
+	var body struct {
+		Error         string   `json:"error"`
+		Reason        string   `json:"reason"`
+		RequiredRoles []string `json:"required_roles"`
+	}
+	if decodeErr := json.Unmarshal(forbidden.Body.Bytes(), &body); decodeErr != nil {
+		t.Fatalf("decode body: %v", decodeErr)
+	}
+	if body.Error != "forbidden" || body.Reason != ErrMissingRole.Error() || !slices.Equal(body.RequiredRoles, []string{"user", "admin"}) {
+		t.Fatalf("unexpected body %+v", body)
+	}
+
+	unauthenticated := httptest.NewRecorder()
+	RequireAnyRole("user").Middleware(nil)(allowed).ServeHTTP(unauthenticated, httptest.NewRequest(http.MethodGet, "/admin", nil))
+	if unauthenticated.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without validated claims, got %d", unauthenticated.Code)
+	}
+}
+
+func TestRequirementGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	now := time.Unix(1700000000, 0).UTC()
+	validator, err := New(Config{SigningKey: []byte("secret-key"), Issuer: "issuer", Clock: fixedClock{current: now}})
+	if err != nil {
+		t.Fatalf("new validator: %v", err)
+	}
+	var recordedErrs []*gin.Error
+	router := gin.New()
+	router.Use(func(contextGin *gin.Context) {
+		contextGin.Next()
+		recordedErrs = contextGin.Errors
+	})
+	router.Use(validator.GinMiddleware(""))
+	router.GET("/reports", RequireAnyRole("user", "auditor").GinMiddleware(nil), func(contextGin *gin.Context) {
+		contextGin.Status(http.StatusOK)
+	})
+	router.GET("/admin", RequireAnyRole("admin").GinMiddleware(nil), func(contextGin *gin.Context) {
+		t.Fatalf("handler must not run without the admin role")
+	})
+
+	tokenValue := mintToken(t, []byte("secret-key"), "issuer", now, time.Minute)
+	testCases := []struct {
+		path           string
+		expectedStatus int
+	}{
+		{path: "/reports", expectedStatus: http.StatusOK},
+		{path: "/admin", expectedStatus: http.StatusForbidden},
+	}
+	for _, testCase := range testCases {
+		request := httptest.NewRequest(http.MethodGet, testCase.path, nil)
+		request.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: tokenValue})
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		if response.Code != testCase.expectedStatus {
+			t.Fatalf("%s: expected %d, got %d", testCase.path, testCase.expectedStatus, response.Code)
+		}
+	}
+	if len(recordedErrs) != 1 || !errors.Is(recordedErrs[0].Err, ErrMissingRole) {
+		t.Fatalf("expected authorization error recorded on the gin context, got %v", recordedErrs)
+	}
+}
@@ -0,0 +1,108 @@
+package sessionvalidator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidClaimsPolicy indicates a negative Leeway or MaxTokenAge, or an empty RequiredClaims entry.
+	ErrInvalidClaimsPolicy = errors.New("session.validator.invalid_claims_policy")
+	// ErrMissingClaim indicates the token lacks a claim listed in RequiredClaims.
+	ErrMissingClaim = errors.New("session.validator.missing_claim")
+	// ErrTokenNotYetValid indicates the token's nbf or iat lies in the future beyond the leeway.
+	ErrTokenNotYetValid = errors.New("session.validator.not_yet_valid")
+	// ErrTokenTooOld indicates the token was issued longer than MaxTokenAge ago.
+	ErrTokenTooOld = errors.New("session.validator.token_too_old")
+)
+
+// claimsPolicy holds the time and presence rules applied after the signature is verified.
+type claimsPolicy struct {
+	leeway         time.Duration
+	requiredClaims []string
+	maxTokenAge    time.Duration
+}
+
+func newClaimsPolicy(configuration Config) (claimsPolicy, error) {
+	if configuration.Leeway < 0 || configuration.MaxTokenAge < 0 {
+		return claimsPolicy{}, ErrInvalidClaimsPolicy
+	}
+	requiredClaims := make([]string, 0, len(configuration.RequiredClaims)+1)
+	for _, name := range configuration.RequiredClaims {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return claimsPolicy{}, ErrInvalidClaimsPolicy
+		}
+		requiredClaims = append(requiredClaims, name)
+	}
+	if configuration.MaxTokenAge > 0 {
+		// The age cap is meaningless for tokens that do not say when they were issued.
+		requiredClaims = append(requiredClaims, "iat")
+	}
+	return claimsPolicy{
+		leeway:         configuration.Leeway,
+		requiredClaims: requiredClaims,
+		maxTokenAge:    configuration.MaxTokenAge,
+	}, nil
+}
+
+func (policy claimsPolicy) check(claims *Claims, current time.Time) error {
+	for _, name := range policy.requiredClaims {
+		if !hasClaim(claims, name) {
+			return fmt.Errorf("%w: %s", ErrMissingClaim, name)
+		}
+	}
+	if claims.ExpiresAt != nil && current.After(claims.ExpiresAt.Add(policy.leeway)) {
+		return ErrTokenExpired
+	}
+	if claims.NotBefore != nil && current.Add(policy.leeway).Before(claims.NotBefore.Time) {
+		return ErrTokenNotYetValid
+	}
+	if claims.IssuedAt != nil && current.Add(policy.leeway).Before(claims.IssuedAt.Time) {
+		return ErrTokenNotYetValid
+	}
+	if policy.maxTokenAge > 0 && current.Sub(claims.IssuedAt.Time) > policy.maxTokenAge+policy.leeway {
+		return ErrTokenTooOld
+	}
+	return nil
+}
+
+// hasClaim reports whether the named registered, TAuth, or custom claim is present.
+func hasClaim(claims *Claims, name string) bool {
+	switch name {
+	case "iss":
+		return claims.Issuer != ""
+	case "sub":
+		return claims.Subject != ""
+	case "aud":
+		return len(claims.Audience) > 0
+	case "exp":
+		return claims.ExpiresAt != nil
+	case "nbf":
+		return claims.NotBefore != nil
+	case "iat":
+		return claims.IssuedAt != nil
+	case "jti":
+		return claims.ID != ""
+	case "sid":
+		return claims.SessionID != ""
+	case "amr":
+		return len(claims.AuthMethods) > 0
+	case "auth_time":
+		return claims.AuthTime != nil
+	case "user_id":
+		return claims.UserID != ""
+	case "user_email":
+		return claims.UserEmail != ""
+	case "user_display_name":
+		return claims.UserDisplayName != ""
+	case "user_avatar_url":
+		return claims.UserAvatarURL != ""
+	case "user_roles":
+		return len(claims.UserRoles) > 0
+	}
+	_, ok := claims.CustomClaim(name)
+	return ok
+}
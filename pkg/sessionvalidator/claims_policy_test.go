@@ -0,0 +1,121 @@
+package sessionvalidator
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestValidateTokenClaimsPolicy(t *testing.T) {
+	t.Parallel()
+
+	issuedAt := time.Unix(1700000000, 0).UTC()
+	mintWithAuthMethods := func(tokenID string, custom map[string]interface{}, authMethods []string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+			UserID:      "user-123",
+			AuthMethods: authMethods,
+			Custom:      custom,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "issuer",
+				Subject:   "user-123",
+				ID:        tokenID,
+				IssuedAt:  jwt.NewNumericDate(issuedAt),
+				NotBefore: jwt.NewNumericDate(issuedAt),
+				ExpiresAt: jwt.NewNumericDate(issuedAt.Add(time.Hour)),
+			},
+		})
+		signed, err := token.SignedString([]byte("secret-key"))
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return signed
+	}
+	mint := func(tokenID string, custom map[string]interface{}) string {
+		return mintWithAuthMethods(tokenID, custom, nil)
+	}
+
+	testCases := []struct {
+		name        string
+		config      Config
+		now         time.Time
+		token       string
+		expectedErr error
+	}{
+		{name: "IssuedInFutureWithoutLeeway", now: issuedAt.Add(-5 * time.Second), token: mint("", nil), expectedErr: ErrTokenNotYetValid},
+		{name: "IssuedInFutureWithinLeeway", config: Config{Leeway: 10 * time.Second}, now: issuedAt.Add(-5 * time.Second), token: mint("", nil)},
+		{name: "IssuedInFutureBeyondLeeway", config: Config{Leeway: 10 * time.Second}, now: issuedAt.Add(-time.Minute), token: mint("", nil), expectedErr: ErrTokenNotYetValid},
+		{name: "ExpiredWithinLeeway", config: Config{Leeway: 10 * time.Second}, now: issuedAt.Add(time.Hour + 5*time.Second), token: mint("", nil)},
+		{name: "ExpiredBeyondLeeway", config: Config{Leeway: 10 * time.Second}, now: issuedAt.Add(time.Hour + time.Minute), token: mint("", nil), expectedErr: ErrTokenExpired},
+		{name: "RequiredClaimsPresent", config: Config{RequiredClaims: []string{"sub", "iat", "jti", "acme/tenant_id"}}, now: issuedAt, token: mint("token-1", map[string]interface{}{"acme/tenant_id": "t-1"})},
+		{name: "RequiredRegisteredClaimMissing", config: Config{RequiredClaims: []string{"sub", "jti"}}, now: issuedAt, token: mint("", nil), expectedErr: ErrMissingClaim},
+		{name: "RequiredCustomClaimMissing", config: Config{RequiredClaims: []string{"acme/tenant_id"}}, now: issuedAt, token: mint("token-1", nil), expectedErr: ErrMissingClaim},
+		{name: "RequiredAuthMethodsPresent", config: Config{RequiredClaims: []string{"amr"}}, now: issuedAt, token: mintWithAuthMethods("token-1", nil, []string{AuthMethodOTP, AuthMethodMFA})},
+		{name: "RequiredAuthMethodsMissing", config: Config{RequiredClaims: []string{"amr"}}, now: issuedAt, token: mint("token-1", nil), expectedErr: ErrMissingClaim},
+		{name: "WithinMaxAge", config: Config{MaxTokenAge: 10 * time.Minute}, now: issuedAt.Add(9 * time.Minute), token: mint("", nil)},
+		{name: "BeyondMaxAge", config: Config{MaxTokenAge: 10 * time.Minute}, now: issuedAt.Add(11 * time.Minute), token: mint("", nil), expectedErr: ErrTokenTooOld},
+		{name: "MaxAgeHonoursLeeway", config: Config{MaxTokenAge: 10 * time.Minute, Leeway: 2 * time.Minute}, now: issuedAt.Add(11 * time.Minute), token: mint("", nil)},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			configuration := testCase.config
+			configuration.SigningKey = []byte("secret-key")
+			configuration.Issuer = "issuer"
+			configuration.Clock = fixedClock{current: testCase.now}
+			validator, err := New(configuration)
+			if err != nil {
+				t.Fatalf("new validator: %v", err)
+			}
+			_, validateErr := validator.ValidateToken(testCase.token)
+			if testCase.expectedErr == nil {
+				if validateErr != nil {
+					t.Fatalf("expected token to validate, got %v", validateErr)
+				}
+				return
+			}
+			if !errors.Is(validateErr, testCase.expectedErr) {
+				t.Fatalf("expected %v, got %v", testCase.expectedErr, validateErr)
+			}
+		})
+	}
+}
+
+func TestMaxTokenAgeRequiresIssuedAt(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0).UTC()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		UserID:           "user-123",
+		RegisteredClaims: jwt.RegisteredClaims{Issuer: "issuer", ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute))},
+	})
+	signed, err := token.SignedString([]byte("secret-key"))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	validator, err := New(Config{SigningKey: []byte("secret-key"), Issuer: "issuer", MaxTokenAge: time.Hour, Clock: fixedClock{current: now}})
+	if err != nil {
+		t.Fatalf("new validator: %v", err)
+	}
+	if _, validateErr := validator.ValidateToken(signed); !errors.Is(validateErr, ErrMissingClaim) {
+		t.Fatalf("expected token without iat to be rejected, got %v", validateErr)
+	}
+}
+
+func TestNewRejectsInvalidClaimsPolicy(t *testing.T) {
+	t.Parallel()
+
+	for _, configuration := range []Config{
+		{Leeway: -time.Second},
+		{MaxTokenAge: -time.Second},
+		{RequiredClaims: []string{"sub", " "}},
+	} {
+		configuration.SigningKey = []byte("secret-key")
+		configuration.Issuer = "issuer"
+		if _, err := New(configuration); !errors.Is(err, ErrInvalidClaimsPolicy) {
+			t.Fatalf("expected invalid claims policy for %+v, got %v", configuration, err)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package sessionvalidator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrReservedClaim indicates a custom claim reuses a registered or TAuth claim name.
+var ErrReservedClaim = errors.New("session.validator.reserved_claim")
+
+var claimNames = sync.OnceValue(func() []string {
+	return collectJSONFieldNames(reflect.TypeOf(Claims{}))
+})
+
+// ClaimNames lists the registered and TAuth claim names decoded into Claims.
+// Custom claims may not reuse them.
+func ClaimNames() []string {
+	return slices.Clone(claimNames())
+}
+
+// IsReservedClaim reports whether name is one of ClaimNames.
+func IsReservedClaim(name string) bool {
+	return slices.Contains(claimNames(), name)
+}
+
+func collectJSONFieldNames(structType reflect.Type) []string {
+	names := make([]string, 0, structType.NumField())
+	for index := 0; index < structType.NumField(); index++ {
+		field := structType.Field(index)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			names = append(names, collectJSONFieldNames(field.Type)...)
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// plainClaims drops the JSON methods of Claims so they can delegate to the default encoding.
+type plainClaims Claims
+
+// MarshalJSON encodes the standard claims and merges Custom into the payload.
+func (claims Claims) MarshalJSON() ([]byte, error) {
+	encoded, encodeErr := json.Marshal(plainClaims(claims))
+	if encodeErr != nil || len(claims.Custom) == 0 {
+		return encoded, encodeErr
+	}
+	merged := make(map[string]json.RawMessage)
+	if decodeErr := json.Unmarshal(encoded, &merged); decodeErr != nil {
+		return nil, decodeErr
+	}
+	for name, value := range claims.Custom {
+		if IsReservedClaim(name) {
+			return nil, fmt.Errorf("session.validator.claims.%s: %w", name, ErrReservedClaim)
+		}
+		encodedValue, valueErr := json.Marshal(value)
+		if valueErr != nil {
+			return nil, valueErr
+		}
+		merged[name] = encodedValue
+	}
+	return json.Marshal(merged)
+}
+
+// UnmarshalJSON decodes the standard claims and collects every other claim into Custom.
+func (claims *Claims) UnmarshalJSON(data []byte) error {
+	var decoded plainClaims
+	if decodeErr := json.Unmarshal(data, &decoded); decodeErr != nil {
+		return decodeErr
+	}
+	var payload map[string]interface{}
+	if decodeErr := json.Unmarshal(data, &payload); decodeErr != nil {
+		return decodeErr
+	}
+	for name, value := range payload {
+		if IsReservedClaim(name) {
+			continue
+		}
+		if decoded.Custom == nil {
+			decoded.Custom = make(map[string]interface{})
+		}
+		decoded.Custom[name] = value
+	}
+	*claims = Claims(decoded)
+	return nil
+}
+
+// CustomClaim returns a claim added by the issuer's claims enricher. Values
+// carry their JSON-decoded types (string, float64, bool, []interface{}, map).
+func (claims *Claims) CustomClaim(name string) (interface{}, bool) {
+	if claims == nil || claims.Custom == nil {
+		return nil, false
+	}
+	value, ok := claims.Custom[name]
+	return value, ok
+}
+
+// ValidateInto validates the token and decodes its payload into T, so services
+// can declare a struct tagged with the custom claim names they rely on.
+func ValidateInto[T any](validator *Validator, tokenString string) (T, *Claims, error) {
+	var target T
+	signedToken, openErr := validator.openToken(tokenString)
+	if openErr != nil {
+		return target, nil, openErr
+	}
+	claims, validateErr := validator.validateSignedToken(signedToken)
+	if validateErr != nil {
+		return target, nil, validateErr
+	}
+	if revokedErr := validator.checkRevocation(context.Background(), claims); revokedErr != nil {
+		return target, nil, revokedErr
+	}
+	segments := strings.Split(signedToken, ".")
+	if len(segments) != 3 {
+		return target, nil, fmt.Errorf("session.validator.validate_into: %w", ErrInvalidToken)
+	}
+	payload, decodeErr := jwt.NewParser().DecodeSegment(segments[1])
+	if decodeErr != nil {
+		return target, nil, fmt.Errorf("session.validator.validate_into: %w", ErrInvalidToken)
+	}
+	if unmarshalErr := json.Unmarshal(payload, &target); unmarshalErr != nil {
+		return target, nil, fmt.Errorf("session.validator.validate_into: %w: %v", ErrInvalidToken, unmarshalErr)
+	}
+	return target, claims, nil
+}
@@ -0,0 +1,80 @@
+package sessionvalidator
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestClaimsRoundTripCustomClaims(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0).UTC()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		UserID: "user-123",
+		Custom: map[string]interface{}{"acme/tenant_id": "tenant-42", "acme/seats": 5},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "issuer",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	})
+	signed, err := token.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	validator, err := New(Config{SigningKey: []byte("secret"), Issuer: "issuer", Clock: fixedClock{current: now}})
+	if err != nil {
+		t.Fatalf("new validator: %v", err)
+	}
+
+	claims, validateErr := validator.ValidateToken(signed)
+	if validateErr != nil {
+		t.Fatalf("validate token: %v", validateErr)
+	}
+	if claims.UserID != "user-123" || claims.Issuer != "issuer" {
+		t.Fatalf("standard claims not decoded: %#v", claims)
+	}
+	if tenant, ok := claims.CustomClaim("acme/tenant_id"); !ok || tenant != "tenant-42" {
+		t.Fatalf("unexpected tenant claim %v", tenant)
+	}
+	if seats, ok := claims.CustomClaim("acme/seats"); !ok || seats != float64(5) {
+		t.Fatalf("unexpected seats claim %v", seats)
+	}
+	if _, ok := claims.CustomClaim("iss"); ok {
+		t.Fatalf("registered claims must not appear as custom claims")
+	}
+
+	typed, _, intoErr := ValidateInto[struct {
+		TenantID string `json:"acme/tenant_id"`
+		Seats    int    `json:"acme/seats"`
+	}](validator, signed)
+	if intoErr != nil {
+		t.Fatalf("validate into: %v", intoErr)
+	}
+	if typed.TenantID != "tenant-42" || typed.Seats != 5 {
+		t.Fatalf("unexpected typed claims %#v", typed)
+	}
+	if _, _, intoErr := ValidateInto[struct{}](validator, "not-a-token"); !errors.Is(intoErr, ErrInvalidToken) {
+		t.Fatalf("expected invalid token error, got %v", intoErr)
+	}
+}
+
+func TestClaimsMarshalRejectsReservedCustomClaims(t *testing.T) {
+	t.Parallel()
+
+	_, err := json.Marshal(Claims{UserID: "user-123", Custom: map[string]interface{}{"user_roles": []string{"admin"}}})
+	if !errors.Is(err, ErrReservedClaim) {
+		t.Fatalf("expected reserved claim error, got %v", err)
+	}
+	names := ClaimNames()
+	for _, expected := range []string{"user_id", "user_email", "user_display_name", "user_avatar_url", "user_roles", "iss", "sub", "aud", "exp", "nbf", "iat", "jti"} {
+		if !slices.Contains(names, expected) {
+			t.Fatalf("expected %q in claim names %v", expected, names)
+		}
+	}
+}
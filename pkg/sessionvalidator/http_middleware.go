@@ -0,0 +1,118 @@
+package sessionvalidator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type claimsContextKey struct{}
+
+// ContextWithClaims returns a copy of ctx carrying the validated session claims.
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by Middleware or GinMiddleware.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// UnauthorizedHandler writes the response for a request whose session failed
+// validation. The error wraps one of the validator's sentinel errors.
+type UnauthorizedHandler func(writer http.ResponseWriter, request *http.Request, validationErr error)
+
+// PlainUnauthorized responds with a bare 401 status. It is the default handler.
+func PlainUnauthorized() UnauthorizedHandler {
+	return func(writer http.ResponseWriter, request *http.Request, validationErr error) {
+		writer.WriteHeader(http.StatusUnauthorized)
+	}
+}
+
+// JSONUnauthorized responds with 401 and a JSON body such as
+// {"error":"unauthorized","reason":"session.validator.expired"}.
+func JSONUnauthorized() UnauthorizedHandler {
+	return func(writer http.ResponseWriter, request *http.Request, validationErr error) {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(writer).Encode(map[string]string{
+			"error":  "unauthorized",
+			"reason": ValidationErrorCode(validationErr),
+		})
+	}
+}
+
+// RedirectUnauthorized sends browsers to loginURL with 302 Found (303 See Other
+// for non-GET requests) so they can establish a session.
+func RedirectUnauthorized(loginURL string) UnauthorizedHandler {
+	return func(writer http.ResponseWriter, request *http.Request, validationErr error) {
+		status := http.StatusFound
+		if request.Method != http.MethodGet && request.Method != http.MethodHead {
+			status = http.StatusSeeOther
+		}
+		http.Redirect(writer, request, loginURL, status)
+	}
+}
+
+// WWWAuthenticateUnauthorized responds with 401 and an RFC 6750 style
+// WWW-Authenticate challenge for the given realm.
+func WWWAuthenticateUnauthorized(realm string) UnauthorizedHandler {
+	return func(writer http.ResponseWriter, request *http.Request, validationErr error) {
+		challenge := fmt.Sprintf("Bearer realm=%q", realm)
+		if !errors.Is(validationErr, ErrNoCredentials) && !errors.Is(validationErr, ErrMissingToken) {
+			challenge += `, error="invalid_token"`
+		}
+		writer.Header().Set("WWW-Authenticate", challenge)
+		writer.WriteHeader(http.StatusUnauthorized)
+	}
+}
+
+var validationSentinels = []error{
+	ErrMissingToken,
+	ErrNoCredentials,
+	ErrMalformedAuthorization,
+	ErrTokenExpired,
+	ErrTokenNotYetValid,
+	ErrTokenTooOld,
+	ErrMissingClaim,
+	ErrTokenRevoked,
+	ErrRevocationUnavailable,
+	ErrInvalidIssuer,
+	ErrInvalidAudience,
+	ErrEncryptionRequired,
+	ErrKeySetUnavailable,
+	ErrInvalidToken,
+}
+
+// ValidationErrorCode returns the stable code (e.g. "session.validator.expired")
+// of the sentinel wrapped by a validation error.
+func ValidationErrorCode(validationErr error) string {
+	for _, sentinel := range validationSentinels {
+		if errors.Is(validationErr, sentinel) {
+			return sentinel.Error()
+		}
+	}
+	return ErrInvalidToken.Error()
+}
+
+// Middleware returns net/http middleware (compatible with chi and similar
+// routers) that validates the session token and stores the claims in the
+// request context. A nil onUnauthorized falls back to PlainUnauthorized.
+func (validator *Validator) Middleware(onUnauthorized UnauthorizedHandler) func(http.Handler) http.Handler {
+	if onUnauthorized == nil {
+		onUnauthorized = PlainUnauthorized()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			claims, validateErr := validator.ValidateRequest(request)
+			if validateErr != nil {
+				onUnauthorized(writer, request, validateErr)
+				return
+			}
+			next.ServeHTTP(writer, request.WithContext(ContextWithClaims(request.Context(), claims)))
+		})
+	}
+}
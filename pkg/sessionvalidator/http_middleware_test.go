@@ -0,0 +1,125 @@
+package sessionvalidator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareStoresClaimsInContext(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0).UTC()
+	validator, err := New(Config{SigningKey: []byte("secret-key"), Issuer: "issuer", Clock: fixedClock{current: now}})
+	if err != nil {
+		t.Fatalf("new validator: %v", err)
+	}
+	handler := validator.Middleware(nil)(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		claims, ok := ClaimsFromContext(request.Context())
+		if !ok {
+			t.Fatalf("claims missing from context")
+		}
+		_, _ = writer.Write([]byte(claims.GetUserID()))
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	request.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: mintToken(t, []byte("secret-key"), "issuer", now, time.Minute)})
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK || response.Body.String() != "user-123" {
+		t.Fatalf("expected 200 with user id, got %d %q", response.Code, response.Body.String())
+	}
+
+	missingResponse := httptest.NewRecorder()
+	handler.ServeHTTP(missingResponse, httptest.NewRequest(http.MethodGet, "/protected", nil))
+	if missingResponse.Code != http.StatusUnauthorized || missingResponse.Body.Len() != 0 {
+		t.Fatalf("expected bare 401 by default, got %d %q", missingResponse.Code, missingResponse.Body.String())
+	}
+
+	if _, ok := ClaimsFromContext(context.Background()); ok {
+		t.Fatalf("expected no claims in empty context")
+	}
+}
+
+func TestMiddlewareUnauthorizedResponses(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0).UTC()
+	validator, err := New(Config{SigningKey: []byte("secret-key"), Issuer: "issuer", Clock: fixedClock{current: now}})
+	if err != nil {
+		t.Fatalf("new validator: %v", err)
+	}
+	expiredToken := mintToken(t, []byte("secret-key"), "issuer", now.Add(-time.Hour), time.Minute)
+	unreachable := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Fatalf("next handler must not run for unauthorized requests")
+	})
+
+	testCases := []struct {
+		name           string
+		handler        UnauthorizedHandler
+		method         string
+		withToken      bool
+		expectedStatus int
+		assert         func(t *testing.T, response *httptest.ResponseRecorder)
+	}{
+		{
+			name: "JSON", handler: JSONUnauthorized(), method: http.MethodGet, withToken: true, expectedStatus: http.StatusUnauthorized,
+			assert: func(t *testing.T, response *httptest.ResponseRecorder) {
+				var body map[string]string
+				if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+					t.Fatalf("decode body: %v", err)
+				}
+				if body["error"] != "unauthorized" || body["reason"] != ErrTokenExpired.Error() {
+					t.Fatalf("unexpected body %v", body)
+				}
+			},
+		},
+		{
+			name: "RedirectGet", handler: RedirectUnauthorized("/login"), method: http.MethodGet, expectedStatus: http.StatusFound,
+			assert: func(t *testing.T, response *httptest.ResponseRecorder) {
+				if response.Header().Get("Location") != "/login" {
+					t.Fatalf("unexpected location %q", response.Header().Get("Location"))
+				}
+			},
+		},
+		{
+			name: "RedirectPost", handler: RedirectUnauthorized("/login"), method: http.MethodPost, expectedStatus: http.StatusSeeOther,
+			assert: func(t *testing.T, response *httptest.ResponseRecorder) {},
+		},
+		{
+			name: "ChallengeMissingCookie", handler: WWWAuthenticateUnauthorized("tauth"), method: http.MethodGet, expectedStatus: http.StatusUnauthorized,
+			assert: func(t *testing.T, response *httptest.ResponseRecorder) {
+				if challenge := response.Header().Get("WWW-Authenticate"); challenge != `Bearer realm="tauth"` {
+					t.Fatalf("unexpected challenge %q", challenge)
+				}
+			},
+		},
+		{
+			name: "ChallengeInvalidToken", handler: WWWAuthenticateUnauthorized("tauth"), method: http.MethodGet, withToken: true, expectedStatus: http.StatusUnauthorized,
+			assert: func(t *testing.T, response *httptest.ResponseRecorder) {
+				if challenge := response.Header().Get("WWW-Authenticate"); challenge != `Bearer realm="tauth", error="invalid_token"` {
+					t.Fatalf("unexpected challenge %q", challenge)
+				}
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			request := httptest.NewRequest(testCase.method, "/protected", nil)
+			if testCase.withToken {
+				request.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: expiredToken})
+			}
+			response := httptest.NewRecorder()
+			validator.Middleware(testCase.handler)(unreachable).ServeHTTP(response, request)
+			if response.Code != testCase.expectedStatus {
+				t.Fatalf("expected %d, got %d", testCase.expectedStatus, response.Code)
+			}
+			testCase.assert(t, response)
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package sessionvalidator
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// EncryptionKeySize is the length in bytes of an A256GCM content encryption key.
+	EncryptionKeySize = 32
+
+	jweAlgorithmDirect     = "dir"
+	jweEncryptionA256GCM   = "A256GCM"
+	jweContentTypeJWT      = "JWT"
+	encryptionKeyIDLength  = 16
+	compactJWESegmentCount = 5
+)
+
+var (
+	// ErrInvalidEncryptionKey indicates an encryption key is not 256 bits long.
+	ErrInvalidEncryptionKey = errors.New("session.validator.invalid_encryption_key")
+	// ErrEncryptionRequired indicates an unencrypted token was presented to a validator that requires JWE.
+	ErrEncryptionRequired = errors.New("session.validator.encryption_required")
+)
+
+// EncryptionKey is a shared A256GCM key used to seal session tokens in a
+// compact JWE ("dir" key management). Construct it with NewEncryptionKey.
+type EncryptionKey struct {
+	keyID string
+	key   []byte
+}
+
+// NewEncryptionKey validates a 256-bit key. The key ID is derived from the key
+// without revealing it, so TAuth and validators agree on it independently.
+func NewEncryptionKey(key []byte) (EncryptionKey, error) {
+	if len(key) != EncryptionKeySize {
+		return EncryptionKey{}, fmt.Errorf("session.validator.encryption_key: %w", ErrInvalidEncryptionKey)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("tauth.encryption_key_id"))
+	return EncryptionKey{
+		keyID: base64.RawURLEncoding.EncodeToString(mac.Sum(nil))[:encryptionKeyIDLength],
+		key:   append([]byte(nil), key...),
+	}, nil
+}
+
+// KeyID returns the identifier carried in the JWE kid header.
+func (encryptionKey EncryptionKey) KeyID() string {
+	return encryptionKey.keyID
+}
+
+type jweHeader struct {
+	Algorithm   string `json:"alg"`
+	Encryption  string `json:"enc"`
+	ContentType string `json:"cty,omitempty"`
+	KeyID       string `json:"kid,omitempty"`
+}
+
+// EncryptToken seals a signed session token in a compact JWE using direct
+// encryption with A256GCM. The signature stays inside, so validators still
+// verify the issuer after decrypting.
+func EncryptToken(signedToken string, encryptionKey EncryptionKey) (string, error) {
+	if len(encryptionKey.key) != EncryptionKeySize {
+		return "", fmt.Errorf("session.validator.encrypt_token: %w", ErrInvalidEncryptionKey)
+	}
+	headerJSON, headerErr := json.Marshal(jweHeader{
+		Algorithm:   jweAlgorithmDirect,
+		Encryption:  jweEncryptionA256GCM,
+		ContentType: jweContentTypeJWT,
+		KeyID:       encryptionKey.keyID,
+	})
+	if headerErr != nil {
+		return "", fmt.Errorf("session.validator.encrypt_token: %w", headerErr)
+	}
+	aead, aeadErr := newContentCipher(encryptionKey.key)
+	if aeadErr != nil {
+		return "", fmt.Errorf("session.validator.encrypt_token: %w", aeadErr)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, randErr := rand.Read(nonce); randErr != nil {
+		return "", fmt.Errorf("session.validator.encrypt_token: %w", randErr)
+	}
+	protectedHeader := encodeSegment(headerJSON)
+	sealed := aead.Seal(nil, nonce, []byte(signedToken), []byte(protectedHeader))
+	tagOffset := len(sealed) - aead.Overhead()
+	return strings.Join([]string{
+		protectedHeader,
+		"",
+		encodeSegment(nonce),
+		encodeSegment(sealed[:tagOffset]),
+		encodeSegment(sealed[tagOffset:]),
+	}, "."), nil
+}
+
+// isEncryptedToken reports whether the token uses the five-segment JWE compact form.
+func isEncryptedToken(token string) bool {
+	return strings.Count(token, ".") == compactJWESegmentCount-1
+}
+
+func decryptToken(token string, encryptionKeys []EncryptionKey) (string, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != compactJWESegmentCount || segments[1] != "" {
+		return "", ErrInvalidToken
+	}
+	headerJSON, headerErr := decodeSegment(segments[0])
+	if headerErr != nil {
+		return "", ErrInvalidToken
+	}
+	var header jweHeader
+	if decodeErr := json.Unmarshal(headerJSON, &header); decodeErr != nil {
+		return "", ErrInvalidToken
+	}
+	if header.Algorithm != jweAlgorithmDirect || header.Encryption != jweEncryptionA256GCM {
+		return "", ErrInvalidToken
+	}
+	nonce, nonceErr := decodeSegment(segments[2])
+	ciphertext, ciphertextErr := decodeSegment(segments[3])
+	tag, tagErr := decodeSegment(segments[4])
+	if nonceErr != nil || ciphertextErr != nil || tagErr != nil {
+		return "", ErrInvalidToken
+	}
+	sealed := append(ciphertext, tag...)
+	for _, encryptionKey := range encryptionKeys {
+		if header.KeyID != "" && header.KeyID != encryptionKey.keyID {
+			continue
+		}
+		aead, aeadErr := newContentCipher(encryptionKey.key)
+		if aeadErr != nil || len(nonce) != aead.NonceSize() {
+			continue
+		}
+		plaintext, openErr := aead.Open(nil, nonce, sealed, []byte(segments[0]))
+		if openErr == nil {
+			return string(plaintext), nil
+		}
+	}
+	return "", ErrUnknownKey
+}
+
+func newContentCipher(key []byte) (cipher.AEAD, error) {
+	block, blockErr := aes.NewCipher(key)
+	if blockErr != nil {
+		return nil, blockErr
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,99 @@
+package sessionvalidator
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustEncryptionKey(t *testing.T, fill byte) EncryptionKey {
+	t.Helper()
+	encryptionKey, err := NewEncryptionKey(bytes.Repeat([]byte{fill}, EncryptionKeySize))
+	if err != nil {
+		t.Fatalf("new encryption key: %v", err)
+	}
+	return encryptionKey
+}
+
+func TestEncryptedTokenRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0).UTC()
+	currentKey := mustEncryptionKey(t, 1)
+	previousKey := mustEncryptionKey(t, 2)
+	validator, err := New(Config{
+		SigningKey:     []byte("secret-key"),
+		Issuer:         "issuer",
+		EncryptionKeys: []EncryptionKey{currentKey, previousKey},
+		Clock:          fixedClock{current: now},
+	})
+	if err != nil {
+		t.Fatalf("new validator: %v", err)
+	}
+	signed := mintToken(t, []byte("secret-key"), "issuer", now, time.Minute)
+
+	for _, encryptionKey := range []EncryptionKey{currentKey, previousKey} {
+		encrypted, encryptErr := EncryptToken(signed, encryptionKey)
+		if encryptErr != nil {
+			t.Fatalf("encrypt token: %v", encryptErr)
+		}
+		if strings.Count(encrypted, ".") != 4 {
+			t.Fatalf("expected compact JWE with five segments, got %q", encrypted)
+		}
+		if strings.Contains(encrypted, strings.Split(signed, ".")[1]) {
+			t.Fatalf("encrypted token leaks the session payload")
+		}
+		for _, segment := range strings.Split(encrypted, ".") {
+			if decoded, _ := decodeSegment(segment); bytes.Contains(decoded, []byte("user@example.com")) {
+				t.Fatalf("encrypted token leaks the user email")
+			}
+		}
+		claims, validateErr := validator.ValidateToken(encrypted)
+		if validateErr != nil {
+			t.Fatalf("validate encrypted token: %v", validateErr)
+		}
+		if claims.GetUserEmail() != "user@example.com" {
+			t.Fatalf("unexpected email %q", claims.GetUserEmail())
+		}
+	}
+
+	if _, validateErr := validator.ValidateToken(signed); !errors.Is(validateErr, ErrEncryptionRequired) {
+		t.Fatalf("expected unencrypted token to be rejected, got %v", validateErr)
+	}
+	foreign, _ := EncryptToken(signed, mustEncryptionKey(t, 3))
+	if _, validateErr := validator.ValidateToken(foreign); !errors.Is(validateErr, ErrInvalidToken) {
+		t.Fatalf("expected token sealed with unknown key to be rejected, got %v", validateErr)
+	}
+	encrypted, _ := EncryptToken(signed, currentKey)
+	segments := strings.Split(encrypted, ".")
+	ciphertext, _ := decodeSegment(segments[3])
+	ciphertext[0] ^= 0xff
+	segments[3] = encodeSegment(ciphertext)
+	if _, validateErr := validator.ValidateToken(strings.Join(segments, ".")); !errors.Is(validateErr, ErrInvalidToken) {
+		t.Fatalf("expected tampered ciphertext to be rejected, got %v", validateErr)
+	}
+
+	plainValidator, err := New(Config{SigningKey: []byte("secret-key"), Issuer: "issuer", Clock: fixedClock{current: now}})
+	if err != nil {
+		t.Fatalf("new validator: %v", err)
+	}
+	if _, validateErr := plainValidator.ValidateToken(encrypted); !errors.Is(validateErr, ErrInvalidToken) {
+		t.Fatalf("expected validator without keys to reject JWE, got %v", validateErr)
+	}
+}
+
+func TestNewEncryptionKeyRequires256Bits(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewEncryptionKey([]byte("too-short")); !errors.Is(err, ErrInvalidEncryptionKey) {
+		t.Fatalf("expected ErrInvalidEncryptionKey, got %v", err)
+	}
+	if _, err := New(Config{SigningKey: []byte("secret"), Issuer: "issuer", EncryptionKeys: []EncryptionKey{{}}}); !errors.Is(err, ErrInvalidEncryptionKey) {
+		t.Fatalf("expected zero-value encryption key to be rejected, got %v", err)
+	}
+	if mustEncryptionKey(t, 1).KeyID() == mustEncryptionKey(t, 2).KeyID() {
+		t.Fatalf("expected distinct keys to derive distinct key ids")
+	}
+}
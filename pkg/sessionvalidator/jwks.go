@@ -0,0 +1,195 @@
+package sessionvalidator
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JSON Web Key type and curve identifiers supported by TAuth.
+const (
+	keyTypeRSA       = "RSA"
+	keyTypeEC        = "EC"
+	keyTypeOctetPair = "OKP"
+	keyUseSignature  = "sig"
+	curveP256        = "P-256"
+	curveP384        = "P-384"
+	curveP521        = "P-521"
+	curveEd25519     = "Ed25519"
+)
+
+// Sentinel errors describing JSON Web Key failures.
+var (
+	ErrUnsupportedKey = errors.New("session.validator.unsupported_key")
+	ErrInvalidKeySet  = errors.New("session.validator.invalid_key_set")
+)
+
+// JSONWebKey is the public half of a signing key encoded per RFC 7517.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	Modulus   string `json:"n,omitempty"`
+	Exponent  string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet is the document served at /.well-known/jwks.json.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// NewJSONWebKey encodes an RSA, ECDSA, or Ed25519 public key as a signature JWK.
+func NewJSONWebKey(publicKey crypto.PublicKey, keyID string) (JSONWebKey, error) {
+	algorithm, algorithmErr := AlgorithmForPublicKey(publicKey)
+	if algorithmErr != nil {
+		return JSONWebKey{}, fmt.Errorf("session.validator.new_jwk: %w", algorithmErr)
+	}
+	webKey := JSONWebKey{Use: keyUseSignature, KeyID: keyID, Algorithm: algorithm}
+	switch typedKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		webKey.KeyType = keyTypeRSA
+		webKey.Modulus = encodeSegment(typedKey.N.Bytes())
+		webKey.Exponent = encodeSegment(big.NewInt(int64(typedKey.E)).Bytes())
+	case *ecdsa.PublicKey:
+		encoded, encodeErr := typedKey.Bytes()
+		if encodeErr != nil {
+			return JSONWebKey{}, fmt.Errorf("session.validator.new_jwk: %w", ErrUnsupportedKey)
+		}
+		coordinateLength := (len(encoded) - 1) / 2
+		webKey.KeyType = keyTypeEC
+		webKey.Curve = typedKey.Curve.Params().Name
+		webKey.X = encodeSegment(encoded[1 : 1+coordinateLength])
+		webKey.Y = encodeSegment(encoded[1+coordinateLength:])
+	case ed25519.PublicKey:
+		webKey.KeyType = keyTypeOctetPair
+		webKey.Curve = curveEd25519
+		webKey.X = encodeSegment(typedKey)
+	}
+	return webKey, nil
+}
+
+// PublicKey decodes the JWK into its crypto.PublicKey representation.
+func (webKey JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch webKey.KeyType {
+	case keyTypeRSA:
+		modulus, modulusErr := decodeSegment(webKey.Modulus)
+		exponent, exponentErr := decodeSegment(webKey.Exponent)
+		if modulusErr != nil || exponentErr != nil || len(modulus) == 0 || len(exponent) == 0 || len(exponent) > 4 {
+			return nil, fmt.Errorf("session.validator.jwk.rsa: %w", ErrInvalidKeySet)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulus),
+			E: int(new(big.Int).SetBytes(exponent).Int64()),
+		}, nil
+	case keyTypeEC:
+		curve, curveErr := curveByName(webKey.Curve)
+		if curveErr != nil {
+			return nil, fmt.Errorf("session.validator.jwk.ec: %w", curveErr)
+		}
+		coordinateX, xErr := decodeSegment(webKey.X)
+		coordinateY, yErr := decodeSegment(webKey.Y)
+		coordinateLength := (curve.Params().BitSize + 7) / 8
+		if xErr != nil || yErr != nil || len(coordinateX) != coordinateLength || len(coordinateY) != coordinateLength {
+			return nil, fmt.Errorf("session.validator.jwk.ec: %w", ErrInvalidKeySet)
+		}
+		uncompressed := append(append([]byte{4}, coordinateX...), coordinateY...)
+		publicKey, parseErr := ecdsa.ParseUncompressedPublicKey(curve, uncompressed)
+		if parseErr != nil {
+			return nil, fmt.Errorf("session.validator.jwk.ec: %w", ErrInvalidKeySet)
+		}
+		return publicKey, nil
+	case keyTypeOctetPair:
+		coordinateX, xErr := decodeSegment(webKey.X)
+		if webKey.Curve != curveEd25519 || xErr != nil || len(coordinateX) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("session.validator.jwk.okp: %w", ErrInvalidKeySet)
+		}
+		return ed25519.PublicKey(coordinateX), nil
+	default:
+		return nil, fmt.Errorf("session.validator.jwk.%s: %w", strings.ToLower(webKey.KeyType), ErrUnsupportedKey)
+	}
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint, suitable as a stable key ID.
+func (webKey JSONWebKey) Thumbprint() string {
+	var canonical string
+	switch webKey.KeyType {
+	case keyTypeRSA:
+		canonical = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, webKey.Exponent, webKey.KeyType, webKey.Modulus)
+	case keyTypeEC:
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, webKey.Curve, webKey.KeyType, webKey.X, webKey.Y)
+	default:
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, webKey.Curve, webKey.KeyType, webKey.X)
+	}
+	digest := sha256.Sum256([]byte(canonical))
+	return encodeSegment(digest[:])
+}
+
+// ParseJSONWebKeySet decodes a JWKS document and verifies every key is usable.
+func ParseJSONWebKeySet(document []byte) (JSONWebKeySet, error) {
+	var keySet JSONWebKeySet
+	if err := json.Unmarshal(document, &keySet); err != nil {
+		return JSONWebKeySet{}, fmt.Errorf("session.validator.parse_jwks: %w", ErrInvalidKeySet)
+	}
+	for _, webKey := range keySet.Keys {
+		if _, keyErr := webKey.PublicKey(); keyErr != nil {
+			return JSONWebKeySet{}, fmt.Errorf("session.validator.parse_jwks: %w", keyErr)
+		}
+	}
+	return keySet, nil
+}
+
+// AlgorithmForPublicKey returns the JWS algorithm TAuth uses for the key type.
+func AlgorithmForPublicKey(publicKey crypto.PublicKey) (string, error) {
+	switch typedKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256.Alg(), nil
+	case *ecdsa.PublicKey:
+		switch typedKey.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256.Alg(), nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384.Alg(), nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512.Alg(), nil
+		}
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA.Alg(), nil
+	}
+	return "", ErrUnsupportedKey
+}
+
+func curveByName(name string) (elliptic.Curve, error) {
+	switch name {
+	case curveP256:
+		return elliptic.P256(), nil
+	case curveP384:
+		return elliptic.P384(), nil
+	case curveP521:
+		return elliptic.P521(), nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+func encodeSegment(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
+
+func decodeSegment(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(value)
+}
@@ -0,0 +1,235 @@
+package sessionvalidator
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func mintSignedToken(t *testing.T, method jwt.SigningMethod, signingKey interface{}, keyID string, issuer string, issuedAt time.Time, ttl time.Duration) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, Claims{
+		UserID:    "user-123",
+		UserEmail: "user@example.com",
+		UserRoles: []string{"user"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   "user-123",
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			NotBefore: jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(ttl)),
+		},
+	})
+	if keyID != "" {
+		token.Header["kid"] = keyID
+	}
+	result, err := token.SignedString(signingKey)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return result
+}
+
+func TestJSONWebKeyRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, rsaErr := rsa.GenerateKey(rand.Reader, 2048)
+	if rsaErr != nil {
+		t.Fatalf("generate rsa key: %v", rsaErr)
+	}
+	ecKey, ecErr := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if ecErr != nil {
+		t.Fatalf("generate ecdsa key: %v", ecErr)
+	}
+	edPublic, _, edErr := ed25519.GenerateKey(rand.Reader)
+	if edErr != nil {
+		t.Fatalf("generate ed25519 key: %v", edErr)
+	}
+
+	testCases := []struct {
+		name              string
+		publicKey         crypto.PublicKey
+		expectedType      string
+		expectedAlgorithm string
+	}{
+		{name: "RSA", publicKey: &rsaKey.PublicKey, expectedType: "RSA", expectedAlgorithm: "RS256"},
+		{name: "ECDSA", publicKey: &ecKey.PublicKey, expectedType: "EC", expectedAlgorithm: "ES384"},
+		{name: "Ed25519", publicKey: edPublic, expectedType: "OKP", expectedAlgorithm: "EdDSA"},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			webKey, err := NewJSONWebKey(testCase.publicKey, "key-1")
+			if err != nil {
+				t.Fatalf("encode jwk: %v", err)
+			}
+			if webKey.KeyType != testCase.expectedType || webKey.Algorithm != testCase.expectedAlgorithm || webKey.Use != "sig" || webKey.KeyID != "key-1" {
+				t.Fatalf("unexpected jwk metadata: %#v", webKey)
+			}
+			encoded, marshalErr := json.Marshal(JSONWebKeySet{Keys: []JSONWebKey{webKey}})
+			if marshalErr != nil {
+				t.Fatalf("marshal jwks: %v", marshalErr)
+			}
+			keySet, parseErr := ParseJSONWebKeySet(encoded)
+			if parseErr != nil {
+				t.Fatalf("parse jwks: %v", parseErr)
+			}
+			decoded, decodeErr := keySet.Keys[0].PublicKey()
+			if decodeErr != nil {
+				t.Fatalf("decode jwk: %v", decodeErr)
+			}
+			comparable, ok := decoded.(interface{ Equal(crypto.PublicKey) bool })
+			if !ok || !comparable.Equal(testCase.publicKey) {
+				t.Fatalf("decoded key does not match original")
+			}
+		})
+	}
+}
+
+func TestParseJSONWebKeySetRejectsMalformedKeys(t *testing.T) {
+	t.Parallel()
+
+	documents := map[string]string{
+		"NotJSON":         `not-json`,
+		"UnsupportedType": `{"keys":[{"kty":"oct","k":"c2VjcmV0"}]}`,
+		"TruncatedCurve":  `{"keys":[{"kty":"EC","crv":"P-256","x":"AQ","y":"AQ"}]}`,
+		"BadEd25519":      `{"keys":[{"kty":"OKP","crv":"Ed25519","x":"AQ"}]}`,
+	}
+	for name, document := range documents {
+		if _, err := ParseJSONWebKeySet([]byte(document)); err == nil {
+			t.Fatalf("%s: expected parse error", name)
+		}
+	}
+}
+
+func TestValidatorAcceptsAsymmetricKeys(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0).UTC()
+	ecKey, ecErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if ecErr != nil {
+		t.Fatalf("generate ecdsa key: %v", ecErr)
+	}
+	edPublic, edPrivate, edErr := ed25519.GenerateKey(rand.Reader)
+	if edErr != nil {
+		t.Fatalf("generate ed25519 key: %v", edErr)
+	}
+
+	publicKeyValidator, err := New(Config{PublicKey: &ecKey.PublicKey, Issuer: "issuer", Clock: fixedClock{current: now}})
+	if err != nil {
+		t.Fatalf("new validator with public key: %v", err)
+	}
+	ecToken := mintSignedToken(t, jwt.SigningMethodES256, ecKey, "", "issuer", now, time.Minute)
+	if _, validateErr := publicKeyValidator.ValidateToken(ecToken); validateErr != nil {
+		t.Fatalf("expected ES256 token to validate, got %v", validateErr)
+	}
+
+	webKey, webKeyErr := NewJSONWebKey(edPublic, "ed-key")
+	if webKeyErr != nil {
+		t.Fatalf("encode jwk: %v", webKeyErr)
+	}
+	keySetValidator, err := New(Config{KeySet: JSONWebKeySet{Keys: []JSONWebKey{webKey}}, Issuer: "issuer", Clock: fixedClock{current: now}})
+	if err != nil {
+		t.Fatalf("new validator with key set: %v", err)
+	}
+	edToken := mintSignedToken(t, jwt.SigningMethodEdDSA, edPrivate, "ed-key", "issuer", now, time.Minute)
+	if _, validateErr := keySetValidator.ValidateToken(edToken); validateErr != nil {
+		t.Fatalf("expected EdDSA token to validate, got %v", validateErr)
+	}
+	if _, validateErr := keySetValidator.ValidateToken(ecToken); !errors.Is(validateErr, ErrInvalidToken) {
+		t.Fatalf("expected token signed by unknown key to be rejected, got %v", validateErr)
+	}
+}
+
+func TestValidatorRejectsHMACTokenWhenConfiguredWithPublicKey(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0).UTC()
+	rsaKey, rsaErr := rsa.GenerateKey(rand.Reader, 2048)
+	if rsaErr != nil {
+		t.Fatalf("generate rsa key: %v", rsaErr)
+	}
+	validator, err := New(Config{PublicKey: &rsaKey.PublicKey, Issuer: "issuer", Clock: fixedClock{current: now}})
+	if err != nil {
+		t.Fatalf("new validator: %v", err)
+	}
+	forged := mintToken(t, []byte("guessed-secret"), "issuer", now, time.Minute)
+	if _, validateErr := validator.ValidateToken(forged); !errors.Is(validateErr, ErrInvalidToken) {
+		t.Fatalf("expected HS256 token to be rejected, got %v", validateErr)
+	}
+}
+
+func TestNewValidatorRejectsConflictingKeySources(t *testing.T) {
+	t.Parallel()
+
+	edPublic, _, edErr := ed25519.GenerateKey(rand.Reader)
+	if edErr != nil {
+		t.Fatalf("generate ed25519 key: %v", edErr)
+	}
+	_, err := New(Config{SigningKey: []byte("secret"), PublicKey: edPublic, Issuer: "issuer"})
+	if !errors.Is(err, ErrConflictingKeys) {
+		t.Fatalf("expected conflicting keys error, got %v", err)
+	}
+}
+
+func TestValidatorSelectsKeyringEntryByKeyID(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0).UTC()
+	edPublic, edPrivate, edErr := ed25519.GenerateKey(rand.Reader)
+	if edErr != nil {
+		t.Fatalf("generate ed25519 key: %v", edErr)
+	}
+	validator, err := New(Config{
+		Keys: []VerificationKey{
+			{KeyID: "current", PublicKey: edPublic},
+			{KeyID: "previous", SigningKey: []byte("previous-secret")},
+			{KeyID: "older", SigningKey: []byte("older-secret")},
+		},
+		Issuer: "issuer",
+		Clock:  fixedClock{current: now},
+	})
+	if err != nil {
+		t.Fatalf("new validator: %v", err)
+	}
+
+	testCases := []struct {
+		name      string
+		token     string
+		expectErr error
+	}{
+		{name: "ActiveAsymmetricKey", token: mintSignedToken(t, jwt.SigningMethodEdDSA, edPrivate, "current", "issuer", now, time.Minute)},
+		{name: "PreviousSecret", token: mintSignedToken(t, jwt.SigningMethodHS256, []byte("previous-secret"), "previous", "issuer", now, time.Minute)},
+		{name: "LegacyTokenWithoutKeyID", token: mintSignedToken(t, jwt.SigningMethodHS256, []byte("older-secret"), "", "issuer", now, time.Minute)},
+		{name: "UnknownKeyID", token: mintSignedToken(t, jwt.SigningMethodHS256, []byte("previous-secret"), "missing", "issuer", now, time.Minute), expectErr: ErrInvalidToken},
+		{name: "KeyIDAlgorithmMismatch", token: mintSignedToken(t, jwt.SigningMethodHS256, []byte("previous-secret"), "current", "issuer", now, time.Minute), expectErr: ErrInvalidToken},
+		{name: "WrongSecretForKeyID", token: mintSignedToken(t, jwt.SigningMethodHS256, []byte("older-secret"), "previous", "issuer", now, time.Minute), expectErr: ErrInvalidToken},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			_, validateErr := validator.ValidateToken(testCase.token)
+			if testCase.expectErr == nil && validateErr != nil {
+				t.Fatalf("expected token to validate, got %v", validateErr)
+			}
+			if testCase.expectErr != nil && !errors.Is(validateErr, testCase.expectErr) {
+				t.Fatalf("expected %v, got %v", testCase.expectErr, validateErr)
+			}
+		})
+	}
+
+	if _, duplicateErr := New(Config{Keys: []VerificationKey{{KeyID: "a", SigningKey: []byte("x")}, {KeyID: "a", SigningKey: []byte("y")}}, Issuer: "issuer"}); !errors.Is(duplicateErr, ErrConflictingKeys) {
+		t.Fatalf("expected duplicate key ids to be rejected, got %v", duplicateErr)
+	}
+}
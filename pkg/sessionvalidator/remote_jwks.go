@@ -0,0 +1,197 @@
+package sessionvalidator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultJWKSCacheTTL is used when the JWKS response carries no cache headers.
+	DefaultJWKSCacheTTL = 5 * time.Minute
+	// DefaultJWKSRefreshInterval is the minimum spacing between JWKS fetches.
+	DefaultJWKSRefreshInterval = 30 * time.Second
+	// DefaultJWKSFetchTimeout bounds each JWKS request when Config.HTTPClient is nil.
+	DefaultJWKSFetchTimeout = 5 * time.Second
+
+	maxJWKSResponseBytes = 1 << 20
+)
+
+var (
+	// ErrInvalidJWKSURL indicates Config.JWKSURL is not an absolute http(s) URL.
+	ErrInvalidJWKSURL = errors.New("session.validator.invalid_jwks_url")
+	// ErrKeySetUnavailable indicates the remote JWKS could not be fetched and no cached copy exists.
+	ErrKeySetUnavailable = errors.New("session.validator.key_set_unavailable")
+)
+
+// remoteKeyAlgorithms lists the algorithms a published JWKS can carry; HMAC
+// secrets are never published, so HS256 is never accepted from a remote set.
+var remoteKeyAlgorithms = []string{
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodES256.Alg(),
+	jwt.SigningMethodES384.Alg(),
+	jwt.SigningMethodES512.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+}
+
+// remoteKeySet fetches and caches a JWKS document. The cache lifetime follows
+// the response's Cache-Control/Expires headers, and fetches are spaced by at
+// least refreshInterval so tokens with unknown kids cannot hammer the issuer.
+// The fetch runs outside the mutex: concurrent callers wait for the one
+// in-flight fetch instead of queueing behind the HTTP request.
+type remoteKeySet struct {
+	keySetURL       string
+	httpClient      *http.Client
+	clock           Clock
+	defaultTTL      time.Duration
+	refreshInterval time.Duration
+
+	mutex       sync.Mutex
+	keys        []verificationKey
+	fetched     bool
+	expiresAt   time.Time
+	lastFetchAt time.Time
+	// refreshing is closed when the in-flight fetch finishes; nil when idle.
+	refreshing chan struct{}
+}
+
+func newRemoteKeySet(configuration Config, clock Clock) (*remoteKeySet, error) {
+	parsedURL, parseErr := url.Parse(configuration.JWKSURL)
+	if parseErr != nil || (parsedURL.Scheme != "https" && parsedURL.Scheme != "http") || parsedURL.Host == "" {
+		return nil, ErrInvalidJWKSURL
+	}
+	httpClient := configuration.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultJWKSFetchTimeout}
+	}
+	defaultTTL := configuration.JWKSCacheTTL
+	if defaultTTL <= 0 {
+		defaultTTL = DefaultJWKSCacheTTL
+	}
+	refreshInterval := configuration.JWKSRefreshInterval
+	if refreshInterval <= 0 {
+		refreshInterval = DefaultJWKSRefreshInterval
+	}
+	return &remoteKeySet{
+		keySetURL:       parsedURL.String(),
+		httpClient:      httpClient,
+		clock:           clock,
+		defaultTTL:      defaultTTL,
+		refreshInterval: refreshInterval,
+	}, nil
+}
+
+// currentKeys returns the cached keys, refetching when the cache has expired or
+// when forceRefresh is set. A failed refetch keeps serving the stale keys.
+func (remote *remoteKeySet) currentKeys(forceRefresh bool) ([]verificationKey, error) {
+	remote.mutex.Lock()
+	for {
+		now := remote.clock.Now()
+		stale := !remote.fetched || !now.Before(remote.expiresAt) || forceRefresh
+		throttled := !remote.lastFetchAt.IsZero() && now.Sub(remote.lastFetchAt) < remote.refreshInterval
+		if !stale || throttled {
+			break
+		}
+		if remote.refreshing != nil {
+			// Another caller is fetching; its result is throttled for us.
+			refreshing := remote.refreshing
+			remote.mutex.Unlock()
+			<-refreshing
+			remote.mutex.Lock()
+			continue
+		}
+		refreshing := make(chan struct{})
+		remote.refreshing = refreshing
+		remote.lastFetchAt = now
+		remote.mutex.Unlock()
+
+		keys, lifetime, fetchErr := remote.fetch(now)
+
+		remote.mutex.Lock()
+		remote.refreshing = nil
+		close(refreshing)
+		if fetchErr == nil {
+			remote.keys = keys
+			remote.fetched = true
+			remote.expiresAt = now.Add(lifetime)
+		}
+		if fetchErr != nil && !remote.fetched {
+			remote.mutex.Unlock()
+			return nil, fmt.Errorf("session.validator.remote_jwks: %w: %v", ErrKeySetUnavailable, fetchErr)
+		}
+		break
+	}
+	keys, fetched := remote.keys, remote.fetched
+	remote.mutex.Unlock()
+	if !fetched {
+		return nil, fmt.Errorf("session.validator.remote_jwks: %w", ErrKeySetUnavailable)
+	}
+	return keys, nil
+}
+
+func (remote *remoteKeySet) fetch(now time.Time) ([]verificationKey, time.Duration, error) {
+	request, requestErr := http.NewRequest(http.MethodGet, remote.keySetURL, nil)
+	if requestErr != nil {
+		return nil, 0, requestErr
+	}
+	request.Header.Set("Accept", "application/json")
+	response, responseErr := remote.httpClient.Do(request)
+	if responseErr != nil {
+		return nil, 0, responseErr
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+	body, readErr := io.ReadAll(io.LimitReader(response.Body, maxJWKSResponseBytes))
+	if readErr != nil {
+		return nil, 0, readErr
+	}
+	// Unlike ParseJSONWebKeySet, a published set may carry keys TAuth cannot
+	// use; buildKeySetKeys skips them.
+	var keySet JSONWebKeySet
+	if unmarshalErr := json.Unmarshal(body, &keySet); unmarshalErr != nil {
+		return nil, 0, fmt.Errorf("session.validator.parse_jwks: %w", ErrInvalidKeySet)
+	}
+	keys, keysErr := buildKeySetKeys(keySet)
+	if keysErr != nil {
+		return nil, 0, keysErr
+	}
+	return keys, cacheLifetime(response.Header, now, remote.defaultTTL), nil
+}
+
+// cacheLifetime honours Cache-Control (no-store, no-cache, max-age) before
+// falling back to Expires and finally the configured default.
+func cacheLifetime(header http.Header, now time.Time, defaultTTL time.Duration) time.Duration {
+	if cacheControl := header.Get("Cache-Control"); cacheControl != "" {
+		for _, directive := range strings.Split(cacheControl, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			switch {
+			case directive == "no-store" || directive == "no-cache":
+				return 0
+			case strings.HasPrefix(directive, "max-age="):
+				seconds, parseErr := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+				if parseErr == nil && seconds >= 0 {
+					return time.Duration(seconds) * time.Second
+				}
+			}
+		}
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		expiresAt, parseErr := http.ParseTime(expires)
+		if parseErr != nil || !expiresAt.After(now) {
+			return 0
+		}
+		return expiresAt.Sub(now)
+	}
+	return defaultTTL
+}
@@ -0,0 +1,320 @@
+package sessionvalidator
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type steppingClock struct {
+	mutex   sync.Mutex
+	current time.Time
+}
+
+func (clock *steppingClock) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	return clock.current
+}
+
+func (clock *steppingClock) Advance(duration time.Duration) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	clock.current = clock.current.Add(duration)
+}
+
+type jwksStub struct {
+	mutex        sync.Mutex
+	keys         []JSONWebKey
+	cacheControl string
+	status       int
+	requests     atomic.Int32
+	// gate, when set, holds each request until it is closed.
+	gate chan struct{}
+}
+
+func (stub *jwksStub) setKeys(keys ...JSONWebKey) {
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+	stub.keys = keys
+}
+
+func (stub *jwksStub) setStatus(status int) {
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+	stub.status = status
+}
+
+func (stub *jwksStub) ServeHTTP(writer http.ResponseWriter, _ *http.Request) {
+	stub.requests.Add(1)
+	if stub.gate != nil {
+		<-stub.gate
+	}
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+	if stub.status != 0 && stub.status != http.StatusOK {
+		writer.WriteHeader(stub.status)
+		return
+	}
+	if stub.cacheControl != "" {
+		writer.Header().Set("Cache-Control", stub.cacheControl)
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(writer).Encode(JSONWebKeySet{Keys: stub.keys})
+}
+
+func mustEd25519WebKey(t *testing.T, keyID string) (JSONWebKey, ed25519.PrivateKey) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %v", err)
+	}
+	webKey, webKeyErr := NewJSONWebKey(publicKey, keyID)
+	if webKeyErr != nil {
+		t.Fatalf("encode jwk: %v", webKeyErr)
+	}
+	return webKey, privateKey
+}
+
+func newRemoteValidator(t *testing.T, serverURL string, clock Clock) *Validator {
+	t.Helper()
+	validator, err := New(Config{
+		JWKSURL:             serverURL,
+		JWKSRefreshInterval: 10 * time.Second,
+		Issuer:              "issuer",
+		Clock:               clock,
+	})
+	if err != nil {
+		t.Fatalf("new validator: %v", err)
+	}
+	return validator
+}
+
+func TestRemoteKeySetCachesAccordingToCacheControl(t *testing.T) {
+	t.Parallel()
+
+	webKey, privateKey := mustEd25519WebKey(t, "current")
+	stub := &jwksStub{cacheControl: "public, max-age=60"}
+	stub.setKeys(webKey)
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	clock := &steppingClock{current: time.Unix(1700000000, 0).UTC()}
+	validator := newRemoteValidator(t, server.URL, clock)
+
+	for attempt := 0; attempt < 3; attempt++ {
+		token := mintSignedToken(t, jwt.SigningMethodEdDSA, privateKey, "current", "issuer", clock.Now(), time.Hour)
+		if _, err := validator.ValidateToken(token); err != nil {
+			t.Fatalf("attempt %d: expected token to validate, got %v", attempt, err)
+		}
+	}
+	if requests := stub.requests.Load(); requests != 1 {
+		t.Fatalf("expected a single JWKS fetch while cached, got %d", requests)
+	}
+
+	clock.Advance(61 * time.Second)
+	token := mintSignedToken(t, jwt.SigningMethodEdDSA, privateKey, "current", "issuer", clock.Now(), time.Hour)
+	if _, err := validator.ValidateToken(token); err != nil {
+		t.Fatalf("expected token to validate after refresh, got %v", err)
+	}
+	if requests := stub.requests.Load(); requests != 2 {
+		t.Fatalf("expected JWKS refetch after max-age elapsed, got %d fetches", requests)
+	}
+}
+
+func TestRemoteKeySetRefetchesOnUnknownKeyIDWithRateLimit(t *testing.T) {
+	t.Parallel()
+
+	currentKey, _ := mustEd25519WebKey(t, "current")
+	rotatedKey, rotatedPrivate := mustEd25519WebKey(t, "rotated")
+	_, strangerPrivate := mustEd25519WebKey(t, "stranger")
+	stub := &jwksStub{cacheControl: "max-age=3600"}
+	stub.setKeys(currentKey)
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	clock := &steppingClock{current: time.Unix(1700000000, 0).UTC()}
+	validator := newRemoteValidator(t, server.URL, clock)
+
+	strangerToken := mintSignedToken(t, jwt.SigningMethodEdDSA, strangerPrivate, "stranger", "issuer", clock.Now(), time.Hour)
+	if _, err := validator.ValidateToken(strangerToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected unknown kid to be rejected, got %v", err)
+	}
+	for attempt := 0; attempt < 5; attempt++ {
+		if _, err := validator.ValidateToken(strangerToken); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("expected unknown kid to be rejected, got %v", err)
+		}
+	}
+	if requests := stub.requests.Load(); requests != 1 {
+		t.Fatalf("expected unknown kids to be rate limited, got %d fetches", requests)
+	}
+
+	stub.setKeys(currentKey, rotatedKey)
+	clock.Advance(11 * time.Second)
+	rotatedToken := mintSignedToken(t, jwt.SigningMethodEdDSA, rotatedPrivate, "rotated", "issuer", clock.Now(), time.Hour)
+	if _, err := validator.ValidateToken(rotatedToken); err != nil {
+		t.Fatalf("expected rotated key to be discovered, got %v", err)
+	}
+	if requests := stub.requests.Load(); requests != 2 {
+		t.Fatalf("expected one refetch for the rotated kid, got %d fetches", requests)
+	}
+}
+
+func TestRemoteKeySetServesStaleKeysWhenIssuerIsDown(t *testing.T) {
+	t.Parallel()
+
+	webKey, privateKey := mustEd25519WebKey(t, "current")
+	stub := &jwksStub{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	clock := &steppingClock{current: time.Unix(1700000000, 0).UTC()}
+	validator := newRemoteValidator(t, server.URL, clock)
+
+	token := mintSignedToken(t, jwt.SigningMethodEdDSA, privateKey, "current", "issuer", clock.Now(), time.Hour)
+	if _, err := validator.ValidateToken(token); !errors.Is(err, ErrKeySetUnavailable) {
+		t.Fatalf("expected key set unavailable error, got %v", err)
+	}
+
+	stub.setStatus(http.StatusOK)
+	stub.setKeys(webKey)
+	clock.Advance(11 * time.Second)
+	if _, err := validator.ValidateToken(token); err != nil {
+		t.Fatalf("expected token to validate once issuer recovers, got %v", err)
+	}
+
+	stub.setStatus(http.StatusInternalServerError)
+	clock.Advance(DefaultJWKSCacheTTL + time.Second)
+	if _, err := validator.ValidateToken(token); err != nil {
+		t.Fatalf("expected stale keys to keep validating, got %v", err)
+	}
+}
+
+func TestRemoteKeySetSkipsUnusableKeys(t *testing.T) {
+	t.Parallel()
+
+	webKey, privateKey := mustEd25519WebKey(t, "current")
+	mismatchedKey, _ := mustEd25519WebKey(t, "mismatched")
+	mismatchedKey.Algorithm = "RS512"
+	symmetricKey := JSONWebKey{KeyType: "oct", KeyID: "symmetric", Use: "sig"}
+	stub := &jwksStub{cacheControl: "max-age=3600"}
+	stub.setKeys(symmetricKey, mismatchedKey)
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	clock := &steppingClock{current: time.Unix(1700000000, 0).UTC()}
+	validator := newRemoteValidator(t, server.URL, clock)
+
+	token := mintSignedToken(t, jwt.SigningMethodEdDSA, privateKey, "current", "issuer", clock.Now(), time.Hour)
+	if _, err := validator.ValidateToken(token); !errors.Is(err, ErrKeySetUnavailable) {
+		t.Fatalf("expected a set of unusable keys to be unavailable, got %v", err)
+	}
+
+	stub.setKeys(symmetricKey, mismatchedKey, webKey)
+	clock.Advance(11 * time.Second)
+	if _, err := validator.ValidateToken(token); err != nil {
+		t.Fatalf("expected the usable key to validate next to unusable ones, got %v", err)
+	}
+}
+
+func TestRemoteKeySetFetchesOutsideTheLock(t *testing.T) {
+	t.Parallel()
+
+	currentKey, currentPrivate := mustEd25519WebKey(t, "current")
+	_, strangerPrivate := mustEd25519WebKey(t, "stranger")
+	stub := &jwksStub{cacheControl: "max-age=3600"}
+	stub.setKeys(currentKey)
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	clock := &steppingClock{current: time.Unix(1700000000, 0).UTC()}
+	validator := newRemoteValidator(t, server.URL, clock)
+	currentToken := mintSignedToken(t, jwt.SigningMethodEdDSA, currentPrivate, "current", "issuer", clock.Now(), time.Hour)
+	if _, err := validator.ValidateToken(currentToken); err != nil {
+		t.Fatalf("expected token to validate, got %v", err)
+	}
+
+	stub.gate = make(chan struct{})
+	clock.Advance(11 * time.Second)
+	strangerToken := mintSignedToken(t, jwt.SigningMethodEdDSA, strangerPrivate, "stranger", "issuer", clock.Now(), time.Hour)
+	var waiters sync.WaitGroup
+	for caller := 0; caller < 3; caller++ {
+		waiters.Add(1)
+		go func() {
+			defer waiters.Done()
+			_, _ = validator.ValidateToken(strangerToken)
+		}()
+	}
+	for stub.requests.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	validated := make(chan error, 1)
+	go func() {
+		_, err := validator.ValidateToken(currentToken)
+		validated <- err
+	}()
+	select {
+	case err := <-validated:
+		if err != nil {
+			t.Fatalf("expected cached keys to validate during a refetch, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected cached keys to be served while a refetch is in flight")
+	}
+
+	close(stub.gate)
+	waiters.Wait()
+	if requests := stub.requests.Load(); requests != 2 {
+		t.Fatalf("expected concurrent refetches to share one request, got %d", requests)
+	}
+}
+
+func TestNewValidatorRejectsInvalidJWKSURL(t *testing.T) {
+	t.Parallel()
+
+	for _, keySetURL := range []string{"ftp://auth.example.com/jwks.json", "/.well-known/jwks.json", "https://"} {
+		if _, err := New(Config{JWKSURL: keySetURL, Issuer: "issuer"}); !errors.Is(err, ErrInvalidJWKSURL) {
+			t.Fatalf("%s: expected ErrInvalidJWKSURL, got %v", keySetURL, err)
+		}
+	}
+	if _, err := New(Config{JWKSURL: "https://auth.example.com/.well-known/jwks.json", SigningKey: []byte("secret"), Issuer: "issuer"}); !errors.Is(err, ErrConflictingKeys) {
+		t.Fatalf("expected conflicting keys error, got %v", err)
+	}
+}
+
+func TestCacheLifetime(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0).UTC()
+	testCases := []struct {
+		name     string
+		header   http.Header
+		expected time.Duration
+	}{
+		{name: "MaxAge", header: http.Header{"Cache-Control": {"public, max-age=300"}}, expected: 300 * time.Second},
+		{name: "NoStore", header: http.Header{"Cache-Control": {"no-store"}}, expected: 0},
+		{name: "Expires", header: http.Header{"Expires": {now.Add(90 * time.Second).Format(http.TimeFormat)}}, expected: 90 * time.Second},
+		{name: "ExpiredExpires", header: http.Header{"Expires": {now.Add(-time.Minute).Format(http.TimeFormat)}}, expected: 0},
+		{name: "MaxAgeWinsOverExpires", header: http.Header{"Cache-Control": {"max-age=10"}, "Expires": {now.Add(time.Hour).Format(http.TimeFormat)}}, expected: 10 * time.Second},
+		{name: "NoHeaders", header: http.Header{}, expected: DefaultJWKSCacheTTL},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			if lifetime := cacheLifetime(testCase.header, now, DefaultJWKSCacheTTL); lifetime != testCase.expected {
+				t.Fatalf("expected %s, got %s", testCase.expected, lifetime)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package sessionvalidator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRevocationRefreshInterval is how long the cached revocation list is trusted before it is refetched.
+	DefaultRevocationRefreshInterval = 30 * time.Second
+	// DefaultRevocationFetchTimeout bounds each revocation request when RevocationConfig.HTTPClient is nil.
+	DefaultRevocationFetchTimeout = 5 * time.Second
+
+	maxRevocationResponseBytes = 4 << 20
+)
+
+var (
+	// ErrTokenRevoked indicates the session or token was revoked before it expired.
+	ErrTokenRevoked = errors.New("session.validator.revoked")
+	// ErrRevocationUnavailable indicates the revocation status could not be determined.
+	// Validation fails closed in that case.
+	ErrRevocationUnavailable = errors.New("session.validator.revocation_unavailable")
+	// ErrInvalidRevocationURL indicates RevocationConfig.URL is not an absolute http(s) URL.
+	ErrInvalidRevocationURL = errors.New("session.validator.invalid_revocation_url")
+)
+
+// RevocationChecker reports whether validated claims belong to a revoked
+// session (sid) or token (jti).
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, claims *Claims) (bool, error)
+}
+
+// RevocationCheckerFunc adapts a function to RevocationChecker.
+type RevocationCheckerFunc func(ctx context.Context, claims *Claims) (bool, error)
+
+// IsRevoked calls checker(ctx, claims).
+func (checker RevocationCheckerFunc) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	return checker(ctx, claims)
+}
+
+// RevocationConfig points a revocation checker at TAuth's /auth/revocations
+// endpoint. HTTPClient defaults to a client with DefaultRevocationFetchTimeout;
+// RefreshInterval only applies to NewCachedRevocationChecker and defaults to
+// DefaultRevocationRefreshInterval.
+type RevocationConfig struct {
+	URL             string
+	HTTPClient      *http.Client
+	RefreshInterval time.Duration
+	Clock           Clock
+}
+
+// NewRemoteRevocationChecker asks the revocation endpoint about every token
+// (GET URL?sid=...&jti=...). Revocations apply immediately at the cost of one
+// request per validation.
+func NewRemoteRevocationChecker(configuration RevocationConfig) (RevocationChecker, error) {
+	endpoint, httpClient, configErr := parseRevocationConfig(configuration)
+	if configErr != nil {
+		return nil, configErr
+	}
+	return RevocationCheckerFunc(func(ctx context.Context, claims *Claims) (bool, error) {
+		query := endpoint.Query()
+		query.Set("sid", claims.GetSessionID())
+		query.Set("jti", claims.ID)
+		requestURL := *endpoint
+		requestURL.RawQuery = query.Encode()
+		var status struct {
+			Revoked bool `json:"revoked"`
+		}
+		if fetchErr := fetchRevocationJSON(ctx, httpClient, requestURL.String(), &status); fetchErr != nil {
+			return false, fetchErr
+		}
+		return status.Revoked, nil
+	}), nil
+}
+
+// NewCachedRevocationChecker downloads the full revocation list and answers
+// from memory, refetching it once RefreshInterval has elapsed. Revocations
+// therefore take effect within one interval. A failed refetch keeps serving
+// the previous list; before the first successful fetch every check fails with
+// ErrRevocationUnavailable.
+func NewCachedRevocationChecker(configuration RevocationConfig) (RevocationChecker, error) {
+	endpoint, httpClient, configErr := parseRevocationConfig(configuration)
+	if configErr != nil {
+		return nil, configErr
+	}
+	refreshInterval := configuration.RefreshInterval
+	if refreshInterval <= 0 {
+		refreshInterval = DefaultRevocationRefreshInterval
+	}
+	clock := configuration.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &cachedRevocationList{
+		listURL:         endpoint.String(),
+		httpClient:      httpClient,
+		clock:           clock,
+		refreshInterval: refreshInterval,
+	}, nil
+}
+
+type cachedRevocationList struct {
+	listURL         string
+	httpClient      *http.Client
+	clock           Clock
+	refreshInterval time.Duration
+
+	mutex       sync.Mutex
+	sessionIDs  []string
+	tokenIDs    []string
+	fetched     bool
+	lastFetchAt time.Time
+}
+
+// IsRevoked reports whether the claims' sid or jti appears in the cached list.
+func (list *cachedRevocationList) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+
+	now := list.clock.Now()
+	if !list.fetched || now.Sub(list.lastFetchAt) >= list.refreshInterval {
+		list.lastFetchAt = now
+		var document struct {
+			SessionIDs []string `json:"session_ids"`
+			TokenIDs   []string `json:"token_ids"`
+		}
+		fetchErr := fetchRevocationJSON(ctx, list.httpClient, list.listURL, &document)
+		if fetchErr != nil && !list.fetched {
+			return false, fetchErr
+		}
+		if fetchErr == nil {
+			list.sessionIDs = document.SessionIDs
+			list.tokenIDs = document.TokenIDs
+			list.fetched = true
+		}
+	}
+	sessionRevoked := claims.GetSessionID() != "" && slices.Contains(list.sessionIDs, claims.GetSessionID())
+	tokenRevoked := claims.ID != "" && slices.Contains(list.tokenIDs, claims.ID)
+	return sessionRevoked || tokenRevoked, nil
+}
+
+func parseRevocationConfig(configuration RevocationConfig) (*url.URL, *http.Client, error) {
+	parsedURL, parseErr := url.Parse(configuration.URL)
+	if parseErr != nil || (parsedURL.Scheme != "https" && parsedURL.Scheme != "http") || parsedURL.Host == "" {
+		return nil, nil, ErrInvalidRevocationURL
+	}
+	httpClient := configuration.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultRevocationFetchTimeout}
+	}
+	return parsedURL, httpClient, nil
+}
+
+func fetchRevocationJSON(ctx context.Context, httpClient *http.Client, requestURL string, target interface{}) error {
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if requestErr != nil {
+		return fmt.Errorf("session.validator.revocation: %w: %v", ErrRevocationUnavailable, requestErr)
+	}
+	request.Header.Set("Accept", "application/json")
+	response, responseErr := httpClient.Do(request)
+	if responseErr != nil {
+		return fmt.Errorf("session.validator.revocation: %w: %v", ErrRevocationUnavailable, responseErr)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("session.validator.revocation: %w: unexpected status %d", ErrRevocationUnavailable, response.StatusCode)
+	}
+	body, readErr := io.ReadAll(io.LimitReader(response.Body, maxRevocationResponseBytes))
+	if readErr != nil {
+		return fmt.Errorf("session.validator.revocation: %w: %v", ErrRevocationUnavailable, readErr)
+	}
+	if decodeErr := json.Unmarshal(body, target); decodeErr != nil {
+		return fmt.Errorf("session.validator.revocation: %w: %v", ErrRevocationUnavailable, decodeErr)
+	}
+	return nil
+}
+
+// checkRevocation consults the configured RevocationChecker, failing closed
+// when the status cannot be determined.
+func (validator *Validator) checkRevocation(ctx context.Context, claims *Claims) error {
+	if validator.revocations == nil {
+		return nil
+	}
+	revoked, checkErr := validator.revocations.IsRevoked(ctx, claims)
+	if checkErr != nil {
+		if errors.Is(checkErr, ErrRevocationUnavailable) {
+			return fmt.Errorf("session.validator.validate_token: %w", checkErr)
+		}
+		return fmt.Errorf("session.validator.validate_token: %w: %v", ErrRevocationUnavailable, checkErr)
+	}
+	if revoked {
+		return fmt.Errorf("session.validator.validate_token: %w", ErrTokenRevoked)
+	}
+	return nil
+}
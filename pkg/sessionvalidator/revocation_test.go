@@ -0,0 +1,160 @@
+package sessionvalidator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type revocationStub struct {
+	mutex      sync.Mutex
+	sessionIDs []string
+	tokenIDs   []string
+	fetchCount int
+	failing    bool
+}
+
+func (stub *revocationStub) revokeSession(sessionID string) {
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+	stub.sessionIDs = append(stub.sessionIDs, sessionID)
+}
+
+func (stub *revocationStub) setFailing(failing bool) {
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+	stub.failing = failing
+}
+
+func (stub *revocationStub) fetches() int {
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+	return stub.fetchCount
+}
+
+func (stub *revocationStub) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+	stub.fetchCount++
+	if stub.failing {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	sessionID, tokenID := request.URL.Query().Get("sid"), request.URL.Query().Get("jti")
+	if sessionID == "" && tokenID == "" {
+		_ = json.NewEncoder(writer).Encode(map[string][]string{"session_ids": stub.sessionIDs, "token_ids": stub.tokenIDs})
+		return
+	}
+	revoked := slices.Contains(stub.sessionIDs, sessionID) || slices.Contains(stub.tokenIDs, tokenID)
+	_ = json.NewEncoder(writer).Encode(map[string]bool{"revoked": revoked})
+}
+
+func mintSessionToken(t *testing.T, issuedAt time.Time, sessionID string, tokenID string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		UserID:    "user-123",
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "issuer",
+			ID:        tokenID,
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(time.Hour)),
+		},
+	})
+	signed, err := token.SignedString([]byte("secret-key"))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestRemoteRevocationChecker(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0).UTC()
+	stub := &revocationStub{tokenIDs: []string{"token-revoked"}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	checker, err := NewRemoteRevocationChecker(RevocationConfig{URL: server.URL + "/auth/revocations"})
+	if err != nil {
+		t.Fatalf("new checker: %v", err)
+	}
+	validator, err := New(Config{SigningKey: []byte("secret-key"), Issuer: "issuer", RevocationChecker: checker, Clock: fixedClock{current: now}})
+	if err != nil {
+		t.Fatalf("new validator: %v", err)
+	}
+
+	claims, validateErr := validator.ValidateToken(mintSessionToken(t, now, "session-1", "token-1"))
+	if validateErr != nil || claims.GetSessionID() != "session-1" {
+		t.Fatalf("expected live session to validate, got %v", validateErr)
+	}
+	if _, validateErr := validator.ValidateToken(mintSessionToken(t, now, "session-1", "token-revoked")); !errors.Is(validateErr, ErrTokenRevoked) {
+		t.Fatalf("expected revoked jti to be rejected, got %v", validateErr)
+	}
+	stub.revokeSession("session-1")
+	if _, validateErr := validator.ValidateToken(mintSessionToken(t, now, "session-1", "token-2")); !errors.Is(validateErr, ErrTokenRevoked) {
+		t.Fatalf("expected revoked sid to be rejected immediately, got %v", validateErr)
+	}
+	stub.setFailing(true)
+	if _, validateErr := validator.ValidateToken(mintSessionToken(t, now, "session-2", "token-3")); !errors.Is(validateErr, ErrRevocationUnavailable) {
+		t.Fatalf("expected revocation outage to fail closed, got %v", validateErr)
+	}
+}
+
+func TestCachedRevocationChecker(t *testing.T) {
+	t.Parallel()
+
+	clock := &steppingClock{current: time.Unix(1700000000, 0).UTC()}
+	stub := &revocationStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	checker, err := NewCachedRevocationChecker(RevocationConfig{URL: server.URL, RefreshInterval: time.Minute, Clock: clock})
+	if err != nil {
+		t.Fatalf("new checker: %v", err)
+	}
+	validator, err := New(Config{SigningKey: []byte("secret-key"), Issuer: "issuer", RevocationChecker: checker, Clock: clock})
+	if err != nil {
+		t.Fatalf("new validator: %v", err)
+	}
+	token := mintSessionToken(t, clock.Now(), "session-1", "token-1")
+
+	stub.setFailing(true)
+	if _, validateErr := validator.ValidateToken(token); !errors.Is(validateErr, ErrRevocationUnavailable) {
+		t.Fatalf("expected checks to fail before the first fetch, got %v", validateErr)
+	}
+	clock.Advance(time.Minute)
+	stub.setFailing(false)
+	if _, validateErr := validator.ValidateToken(token); validateErr != nil {
+		t.Fatalf("expected token to validate, got %v", validateErr)
+	}
+	stub.revokeSession("session-1")
+	if _, validateErr := validator.ValidateToken(token); validateErr != nil {
+		t.Fatalf("expected cached list to be served within the refresh interval, got %v", validateErr)
+	}
+	if fetches := stub.fetches(); fetches != 2 {
+		t.Fatalf("expected 2 fetches, got %d", fetches)
+	}
+
+	clock.Advance(time.Minute)
+	if _, validateErr := validator.ValidateToken(token); !errors.Is(validateErr, ErrTokenRevoked) {
+		t.Fatalf("expected revocation after refresh, got %v", validateErr)
+	}
+	clock.Advance(time.Minute)
+	stub.setFailing(true)
+	if _, validateErr := validator.ValidateToken(token); !errors.Is(validateErr, ErrTokenRevoked) {
+		t.Fatalf("expected stale list to keep serving after a failed refetch, got %v", validateErr)
+	}
+
+	if _, err := NewCachedRevocationChecker(RevocationConfig{URL: "/relative"}); !errors.Is(err, ErrInvalidRevocationURL) {
+		t.Fatalf("expected invalid url error, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package sessionvalidator
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultQueryParameter is the query parameter read by QuerySource when none is given.
+const DefaultQueryParameter = "access_token"
+
+var (
+	// ErrNoCredentials indicates none of the configured sources carried a token.
+	// Every "missing" error below also matches it.
+	ErrNoCredentials = errors.New("session.validator.no_credentials")
+	// ErrMissingBearer indicates the request had no Authorization: Bearer header.
+	ErrMissingBearer = errors.New("session.validator.missing_bearer")
+	// ErrMissingQueryToken indicates the configured query parameter was absent.
+	ErrMissingQueryToken = errors.New("session.validator.missing_query_token")
+	// ErrMalformedAuthorization indicates a Bearer Authorization header without a usable token.
+	ErrMalformedAuthorization = errors.New("session.validator.malformed_authorization")
+)
+
+// TokenSource locates the session token in a request. Use CookieSource,
+// BearerSource, or QuerySource to construct one.
+type TokenSource interface {
+	extractToken(request *http.Request) (string, error)
+}
+
+type cookieSource struct {
+	name string
+}
+
+type bearerSource struct{}
+
+type querySource struct {
+	parameter string
+}
+
+// CookieSource reads the token from the named cookie; an empty name uses the
+// validator's configured cookie name.
+func CookieSource(name string) TokenSource {
+	return cookieSource{name: strings.TrimSpace(name)}
+}
+
+// BearerSource reads the token from an "Authorization: Bearer <token>" header.
+func BearerSource() TokenSource {
+	return bearerSource{}
+}
+
+// QuerySource reads the token from a query parameter, which browsers need for
+// WebSocket upgrades. An empty parameter uses DefaultQueryParameter.
+func QuerySource(parameter string) TokenSource {
+	parameter = strings.TrimSpace(parameter)
+	if parameter == "" {
+		parameter = DefaultQueryParameter
+	}
+	return querySource{parameter: parameter}
+}
+
+func (source cookieSource) extractToken(request *http.Request) (string, error) {
+	cookie, cookieErr := request.Cookie(source.name)
+	if cookieErr != nil || cookie == nil || strings.TrimSpace(cookie.Value) == "" {
+		return "", ErrMissingCookie
+	}
+	return cookie.Value, nil
+}
+
+func (bearerSource) extractToken(request *http.Request) (string, error) {
+	authorization := strings.TrimSpace(request.Header.Get("Authorization"))
+	scheme, token, _ := strings.Cut(authorization, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", ErrMissingBearer
+	}
+	token = strings.TrimSpace(token)
+	if token == "" || strings.ContainsAny(token, " \t") {
+		return "", ErrMalformedAuthorization
+	}
+	return token, nil
+}
+
+func (source querySource) extractToken(request *http.Request) (string, error) {
+	token := strings.TrimSpace(request.URL.Query().Get(source.parameter))
+	if token == "" {
+		return "", ErrMissingQueryToken
+	}
+	return token, nil
+}
+
+// extractRequestToken returns the token from the first source that carries
+// one. A present but malformed credential stops the search rather than
+// falling through to the next source.
+func extractRequestToken(request *http.Request, sources []TokenSource) (string, error) {
+	missing := make([]error, 0, len(sources))
+	for _, source := range sources {
+		token, extractErr := source.extractToken(request)
+		if extractErr == nil {
+			return token, nil
+		}
+		if !isMissingCredential(extractErr) {
+			return "", extractErr
+		}
+		missing = append(missing, extractErr)
+	}
+	return "", fmt.Errorf("%w: %w", ErrNoCredentials, errors.Join(missing...))
+}
+
+func isMissingCredential(err error) bool {
+	return errors.Is(err, ErrMissingCookie) || errors.Is(err, ErrMissingBearer) || errors.Is(err, ErrMissingQueryToken)
+}
+
+func resolveTokenSources(sources []TokenSource, cookieName string) []TokenSource {
+	if len(sources) == 0 {
+		return []TokenSource{cookieSource{name: cookieName}}
+	}
+	resolved := make([]TokenSource, 0, len(sources))
+	for _, source := range sources {
+		if cookie, isCookie := source.(cookieSource); isCookie && cookie.name == "" {
+			source = cookieSource{name: cookieName}
+		}
+		resolved = append(resolved, source)
+	}
+	return resolved
+}
@@ -0,0 +1,95 @@
+package sessionvalidator
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValidateRequestTokenSources(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0).UTC()
+	validToken := mintToken(t, []byte("secret-key"), "issuer", now, time.Minute)
+	forgedToken := mintToken(t, []byte("other-key"), "issuer", now, time.Minute)
+	validator, err := New(Config{
+		SigningKey:   []byte("secret-key"),
+		Issuer:       "issuer",
+		CookieName:   "session",
+		TokenSources: []TokenSource{CookieSource(""), BearerSource(), QuerySource("")},
+		Clock:        fixedClock{current: now},
+	})
+	if err != nil {
+		t.Fatalf("new validator: %v", err)
+	}
+
+	testCases := []struct {
+		name         string
+		prepare      func(request *http.Request)
+		expectedErrs []error
+	}{
+		{name: "Cookie", prepare: func(request *http.Request) {
+			request.AddCookie(&http.Cookie{Name: "session", Value: validToken})
+		}},
+		{name: "Bearer", prepare: func(request *http.Request) {
+			request.Header.Set("Authorization", "Bearer "+validToken)
+		}},
+		{name: "BearerSchemeIsCaseInsensitive", prepare: func(request *http.Request) {
+			request.Header.Set("Authorization", "bearer "+validToken)
+		}},
+		{name: "QueryParameter", prepare: func(request *http.Request) {
+			request.URL.RawQuery = "access_token=" + validToken
+		}},
+		{name: "NoCredentials", prepare: func(request *http.Request) {
+			request.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+		}, expectedErrs: []error{ErrNoCredentials, ErrMissingCookie, ErrMissingBearer, ErrMissingQueryToken}},
+		{name: "MalformedBearer", prepare: func(request *http.Request) {
+			request.Header.Set("Authorization", "Bearer ")
+			request.URL.RawQuery = "access_token=" + validToken
+		}, expectedErrs: []error{ErrMalformedAuthorization}},
+		{name: "FirstPresentSourceWins", prepare: func(request *http.Request) {
+			request.AddCookie(&http.Cookie{Name: "session", Value: forgedToken})
+			request.Header.Set("Authorization", "Bearer "+validToken)
+		}, expectedErrs: []error{ErrInvalidToken}},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			request := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			testCase.prepare(request)
+			claims, validateErr := validator.ValidateRequest(request)
+			if len(testCase.expectedErrs) == 0 {
+				if validateErr != nil || claims.GetUserID() != "user-123" {
+					t.Fatalf("expected request to validate, got %v", validateErr)
+				}
+				return
+			}
+			for _, expectedErr := range testCase.expectedErrs {
+				if !errors.Is(validateErr, expectedErr) {
+					t.Fatalf("expected %v, got %v", expectedErr, validateErr)
+				}
+			}
+			if !errors.Is(testCase.expectedErrs[0], ErrNoCredentials) && errors.Is(validateErr, ErrNoCredentials) {
+				t.Fatalf("bad credentials must not be reported as missing: %v", validateErr)
+			}
+		})
+	}
+}
+
+func TestValidateRequestDefaultsToCookieOnly(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0).UTC()
+	validator, err := New(Config{SigningKey: []byte("secret-key"), Issuer: "issuer", Clock: fixedClock{current: now}})
+	if err != nil {
+		t.Fatalf("new validator: %v", err)
+	}
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Authorization", "Bearer "+mintToken(t, []byte("secret-key"), "issuer", now, time.Minute))
+	if _, validateErr := validator.ValidateRequest(request); !errors.Is(validateErr, ErrMissingCookie) || !errors.Is(validateErr, ErrNoCredentials) {
+		t.Fatalf("expected bearer header to be ignored without a BearerSource, got %v", validateErr)
+	}
+}
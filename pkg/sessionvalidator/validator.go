@@ -1,9 +1,12 @@
 package sessionvalidator
 
 import (
+	"context"
+	"crypto"
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -23,12 +26,57 @@ func (systemClock) Now() time.Time {
 	return time.Now().UTC()
 }
 
-// Config configures the Validator.
+// Config configures the Validator. Exactly one of SigningKey (HS256 secret),
+// PublicKey (RSA, ECDSA, or Ed25519), KeySet (JWKS), Keys (a rotation
+// keyring), or JWKSURL (a remote JWKS endpoint) must be provided.
+//
+// TokenSources lists where ValidateRequest looks for the token, in order; it
+// defaults to the session cookie named CookieName.
+//
+// When EncryptionKeys is set, tokens must be JWEs sealed with one of the keys
+// (see EncryptToken); unencrypted tokens are rejected with ErrEncryptionRequired.
+//
+// When Audience is set, tokens must list it in their aud claim; tokens without
+// an aud claim are rejected.
+//
+// Leeway tolerates clock skew when comparing exp, nbf, and iat. RequiredClaims
+// names claims (e.g. "sub", "iat", "jti", or a custom claim) every token must
+// carry, and MaxTokenAge rejects tokens issued longer ago than the cap even if
+// they have not expired; it implies "iat" is required.
+//
+// RevocationChecker, when set, is consulted after every successful validation
+// so revoked sessions (sid) and tokens (jti) are rejected before they expire.
+//
+// HTTPClient, JWKSCacheTTL, and JWKSRefreshInterval only apply to JWKSURL and
+// default to a client with DefaultJWKSFetchTimeout, DefaultJWKSCacheTTL, and
+// DefaultJWKSRefreshInterval respectively.
 type Config struct {
+	SigningKey          []byte
+	PublicKey           crypto.PublicKey
+	KeySet              JSONWebKeySet
+	Keys                []VerificationKey
+	JWKSURL             string
+	HTTPClient          *http.Client
+	JWKSCacheTTL        time.Duration
+	JWKSRefreshInterval time.Duration
+	Issuer              string
+	Audience            string
+	Leeway              time.Duration
+	RequiredClaims      []string
+	MaxTokenAge         time.Duration
+	RevocationChecker   RevocationChecker
+	EncryptionKeys      []EncryptionKey
+	CookieName          string
+	TokenSources        []TokenSource
+	Clock               Clock
+}
+
+// VerificationKey is one entry of a keyring; tokens select it through their kid header.
+// Exactly one of SigningKey or PublicKey must be set.
+type VerificationKey struct {
+	KeyID      string
 	SigningKey []byte
-	Issuer     string
-	CookieName string
-	Clock      Clock
+	PublicKey  crypto.PublicKey
 }
 
 // DefaultContextKey is used by GinMiddleware when no explicit key is provided.
@@ -40,29 +88,50 @@ const DefaultCookieName = "app_session"
 // Sentinel errors exposed by the validator.
 var (
 	ErrMissingSigningKey = errors.New("session.validator.missing_signing_key")
+	ErrConflictingKeys   = errors.New("session.validator.conflicting_keys")
+	ErrUnknownKey        = errors.New("session.validator.unknown_key")
 	ErrMissingIssuer     = errors.New("session.validator.missing_issuer")
 	ErrMissingToken      = errors.New("session.validator.missing_token")
 	ErrMissingCookie     = errors.New("session.validator.missing_cookie")
 	ErrInvalidToken      = errors.New("session.validator.invalid_token")
 	ErrInvalidIssuer     = errors.New("session.validator.invalid_issuer")
+	ErrInvalidAudience   = errors.New("session.validator.invalid_audience")
 	ErrTokenExpired      = errors.New("session.validator.expired")
 )
 
 // Validator validates TAuth session cookies.
 type Validator struct {
-	signingKey []byte
-	issuer     string
-	cookieName string
-	clock      Clock
+	keys           []verificationKey
+	remote         *remoteKeySet
+	algorithms     []string
+	issuer         string
+	audience       string
+	policy         claimsPolicy
+	revocations    RevocationChecker
+	encryptionKeys []EncryptionKey
+	cookieName     string
+	tokenSources   []TokenSource
+	clock          Clock
+}
+
+type verificationKey struct {
+	keyID     string
+	algorithm string
+	material  interface{}
 }
 
 // Claims represent the session payload embedded inside TAuth access tokens.
+// Custom holds the namespaced claims added by the issuer's claims enricher.
 type Claims struct {
-	UserID          string   `json:"user_id"`
-	UserEmail       string   `json:"user_email"`
-	UserDisplayName string   `json:"user_display_name"`
-	UserAvatarURL   string   `json:"user_avatar_url"`
-	UserRoles       []string `json:"user_roles"`
+	UserID          string                 `json:"user_id"`
+	UserEmail       string                 `json:"user_email"`
+	UserDisplayName string                 `json:"user_display_name"`
+	UserAvatarURL   string                 `json:"user_avatar_url"`
+	UserRoles       []string               `json:"user_roles"`
+	SessionID       string                 `json:"sid,omitempty"`
+	AuthMethods     []string               `json:"amr,omitempty"`
+	AuthTime        *jwt.NumericDate       `json:"auth_time,omitempty"`
+	Custom          map[string]interface{} `json:"-"`
 	jwt.RegisteredClaims
 }
 
@@ -106,6 +175,32 @@ func (claims *Claims) GetUserRoles() []string {
 	return claims.UserRoles
 }
 
+// GetSessionID returns the server-side session the token belongs to.
+func (claims *Claims) GetSessionID() string {
+	if claims == nil {
+		return ""
+	}
+	return claims.SessionID
+}
+
+// GetAuthMethods returns how the session was authenticated (the amr claim),
+// such as AuthMethodMFA after a second factor.
+func (claims *Claims) GetAuthMethods() []string {
+	if claims == nil {
+		return nil
+	}
+	return claims.AuthMethods
+}
+
+// GetAuthTime returns when the user signed in to the session (the auth_time
+// claim). Refreshed session tokens keep the original sign-in time.
+func (claims *Claims) GetAuthTime() time.Time {
+	if claims == nil || claims.AuthTime == nil {
+		return time.Time{}
+	}
+	return claims.AuthTime.Time
+}
+
 // GetExpiresAt returns the expiry timestamp.
 func (claims *Claims) GetExpiresAt() time.Time {
 	if claims == nil || claims.ExpiresAt == nil {
@@ -116,12 +211,22 @@ func (claims *Claims) GetExpiresAt() time.Time {
 
 // New constructs a Validator after validating the supplied configuration.
 func New(configuration Config) (*Validator, error) {
-	if len(configuration.SigningKey) == 0 {
-		return nil, fmt.Errorf("session.validator.new: %w", ErrMissingSigningKey)
+	keys, keysErr := buildVerificationKeys(configuration)
+	if keysErr != nil {
+		return nil, fmt.Errorf("session.validator.new: %w", keysErr)
 	}
 	if strings.TrimSpace(configuration.Issuer) == "" {
 		return nil, fmt.Errorf("session.validator.new: %w", ErrMissingIssuer)
 	}
+	policy, policyErr := newClaimsPolicy(configuration)
+	if policyErr != nil {
+		return nil, fmt.Errorf("session.validator.new: %w", policyErr)
+	}
+	for _, encryptionKey := range configuration.EncryptionKeys {
+		if len(encryptionKey.key) != EncryptionKeySize {
+			return nil, fmt.Errorf("session.validator.new: %w", ErrInvalidEncryptionKey)
+		}
+	}
 	cookieName := configuration.CookieName
 	if strings.TrimSpace(cookieName) == "" {
 		cookieName = DefaultCookieName
@@ -130,28 +235,89 @@ func New(configuration Config) (*Validator, error) {
 	if clock == nil {
 		clock = systemClock{}
 	}
+	algorithms := collectAlgorithms(keys)
+	var remote *remoteKeySet
+	if configuration.JWKSURL != "" {
+		var remoteErr error
+		remote, remoteErr = newRemoteKeySet(configuration, clock)
+		if remoteErr != nil {
+			return nil, fmt.Errorf("session.validator.new: %w", remoteErr)
+		}
+		algorithms = remoteKeyAlgorithms
+	}
 	return &Validator{
-		signingKey: configuration.SigningKey,
-		issuer:     configuration.Issuer,
-		cookieName: cookieName,
-		clock:      clock,
+		keys:           keys,
+		remote:         remote,
+		algorithms:     algorithms,
+		issuer:         configuration.Issuer,
+		audience:       strings.TrimSpace(configuration.Audience),
+		policy:         policy,
+		revocations:    configuration.RevocationChecker,
+		encryptionKeys: configuration.EncryptionKeys,
+		cookieName:     cookieName,
+		tokenSources:   resolveTokenSources(configuration.TokenSources, cookieName),
+		clock:          clock,
 	}, nil
 }
 
-// ValidateToken validates the provided JWT string and returns the parsed claims.
+// ValidateToken validates the provided JWT (or JWE, when encryption keys are
+// configured) and returns the parsed claims.
 func (validator *Validator) ValidateToken(tokenString string) (*Claims, error) {
+	return validator.validateToken(context.Background(), tokenString)
+}
+
+// ValidateTokenContext is ValidateToken with ctx passed to the RevocationChecker.
+func (validator *Validator) ValidateTokenContext(ctx context.Context, tokenString string) (*Claims, error) {
+	return validator.validateToken(ctx, tokenString)
+}
+
+func (validator *Validator) validateToken(ctx context.Context, tokenString string) (*Claims, error) {
+	signedToken, openErr := validator.openToken(tokenString)
+	if openErr != nil {
+		return nil, openErr
+	}
+	claims, validateErr := validator.validateSignedToken(signedToken)
+	if validateErr != nil {
+		return nil, validateErr
+	}
+	if revokedErr := validator.checkRevocation(ctx, claims); revokedErr != nil {
+		return nil, revokedErr
+	}
+	return claims, nil
+}
+
+// openToken returns the signed JWT, decrypting it when the validator requires encryption.
+func (validator *Validator) openToken(tokenString string) (string, error) {
 	if strings.TrimSpace(tokenString) == "" {
-		return nil, fmt.Errorf("session.validator.validate_token: %w", ErrMissingToken)
+		return "", fmt.Errorf("session.validator.validate_token: %w", ErrMissingToken)
 	}
-	parsedToken, parseErr := jwt.ParseWithClaims(tokenString, &Claims{}, func(parsed *jwt.Token) (interface{}, error) {
-		return validator.signingKey, nil
-	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithTimeFunc(func() time.Time {
+	if len(validator.encryptionKeys) == 0 {
+		return tokenString, nil
+	}
+	if !isEncryptedToken(tokenString) {
+		return "", fmt.Errorf("session.validator.validate_token: %w", ErrEncryptionRequired)
+	}
+	signedToken, decryptErr := decryptToken(tokenString, validator.encryptionKeys)
+	if decryptErr != nil {
+		return "", fmt.Errorf("session.validator.validate_token: %w", ErrInvalidToken)
+	}
+	return signedToken, nil
+}
+
+func (validator *Validator) validateSignedToken(tokenString string) (*Claims, error) {
+	parsedToken, parseErr := jwt.ParseWithClaims(tokenString, &Claims{}, validator.resolveKey, jwt.WithValidMethods(validator.algorithms), jwt.WithLeeway(validator.policy.leeway), jwt.WithTimeFunc(func() time.Time {
 		return validator.clock.Now()
 	}))
 	if parseErr != nil {
 		if errors.Is(parseErr, jwt.ErrTokenExpired) {
 			return nil, fmt.Errorf("session.validator.validate_token: %w", ErrTokenExpired)
 		}
+		if errors.Is(parseErr, jwt.ErrTokenNotValidYet) {
+			return nil, fmt.Errorf("session.validator.validate_token: %w", ErrTokenNotYetValid)
+		}
+		if errors.Is(parseErr, ErrKeySetUnavailable) {
+			return nil, fmt.Errorf("session.validator.validate_token: %w", ErrKeySetUnavailable)
+		}
 		return nil, fmt.Errorf("session.validator.validate_token: %w", ErrInvalidToken)
 	}
 	if parsedToken == nil || !parsedToken.Valid {
@@ -164,32 +330,199 @@ func (validator *Validator) ValidateToken(tokenString string) (*Claims, error) {
 	if claims.Issuer != validator.issuer {
 		return nil, fmt.Errorf("session.validator.validate_token: %w", ErrInvalidIssuer)
 	}
-	current := validator.clock.Now()
-	if claims.ExpiresAt != nil && current.After(claims.ExpiresAt.Time) {
-		return nil, fmt.Errorf("session.validator.validate_token: %w", ErrTokenExpired)
+	if validator.audience != "" && !slices.Contains(claims.Audience, validator.audience) {
+		return nil, fmt.Errorf("session.validator.validate_token: %w", ErrInvalidAudience)
 	}
-	if claims.NotBefore != nil && current.Before(claims.NotBefore.Time) {
-		return nil, fmt.Errorf("session.validator.validate_token: %w", ErrInvalidToken)
-	}
-	if claims.IssuedAt != nil && current.Before(claims.IssuedAt.Time) {
-		return nil, fmt.Errorf("session.validator.validate_token: %w", ErrInvalidToken)
+	if policyErr := validator.policy.check(claims, validator.clock.Now()); policyErr != nil {
+		return nil, fmt.Errorf("session.validator.validate_token: %w", policyErr)
 	}
 	return claims, nil
 }
 
-// ValidateRequest reads the configured cookie from the request and validates it.
+func (validator *Validator) resolveKey(parsed *jwt.Token) (interface{}, error) {
+	if validator.remote == nil {
+		return selectKey(validator.keys, parsed)
+	}
+	keys, keysErr := validator.remote.currentKeys(false)
+	if keysErr != nil {
+		return nil, keysErr
+	}
+	key, selectErr := selectKey(keys, parsed)
+	if errors.Is(selectErr, ErrUnknownKey) {
+		if keyID, _ := parsed.Header["kid"].(string); keyID != "" {
+			// The issuer may have rotated in a key we have not seen yet.
+			refreshed, refreshErr := validator.remote.currentKeys(true)
+			if refreshErr != nil {
+				return nil, refreshErr
+			}
+			return selectKey(refreshed, parsed)
+		}
+	}
+	return key, selectErr
+}
+
+func selectKey(keys []verificationKey, parsed *jwt.Token) (interface{}, error) {
+	keyID, _ := parsed.Header["kid"].(string)
+	algorithm := parsed.Method.Alg()
+	if keyID != "" {
+		for _, candidate := range keys {
+			if candidate.keyID != keyID {
+				continue
+			}
+			if candidate.algorithm != algorithm {
+				return nil, ErrUnknownKey
+			}
+			return candidate.material, nil
+		}
+	}
+	matches := make([]jwt.VerificationKey, 0, len(keys))
+	for _, candidate := range keys {
+		if candidate.algorithm != algorithm || (keyID != "" && candidate.keyID != "") {
+			continue
+		}
+		matches = append(matches, candidate.material)
+	}
+	switch len(matches) {
+	case 0:
+		return nil, ErrUnknownKey
+	case 1:
+		return matches[0], nil
+	default:
+		return jwt.VerificationKeySet{Keys: matches}, nil
+	}
+}
+
+func buildVerificationKeys(configuration Config) ([]verificationKey, error) {
+	sources := 0
+	for _, provided := range []bool{len(configuration.SigningKey) > 0, configuration.PublicKey != nil, len(configuration.KeySet.Keys) > 0, len(configuration.Keys) > 0, configuration.JWKSURL != ""} {
+		if provided {
+			sources++
+		}
+	}
+	switch {
+	case sources == 0:
+		return nil, ErrMissingSigningKey
+	case sources > 1:
+		return nil, ErrConflictingKeys
+	}
+
+	if len(configuration.SigningKey) > 0 {
+		return []verificationKey{{algorithm: jwt.SigningMethodHS256.Alg(), material: configuration.SigningKey}}, nil
+	}
+	if configuration.PublicKey != nil {
+		algorithm, algorithmErr := AlgorithmForPublicKey(configuration.PublicKey)
+		if algorithmErr != nil {
+			return nil, algorithmErr
+		}
+		return []verificationKey{{algorithm: algorithm, material: configuration.PublicKey}}, nil
+	}
+	if len(configuration.Keys) > 0 {
+		return buildKeyringKeys(configuration.Keys)
+	}
+	if configuration.JWKSURL != "" {
+		return nil, nil
+	}
+	return buildKeySetKeys(configuration.KeySet)
+}
+
+// buildKeySetKeys keeps the signature keys the validator can use. Issuers
+// publish keys for other algorithms (PS256, RS512, unknown key types) next to
+// the ones they sign sessions with, so unusable keys are skipped; the set
+// fails only when none remain, with the first reason a key was skipped.
+func buildKeySetKeys(keySet JSONWebKeySet) ([]verificationKey, error) {
+	keys := make([]verificationKey, 0, len(keySet.Keys))
+	var skippedErr error
+	for _, webKey := range keySet.Keys {
+		if webKey.Use != "" && webKey.Use != keyUseSignature {
+			continue
+		}
+		key, keyErr := buildWebKey(webKey)
+		if keyErr != nil {
+			if skippedErr == nil {
+				skippedErr = keyErr
+			}
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		if skippedErr != nil {
+			return nil, skippedErr
+		}
+		return nil, ErrMissingSigningKey
+	}
+	return keys, nil
+}
+
+func buildWebKey(webKey JSONWebKey) (verificationKey, error) {
+	publicKey, keyErr := webKey.PublicKey()
+	if keyErr != nil {
+		return verificationKey{}, keyErr
+	}
+	algorithm, algorithmErr := AlgorithmForPublicKey(publicKey)
+	if algorithmErr != nil {
+		return verificationKey{}, algorithmErr
+	}
+	if webKey.Algorithm != "" && webKey.Algorithm != algorithm {
+		return verificationKey{}, ErrUnsupportedKey
+	}
+	return verificationKey{keyID: webKey.KeyID, algorithm: algorithm, material: publicKey}, nil
+}
+
+func buildKeyringKeys(entries []VerificationKey) ([]verificationKey, error) {
+	keys := make([]verificationKey, 0, len(entries))
+	seenKeyIDs := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		if entry.KeyID != "" {
+			if _, duplicate := seenKeyIDs[entry.KeyID]; duplicate {
+				return nil, ErrConflictingKeys
+			}
+			seenKeyIDs[entry.KeyID] = struct{}{}
+		}
+		switch {
+		case len(entry.SigningKey) > 0 && entry.PublicKey != nil:
+			return nil, ErrConflictingKeys
+		case len(entry.SigningKey) > 0:
+			keys = append(keys, verificationKey{keyID: entry.KeyID, algorithm: jwt.SigningMethodHS256.Alg(), material: entry.SigningKey})
+		case entry.PublicKey != nil:
+			algorithm, algorithmErr := AlgorithmForPublicKey(entry.PublicKey)
+			if algorithmErr != nil {
+				return nil, algorithmErr
+			}
+			keys = append(keys, verificationKey{keyID: entry.KeyID, algorithm: algorithm, material: entry.PublicKey})
+		default:
+			return nil, ErrMissingSigningKey
+		}
+	}
+	return keys, nil
+}
+
+func collectAlgorithms(keys []verificationKey) []string {
+	algorithms := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !slices.Contains(algorithms, key.algorithm) {
+			algorithms = append(algorithms, key.algorithm)
+		}
+	}
+	return algorithms
+}
+
+// ValidateRequest reads the token from the configured sources and validates it.
+// Errors matching ErrNoCredentials mean no source carried a token; any other
+// error means a token was presented but rejected.
 func (validator *Validator) ValidateRequest(request *http.Request) (*Claims, error) {
 	if request == nil {
 		return nil, fmt.Errorf("session.validator.validate_request: %w", ErrMissingToken)
 	}
-	cookie, cookieErr := request.Cookie(validator.cookieName)
-	if cookieErr != nil || cookie == nil || strings.TrimSpace(cookie.Value) == "" {
-		return nil, fmt.Errorf("session.validator.validate_request: %w", ErrMissingCookie)
+	token, extractErr := extractRequestToken(request, validator.tokenSources)
+	if extractErr != nil {
+		return nil, fmt.Errorf("session.validator.validate_request: %w", extractErr)
 	}
-	return validator.ValidateToken(cookie.Value)
+	return validator.validateToken(request.Context(), token)
 }
 
 // GinMiddleware returns a Gin middleware that validates the session cookie and injects claims.
+// The claims are also stored in the request context for ClaimsFromContext.
 func (validator *Validator) GinMiddleware(contextKey string) gin.HandlerFunc {
 	if strings.TrimSpace(contextKey) == "" {
 		contextKey = DefaultContextKey
@@ -201,6 +534,7 @@ func (validator *Validator) GinMiddleware(contextKey string) gin.HandlerFunc {
 			return
 		}
 		contextGin.Set(contextKey, claims)
+		contextGin.Request = contextGin.Request.WithContext(ContextWithClaims(contextGin.Request.Context(), claims))
 		contextGin.Next()
 	}
 }
@@ -150,6 +150,55 @@ func TestValidateTokenRejectsInvalidCases(t *testing.T) {
 	}
 }
 
+func TestValidateTokenAudience(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0).UTC()
+	mintWithAudience := func(audience ...string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+			UserID: "user-123",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "issuer",
+				Subject:   "user-123",
+				Audience:  audience,
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			},
+		})
+		signed, err := token.SignedString([]byte("secret-key"))
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return signed
+	}
+
+	scoped, err := New(Config{SigningKey: []byte("secret-key"), Issuer: "issuer", Audience: "billing", Clock: fixedClock{current: now}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	unscoped, err := New(Config{SigningKey: []byte("secret-key"), Issuer: "issuer", Clock: fixedClock{current: now}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	claims, validateErr := scoped.ValidateToken(mintWithAudience("reports", "billing"))
+	if validateErr != nil {
+		t.Fatalf("expected matching audience to validate, got %v", validateErr)
+	}
+	if len(claims.Audience) != 2 {
+		t.Fatalf("expected both audiences to be exposed, got %v", claims.Audience)
+	}
+	if _, validateErr := scoped.ValidateToken(mintWithAudience("reports")); !errors.Is(validateErr, ErrInvalidAudience) {
+		t.Fatalf("expected foreign audience to be rejected, got %v", validateErr)
+	}
+	if _, validateErr := scoped.ValidateToken(mintWithAudience()); !errors.Is(validateErr, ErrInvalidAudience) {
+		t.Fatalf("expected missing audience to be rejected, got %v", validateErr)
+	}
+	if _, validateErr := unscoped.ValidateToken(mintWithAudience("reports")); validateErr != nil {
+		t.Fatalf("expected validator without audience to ignore aud, got %v", validateErr)
+	}
+}
+
 func TestValidateRequest(t *testing.T) {
 	now := time.Unix(1700000000, 0).UTC()
 	tokenValue := mintToken(t, []byte("secret-key"), "issuer", now, time.Minute)
@@ -204,6 +253,9 @@ func TestGinMiddleware(t *testing.T) {
 		if _, ok := value.(*Claims); !ok {
 			t.Fatalf("unexpected claims type: %T", value)
 		}
+		if _, ok := ClaimsFromContext(contextGin.Request.Context()); !ok {
+			t.Fatalf("claims missing from request context")
+		}
 		contextGin.Status(http.StatusOK)
 	})
 